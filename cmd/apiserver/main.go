@@ -1,9 +1,14 @@
 package main
 
 import (
+	"flag"
 	"minik8s.com/minik8s/pkg/apiserver"
 )
 
 func main() {
-	apiserver.Run()
+	var opts apiserver.Options
+	opts.AddFlags(flag.CommandLine)
+	flag.Parse()
+
+	apiserver.Run(opts)
 }
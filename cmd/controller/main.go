@@ -1,19 +1,27 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"k8s.io/klog"
 	"minik8s.com/minik8s/pkg/apiclient"
 	"minik8s.com/minik8s/pkg/controller/component"
 	"minik8s.com/minik8s/pkg/controller/endpoint"
+	"minik8s.com/minik8s/pkg/controller/garbagecollector"
 	"minik8s.com/minik8s/pkg/controller/job"
+	"minik8s.com/minik8s/pkg/controller/leaderelection"
 	"minik8s.com/minik8s/pkg/controller/podautoscaling"
 	rs "minik8s.com/minik8s/pkg/controller/replicaset"
 	"minik8s.com/minik8s/utils/random"
+	"sync"
 	"time"
 )
 
 func main() {
 	random.Init()
+	election := leaderelection.Config{Name: "kube-controller-manager"}
+	leaderElect := leaderelection.AddFlags(flag.CommandLine, &election)
+	flag.Parse()
 
 	for !apiclient.DetectAPIServer() {
 		klog.Info("wait apiserver to start")
@@ -44,24 +52,44 @@ func main() {
 	jobStopChan := make(chan bool)
 	go jobInformer.Run(jobStopChan)
 
+	// the blobs are only watched by the garbage collector, e.g. the files of the GPUJobs
+	blobInformer := component.NewInformer("Blob")
+	blobStopChan := make(chan bool)
+	go blobInformer.Run(blobStopChan)
+
 	for !(podInformer.HasSynced() && rsInformer.HasSynced() && serviceInformer.HasSynced() &&
-		endpointInformer.HasSynced() && hpInformer.HasSynced() && jobInformer.HasSynced()) {
+		endpointInformer.HasSynced() && hpInformer.HasSynced() && jobInformer.HasSynced() &&
+		blobInformer.HasSynced()) {
 
 	}
 
-	rsController := rs.NewReplicaSetController(podInformer, rsInformer)
-	go rsController.Run()
-
-	endpointController := endpoint.NewEndpointController(podInformer, serviceInformer, endpointInformer)
-	go endpointController.Run()
-
-	hpaController := podautoscaling.NewHorizontalController(hpInformer, podInformer, rsInformer)
-	go hpaController.Run()
-
-	jobController := job.NewJobController(podInformer, jobInformer)
-	go jobController.Run()
-
-	for {
-		time.Sleep(time.Second * 100)
+	// the informers of the standbys keep in sync, so that they take over without listing.
+	// The controllers stop when ctx is done, startControllers returns once they all have.
+	startControllers := func(ctx context.Context) {
+		var wg sync.WaitGroup
+		run := func(controller interface{ Run(context.Context) }) {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				controller.Run(ctx)
+			}()
+		}
+		run(rs.NewReplicaSetController(podInformer, rsInformer))
+		run(endpoint.NewEndpointController(podInformer, serviceInformer, endpointInformer))
+		run(podautoscaling.NewHorizontalController(hpInformer, podInformer, rsInformer))
+		run(job.NewJobController(podInformer, jobInformer))
+		run(garbagecollector.NewGarbageCollector(podInformer, rsInformer, serviceInformer,
+			endpointInformer, hpInformer, jobInformer, blobInformer))
+		wg.Wait()
+	}
+	if *leaderElect {
+		election.OnStartedLeading = startControllers
+		// the controllers have stopped writing by now, a standby takes over
+		election.OnStoppedLeading = func() { klog.Exitf("leader election lost") }
+		if err := leaderelection.Run(context.Background(), election); err != nil {
+			klog.Fatalf("leader election error: %v", err)
+		}
+		return
 	}
+	startControllers(context.Background())
 }
@@ -1,8 +1,30 @@
 package main
 
-import "minik8s.com/minik8s/pkg/scheduler"
+import (
+	"context"
+	"flag"
+	"k8s.io/klog/v2"
+	"minik8s.com/minik8s/pkg/controller/leaderelection"
+	"minik8s.com/minik8s/pkg/scheduler"
+	"minik8s.com/minik8s/utils/random"
+)
 
 func main() {
+	random.Init()
+	election := leaderelection.Config{Name: "kube-scheduler"}
+	leaderElect := leaderelection.AddFlags(flag.CommandLine, &election)
+	flag.Parse()
+
 	scheduler.Init()
-	scheduler.Run()
+	if !*leaderElect {
+		scheduler.Run(context.Background())
+		return
+	}
+	// the standbys wait here, a leader that fails to renew stops binding, waits for the
+	// bindings in flight and exits, leaving the pods to them
+	election.OnStartedLeading = scheduler.Run
+	election.OnStoppedLeading = func() { klog.Exitf("leader election lost") }
+	if err := leaderelection.Run(context.Background(), election); err != nil {
+		klog.Fatalf("leader election error: %v", err)
+	}
 }
@@ -19,6 +19,15 @@ const (
 	AS_OP_ERROR_String  = "ERROR"
 )
 
+// media types of the watch streams, chosen by the Accept header of a watch request.
+// A watch is streamed as newline-delimited json unless the client asks for server-sent
+// events or the legacy stream of json objects each followed by the 0x1A byte.
+const (
+	AS_WatchJSONLines_Type   = "application/x-ndjson"
+	AS_WatchEventStream_Type = "text/event-stream"
+	AS_WatchLegacy_Type      = "application/vnd.minik8s.watch-0x1a"
+)
+
 const (
 	AC_ServerAddr = "http://10.119.11.209"
 	AC_ServerPort = 8080
@@ -61,6 +70,8 @@ const (
 	AC_RestFunction_Path  = "/function"
 	AC_RestActChain_Path  = "/actionchain"
 	AC_RestTrigger_Path  = "/trigger"
+	AC_RestNamespaces_Path = "/namespaces"
+	AC_RestNamespace_Path  = "/namespace"
 
 	AC_Root_Path = "/"
 )
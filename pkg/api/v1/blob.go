@@ -0,0 +1,48 @@
+package v1
+
+import "time"
+
+// Blob is a file kept by the api server, e.g. an input of a GPUJob. The object is created
+// with the checksum and the size of the file, then the file is uploaded to its data
+// subresource, which only accepts the content matching them. The content is stored by
+// its checksum, so the blobs of the same content share it.
+type Blob struct {
+	TypeMeta
+
+	ObjectMeta `json:"metadata,omitempty"`
+
+	Spec BlobSpec `json:"spec,omitempty"`
+
+	Status BlobStatus `json:"status,omitempty"`
+}
+
+type BlobSpec struct {
+	// Filename is the name the file is downloaded as, it may not contain a "/"
+	Filename string `json:"filename,omitempty"`
+
+	// SHA256 is the hex encoded sha256 checksum of the content
+	SHA256 string `json:"sha256"`
+
+	// Size is the size of the content in bytes
+	Size int64 `json:"size"`
+
+	// ContentType is the media type the content is served as, application/octet-stream
+	// if empty
+	ContentType string `json:"contentType,omitempty"`
+}
+
+type BlobPhase string
+
+const (
+	// BlobPending blobs are waiting for their content to be uploaded
+	BlobPending BlobPhase = "Pending"
+	// BlobReady blobs have their content stored
+	BlobReady BlobPhase = "Ready"
+)
+
+type BlobStatus struct {
+	Phase BlobPhase `json:"phase,omitempty"`
+
+	// UploadTime is when the content was stored
+	UploadTime *time.Time `json:"uploadTime,omitempty"`
+}
@@ -0,0 +1,72 @@
+package v1
+
+// the scopes of a custom resource
+const (
+	NamespaceScoped ResourceScope = "Namespaced"
+	ClusterScoped   ResourceScope = "Cluster"
+)
+
+type ResourceScope string
+
+// CustomResourceDefinition defines a kind at runtime. Its name must be <plural>.<group>,
+// and the objects of the kind are served at /apis/<group>/<version>/<plural>, or at
+// /apis/<group>/<version>/namespaces/<namespace>/<plural> if they are namespaced.
+type CustomResourceDefinition struct {
+	TypeMeta   `json:",inline"`
+	ObjectMeta `json:"metadata,omitempty"`
+	Spec       CustomResourceDefinitionSpec `json:"spec,omitempty"`
+}
+
+type CustomResourceDefinitionSpec struct {
+	// Group is a dns name, e.g. example.com
+	Group string                        `json:"group"`
+	Names CustomResourceDefinitionNames `json:"names"`
+	// Scope is Namespaced or Cluster, it cannot be changed
+	Scope ResourceScope `json:"scope"`
+	// Versions are those served, the objects are stored the same whatever the version
+	Versions []CustomResourceDefinitionVersion `json:"versions"`
+}
+
+type CustomResourceDefinitionNames struct {
+	// Kind is the kind of the objects, e.g. Experiment
+	Kind string `json:"kind"`
+	// Plural is the lower case name in the urls, e.g. experiments
+	Plural string `json:"plural"`
+	// Singular is the lower case name of an object, the lower case kind by default
+	Singular string `json:"singular,omitempty"`
+	// ShortNames are the abbreviations accepted by kubectl, e.g. exp
+	ShortNames []string `json:"shortNames,omitempty"`
+}
+
+type CustomResourceDefinitionVersion struct {
+	Name string `json:"name"`
+	// Served versions are served by the api server, the others are not
+	Served bool `json:"served"`
+	// Schema validates the objects created or updated through this version, nothing is
+	// validated without it
+	Schema *CustomResourceValidation `json:"schema,omitempty"`
+}
+
+type CustomResourceValidation struct {
+	OpenAPIV3Schema *JSONSchemaProps `json:"openAPIV3Schema,omitempty"`
+}
+
+// JSONSchemaProps is the subset of the json schema the api server validates with. The
+// metadata, kind and apiversion of the objects are not validated by it.
+type JSONSchemaProps struct {
+	Description string `json:"description,omitempty"`
+	// Type is one of object, array, string, integer, number and boolean, anything is
+	// accepted if it is empty
+	Type       string                     `json:"type,omitempty"`
+	Properties map[string]JSONSchemaProps `json:"properties,omitempty"`
+	Required   []string                   `json:"required,omitempty"`
+	Items      *JSONSchemaProps           `json:"items,omitempty"`
+	Enum       []any                      `json:"enum,omitempty"`
+	Minimum    *float64                   `json:"minimum,omitempty"`
+	Maximum    *float64                   `json:"maximum,omitempty"`
+	MinLength  *int64                     `json:"minLength,omitempty"`
+	MaxLength  *int64                     `json:"maxLength,omitempty"`
+	MinItems   *int64                     `json:"minItems,omitempty"`
+	MaxItems   *int64                     `json:"maxItems,omitempty"`
+	Pattern    string                     `json:"pattern,omitempty"`
+}
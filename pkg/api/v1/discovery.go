@@ -0,0 +1,25 @@
+package v1
+
+// APIResourceList is served at /apis, it lists every resource the api server serves, the
+// custom resources included
+type APIResourceList struct {
+	TypeMeta  `json:",inline"`
+	Resources []APIResource `json:"resources"`
+}
+
+// APIResource tells how a resource is served. The built-in resources have no group, their
+// objects are at /<singularName>/<object> or /namespaces/<namespace>/<name>/<object> and
+// are listed at /<name>. The objects of a group are at
+// /apis/<group>/<version>/[namespaces/<namespace>/]<name>/<object>.
+type APIResource struct {
+	// Name is the plural of the resource, e.g. pods, or <plural>/<subresource>, e.g. pods/status
+	Name         string   `json:"name"`
+	SingularName string   `json:"singularName,omitempty"`
+	Kind         string   `json:"kind"`
+	Group        string   `json:"group,omitempty"`
+	Version      string   `json:"version"`
+	Namespaced   bool     `json:"namespaced"`
+	Verbs        []string `json:"verbs"`
+	// ShortNames are the abbreviations of the resource accepted by kubectl, e.g. po
+	ShortNames []string `json:"shortNames,omitempty"`
+}
@@ -0,0 +1,61 @@
+package v1
+
+import "time"
+
+// the types of the events
+const (
+	// EventTypeNormal is an event of things going as expected
+	EventTypeNormal = "Normal"
+	// EventTypeWarning is an event of something going wrong
+	EventTypeWarning = "Warning"
+)
+
+// Event is a report of something happened to an object, e.g. a pod failing to pull its
+// image. Repeated occurrences of the same event are counted in one Event.
+type Event struct {
+	TypeMeta
+
+	ObjectMeta `json:"metadata,omitempty"`
+
+	// InvolvedObject is the object the event is about
+	InvolvedObject ObjectReference `json:"involvedObject"`
+
+	// Reason is a short CamelCase word of why the event happened, e.g. FailedScheduling
+	Reason string `json:"reason,omitempty"`
+
+	// Message is a human readable description of the event
+	Message string `json:"message,omitempty"`
+
+	// Type is Normal or Warning
+	Type string `json:"type,omitempty"`
+
+	// Count is how many times the event has happened
+	Count int32 `json:"count,omitempty"`
+
+	FirstTimestamp time.Time `json:"firstTimestamp,omitempty"`
+	LastTimestamp  time.Time `json:"lastTimestamp,omitempty"`
+
+	// Source is the component reporting the event
+	Source EventSource `json:"source,omitempty"`
+}
+
+// ObjectReference refers to an object of any kind
+type ObjectReference struct {
+	Kind       string `json:"kind,omitempty"`
+	APIVersion string `json:"apiversion,omitempty"`
+	Namespace  string `json:"namespace,omitempty"`
+	Name       string `json:"name,omitempty"`
+	UID        string `json:"uid,omitempty"`
+}
+
+type EventSource struct {
+	// Component is the reporter, e.g. scheduler or kubelet
+	Component string `json:"component,omitempty"`
+	// Host is the node of the reporter, if it runs on one
+	Host string `json:"host,omitempty"`
+}
+
+// ReferenceTo refers to the object of the kind
+func ReferenceTo(kind string, meta *ObjectMeta) ObjectReference {
+	return ObjectReference{Kind: kind, Namespace: meta.Namespace, Name: meta.Name, UID: meta.UID}
+}
@@ -9,6 +9,9 @@ type GPUJob struct {
 
 	Script string `json:"script,omitempty"`
 
+	// ScriptBlob is the Blob holding the script, it is uploaded before the job is created
+	ScriptBlob string `json:"scriptBlob,omitempty"`
+
 	JobNum string `json:"jobnum,omitempty"`
 
 	Output string `json:"output,omitempty"`
@@ -16,6 +19,10 @@ type GPUJob struct {
 	Error string `json:"error,omitempty"`
 }
 
+// UploadFile is an input of the job, uploaded as a Blob owned by the job
 type UploadFile struct {
 	Filename string `json:"filename,omitempty"`
+
+	// Blob is the Blob holding the file
+	Blob string `json:"blob,omitempty"`
 }
@@ -0,0 +1,30 @@
+package v1
+
+import "time"
+
+// Lease is a lock held by one of the replicas of a component, e.g. the scheduler. The
+// holder renews it before it expires, and the others take it over once it has.
+type Lease struct {
+	TypeMeta
+
+	ObjectMeta `json:"metadata,omitempty"`
+
+	Spec LeaseSpec `json:"spec,omitempty"`
+}
+
+type LeaseSpec struct {
+	// HolderIdentity is the identity of the holder, empty if the lease is released
+	HolderIdentity string `json:"holderIdentity,omitempty"`
+
+	// LeaseDurationSeconds is how long the lease lasts after it is renewed
+	LeaseDurationSeconds int32 `json:"leaseDurationSeconds,omitempty"`
+
+	// AcquireTime is when the current holder acquired the lease
+	AcquireTime *time.Time `json:"acquireTime,omitempty"`
+
+	// RenewTime is when the current holder last renewed the lease
+	RenewTime *time.Time `json:"renewTime,omitempty"`
+
+	// LeaseTransitions counts how many times the lease has changed hands
+	LeaseTransitions int32 `json:"leaseTransitions,omitempty"`
+}
@@ -0,0 +1,105 @@
+package v1
+
+import "time"
+
+// the operations a ManagedFieldsEntry records
+const (
+	// ManagedFieldsOperationApply is a server-side apply, the fields are those of the
+	// last configuration applied by the manager
+	ManagedFieldsOperationApply = "Apply"
+	// ManagedFieldsOperationUpdate is any other write, the fields are those it changed
+	ManagedFieldsOperationUpdate = "Update"
+)
+
+// ManagedFieldsEntry is the set of fields a manager owns through one operation
+type ManagedFieldsEntry struct {
+	// Manager is the ?fieldManager= of the requests, or the user sending them
+	Manager string `json:"manager"`
+
+	// Operation is Apply or Update
+	Operation string `json:"operation"`
+
+	// Time is when the manager last changed the fields
+	Time *time.Time `json:"time,omitempty"`
+
+	FieldsV1 FieldSet `json:"fieldsV1,omitempty"`
+}
+
+// FieldSet is a tree of json field names, e.g. {"spec":{"replicas":{}}} holds
+// spec.replicas. The fields without children are the leaves, a list is a leaf as a whole.
+type FieldSet map[string]FieldSet
+
+// Insert adds the field at the path
+func (s FieldSet) Insert(path []string) {
+	for _, name := range path {
+		child, exist := s[name]
+		if !exist {
+			child = FieldSet{}
+			s[name] = child
+		}
+		s = child
+	}
+}
+
+// Has tells whether the field at the path is a leaf of the set
+func (s FieldSet) Has(path []string) bool {
+	for _, name := range path {
+		child, exist := s[name]
+		if !exist {
+			return false
+		}
+		s = child
+	}
+	return len(s) == 0
+}
+
+// Overlaps tells whether the set holds the field at the path, a field under it or a
+// field holding it
+func (s FieldSet) Overlaps(path []string) bool {
+	for _, name := range path {
+		child, exist := s[name]
+		if !exist {
+			return false
+		}
+		if len(child) == 0 {
+			return true
+		}
+		s = child
+	}
+	return true
+}
+
+// Remove removes the fields overlapping the path, the fields left without children
+// are removed as well
+func (s FieldSet) Remove(path []string) {
+	if len(path) == 0 {
+		return
+	}
+	child, exist := s[path[0]]
+	if !exist {
+		return
+	}
+	if len(child) != 0 && len(path) > 1 {
+		child.Remove(path[1:])
+		if len(child) != 0 {
+			return
+		}
+	}
+	delete(s, path[0])
+}
+
+// Leaves calls fn with the path of every leaf
+func (s FieldSet) Leaves(fn func(path []string)) {
+	s.leaves(nil, fn)
+}
+
+func (s FieldSet) leaves(prefix []string, fn func(path []string)) {
+	for name, child := range s {
+		path := append(append([]string{}, prefix...), name)
+		if len(child) == 0 {
+			fn(path)
+		} else {
+			child.leaves(path, fn)
+		}
+	}
+}
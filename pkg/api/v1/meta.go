@@ -1,5 +1,7 @@
 package v1
 
+import "time"
+
 type TypeMeta struct {
 	// Kind is a string value representing the REST resource this object represents.
 	// Servers may infer this from the endpoint the client submits requests to.
@@ -21,6 +23,11 @@ type ObjectMeta struct {
 	// definition.
 	Name string `json:"name,omitempty"`
 
+	// GenerateName is a prefix used by the server to generate a unique name, only if the
+	// Name field has not been provided. The server appends a random suffix to it, the
+	// request fails with a conflict if the generated name happens to exist.
+	GenerateName string `json:"generateName,omitempty"`
+
 	// Namespace defines the space within which each name must be unique. An empty namespace is
 	// equivalent to the "default" namespace, but "default" is the canonical representation.
 	// Not all objects are required to be scoped to a namespace - the value of this field for
@@ -33,9 +40,36 @@ type ObjectMeta struct {
 	// Read Only
 	UID string `json:"uid,omitempty"`
 
+	// ResourceVersion is the etcd revision at which the object was last modified. It is
+	// filled by the server on reads, and an update carrying it fails with a conflict if the
+	// object has been modified since. Leave it empty for an unconditional update.
+	// Read Only
+	ResourceVersion string `json:"resourceVersion,omitempty"`
+
+	// DeletionTimestamp is the time the object was asked to be deleted at. An object with
+	// finalizers is only marked by a DELETE request, and it is removed once all of them
+	// have been cleared. No finalizer can be added to an object marked for deletion.
+	// Read Only
+	DeletionTimestamp *time.Time `json:"deletionTimestamp,omitempty"`
+
+	// DeletionGracePeriodSeconds is how long the object is given to terminate gracefully,
+	// e.g. how long the kubelet waits for the containers of a pod to stop before killing
+	// them. It is set along with DeletionTimestamp, and can only be shortened afterwards.
+	// Read Only
+	DeletionGracePeriodSeconds *int64 `json:"deletionGracePeriodSeconds,omitempty"`
+
+	// Finalizers name the components which must clean up after the object before it is
+	// removed, each of them removes its own finalizer once done.
+	Finalizers []string `json:"finalizers,omitempty"`
+
 	Labels map[string]string `json:"labels,omitempty"`
 
 	OwnerReferences []OwnerReference `json:"ownerReferences,omitempty"`
+
+	// ManagedFields record which manager set which fields. Server-side apply reports a
+	// conflict when a manager applies a value to a field owned by another one.
+	// Read Only
+	ManagedFields []ManagedFieldsEntry `json:"managedFields,omitempty"`
 }
 
 type OwnerReference struct {
@@ -43,4 +77,71 @@ type OwnerReference struct {
 	Kind       string `json:"kind"`
 	Name       string `json:"name"`
 	UID        string `json:"uid"`
+
+	// Controller marks the owner that manages the object, e.g. the ReplicaSet of a pod.
+	// The garbage collector deletes an object once none of its owners exist, whether
+	// they are controllers or not. A foreground deletion of the controller waits for
+	// the object to be gone.
+	Controller bool `json:"controller,omitempty"`
+}
+
+// DeletionPropagation tells what happens to the dependents of a deleted object, it is
+// passed as ?propagationPolicy= on DELETE requests
+type DeletionPropagation string
+
+const (
+	// DeletePropagationOrphan keeps the dependents and removes their references to the owner
+	DeletePropagationOrphan DeletionPropagation = "Orphan"
+	// DeletePropagationBackground deletes the owner at once, and the garbage collector
+	// deletes the dependents afterwards. It is the default.
+	DeletePropagationBackground DeletionPropagation = "Background"
+	// DeletePropagationForeground marks the owner with the foregroundDeletion finalizer, the
+	// garbage collector deletes the dependents it controls and then the owner
+	DeletePropagationForeground DeletionPropagation = "Foreground"
+)
+
+// FinalizerForegroundDeletion is held by an owner deleted in the foreground until the
+// dependents it controls are gone
+const FinalizerForegroundDeletion = "foregroundDeletion"
+
+// Object is implemented by every persisted resource through its embedded ObjectMeta,
+// so the api server can handle all kinds generically.
+type Object interface {
+	GetObjectMeta() *ObjectMeta
+}
+
+func (meta *ObjectMeta) GetObjectMeta() *ObjectMeta {
+	return meta
+}
+
+// FinalizerContents is held by a namespace or a CustomResourceDefinition being deleted
+// until the objects it contains are gone
+const FinalizerContents = "minik8s.com/contents"
+
+// HasFinalizer tells whether the object carries the finalizer
+func (meta *ObjectMeta) HasFinalizer(finalizer string) bool {
+	for _, f := range meta.Finalizers {
+		if f == finalizer {
+			return true
+		}
+	}
+	return false
+}
+
+// AddFinalizer adds the finalizer if the object does not carry it yet
+func (meta *ObjectMeta) AddFinalizer(finalizer string) {
+	if !meta.HasFinalizer(finalizer) {
+		meta.Finalizers = append(meta.Finalizers, finalizer)
+	}
+}
+
+// RemoveFinalizer removes the finalizer, it returns false if the object does not carry it
+func (meta *ObjectMeta) RemoveFinalizer(finalizer string) bool {
+	for i, f := range meta.Finalizers {
+		if f == finalizer {
+			meta.Finalizers = append(meta.Finalizers[:i], meta.Finalizers[i+1:]...)
+			return true
+		}
+	}
+	return false
 }
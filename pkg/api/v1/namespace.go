@@ -0,0 +1,37 @@
+package v1
+
+const (
+	// NamespaceDefault is the namespace of objects created without one
+	NamespaceDefault = "default"
+
+	NamespaceActive = "Active"
+	// NamespaceTerminating is the phase of a namespace being deleted, no object can be
+	// created in it while the objects it has are deleted
+	NamespaceTerminating = "Terminating"
+)
+
+// Namespace provides a scope for names. Objects in different namespaces never select,
+// own or target each other, and deleting a namespace deletes everything in it.
+type Namespace struct {
+	TypeMeta   `json:",inline"`
+	ObjectMeta `json:"metadata,omitempty"`
+	Status     NamespaceStatus `json:"status,omitempty"`
+}
+
+type NamespaceStatus struct {
+	// Phase is Active, or Terminating once the namespace is deleted until its objects are gone
+	Phase string `json:"phase,omitempty"`
+}
+
+// NamespaceOf returns the namespace of meta, an empty namespace is the default one
+func NamespaceOf(meta *ObjectMeta) string {
+	if meta.Namespace == "" {
+		return NamespaceDefault
+	}
+	return meta.Namespace
+}
+
+// SameNamespace tells whether the two objects are in the same namespace
+func SameNamespace(a *ObjectMeta, b *ObjectMeta) bool {
+	return NamespaceOf(a) == NamespaceOf(b)
+}
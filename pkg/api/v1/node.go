@@ -1,5 +1,9 @@
 package v1
 
+// LabelHostname labels a node with the name of the kubelet that registered it, which
+// authenticates as system:node:<name>
+const LabelHostname = "minik8s.com/hostname"
+
 type Node struct {
 	TypeMeta
 
@@ -28,6 +28,14 @@ const (
 	PodUnknown PodPhase = "Unknown"
 )
 
+// FinalizerKubelet is held by a pod bound to a node until the kubelet has stopped its
+// containers, so the pod is not removed while they may still be running
+const FinalizerKubelet = "minik8s.com/kubelet"
+
+// DefaultTerminationGracePeriodSeconds is how long the containers of a deleted pod are
+// given to stop, unless the DELETE request asks for another grace period
+const DefaultTerminationGracePeriodSeconds int64 = 30
+
 type Pod struct {
 	TypeMeta
 
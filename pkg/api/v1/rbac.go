@@ -0,0 +1,81 @@
+package v1
+
+// the verbs of the requests to resources
+const (
+	VerbGet    = "get"
+	VerbList   = "list"
+	VerbWatch  = "watch"
+	VerbCreate = "create"
+	VerbUpdate = "update"
+	VerbPatch  = "patch"
+	VerbDelete = "delete"
+
+	// VerbAll and ResourceAll match any verb and any resource in a PolicyRule
+	VerbAll     = "*"
+	ResourceAll = "*"
+)
+
+// the kinds of the subjects of a binding
+const (
+	UserKind  = "User"
+	GroupKind = "Group"
+)
+
+// PolicyRule allows the verbs on the resources, or on the non-resource urls
+type PolicyRule struct {
+	Verbs []string `json:"verbs"`
+
+	// Resources are the plurals of the kinds, e.g. pods, followed by the subresource for
+	// the subresources, e.g. pods/status
+	Resources []string `json:"resources,omitempty"`
+
+	// ResourceNames limits the rule to these objects, an empty list means all of them
+	ResourceNames []string `json:"resourceNames,omitempty"`
+
+	// NonResourceURLs are the paths not served by a resource, e.g. /innode/*. A trailing
+	// * matches any suffix. They are only allowed by a ClusterRole bound by a ClusterRoleBinding.
+	NonResourceURLs []string `json:"nonResourceURLs,omitempty"`
+}
+
+// Role is a set of rules in a namespace
+type Role struct {
+	TypeMeta   `json:",inline"`
+	ObjectMeta `json:"metadata,omitempty"`
+	Rules      []PolicyRule `json:"rules"`
+}
+
+// ClusterRole is a set of rules in the whole cluster, or in the namespace of a RoleBinding
+type ClusterRole struct {
+	TypeMeta   `json:",inline"`
+	ObjectMeta `json:"metadata,omitempty"`
+	Rules      []PolicyRule `json:"rules"`
+}
+
+// Subject is a user or a group a role is bound to
+type Subject struct {
+	// Kind is User or Group
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+}
+
+// RoleRef is the role bound, a Role in the namespace of the binding or a ClusterRole
+type RoleRef struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+}
+
+// RoleBinding grants the rules of a role to the subjects in the namespace of the binding
+type RoleBinding struct {
+	TypeMeta   `json:",inline"`
+	ObjectMeta `json:"metadata,omitempty"`
+	Subjects   []Subject `json:"subjects"`
+	RoleRef    RoleRef   `json:"roleRef"`
+}
+
+// ClusterRoleBinding grants the rules of a ClusterRole to the subjects in the whole cluster
+type ClusterRoleBinding struct {
+	TypeMeta   `json:",inline"`
+	ObjectMeta `json:"metadata,omitempty"`
+	Subjects   []Subject `json:"subjects"`
+	RoleRef    RoleRef   `json:"roleRef"`
+}
@@ -0,0 +1,134 @@
+package v1
+
+import (
+	"errors"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type SelectorOperator string
+
+const (
+	SelectorEquals    SelectorOperator = "="
+	SelectorNotEquals SelectorOperator = "!="
+	SelectorExists    SelectorOperator = "exists"
+	SelectorNotExists SelectorOperator = "!"
+)
+
+// Requirement is a single term of a selector, e.g. app=web, tier!=db, app or !app
+type Requirement struct {
+	Key      string
+	Operator SelectorOperator
+	Value    string
+}
+
+// Selector is the conjunction of its requirements, the empty selector matches everything.
+// Label selectors and field selectors share the syntax, e.g. "app=web,tier!=db" or
+// "spec.nodeName=N1001,status.phase=Running".
+type Selector []Requirement
+
+// selectorKeyRegexp is the syntax of the keys, a label key with an optional prefix,
+// e.g. app or example.com/app, or a field path, e.g. spec.nodeName
+var selectorKeyRegexp = regexp.MustCompile(`^([a-z0-9]([-a-z0-9.]*[a-z0-9])?/)?[A-Za-z0-9]([-A-Za-z0-9_.]*[A-Za-z0-9])?$`)
+
+// ParseSelector parses a comma separated list of key=value, key==value, key!=value,
+// key and !key requirements. The set-based requirements, e.g. "app in (web,db)", are
+// not supported and rejected.
+func ParseSelector(s string) (Selector, error) {
+	if strings.ContainsAny(s, "()") {
+		return nil, errors.New("set-based requirements (in, notin) are not supported: " + s)
+	}
+	var selector Selector
+	for _, term := range strings.Split(s, ",") {
+		term = strings.TrimSpace(term)
+		if term == "" {
+			continue
+		}
+		var req Requirement
+		if i := strings.Index(term, "!="); i >= 0 {
+			req = Requirement{Key: term[:i], Operator: SelectorNotEquals, Value: term[i+2:]}
+		} else if i = strings.Index(term, "=="); i >= 0 {
+			req = Requirement{Key: term[:i], Operator: SelectorEquals, Value: term[i+2:]}
+		} else if i = strings.Index(term, "="); i >= 0 {
+			req = Requirement{Key: term[:i], Operator: SelectorEquals, Value: term[i+1:]}
+		} else if strings.HasPrefix(term, "!") {
+			req = Requirement{Key: term[1:], Operator: SelectorNotExists}
+		} else {
+			req = Requirement{Key: term, Operator: SelectorExists}
+		}
+		req.Key = strings.TrimSpace(req.Key)
+		req.Value = strings.TrimSpace(req.Value)
+		if !selectorKeyRegexp.MatchString(req.Key) {
+			return nil, errors.New("invalid key " + strconv.Quote(req.Key) + " in selector term " + term)
+		}
+		if strings.ContainsAny(req.Value, "=!<> \t") {
+			return nil, errors.New("invalid value " + strconv.Quote(req.Value) + " in selector term " + term)
+		}
+		selector = append(selector, req)
+	}
+	return selector, nil
+}
+
+// Matches tells whether the values returned by get satisfy every requirement, get
+// returns false if the key is absent
+func (selector Selector) Matches(get func(key string) (string, bool)) bool {
+	for _, req := range selector {
+		value, exist := get(req.Key)
+		switch req.Operator {
+		case SelectorEquals:
+			if !exist || value != req.Value {
+				return false
+			}
+		case SelectorNotEquals:
+			if exist && value == req.Value {
+				return false
+			}
+		case SelectorExists:
+			if !exist {
+				return false
+			}
+		case SelectorNotExists:
+			if exist {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// MatchesLabels is Matches on a set of labels
+func (selector Selector) MatchesLabels(labels map[string]string) bool {
+	return selector.Matches(func(key string) (string, bool) {
+		value, exist := labels[key]
+		return value, exist
+	})
+}
+
+func (selector Selector) String() string {
+	terms := make([]string, 0, len(selector))
+	for _, req := range selector {
+		switch req.Operator {
+		case SelectorExists:
+			terms = append(terms, req.Key)
+		case SelectorNotExists:
+			terms = append(terms, "!"+req.Key)
+		default:
+			terms = append(terms, req.Key+string(req.Operator)+req.Value)
+		}
+	}
+	return strings.Join(terms, ",")
+}
+
+// SelectorFromLabels returns the selector matching the objects that carry all the labels
+func SelectorFromLabels(labels map[string]string) Selector {
+	selector := make(Selector, 0, len(labels))
+	for key, value := range labels {
+		selector = append(selector, Requirement{Key: key, Operator: SelectorEquals, Value: value})
+	}
+	sort.Slice(selector, func(i, j int) bool {
+		return selector[i].Key < selector[j].Key
+	})
+	return selector
+}
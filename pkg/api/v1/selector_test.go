@@ -0,0 +1,97 @@
+package v1
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSelector(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Selector
+		wantErr bool
+	}{
+		{in: "", want: nil},
+		{in: "app=web", want: Selector{{Key: "app", Operator: SelectorEquals, Value: "web"}}},
+		{in: "app==web", want: Selector{{Key: "app", Operator: SelectorEquals, Value: "web"}}},
+		{in: " app = web , tier!=db ", want: Selector{
+			{Key: "app", Operator: SelectorEquals, Value: "web"},
+			{Key: "tier", Operator: SelectorNotEquals, Value: "db"},
+		}},
+		{in: "app,!canary", want: Selector{
+			{Key: "app", Operator: SelectorExists},
+			{Key: "canary", Operator: SelectorNotExists},
+		}},
+		{in: "example.com/app=web", want: Selector{{Key: "example.com/app", Operator: SelectorEquals, Value: "web"}}},
+		{in: "spec.nodeName=N1001,status.phase=Running", want: Selector{
+			{Key: "spec.nodeName", Operator: SelectorEquals, Value: "N1001"},
+			{Key: "status.phase", Operator: SelectorEquals, Value: "Running"},
+		}},
+		{in: "app=", want: Selector{{Key: "app", Operator: SelectorEquals, Value: ""}}},
+
+		{in: "app in (web,db)", wantErr: true},
+		{in: "app notin (web)", wantErr: true},
+		{in: "app>1", wantErr: true},
+		{in: "my app=web", wantErr: true},
+		{in: "=web", wantErr: true},
+		{in: "!", wantErr: true},
+		{in: "app=w=b", wantErr: true},
+		{in: "app=a b", wantErr: true},
+		{in: "-app=web", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseSelector(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseSelector(%q) = %v, want an error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseSelector(%q) error: %v", tt.in, err)
+		} else if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseSelector(%q) = %#v, want %#v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSelectorMatchesLabels(t *testing.T) {
+	labels := map[string]string{"app": "web", "tier": "frontend"}
+	tests := []struct {
+		selector string
+		want     bool
+	}{
+		{"", true},
+		{"app=web", true},
+		{"app=db", false},
+		{"app!=db", true},
+		{"app!=web", false},
+		{"missing!=x", true},
+		{"app", true},
+		{"missing", false},
+		{"!missing", true},
+		{"!app", false},
+		{"app=web,tier=frontend", true},
+		{"app=web,tier=backend", false},
+	}
+	for _, tt := range tests {
+		selector, err := ParseSelector(tt.selector)
+		if err != nil {
+			t.Fatalf("ParseSelector(%q) error: %v", tt.selector, err)
+		}
+		if got := selector.MatchesLabels(labels); got != tt.want {
+			t.Errorf("%q matches %v = %v, want %v", tt.selector, labels, got, tt.want)
+		}
+	}
+}
+
+func TestSelectorFromLabels(t *testing.T) {
+	selector := SelectorFromLabels(map[string]string{"tier": "db", "app": "web"})
+	if got, want := selector.String(), "app=web,tier=db"; got != want {
+		t.Errorf("SelectorFromLabels().String() = %q, want %q", got, want)
+	}
+	parsed, err := ParseSelector(selector.String())
+	if err != nil || !reflect.DeepEqual(parsed, selector) {
+		t.Errorf("ParseSelector(%q) = %v, %v, want %v", selector.String(), parsed, err, selector)
+	}
+}
@@ -0,0 +1,49 @@
+package v1
+
+import "time"
+
+// SnapshotVersion is the version of the snapshot format written
+const SnapshotVersion = 1
+
+// Snapshot is every key of minik8s as of a single revision of the storage, in a form
+// that can be restored into another storage
+type Snapshot struct {
+	Version int `json:"version"`
+
+	// Revision is the revision of the storage the keys were read at
+	Revision int64 `json:"revision"`
+
+	// Time is when the snapshot was taken
+	Time time.Time `json:"time"`
+
+	Entries []SnapshotEntry `json:"entries"`
+}
+
+type SnapshotEntry struct {
+	Key string `json:"key"`
+
+	// Value is the value as stored, base64 encoded since not every value is json
+	Value []byte `json:"value"`
+}
+
+// StorageStatus is the state of the storage of the api server, and of the compactions
+// run by it
+type StorageStatus struct {
+	Backend string `json:"backend"`
+
+	// Revision is the current revision of the storage
+	Revision int64 `json:"revision"`
+
+	// DBSize is the size of the database in bytes, DBSizeInUse is the part not freed by
+	// the compactions, the rest is given back by a defragmentation
+	DBSize      int64 `json:"dbSize"`
+	DBSizeInUse int64 `json:"dbSizeInUse"`
+
+	// CompactedRevision is the revision of the last compaction of this api server, and
+	// LastCompactionTime is when it was run
+	CompactedRevision  int64      `json:"compactedRevision,omitempty"`
+	LastCompactionTime *time.Time `json:"lastCompactionTime,omitempty"`
+
+	// LastDefragmentationTime is when this api server last defragmented the storage
+	LastDefragmentationTime *time.Time `json:"lastDefragmentationTime,omitempty"`
+}
@@ -0,0 +1,67 @@
+package v1
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// Unstructured is an object of a kind defined by a CustomResourceDefinition, which has no
+// go type. Its metadata is decoded like that of any other object, the rest is kept as the
+// json it was sent as.
+type Unstructured struct {
+	TypeMeta
+	ObjectMeta
+	// Object holds every field of the object, the numbers are json.Number. The kind,
+	// apiversion and metadata in it are replaced by the fields above when encoded.
+	Object map[string]any
+}
+
+func (u *Unstructured) UnmarshalJSON(data []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var object map[string]any
+	if err := decoder.Decode(&object); err != nil {
+		return err
+	}
+	var typed struct {
+		TypeMeta   `json:",inline"`
+		ObjectMeta `json:"metadata,omitempty"`
+	}
+	if err := json.Unmarshal(data, &typed); err != nil {
+		return err
+	}
+	u.TypeMeta, u.ObjectMeta, u.Object = typed.TypeMeta, typed.ObjectMeta, object
+	return nil
+}
+
+func (u Unstructured) MarshalJSON() ([]byte, error) {
+	object := make(map[string]any, len(u.Object)+3)
+	for k, v := range u.Object {
+		object[k] = v
+	}
+	delete(object, "kind")
+	delete(object, "apiversion")
+	if u.Kind != "" {
+		object["kind"] = u.Kind
+	}
+	if u.APIVersion != "" {
+		object["apiversion"] = u.APIVersion
+	}
+	object["metadata"] = u.ObjectMeta
+	return json.Marshal(object)
+}
+
+// NestedField returns the field at the path, e.g. "spec", "replicas"
+func (u *Unstructured) NestedField(path ...string) (any, bool) {
+	var field any = u.Object
+	for _, name := range path {
+		m, ok := field.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if field, ok = m[name]; !ok {
+			return nil, false
+		}
+	}
+	return field, true
+}
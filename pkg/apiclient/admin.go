@@ -0,0 +1,102 @@
+package apiclient
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	v1 "minik8s.com/minik8s/pkg/api/v1"
+	"net/http"
+	"strconv"
+)
+
+// StorageStatus returns the state of the storage of the api server
+func StorageStatus() (*v1.StorageStatus, error) {
+	buf, err := admin(http.MethodGet, "/admin/status", nil)
+	if err != nil {
+		return nil, err
+	}
+	var status v1.StorageStatus
+	if err = json.Unmarshal(buf, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// SaveSnapshot writes a snapshot of every key of minik8s to w
+func SaveSnapshot(w io.Writer) error {
+	resp, err := HttpGet(ServerURL() + "/admin/snapshot")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		buf, _ := io.ReadAll(resp.Body)
+		return adminError(resp.StatusCode, buf)
+	}
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+// RestoreSnapshot restores the snapshot read from r into the storage of the api server,
+// which must be empty. It returns the resourceVersion of the storage after the restore.
+func RestoreSnapshot(r io.Reader) (string, error) {
+	buf, err := admin(http.MethodPost, "/admin/restore", r)
+	if err != nil {
+		return "", err
+	}
+	var resp HttpResponse
+	if err = json.Unmarshal(buf, &resp); err != nil {
+		return "", err
+	}
+	return resp.ResourceVersion, nil
+}
+
+// Compact compacts the history of the storage before the revision, 0 meaning the current
+// one, and returns the revision compacted at
+func Compact(revision int64) (string, error) {
+	path := "/admin/compact"
+	if revision != 0 {
+		path += "?revision=" + strconv.FormatInt(revision, 10)
+	}
+	buf, err := admin(http.MethodPost, path, nil)
+	if err != nil {
+		return "", err
+	}
+	var resp HttpResponse
+	if err = json.Unmarshal(buf, &resp); err != nil {
+		return "", err
+	}
+	return resp.ResourceVersion, nil
+}
+
+// Defragment gives the space freed by the compactions back to the file system
+func Defragment() error {
+	_, err := admin(http.MethodPost, "/admin/defrag", nil)
+	return err
+}
+
+// admin sends a request to the admin api and returns the response body
+func admin(method string, path string, body io.Reader) ([]byte, error) {
+	resp, err := HttpSend(method, ServerURL()+path, "application/json", body)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	buf, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, adminError(resp.StatusCode, buf)
+	}
+	return buf, nil
+}
+
+// adminError is the error the admin api replied, the conflicts are told by it as well
+func adminError(code int, buf []byte) error {
+	var resp HttpResponse
+	if json.Unmarshal(buf, &resp) == nil && resp.Error != "" {
+		return errors.New(resp.Error)
+	}
+	return responseError(code, buf)
+}
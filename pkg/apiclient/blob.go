@@ -0,0 +1,183 @@
+package apiclient
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	v1 "minik8s.com/minik8s/pkg/api/v1"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// GetBlob returns the blob, ErrNotFound if it does not exist
+func GetBlob(namespace string, name string) (*v1.Blob, error) {
+	res, err := ResourceFor("Blob")
+	if err != nil {
+		return nil, err
+	}
+	buf, err := GetResource(res, namespace, name)
+	if err != nil {
+		return nil, err
+	}
+	var kv struct {
+		Blob v1.Blob `json:"value"`
+	}
+	if err = json.Unmarshal(buf, &kv); err != nil {
+		return nil, err
+	}
+	return &kv.Blob, nil
+}
+
+// ListBlobs returns the blobs of the namespace selected by opts, e.g. the fieldSelector
+// "spec.filename=train.py"
+func ListBlobs(namespace string, opts ListOptions) ([]v1.Blob, error) {
+	res, err := ResourceFor("Blob")
+	if err != nil {
+		return nil, err
+	}
+	opts.Namespace = namespace
+	buf, _, err := ListResource(res, opts)
+	if err != nil {
+		return nil, err
+	}
+	var kvs []struct {
+		Blob v1.Blob `json:"value"`
+	}
+	if err = json.Unmarshal(buf, &kvs); err != nil {
+		return nil, err
+	}
+	blobs := make([]v1.Blob, 0, len(kvs))
+	for _, kv := range kvs {
+		blobs = append(blobs, kv.Blob)
+	}
+	return blobs, nil
+}
+
+// UploadBlob creates a blob of the file in the namespace and uploads its content. The
+// blob is owned by owner if it is not nil, so it is garbage-collected with it. The
+// content already stored in the namespace is not uploaded again.
+func UploadBlob(namespace string, path string, owner *v1.OwnerReference) (*v1.Blob, error) {
+	res, err := ResourceFor("Blob")
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return nil, err
+	}
+
+	blob := &v1.Blob{
+		TypeMeta: v1.TypeMeta{Kind: "Blob", APIVersion: "v1"},
+		ObjectMeta: v1.ObjectMeta{
+			GenerateName: "blob-",
+			Namespace:    namespace,
+		},
+		Spec: v1.BlobSpec{
+			Filename: filepath.Base(path),
+			SHA256:   hex.EncodeToString(hash.Sum(nil)),
+			Size:     size,
+		},
+	}
+	if owner != nil {
+		blob.OwnerReferences = []v1.OwnerReference{*owner}
+	}
+	name, err := CreateResource(res, &blob.ObjectMeta, blob)
+	if err != nil {
+		return nil, err
+	}
+	if blob, err = GetBlob(namespace, name); err != nil {
+		return nil, err
+	}
+	if blob.Status.Phase == v1.BlobReady {
+		return blob, nil
+	}
+
+	if _, err = file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	objURL := ServerURL() + ObjectPath(res, namespace, blob.Name)
+	req, err := http.NewRequest(http.MethodPut, objURL+"/data", file)
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", "application/octet-stream")
+	httpResp, err := Do(req)
+	if err != nil {
+		return nil, err
+	}
+	buf, err := io.ReadAll(httpResp.Body)
+	httpResp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	if err = responseError(httpResp.StatusCode, buf); err != nil {
+		return nil, err
+	}
+	return GetBlob(namespace, blob.Name)
+}
+
+// SetBlobOwner makes the owner own the blob, so that it is garbage-collected with it
+func SetBlobOwner(namespace string, name string, owner v1.OwnerReference) error {
+	res, err := ResourceFor("Blob")
+	if err != nil {
+		return err
+	}
+	patch, err := json.Marshal(map[string]any{
+		"metadata": map[string]any{"ownerReferences": []v1.OwnerReference{owner}},
+	})
+	if err != nil {
+		return err
+	}
+	return PatchResource(res, namespace, name, MergePatchType, patch)
+}
+
+// DeleteBlob deletes the blob, its content is removed once no blob refers to it
+func DeleteBlob(namespace string, name string) bool {
+	res, err := ResourceFor("Blob")
+	if err != nil {
+		return false
+	}
+	return deleted(RestResource(res, namespace, name, "", OP_DELETE))
+}
+
+// DownloadBlob writes the content of the blob to w, it fails if the content read does
+// not match the checksum of the blob
+func DownloadBlob(namespace string, name string, w io.Writer) error {
+	res, err := ResourceFor("Blob")
+	if err != nil {
+		return err
+	}
+	resp, err := HttpGet(ServerURL() + ObjectPath(res, namespace, name) + "/data")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		buf, _ := io.ReadAll(resp.Body)
+		return responseError(resp.StatusCode, buf)
+	}
+	// the checksum of the blob is its ETag
+	sum, err := strconv.Unquote(resp.Header.Get("ETag"))
+	if err != nil {
+		return fmt.Errorf("invalid checksum %q of blob %s", resp.Header.Get("ETag"), name)
+	}
+	hash := sha256.New()
+	if _, err = io.Copy(io.MultiWriter(w, hash), resp.Body); err != nil {
+		return err
+	}
+	if got := hex.EncodeToString(hash.Sum(nil)); got != sum {
+		return fmt.Errorf("the sha256 of the content of blob %s is %s, want %s", name, got, sum)
+	}
+	return nil
+}
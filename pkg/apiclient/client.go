@@ -1,15 +1,16 @@
 package apiclient
 
 import (
-	"bufio"
-	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"k8s.io/klog"
 	"minik8s.com/minik8s/config"
 	v1 "minik8s.com/minik8s/pkg/api/v1"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 	"time"
@@ -19,11 +20,34 @@ type ObjType int8
 type OpType int8
 
 type HttpResponse struct {
-	ID     string `json:"id,omitempty"`
-	Status string `json:"status,omitempty"`
-	Error  string `json:"error,omitempty"`
+	// ID is the name of the object created or updated
+	ID              string `json:"id,omitempty"`
+	UID             string `json:"uid,omitempty"`
+	Status          string `json:"status,omitempty"`
+	Error           string `json:"error,omitempty"`
+	ResourceVersion string `json:"resourceVersion,omitempty"`
 }
 
+// ErrConflict is returned when an update carries a stale resourceVersion, the caller
+// should re-read the object and retry.
+var ErrConflict = errors.New("the object has been modified")
+
+// ErrNotFound is returned when the object does not exist
+var ErrNotFound = errors.New("the object does not exist")
+
+// ErrExpired is returned when a watch can not be resumed because the revision it
+// resumes from has been compacted, or the api server has dropped it for falling behind
+var ErrExpired = errors.New("too old resource version")
+
+// ResourceVersionHeader carries the resourceVersion of a list
+const ResourceVersionHeader = "X-Resource-Version"
+
+// ContinueHeader carries the token of the next page of a list
+const ContinueHeader = "X-Continue"
+
+// how many objects List gets in one request
+const listPageSize = 500
+
 const (
 	OBJ_ALL_PODS      ObjType = 0
 	OBJ_ALL_SERVICES  ObjType = 1
@@ -35,6 +59,7 @@ const (
 	OBJ_ALL_HPAS      ObjType = 15
 	OBJ_ALL_FUNCTIONS      ObjType = 19
 	OBJ_ALL_ACTCHAINS      ObjType = 20
+	OBJ_ALL_NAMESPACES ObjType = 21
 
 	OBJ_POD      ObjType = 5
 	OBJ_SERVICE  ObjType = 6
@@ -47,6 +72,7 @@ const (
 	OBJ_FUNCTION      ObjType = 16
 	OBJ_ACTCHAIN      ObjType = 17
 	OBJ_TRIGGER      ObjType = 18
+	OBJ_NAMESPACE ObjType = 22
 
 	OP_GET    OpType = 60
 	OP_POST   OpType = 70
@@ -54,124 +80,287 @@ const (
 	OP_DELETE OpType = 90
 )
 
+// ListOptions narrows a list or watch down to the objects of a namespace and to those
+// matching the selectors, which are evaluated by the api server. The zero value selects
+// everything.
+type ListOptions struct {
+	// Namespace of the objects, empty for all namespaces
+	Namespace string
+	// LabelSelector, e.g. "app=web,tier!=db"
+	LabelSelector string
+	// FieldSelector, e.g. "spec.nodeName=N1001,status.phase=Running"
+	FieldSelector string
+}
+
+// query returns the url query of the selectors, starting with "?" unless it is empty
+func (opts ListOptions) query() string {
+	values := url.Values{}
+	if opts.LabelSelector != "" {
+		values.Set("labelSelector", opts.LabelSelector)
+	}
+	if opts.FieldSelector != "" {
+		values.Set("fieldSelector", opts.FieldSelector)
+	}
+	if len(values) == 0 {
+		return ""
+	}
+	return "?" + values.Encode()
+}
+
+func listOptions(opts []ListOptions) ListOptions {
+	if len(opts) == 0 {
+		return ListOptions{}
+	}
+	return opts[0]
+}
+
 /*
 	这个函数用于发送watch请求，请正确填写参数
 	ctx: context for cancel watch task. watch task will be destroyed if ctx is done.
 	ch: the channel where can you get response. use "for str := range <- ch" to get results.
 	ty: which kind of object you want to watch. use OBJ_XXX.
+	opts: optional, only watch the objects selected by it.
+	It returns ctx.Err() once ctx is done, or ErrExpired if the api server drops the watch.
 */
-func Watch(ctx context.Context, ch chan []byte, ty ObjType) {
-	var resp *http.Response
-	var err error
-	baseUrl := config.AC_ServerAddr + ":" + strconv.Itoa(config.AC_ServerPort)
+func Watch(ctx context.Context, ch chan []byte, ty ObjType, opts ...ListOptions) error {
+	return WatchFrom(ctx, ch, ty, "", opts...)
+}
+
+/*
+	WatchFrom is Watch that only sends the changes made after resourceVersion, use the
+	resourceVersion returned by List to miss nothing. An empty resourceVersion means from now on.
+	A broken connection is resumed from the last event received, so no event is lost. If that
+	is too old to resume from, ErrExpired is returned and the caller should List again and
+	watch from the resourceVersion returned. It returns ctx.Err() once ctx is done.
+*/
+func WatchFrom(ctx context.Context, ch chan []byte, ty ObjType, resourceVersion string, opts ...ListOptions) error {
+	opt := listOptions(opts)
+	path := watchPath(ty, opt.Namespace)
+	if path == "" {
+		klog.Error("Invalid arguments!\n")
+		return errors.New("invalid object type")
+	}
+	return watchPathFrom(ctx, ch, path+opt.query(), resourceVersion)
+}
+
+// watchPathFrom is WatchFrom on the watch path
+func watchPathFrom(ctx context.Context, ch chan []byte, path string, resourceVersion string) error {
+	for {
+		var err error
+		resourceVersion, err = watchOnce(ctx, ch, path, resourceVersion)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err == ErrExpired {
+			return err
+		}
+
+		klog.Errorf("error: %v", err)
+		klog.Errorf("Rewatch after three seconds...\n")
+		select {
+		case <-time.After(time.Second * 3):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// watchEvent is the part of a watch event the client itself looks at
+type watchEvent struct {
+	Type            string `json:"type"`
+	ResourceVersion string `json:"resourceVersion,omitempty"`
+}
+
+// watchOnce sends the events of a single watch request to ch until the connection
+// breaks, and returns the resourceVersion to resume from
+func watchOnce(ctx context.Context, ch chan []byte, path string, resourceVersion string) (string, error) {
+	reqURL := ServerURL() + path
+	if resourceVersion != "" {
+		if strings.Contains(path, "?") {
+			reqURL += "&resourceVersion=" + resourceVersion
+		} else {
+			reqURL += "?resourceVersion=" + resourceVersion
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
+	if err != nil {
+		return resourceVersion, err
+	}
+	req.Header.Set("Accept", config.AS_WatchJSONLines_Type)
+	resp, err := Do(req)
+	if err != nil {
+		return resourceVersion, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusGone {
+		return resourceVersion, ErrExpired
+	} else if resp.StatusCode != http.StatusOK {
+		buf, _ := io.ReadAll(resp.Body)
+		return resourceVersion, responseError(resp.StatusCode, buf)
+	}
+
+	decoder := NewWatchDecoder(resp)
+	for {
+		buf, err := decoder.Decode()
+		if err != nil {
+			return resourceVersion, err
+		}
+
+		var event watchEvent
+		if err = json.Unmarshal(buf, &event); err != nil {
+			klog.Errorf("error: %v", err)
+			continue
+		}
+		if event.Type == "ERROR" {
+			return resourceVersion, ErrExpired
+		}
+		if event.ResourceVersion != "" {
+			resourceVersion = event.ResourceVersion
+		}
+		if event.Type == "BOOKMARK" {
+			continue
+		}
+
+		select {
+		case ch <- append(buf, '\n'):
+		case <-ctx.Done():
+			return resourceVersion, ctx.Err()
+		}
+	}
+}
+
+// watchPath returns the watch path of the kind, the objects of a namespace are
+// watched at /watch/namespaces/<namespace>/<plural>
+func watchPath(ty ObjType, namespace string) string {
+	if plural, ok := namespacedPlurals[ty]; ok && namespace != "" && isList(ty) {
+		return "/watch/namespaces/" + namespace + "/" + plural
+	}
 	switch ty {
 	case OBJ_ALL_PODS:
-		resp, err = http.Get(baseUrl + config.AC_WatchPods_Path)
+		return config.AC_WatchPods_Path
 	case OBJ_ALL_NODES:
-		resp, err = http.Get(baseUrl + config.AC_WatchNodes_Path)
+		return config.AC_WatchNodes_Path
 	case OBJ_ALL_SERVICES:
-		resp, err = http.Get(baseUrl + config.AC_WatchServices_Path)
+		return config.AC_WatchServices_Path
 	case OBJ_ALL_REPLICAS:
-		resp, err = http.Get(baseUrl + config.AC_WatchReplicas_Path)
+		return config.AC_WatchReplicas_Path
 	case OBJ_ALL_HPAS:
-		resp, err = http.Get(baseUrl + config.AC_WatchHPAs_Path)
+		return config.AC_WatchHPAs_Path
 	case OBJ_ALL_ENDPOINTS:
-		resp, err = http.Get(baseUrl + config.AC_WatchEndpoints_Path)
+		return config.AC_WatchEndpoints_Path
 	case OBJ_ALL_DNSS:
-		resp, err = http.Get(baseUrl + config.AC_WatchDnss_Path)
+		return config.AC_WatchDnss_Path
 	case OBJ_ALL_GPUS:
-		resp, err = http.Get(baseUrl + config.AC_WatchGpus_Path)
+		return config.AC_WatchGpus_Path
 	case OBJ_POD:
-		resp, err = http.Get(baseUrl + config.AC_WatchPod_Path)
+		return config.AC_WatchPod_Path
 	case OBJ_SERVICE:
-		resp, err = http.Get(baseUrl + config.AC_WatchService_Path)
+		return config.AC_WatchService_Path
 	case OBJ_REPLICAS:
-		resp, err = http.Get(baseUrl + config.AC_WatchReplica_Path)
+		return config.AC_WatchReplica_Path
 	case OBJ_HPA:
-		resp, err = http.Get(baseUrl + config.AC_WatchHPA_Path)
+		return config.AC_WatchHPA_Path
 	case OBJ_ENDPOINT:
-		resp, err = http.Get(baseUrl + config.AC_WatchEndpoint_Path)
-	default:
-		klog.Error("Invalid arguments!\n")
-		return
-	}
-	if err != nil {
-		klog.Errorf("error: %v", err)
-		klog.Errorf("Rewatch...\n")
-		go Watch(ctx, ch, ty)
-		return
+		return config.AC_WatchEndpoint_Path
 	}
+	return ""
+}
 
-	reader := bufio.NewReader(resp.Body)
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		default:
-			buf, err := reader.ReadBytes(26)
-			//var buf []byte
-			//b := make([]byte, 1)
-			//for {
-			//	_, _ = resp.Body.Read(b)
-			//	buf = append(buf, b[0])
-			//	if b[0] == 26 {
-			//		break
-			//	}
-			//}
-			if err != nil {
-				klog.Errorf("error: %v", err)
-				klog.Errorf("Rewatch after three seconds...\n")
-				time.Sleep(time.Second * 3)
-				go Watch(ctx, ch, ty)
-				return
-			}
-
-			buf[len(buf)-1] = '\n'
-			//klog.Infof("buf: %s\n", buf)
-			ch <- buf
-		}
+// GetAll lists the objects of the kind, opts is optional and narrows down the list
+func GetAll(objType ObjType, opts ...ListOptions) []byte {
+	buf, _, err := List(objType, opts...)
+	if err != nil {
+		return nil
 	}
+	return buf
 }
 
-func GetAll(objType ObjType) []byte {
-	var resp *http.Response
-	var err error
-	url := config.AC_ServerAddr + ":" + strconv.Itoa(config.AC_ServerPort)
-	switch objType {
-	case OBJ_ALL_PODS:
+// List is GetAll that also returns the resourceVersion of the list, pass it to
+// WatchFrom to get every change made after the list
+func List(objType ObjType, opts ...ListOptions) ([]byte, string, error) {
+	opt := listOptions(opts)
+	url := ServerURL()
+	plural, namespaced := namespacedPlurals[objType]
+	switch {
+	case namespaced && opt.Namespace != "" && isList(objType):
+		url += "/namespaces/" + opt.Namespace + "/" + plural
+	case objType == OBJ_ALL_PODS:
 		url += config.AC_RestPods_Path
-	case OBJ_ALL_SERVICES:
+	case objType == OBJ_ALL_NODES:
+		url += config.AC_RestNodes_Path
+	case objType == OBJ_ALL_SERVICES:
 		url += config.AC_RestServices_Path
-	case OBJ_ALL_REPLICAS:
+	case objType == OBJ_ALL_REPLICAS:
 		url += config.AC_RestReplicas_Path
-	case OBJ_ALL_ENDPOINTS:
+	case objType == OBJ_ALL_ENDPOINTS:
 		url += config.AC_RestEndpoints_Path
-	case OBJ_ALL_HPAS:
+	case objType == OBJ_ALL_HPAS:
 		url += config.AC_RestHPAs_Path
-	case OBJ_ALL_GPUS:
+	case objType == OBJ_ALL_DNSS:
+		url += config.AC_RestDnss_Path
+	case objType == OBJ_ALL_GPUS:
 		url += config.AC_RestGpus_Path
-	case OBJ_POD:
+	case objType == OBJ_ALL_NAMESPACES:
+		url += config.AC_RestNamespaces_Path
+	case objType == OBJ_POD:
 		url += config.AC_RestPod_Path
-	case OBJ_SERVICE:
+	case objType == OBJ_SERVICE:
 		url += config.AC_RestService_Path
-	case OBJ_REPLICAS:
+	case objType == OBJ_REPLICAS:
 		url += config.AC_RestReplica_Path
-	case OBJ_ENDPOINT:
+	case objType == OBJ_ENDPOINT:
 		url += config.AC_RestEndpoint_Path
-	case OBJ_HPA:
+	case objType == OBJ_HPA:
 		url += config.AC_RestHPA_Path
-	case OBJ_GPU:
+	case objType == OBJ_GPU:
 		url += config.AC_RestGpu_Path
 	default:
 		klog.Error("Invalid arguments!\n")
-		return nil
+		return nil, "", errors.New("invalid arguments")
 	}
-	resp, _ = http.Get(url)
-	buf, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil
+	return listPages(url + opt.query())
+}
+
+// listPages gets the list page by page and joins the pages into one json array, the
+// resourceVersion is the one all the pages are read at
+func listPages(listURL string) ([]byte, string, error) {
+	sep := "?"
+	if strings.Contains(listURL, "?") {
+		sep = "&"
 	}
-	return buf
+	items := []json.RawMessage{}
+	var resourceVersion, token string
+	for {
+		pageURL := listURL + sep + "limit=" + strconv.Itoa(listPageSize)
+		if token != "" {
+			pageURL += "&continue=" + url.QueryEscape(token)
+		}
+		resp, err := HttpGet(pageURL)
+		if err != nil {
+			klog.Errorf("network error: %v", err)
+			return nil, "", err
+		}
+		buf, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, "", err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, "", responseError(resp.StatusCode, buf)
+		}
+		var page []json.RawMessage
+		if err = json.Unmarshal(buf, &page); err != nil {
+			return nil, "", err
+		}
+		items = append(items, page...)
+		resourceVersion = resp.Header.Get(ResourceVersionHeader)
+		token = resp.Header.Get(ContinueHeader)
+		if token == "" {
+			break
+		}
+	}
+	buf, err := json.Marshal(items)
+	return buf, resourceVersion, err
 }
 
 /*
@@ -182,9 +371,64 @@ func GetAll(objType ObjType) []byte {
 	value: used in PUT, POST operation.
 */
 func Rest(id string, value string, objTy ObjType, opTy OpType) []byte {
-	var resp *http.Response
-	var err error
-	url := config.AC_ServerAddr + ":" + strconv.Itoa(config.AC_ServerPort)
+	_, buf := rest("", id, value, objTy, opTy)
+	return buf
+}
+
+// RestIn is Rest on the objects of a namespace. Rest itself addresses the objects of
+// the default namespace, while its lists span all namespaces.
+func RestIn(namespace string, id string, value string, objTy ObjType, opTy OpType) []byte {
+	_, buf := rest(namespace, id, value, objTy, opTy)
+	return buf
+}
+
+// the plural of the namespaced kinds, served at /namespaces/<namespace>/<plural>
+var namespacedPlurals = map[ObjType]string{
+	OBJ_ALL_PODS:      "pods",
+	OBJ_POD:           "pods",
+	OBJ_ALL_SERVICES:  "services",
+	OBJ_SERVICE:       "services",
+	OBJ_ALL_REPLICAS:  "replicas",
+	OBJ_REPLICAS:      "replicas",
+	OBJ_ALL_HPAS:      "hpas",
+	OBJ_HPA:           "hpas",
+	OBJ_ALL_ENDPOINTS: "endpoints",
+	OBJ_ENDPOINT:      "endpoints",
+	OBJ_ALL_DNSS:      "dnss",
+	OBJ_DNS:           "dnss",
+	OBJ_ALL_GPUS:      "gpus",
+	OBJ_GPU:           "gpus",
+}
+
+// isList tells whether the type is a whole collection, i.e. one of OBJ_ALL_XXX
+func isList(ty ObjType) bool {
+	switch ty {
+	case OBJ_ALL_PODS, OBJ_ALL_SERVICES, OBJ_ALL_REPLICAS, OBJ_ALL_ENDPOINTS, OBJ_ALL_NODES, OBJ_ALL_DNSS,
+		OBJ_ALL_GPUS, OBJ_ALL_HPAS, OBJ_ALL_FUNCTIONS, OBJ_ALL_ACTCHAINS, OBJ_ALL_NAMESPACES:
+		return true
+	}
+	return false
+}
+
+// rest is RestIn that also returns the http status code, which is 0 on network errors
+func rest(namespace string, id string, value string, objTy ObjType, opTy OpType) (int, []byte) {
+	url, ok := objectURL(namespace, id, objTy)
+	if !ok {
+		return 0, nil
+	}
+	return do(url, value, opTy)
+}
+
+// objectURL returns the url of the object, or of the collection if id is empty
+func objectURL(namespace string, id string, objTy ObjType) (string, bool) {
+	url := ServerURL()
+	if plural, ok := namespacedPlurals[objTy]; ok && namespace != "" {
+		url += "/namespaces/" + namespace + "/" + plural
+		if id != "" {
+			url += "/" + id
+		}
+		return url, true
+	}
 	switch objTy {
 	case OBJ_ALL_PODS:
 		url += config.AC_RestPods_Path
@@ -206,6 +450,8 @@ func Rest(id string, value string, objTy ObjType, opTy OpType) []byte {
 		url = config.AC_ServerlessAddr + ":" + strconv.Itoa(config.AC_ServerlessPort) + config.AC_RestFunctions_Path
 	case OBJ_ALL_ACTCHAINS:
 		url = config.AC_ServerlessAddr + ":" + strconv.Itoa(config.AC_ServerlessPort) + config.AC_RestActchains_Path
+	case OBJ_ALL_NAMESPACES:
+		url += config.AC_RestNamespaces_Path
 	case OBJ_POD:
 		url += config.AC_RestPod_Path
 	case OBJ_NODE:
@@ -228,141 +474,181 @@ func Rest(id string, value string, objTy ObjType, opTy OpType) []byte {
 		url = config.AC_ServerlessAddr + ":" + strconv.Itoa(config.AC_ServerlessPort) + config.AC_RestActChain_Path
 	case OBJ_TRIGGER:
 		url = config.AC_ServerlessAddr + ":" + strconv.Itoa(config.AC_ServerlessPort) + config.AC_RestTrigger_Path
+	case OBJ_NAMESPACE:
+		url += config.AC_RestNamespace_Path
 	default:
 		klog.Error("Invalid arguments!\n")
-		return nil
+		return "", false
 	}
+	return url + "/" + id, true
+}
+
+// do sends the request to url and returns the status code and the response body
+func do(url string, value string, opTy OpType) (int, []byte) {
+	var method string
 	switch opTy {
 	case OP_GET:
-		cli := http.Client{}
-		req, _ := http.NewRequest(http.MethodGet, url+"/"+id, strings.NewReader(value))
-		resp, err = cli.Do(req)
+		method = http.MethodGet
 	case OP_PUT:
-		cli := http.Client{}
-		req, _ := http.NewRequest(http.MethodPut, url+"/"+id, strings.NewReader(value))
-		resp, err = cli.Do(req)
+		method = http.MethodPut
 	case OP_POST:
-		cli := http.Client{}
-		req, _ := http.NewRequest(http.MethodPost, url+"/"+id, strings.NewReader(value))
-		resp, err = cli.Do(req)
+		method = http.MethodPost
 	case OP_DELETE:
-		cli := http.Client{}
-		req, _ := http.NewRequest(http.MethodDelete, url+"/"+id, strings.NewReader(value))
-		resp, err = cli.Do(req)
+		method = http.MethodDelete
 	default:
 		klog.Error("Invalid arguments!\n")
-		return nil
+		return 0, nil
+	}
+	req, _ := http.NewRequest(method, url, strings.NewReader(value))
+	var resp *http.Response
+	var err error
+	// the credentials are only for the api server, not the serverless one
+	if strings.HasPrefix(url, ServerURL()) {
+		resp, err = Do(req)
+	} else {
+		resp, err = http.DefaultClient.Do(req)
 	}
 	if err != nil {
 		klog.Errorf("network error: %v", err)
-		return nil
+		return 0, nil
 	}
 
 	buf, err := io.ReadAll(resp.Body)
 	resp.Body.Close()
 	if err != nil {
 		klog.Errorf("io read error: %v", err)
-		return nil
+		return 0, nil
 	}
 
-	return buf
+	return resp.StatusCode, buf
 }
 
-// GetPodStatusHttp deprecated
-func GetPodStatusHttp(pod *v1.Pod) []byte {
-	var resp *http.Response
-	var err error
-	url := config.AC_ServerAddr + ":" + strconv.Itoa(config.AC_ServerPort)
-	url += "/innode/" + pod.Spec.NodeName + "/podstatus/" + pod.UID
-
-	resp, err = http.Get(url)
+// update puts obj and translates the response into an error, ErrConflict if the
+// resourceVersion of obj is stale
+func update(meta *v1.ObjectMeta, obj any, objTy ObjType) error {
+	buf, err := json.Marshal(obj)
 	if err != nil {
-		klog.Errorf("network error: %v", err)
-		return nil
+		return err
 	}
-	buf, err := io.ReadAll(resp.Body)
-	resp.Body.Close()
+
+	return responseError(rest(v1.NamespaceOf(meta), meta.Name, string(buf), objTy, OP_PUT))
+}
+
+// updateStatus puts the status of obj to its status subresource, the rest of obj is
+// ignored by the api server
+func updateStatus(meta *v1.ObjectMeta, obj any, objTy ObjType) error {
+	buf, err := json.Marshal(obj)
 	if err != nil {
-		klog.Error("io read error\n")
+		return err
+	}
+	objURL, ok := objectURL(v1.NamespaceOf(meta), meta.Name, objTy)
+	if !ok {
+		return errors.New("invalid object type")
+	}
+	return responseError(do(objURL+"/status", string(buf), OP_PUT))
+}
+
+func responseError(code int, buf []byte) error {
+	switch code {
+	case http.StatusOK:
 		return nil
+	case http.StatusConflict:
+		return ErrConflict
+	case http.StatusNotFound:
+		return ErrNotFound
+	case 0:
+		return errors.New("network error")
 	}
 
-	return buf
+	var responseBody HttpResponse
+	err := json.Unmarshal(buf, &responseBody)
+	if err != nil || responseBody.Error == "" {
+		return fmt.Errorf("request failed with status %d", code)
+	}
+	return errors.New(responseBody.Error)
 }
 
+// PostEndpoint returns the name of the endpoint, which is generated if it has a generateName
 func PostEndpoint(endpoint *v1.Endpoint) string {
-	var resp *http.Response
-	var err error
-	url := config.AC_ServerAddr + ":" + strconv.Itoa(config.AC_ServerPort)
-
-	cli := http.Client{}
 	epBytes, err := json.Marshal(endpoint)
 	if err != nil {
 		klog.Error("Json marshall error\n")
 		return ""
 	}
 
-	req, _ := http.NewRequest(http.MethodPost, url+config.AC_RestEndpoint_Path+"/"+endpoint.UID, bytes.NewReader(epBytes))
-	resp, err = cli.Do(req)
-	if err != nil {
-		klog.Errorf("network error: %v", err)
-		return ""
-	}
+	return post(RestIn(v1.NamespaceOf(&endpoint.ObjectMeta), "", string(epBytes), OBJ_ENDPOINT, OP_POST))
+}
 
-	buf, err := io.ReadAll(resp.Body)
-	resp.Body.Close()
+func UpdateEndpoint(ep *v1.Endpoint) error {
+	return update(&ep.ObjectMeta, ep, OBJ_ENDPOINT)
+}
+
+// PostPod returns the name of the pod, which is generated if it has a generateName
+func PostPod(pod *v1.Pod) string {
+	podByte, err := json.Marshal(pod)
 	if err != nil {
-		klog.Error("Read response error\n")
 		return ""
 	}
 
-	var response HttpResponse
-	err = json.Unmarshal(buf, &response)
+	return post(RestIn(v1.NamespaceOf(&pod.ObjectMeta), "", string(podByte), OBJ_POD, OP_POST))
+}
+
+// PostEvent returns the name of the event, which is generated if it has a generateName
+func PostEvent(event *v1.Event) string {
+	res, err := ResourceFor("Event")
 	if err != nil {
-		klog.Error("Json unmarshal error\n")
+		klog.Errorf("post event error: %v", err)
 		return ""
 	}
-
-	if response.Status == "OK" {
-		return response.ID
-	} else {
+	name, err := CreateResource(res, &event.ObjectMeta, event)
+	if err != nil {
+		klog.Errorf("post failed: %v", err)
 		return ""
 	}
+	return name
 }
 
-func UpdateEndpoint(ep *v1.Endpoint) bool {
-	epByte, err := json.Marshal(ep)
+// GetLease returns the lease, ErrNotFound if it does not exist
+func GetLease(namespace string, name string) (*v1.Lease, error) {
+	res, err := ResourceFor("Lease")
 	if err != nil {
-		return false
+		return nil, err
 	}
-
-	responseBytes := Rest(ep.UID, string(epByte), OBJ_ENDPOINT, OP_PUT)
-
-	var responseBody HttpResponse
-	err = json.Unmarshal(responseBytes, &responseBody)
+	buf, err := GetResource(res, namespace, name)
 	if err != nil {
-		klog.Error("Json unmarshal error\n")
-		return false
+		return nil, err
 	}
-
-	if responseBody.Status == "OK" {
-		return true
-	} else {
-		return false
+	var kv struct {
+		Lease v1.Lease `json:"value"`
 	}
+	if err = json.Unmarshal(buf, &kv); err != nil {
+		return nil, err
+	}
+	return &kv.Lease, nil
 }
 
-// PostPod returns the UID of the pod
-func PostPod(pod *v1.Pod) string {
-	podByte, err := json.Marshal(pod)
+// CreateLease creates the lease, ErrConflict if another one has been created first
+func CreateLease(lease *v1.Lease) error {
+	res, err := ResourceFor("Lease")
 	if err != nil {
-		return ""
+		return err
 	}
+	_, err = CreateResource(res, &lease.ObjectMeta, lease)
+	return err
+}
 
-	responseBytes := Rest(pod.UID, string(podByte), OBJ_POD, OP_POST)
+// UpdateLease puts the lease, ErrConflict if it has been modified since it was read
+func UpdateLease(lease *v1.Lease) error {
+	res, err := ResourceFor("Lease")
+	if err != nil {
+		return err
+	}
+	return UpdateResource(res, &lease.ObjectMeta, lease)
+}
 
+func post(responseBytes []byte) string {
 	var responseBody HttpResponse
-	err = json.Unmarshal(responseBytes, &responseBody)
+	err := json.Unmarshal(responseBytes, &responseBody)
 	if err != nil {
 		klog.Error("Json unmarshal error\n")
 		return ""
@@ -371,113 +657,118 @@ func PostPod(pod *v1.Pod) string {
 	if responseBody.Status == "OK" {
 		return responseBody.ID
 	} else {
+		klog.Errorf("post failed: %v", responseBody.Error)
 		return ""
 	}
 }
 
-func UpdatePod(pod *v1.Pod) bool {
-	podByte, err := json.Marshal(pod)
-	if err != nil {
-		return false
-	}
-
-	responseBytes := Rest(pod.UID, string(podByte), OBJ_POD, OP_PUT)
-
-	var responseBody HttpResponse
-	err = json.Unmarshal(responseBytes, &responseBody)
-	if err != nil {
-		klog.Error("Json unmarshal error\n")
-		return false
-	}
+func UpdatePod(pod *v1.Pod) error {
+	return update(&pod.ObjectMeta, pod, OBJ_POD)
+}
 
-	if responseBody.Status == "OK" {
-		return true
-	} else {
-		return false
-	}
+func UpdateReplicaSet(rs *v1.ReplicaSet) error {
+	return update(&rs.ObjectMeta, rs, OBJ_REPLICAS)
 }
 
-func UpdateReplicaSet(rs *v1.ReplicaSet) bool {
-	rsByte, err := json.Marshal(rs)
-	if err != nil {
-		return false
-	}
+func UpdateHorizontalPodAutoscaler(hpa *v1.HorizontalPodAutoscaler) error {
+	return update(&hpa.ObjectMeta, hpa, OBJ_HPA)
+}
 
-	responseBytes := Rest(rs.UID, string(rsByte), OBJ_REPLICAS, OP_PUT)
+func UpdatePodStatus(pod *v1.Pod) error {
+	return updateStatus(&pod.ObjectMeta, pod, OBJ_POD)
+}
 
-	var responseBody HttpResponse
-	err = json.Unmarshal(responseBytes, &responseBody)
-	if err != nil {
-		klog.Error("Json unmarshal error\n")
-		return false
-	}
+func UpdateReplicaSetStatus(rs *v1.ReplicaSet) error {
+	return updateStatus(&rs.ObjectMeta, rs, OBJ_REPLICAS)
+}
 
-	if responseBody.Status == "OK" {
-		return true
-	} else {
-		return false
-	}
+func UpdateHorizontalPodAutoscalerStatus(hpa *v1.HorizontalPodAutoscaler) error {
+	return updateStatus(&hpa.ObjectMeta, hpa, OBJ_HPA)
 }
 
-func UpdateHorizontalPodAutoscaler(hpa *v1.HorizontalPodAutoscaler) bool {
-	rsByte, err := json.Marshal(hpa)
-	if err != nil {
-		return false
-	}
+// UpdateNodeStatus puts the status of the node, which is named after its UID
+func UpdateNodeStatus(node *v1.Node) error {
+	return updateStatus(&node.ObjectMeta, node, OBJ_NODE)
+}
 
-	responseBytes := Rest(hpa.UID, string(rsByte), OBJ_HPA, OP_PUT)
+func DeleteEndpoint(namespace string, name string) bool {
+	return deleted(RestIn(namespace, name, "", OBJ_ENDPOINT, OP_DELETE))
+}
 
-	var responseBody HttpResponse
-	err = json.Unmarshal(responseBytes, &responseBody)
-	if err != nil {
-		klog.Error("Json unmarshal error\n")
-		return false
-	}
+func DeletePod(namespace string, name string) bool {
+	return deleted(RestIn(namespace, name, "", OBJ_POD, OP_DELETE))
+}
 
-	if responseBody.Status == "OK" {
-		return true
-	} else {
-		return false
-	}
+func DeleteGPUJob(namespace string, name string) bool {
+	return deleted(RestIn(namespace, name, "", OBJ_GPU, OP_DELETE))
 }
 
-func DeleteEndpoint(epID string) bool {
-	responseBytes := Rest(epID, "", OBJ_ENDPOINT, OP_DELETE)
+// DeleteOptions tell how an object is deleted, the zero value leaves it to the api server
+type DeleteOptions struct {
+	// PropagationPolicy tells what happens to the dependents of the object, Background
+	// if empty
+	PropagationPolicy v1.DeletionPropagation
+	// GracePeriodSeconds is how long the object is given to terminate, nil means the
+	// default of its kind
+	GracePeriodSeconds *int64
+}
 
-	var responseBody HttpResponse
-	err := json.Unmarshal(responseBytes, &responseBody)
-	if err != nil {
-		klog.Error("Json unmarshal error\n")
-		return false
+// query returns the url query of the options, starting with "?" unless it is empty
+func (opts DeleteOptions) query() string {
+	values := url.Values{}
+	if opts.PropagationPolicy != "" {
+		values.Set("propagationPolicy", string(opts.PropagationPolicy))
+	}
+	if opts.GracePeriodSeconds != nil {
+		values.Set("gracePeriodSeconds", strconv.FormatInt(*opts.GracePeriodSeconds, 10))
+	}
+	if len(values) == 0 {
+		return ""
 	}
+	return "?" + values.Encode()
+}
 
-	if responseBody.Status == "OK" {
-		return true
-	} else {
-		return false
+// DeleteWith deletes the object and returns the response. An object with finalizers is
+// only marked for deletion, and it is removed once they have all been cleared.
+func DeleteWith(namespace string, name string, objTy ObjType, opts DeleteOptions) []byte {
+	objURL, ok := objectURL(namespace, name, objTy)
+	if !ok {
+		return nil
 	}
+	_, buf := do(objURL+opts.query(), "", OP_DELETE)
+	return buf
 }
 
-func DeletePod(podID string) bool {
-	responseBytes := Rest(podID, "", OBJ_POD, OP_DELETE)
+// the Content-Types of the patches
+const (
+	// MergePatchType replaces the fields in the patch, a null removes the field
+	MergePatchType = "application/merge-patch+json"
+	// JSONPatchType is a list of add, remove, replace, move, copy and test operations
+	JSONPatchType = "application/json-patch+json"
+	// ApplyPatchType is a whole configuration merged by server-side apply
+	ApplyPatchType = "application/apply-patch+json"
+)
 
-	var responseBody HttpResponse
-	err := json.Unmarshal(responseBytes, &responseBody)
-	if err != nil {
-		klog.Error("Json unmarshal error\n")
-		return false
+// Patch applies the patch of the type to the object on the api server. A patch setting
+// metadata.resourceVersion fails with ErrConflict if the object has been modified.
+func Patch(namespace string, name string, objTy ObjType, patchType string, patch []byte) error {
+	objURL, ok := objectURL(namespace, name, objTy)
+	if !ok {
+		return errors.New("invalid object type")
 	}
+	return patchURL(objURL, patchType, patch)
+}
 
-	if responseBody.Status == "OK" {
-		return true
-	} else {
-		return false
+// Get returns the object as replied by the api server, ErrNotFound if it does not exist
+func Get(namespace string, name string, objTy ObjType) ([]byte, error) {
+	code, buf := rest(namespace, name, "", objTy, OP_GET)
+	if err := responseError(code, buf); err != nil {
+		return nil, err
 	}
+	return buf, nil
 }
 
-func DeleteGPUJob(jobID string) bool {
-	responseBytes := Rest(jobID, "", OBJ_GPU, OP_DELETE)
-
+func deleted(responseBytes []byte) bool {
 	var responseBody HttpResponse
 	err := json.Unmarshal(responseBytes, &responseBody)
 	if err != nil {
@@ -493,7 +784,7 @@ func DeleteGPUJob(jobID string) bool {
 }
 
 func DetectAPIServer() bool {
-	_, err := http.Get(config.AC_ServerAddr + ":" + strconv.Itoa(config.AC_ServerPort) + "/test")
+	_, err := HttpGet(ServerURL() + "/test")
 	if err != nil {
 		return false
 	} else {
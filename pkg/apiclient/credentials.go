@@ -0,0 +1,161 @@
+package apiclient
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"k8s.io/klog"
+	"minik8s.com/minik8s/config"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+)
+
+// CredentialsEnv names the credentials file if set, otherwise it is DefaultCredentialsFile
+// in the home directory
+const CredentialsEnv = "MINIK8S_CONFIG"
+
+const DefaultCredentialsFile = ".minik8s/config"
+
+// Credentials is the json file telling the clients where the api server is and how to
+// authenticate to it, e.g.
+//
+//	{
+//	  "server": "https://10.119.11.209:8080",
+//	  "certificateAuthority": "/etc/minik8s/ca.crt",
+//	  "clientCertificate": "/etc/minik8s/kubelet.crt",
+//	  "clientKey": "/etc/minik8s/kubelet.key"
+//	}
+type Credentials struct {
+	Server string `json:"server,omitempty"`
+	// CertificateAuthority verifies the certificate of the server
+	CertificateAuthority  string `json:"certificateAuthority,omitempty"`
+	InsecureSkipTLSVerify bool   `json:"insecureSkipTLSVerify,omitempty"`
+	ClientCertificate     string `json:"clientCertificate,omitempty"`
+	ClientKey             string `json:"clientKey,omitempty"`
+	Token                 string `json:"token,omitempty"`
+}
+
+var (
+	credsOnce  sync.Once
+	serverURL  = config.AC_ServerAddr + ":" + strconv.Itoa(config.AC_ServerPort)
+	httpClient = &http.Client{}
+	token      string
+)
+
+// DefaultCredentialsPath returns $MINIK8S_CONFIG, or ~/.minik8s/config
+func DefaultCredentialsPath() string {
+	if path := os.Getenv(CredentialsEnv); path != "" {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, DefaultCredentialsFile)
+}
+
+// LoadCredentials makes the requests to the api server use the credentials file at path
+// instead of the default one
+func LoadCredentials(path string) error {
+	credsOnce.Do(func() {})
+	return loadCredentials(path)
+}
+
+// ensureCredentials loads the default credentials file before the first request, the
+// api server is reached over plain http without credentials if there is none
+func ensureCredentials() {
+	credsOnce.Do(func() {
+		path := DefaultCredentialsPath()
+		if path == "" {
+			return
+		}
+		if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+			return
+		}
+		if err := loadCredentials(path); err != nil {
+			klog.Errorf("load credentials %s error: %v", path, err)
+		}
+	})
+}
+
+func loadCredentials(path string) error {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var creds Credentials
+	if err = json.Unmarshal(buf, &creds); err != nil {
+		return fmt.Errorf("decode credentials %s: %v", path, err)
+	}
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: creds.InsecureSkipTLSVerify}
+	if creds.CertificateAuthority != "" {
+		pem, err := os.ReadFile(creds.CertificateAuthority)
+		if err != nil {
+			return err
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificate found in %s", creds.CertificateAuthority)
+		}
+	}
+	if creds.ClientCertificate != "" {
+		cert, err := tls.LoadX509KeyPair(creds.ClientCertificate, creds.ClientKey)
+		if err != nil {
+			return err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	if creds.Server != "" {
+		serverURL = creds.Server
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	httpClient = &http.Client{Transport: transport}
+	token = creds.Token
+	return nil
+}
+
+// ServerURL returns the scheme, address and port of the api server
+func ServerURL() string {
+	ensureCredentials()
+	return serverURL
+}
+
+// Do sends the request to the api server with the credentials
+func Do(req *http.Request) (*http.Response, error) {
+	ensureCredentials()
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return httpClient.Do(req)
+}
+
+// HttpGet is http.Get with the credentials
+func HttpGet(url string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return Do(req)
+}
+
+// HttpSend sends a request of the method with the body to the api server with the
+// credentials
+func HttpSend(method string, url string, contentType string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	return Do(req)
+}
@@ -0,0 +1,84 @@
+package apiclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	v1 "minik8s.com/minik8s/pkg/api/v1"
+	"net/http"
+)
+
+// CustomResource addresses the objects of a kind defined by a CustomResourceDefinition,
+// which are served at /apis/<group>/<version>/[namespaces/<namespace>/]<plural>
+type CustomResource struct {
+	Group   string
+	Version string
+	Plural  string
+	// Namespaced tells whether the objects belong to namespaces
+	Namespaced bool
+}
+
+// APIResource returns the resource as told by the discovery
+func (cr *CustomResource) APIResource() *v1.APIResource {
+	return &v1.APIResource{Name: cr.Plural, Group: cr.Group, Version: cr.Version, Namespaced: cr.Namespaced}
+}
+
+// ListCustom lists the objects of the custom kind, use the resourceVersion returned to
+// WatchCustomFrom
+func ListCustom(cr *CustomResource, opts ...ListOptions) ([]byte, string, error) {
+	opt := listOptions(opts)
+	return listPages(ServerURL() + ListPath(cr.APIResource(), opt.Namespace) + opt.query())
+}
+
+// WatchCustomFrom is WatchFrom on the objects of the custom kind
+func WatchCustomFrom(ctx context.Context, ch chan []byte, cr *CustomResource, resourceVersion string, opts ...ListOptions) error {
+	return WatchResourceFrom(ctx, ch, cr.APIResource(), resourceVersion, opts...)
+}
+
+// GetCustom returns the object of the custom kind, ErrNotFound if it does not exist
+func GetCustom(cr *CustomResource, namespace string, name string) (*v1.Unstructured, error) {
+	code, buf := do(ServerURL()+ObjectPath(cr.APIResource(), namespace, name), "", OP_GET)
+	if err := responseError(code, buf); err != nil {
+		return nil, err
+	}
+	obj := &v1.Unstructured{}
+	if err := json.Unmarshal(buf, obj); err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+// CreateCustom creates the object and returns its name, which is generated if it has a
+// generateName
+func CreateCustom(cr *CustomResource, obj *v1.Unstructured) (string, error) {
+	buf, err := json.Marshal(obj)
+	if err != nil {
+		return "", err
+	}
+	code, buf := do(ServerURL()+ObjectPath(cr.APIResource(), obj.Namespace, ""), string(buf), OP_POST)
+	if code != http.StatusOK && code != http.StatusCreated {
+		return "", responseError(code, buf)
+	}
+	var responseBody HttpResponse
+	if err = json.Unmarshal(buf, &responseBody); err != nil {
+		return "", err
+	}
+	if responseBody.Status != "OK" {
+		return "", errors.New(responseBody.Error)
+	}
+	return responseBody.ID, nil
+}
+
+// UpdateCustom puts the object, ErrConflict if its resourceVersion is stale
+func UpdateCustom(cr *CustomResource, obj *v1.Unstructured) error {
+	buf, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+	return responseError(do(ServerURL()+ObjectPath(cr.APIResource(), obj.Namespace, obj.Name), string(buf), OP_PUT))
+}
+
+// DeleteCustom deletes the object of the custom kind
+func DeleteCustom(cr *CustomResource, namespace string, name string) error {
+	return responseError(do(ServerURL()+ObjectPath(cr.APIResource(), namespace, name), "", OP_DELETE))
+}
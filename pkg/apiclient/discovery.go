@@ -0,0 +1,236 @@
+package apiclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	v1 "minik8s.com/minik8s/pkg/api/v1"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// Discover returns the resources served by the api server, the custom resources included
+func Discover() ([]v1.APIResource, error) {
+	resp, err := HttpGet(ServerURL() + "/apis")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	buf, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if err = responseError(resp.StatusCode, buf); err != nil {
+		return nil, err
+	}
+	var list v1.APIResourceList
+	if err = json.Unmarshal(buf, &list); err != nil {
+		return nil, err
+	}
+	return list.Resources, nil
+}
+
+// discovered caches the resources found by Discover by their lower case kind, the
+// built-in ones first
+var discovered = struct {
+	sync.Mutex
+	byKind map[string]*v1.APIResource
+}{}
+
+// ResourceFor returns the resource of the kind, which is matched regardless of case. The
+// discovery is cached and only done again when the kind is not found in the cache.
+func ResourceFor(kind string) (*v1.APIResource, error) {
+	discovered.Lock()
+	defer discovered.Unlock()
+	if res, ok := discovered.byKind[strings.ToLower(kind)]; ok {
+		return res, nil
+	}
+	resources, err := Discover()
+	if err != nil {
+		return nil, err
+	}
+	discovered.byKind = map[string]*v1.APIResource{}
+	for i := range resources {
+		res := &resources[i]
+		key := strings.ToLower(res.Kind)
+		// the subresources, e.g. pods/status, are not addressed by kind
+		if strings.Contains(res.Name, "/") {
+			continue
+		}
+		if prev, ok := discovered.byKind[key]; ok && prev.Group == "" {
+			continue
+		}
+		discovered.byKind[key] = res
+	}
+	if res, ok := discovered.byKind[strings.ToLower(kind)]; ok {
+		return res, nil
+	}
+	return nil, fmt.Errorf("the server has no resource of kind %s", kind)
+}
+
+// ObjectPath returns the path of the object of the resource, or the path its objects are
+// created at if name is empty. The objects of a namespaced resource are in the default
+// namespace unless namespace is set.
+func ObjectPath(res *v1.APIResource, namespace string, name string) string {
+	if namespace == "" {
+		namespace = v1.NamespaceDefault
+	}
+	var path string
+	switch {
+	case res.Group != "" && res.Namespaced:
+		path = "/apis/" + res.Group + "/" + res.Version + "/namespaces/" + namespace + "/" + res.Name
+	case res.Group != "":
+		path = "/apis/" + res.Group + "/" + res.Version + "/" + res.Name
+	case res.Namespaced:
+		path = "/namespaces/" + namespace + "/" + res.Name
+	default:
+		// the built-in cluster scoped objects are addressed by the singular
+		path = "/" + res.SingularName
+	}
+	if name != "" {
+		path += "/" + name
+	}
+	return path
+}
+
+// ListPath returns the path the objects of the resource in the namespace are listed at,
+// those of all namespaces if namespace is empty. Prefix it with /watch to watch them.
+func ListPath(res *v1.APIResource, namespace string) string {
+	path := "/"
+	if res.Group != "" {
+		path = "/apis/" + res.Group + "/" + res.Version + "/"
+	}
+	if res.Namespaced && namespace != "" {
+		path += "namespaces/" + namespace + "/"
+	}
+	return path + res.Name
+}
+
+// RestResource is RestIn on a resource found by Discover
+func RestResource(res *v1.APIResource, namespace string, name string, value string, opTy OpType) []byte {
+	_, buf := do(ServerURL()+ObjectPath(res, namespace, name), value, opTy)
+	return buf
+}
+
+// GetResource is Get on a resource found by Discover
+func GetResource(res *v1.APIResource, namespace string, name string) ([]byte, error) {
+	code, buf := do(ServerURL()+ObjectPath(res, namespace, name), "", OP_GET)
+	if err := responseError(code, buf); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// CreateResource posts obj to the resource, it returns the name of the object created
+func CreateResource(res *v1.APIResource, meta *v1.ObjectMeta, obj any) (string, error) {
+	buf, err := json.Marshal(obj)
+	if err != nil {
+		return "", err
+	}
+	code, buf := do(ServerURL()+ObjectPath(res, v1.NamespaceOf(meta), ""), string(buf), OP_POST)
+	if err = responseError(code, buf); err != nil {
+		return "", err
+	}
+	var resp HttpResponse
+	if err = json.Unmarshal(buf, &resp); err != nil {
+		return "", err
+	}
+	return resp.ID, nil
+}
+
+// UpdateResource is update on a resource found by Discover, ErrConflict if the
+// resourceVersion of obj is stale
+func UpdateResource(res *v1.APIResource, meta *v1.ObjectMeta, obj any) error {
+	buf, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+	return responseError(do(ServerURL()+ObjectPath(res, v1.NamespaceOf(meta), meta.Name), string(buf), OP_PUT))
+}
+
+// ListResource is List on a resource found by Discover
+func ListResource(res *v1.APIResource, opts ...ListOptions) ([]byte, string, error) {
+	opt := listOptions(opts)
+	return listPages(ServerURL() + ListPath(res, opt.Namespace) + opt.query())
+}
+
+// WatchResourceFrom is WatchFrom on a resource found by Discover
+func WatchResourceFrom(ctx context.Context, ch chan []byte, res *v1.APIResource, resourceVersion string, opts ...ListOptions) error {
+	opt := listOptions(opts)
+	return watchPathFrom(ctx, ch, "/watch"+ListPath(res, opt.Namespace)+opt.query(), resourceVersion)
+}
+
+// PatchResource is Patch on a resource found by Discover
+func PatchResource(res *v1.APIResource, namespace string, name string, patchType string, patch []byte) error {
+	return patchURL(ServerURL()+ObjectPath(res, namespace, name), patchType, patch)
+}
+
+// DeleteResourceWith is DeleteWith on a resource found by Discover
+func DeleteResourceWith(res *v1.APIResource, namespace string, name string, opts DeleteOptions) []byte {
+	_, buf := do(ServerURL()+ObjectPath(res, namespace, name)+opts.query(), "", OP_DELETE)
+	return buf
+}
+
+// patchURL applies the patch of the type to the object at the url
+func patchURL(objURL string, patchType string, patch []byte) error {
+	resp, err := HttpSend(http.MethodPatch, objURL, patchType, bytes.NewReader(patch))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	buf, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	return responseError(resp.StatusCode, buf)
+}
+
+// ApplyOptions tell how a configuration is applied
+type ApplyOptions struct {
+	// FieldManager is the name the fields of the configuration are owned by, required
+	FieldManager string
+	// Force takes over the fields owned by the other managers instead of failing
+	Force bool
+	// DryRun checks the configuration without persisting it
+	DryRun bool
+}
+
+func (opts ApplyOptions) query() string {
+	values := url.Values{}
+	values.Set("fieldManager", opts.FieldManager)
+	if opts.Force {
+		values.Set("force", "true")
+	}
+	if opts.DryRun {
+		values.Set("dryRun", "All")
+	}
+	return "?" + values.Encode()
+}
+
+// ApplyResource applies the configuration by server-side apply to the object of a
+// resource found by Discover, the object is created if it does not exist. It returns the
+// response, which holds the resulting object on a dry run. The conflicts with the fields
+// of the other managers are in the ErrConflict returned.
+func ApplyResource(res *v1.APIResource, namespace string, name string, config []byte, opts ApplyOptions) ([]byte, error) {
+	resp, err := HttpSend(http.MethodPatch, ServerURL()+ObjectPath(res, namespace, name)+opts.query(),
+		ApplyPatchType, bytes.NewReader(config))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	buf, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusConflict {
+		var responseBody HttpResponse
+		if json.Unmarshal(buf, &responseBody) == nil && responseBody.Error != "" {
+			return buf, fmt.Errorf("%w: %s", ErrConflict, responseBody.Error)
+		}
+	}
+	return buf, responseError(resp.StatusCode, buf)
+}
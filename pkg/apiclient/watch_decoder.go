@@ -0,0 +1,74 @@
+package apiclient
+
+import (
+	"bufio"
+	"bytes"
+	"mime"
+	"minik8s.com/minik8s/config"
+	"net/http"
+)
+
+// WatchDecoder reads the events of a watch response one by one, in whichever format
+// the api server streamed them
+type WatchDecoder struct {
+	reader *bufio.Reader
+	format string
+}
+
+// NewWatchDecoder returns a decoder of the body of the watch response, the format is
+// told by its Content-Type
+func NewWatchDecoder(resp *http.Response) *WatchDecoder {
+	format, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil {
+		format = config.AS_WatchJSONLines_Type
+	}
+	return &WatchDecoder{reader: bufio.NewReader(resp.Body), format: format}
+}
+
+// Decode returns the json of the next event, the heartbeats are skipped
+func (d *WatchDecoder) Decode() ([]byte, error) {
+	switch d.format {
+	case config.AS_WatchLegacy_Type:
+		buf, err := d.reader.ReadBytes(0x1A)
+		if err != nil {
+			return nil, err
+		}
+		return buf[:len(buf)-1], nil
+	case config.AS_WatchEventStream_Type:
+		return d.decodeEventStream()
+	default:
+		for {
+			line, err := d.reader.ReadBytes('\n')
+			if err != nil {
+				return nil, err
+			}
+			if line = bytes.TrimSpace(line); len(line) != 0 {
+				return line, nil
+			}
+		}
+	}
+}
+
+// decodeEventStream returns the data of the next server-sent event, the comments and
+// the fields other than data are skipped
+func (d *WatchDecoder) decodeEventStream() ([]byte, error) {
+	var data [][]byte
+	for {
+		line, err := d.reader.ReadBytes('\n')
+		if err != nil {
+			// an event cut off by the end of the stream is dropped
+			return nil, err
+		}
+		line = bytes.TrimRight(line, "\r\n")
+		if len(line) == 0 {
+			// a blank line ends the event
+			if len(data) != 0 {
+				return bytes.Join(data, []byte{'\n'}), nil
+			}
+			continue
+		}
+		if bytes.HasPrefix(line, []byte("data:")) {
+			data = append(data, bytes.TrimPrefix(line[len("data:"):], []byte(" ")))
+		}
+	}
+}
@@ -0,0 +1,558 @@
+/*
+	admission chain：对象在持久化之前依次经过各个插件的defaulting与validation，
+	POST与PUT均会执行，校验失败时返回422并给出出错字段的路径
+*/
+package apiserver
+
+import (
+	"encoding/json"
+	"fmt"
+	bytesize "github.com/inhies/go-bytesize"
+	v1 "minik8s.com/minik8s/pkg/api/v1"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// FieldError is a problem with one field of an object, Field is its json path,
+// e.g. spec.containers[0].image
+type FieldError struct {
+	Field  string `json:"field"`
+	Detail string `json:"detail"`
+}
+
+// FieldErrors collects all the problems found by the validation plugins
+type FieldErrors []FieldError
+
+func (errs FieldErrors) Error() string {
+	msgs := make([]string, 0, len(errs))
+	for _, err := range errs {
+		msgs = append(msgs, err.Field+": "+err.Detail)
+	}
+	return "invalid object: " + strings.Join(msgs, "; ")
+}
+
+// AdmissionPlugin defaults and validates the objects of one kind, either function may be nil
+type AdmissionPlugin struct {
+	Name string
+
+	// Default fills in the fields left unset by the client
+	Default func(obj v1.Object)
+
+	// Validate returns the invalid fields of an already defaulted object
+	Validate func(obj v1.Object) FieldErrors
+
+	// Restrict limits what the user sending the object may set, it runs first
+	Restrict func(user UserInfo, obj v1.Object) FieldErrors
+}
+
+// admission plugins of each kind, in the order they run
+var admissionPlugins = map[string][]*AdmissionPlugin{}
+
+func registerAdmission(kind string, plugin *AdmissionPlugin) {
+	admissionPlugins[kind] = append(admissionPlugins[kind], plugin)
+}
+
+// admit runs every restricting plugin of the kind, then every defaulting plugin and
+// then every validation plugin. The object is rejected by the first restricting plugin
+// failing, otherwise the returned errors are those of all the validation plugins.
+func admit(kind string, obj v1.Object, user UserInfo) FieldErrors {
+	plugins := admissionPlugins[kind]
+	for _, plugin := range plugins {
+		if plugin.Restrict != nil {
+			if errs := plugin.Restrict(user, obj); len(errs) != 0 {
+				return errs
+			}
+		}
+	}
+	for _, plugin := range plugins {
+		if plugin.Default != nil {
+			plugin.Default(obj)
+		}
+	}
+	errs := validateObjectMeta(obj.GetObjectMeta())
+	for _, plugin := range plugins {
+		if plugin.Validate != nil {
+			errs = append(errs, plugin.Validate(obj)...)
+		}
+	}
+	return errs
+}
+
+// built-in admission plugins
+func init() {
+	registerAdmission("Pod", &AdmissionPlugin{
+		Name: "PodDefaults",
+		Default: func(obj v1.Object) {
+			defaultPodSpec(&obj.(*v1.Pod).Spec)
+		},
+	})
+	registerAdmission("Pod", &AdmissionPlugin{
+		Name: "PodValidation",
+		Validate: func(obj v1.Object) FieldErrors {
+			return validatePodSpec(&obj.(*v1.Pod).Spec, "spec")
+		},
+	})
+
+	registerAdmission("ReplicaSet", &AdmissionPlugin{
+		Name: "ReplicaSetValidation",
+		Validate: func(obj v1.Object) FieldErrors {
+			rs := obj.(*v1.ReplicaSet)
+			var errs FieldErrors
+			if rs.Spec.Replicas < 0 {
+				errs = append(errs, FieldError{"spec.replicas", "must be greater than or equal to 0"})
+			}
+			return append(errs, validatePodSpec(&rs.Spec.Template.Spec, "spec.template.spec")...)
+		},
+	})
+
+	registerAdmission("HorizontalPodAutoscaler", &AdmissionPlugin{
+		Name: "HorizontalPodAutoscalerDefaults",
+		Default: func(obj v1.Object) {
+			hpa := obj.(*v1.HorizontalPodAutoscaler)
+			if hpa.Spec.MinReplicas == 0 {
+				hpa.Spec.MinReplicas = 1
+			}
+		},
+	})
+	registerAdmission("HorizontalPodAutoscaler", &AdmissionPlugin{
+		Name:     "HorizontalPodAutoscalerValidation",
+		Validate: validateHorizontalPodAutoscaler,
+	})
+
+	registerAdmission("Service", &AdmissionPlugin{
+		Name:     "ServiceValidation",
+		Validate: validateService,
+	})
+	registerAdmission("Service", &AdmissionPlugin{
+		Name:     "ClusterIPAllocation",
+		Validate: validateClusterIPUnique,
+	})
+
+	registerAdmission("DNS", &AdmissionPlugin{
+		Name: "DNSValidation",
+		Validate: func(obj v1.Object) FieldErrors {
+			dns := obj.(*v1.DNS)
+			var errs FieldErrors
+			if dns.Host == "" {
+				errs = append(errs, FieldError{"host", "must not be empty"})
+			}
+			for i, path := range dns.Paths {
+				field := fmt.Sprintf("paths[%d]", i)
+				if path.ServiceName == "" {
+					errs = append(errs, FieldError{field + ".servicename", "must not be empty"})
+				}
+				errs = append(errs, validatePort(field+".port", path.Port)...)
+			}
+			return errs
+		},
+	})
+
+	registerAdmission("Node", &AdmissionPlugin{
+		Name:     "NodeRestriction",
+		Restrict: restrictNode,
+	})
+
+	for _, kind := range []string{"Role", "ClusterRole"} {
+		registerAdmission(kind, &AdmissionPlugin{
+			Name:     kind + "Validation",
+			Validate: validateRules,
+		})
+	}
+	registerAdmission("RoleBinding", &AdmissionPlugin{
+		Name: "RoleBindingValidation",
+		Validate: func(obj v1.Object) FieldErrors {
+			binding := obj.(*v1.RoleBinding)
+			return validateBinding(binding.Subjects, binding.RoleRef, "Role", "ClusterRole")
+		},
+	})
+	registerAdmission("ClusterRoleBinding", &AdmissionPlugin{
+		Name: "ClusterRoleBindingValidation",
+		Validate: func(obj v1.Object) FieldErrors {
+			binding := obj.(*v1.ClusterRoleBinding)
+			return validateBinding(binding.Subjects, binding.RoleRef, "ClusterRole")
+		},
+	})
+
+	registerAdmission("Event", &AdmissionPlugin{
+		Name: "EventValidation",
+		Validate: func(obj v1.Object) FieldErrors {
+			event := obj.(*v1.Event)
+			var errs FieldErrors
+			if event.InvolvedObject.Kind == "" || event.InvolvedObject.Name == "" {
+				errs = append(errs, FieldError{"involvedObject", "kind and name are required"})
+			}
+			if event.Type != v1.EventTypeNormal && event.Type != v1.EventTypeWarning {
+				errs = append(errs, FieldError{"type", "unsupported value " + strconv.Quote(event.Type) +
+					", want " + v1.EventTypeNormal + " or " + v1.EventTypeWarning})
+			}
+			if event.Reason == "" {
+				errs = append(errs, FieldError{"reason", "must not be empty"})
+			}
+			return errs
+		},
+	})
+
+	registerAdmission("CustomResourceDefinition", &AdmissionPlugin{
+		Name:     "CustomResourceDefinitionValidation",
+		Validate: validateCustomResourceDefinition,
+	})
+
+	registerAdmission("Lease", &AdmissionPlugin{
+		Name: "LeaseValidation",
+		Validate: func(obj v1.Object) FieldErrors {
+			spec := obj.(*v1.Lease).Spec
+			var errs FieldErrors
+			if spec.LeaseDurationSeconds < 0 || (spec.HolderIdentity != "" && spec.LeaseDurationSeconds == 0) {
+				errs = append(errs, FieldError{"spec.leaseDurationSeconds", "must be positive"})
+			}
+			if spec.LeaseTransitions < 0 {
+				errs = append(errs, FieldError{"spec.leaseTransitions", "must not be negative"})
+			}
+			return errs
+		},
+	})
+
+	registerAdmission("Blob", &AdmissionPlugin{
+		Name: "BlobValidation",
+		Validate: func(obj v1.Object) FieldErrors {
+			spec := obj.(*v1.Blob).Spec
+			var errs FieldErrors
+			if !sha256Regexp.MatchString(spec.SHA256) {
+				errs = append(errs, FieldError{"spec.sha256", "must be 64 lowercase hex digits"})
+			}
+			if spec.Size < 0 {
+				errs = append(errs, FieldError{"spec.size", "must not be negative"})
+			} else if spec.Size > maxBlobSize {
+				errs = append(errs, FieldError{"spec.size", "must not exceed the maximum blob size of " + strconv.FormatInt(maxBlobSize, 10) + " bytes"})
+			}
+			// the file is downloaded under the name
+			if strings.ContainsAny(spec.Filename, "/\\") || spec.Filename == "." || spec.Filename == ".." {
+				errs = append(errs, FieldError{"spec.filename", "must be a file name, not a path"})
+			}
+			return errs
+		},
+	})
+
+	registerAdmission("Namespace", &AdmissionPlugin{
+		Name: "NamespaceValidation",
+		Validate: func(obj v1.Object) FieldErrors {
+			ns := obj.(*v1.Namespace)
+			if !namespaceNameRegexp.MatchString(ns.Name) {
+				return FieldErrors{{"metadata.name", "invalid namespace name " + ns.Name + ", it must be a lowercase RFC 1123 label"}}
+			}
+			return nil
+		},
+	})
+}
+
+// validateObjectMeta checks the metadata common to all kinds, the name becomes part of
+// the etcd key and the url of the object
+func validateObjectMeta(meta *v1.ObjectMeta) FieldErrors {
+	var errs FieldErrors
+	if meta.Name == "" && meta.GenerateName == "" {
+		errs = append(errs, FieldError{"metadata.name", "name or generateName is required"})
+	}
+	if strings.ContainsAny(meta.Name, "/?#% ") {
+		errs = append(errs, FieldError{"metadata.name", "invalid name " + strconv.Quote(meta.Name) +
+			", it may not contain '/', '?', '#', '%' or spaces"})
+	}
+	if strings.ContainsAny(meta.GenerateName, "/?#% ") {
+		errs = append(errs, FieldError{"metadata.generateName", "invalid prefix " + strconv.Quote(meta.GenerateName) +
+			", it may not contain '/', '?', '#', '%' or spaces"})
+	}
+	for i, f := range meta.Finalizers {
+		if f == "" {
+			errs = append(errs, FieldError{"metadata.finalizers[" + strconv.Itoa(i) + "]", "must not be empty"})
+		}
+	}
+	return errs
+}
+
+// default resources of a container that does not request any
+const (
+	defaultContainerCPU    = "4"
+	defaultContainerMemory = "512MB"
+)
+
+func defaultPodSpec(spec *v1.PodSpec) {
+	if spec.RestartPolicy == "" {
+		spec.RestartPolicy = v1.RestartPolicyAlways
+	}
+	for _, c := range spec.Containers {
+		if c == nil {
+			continue
+		}
+		if c.ImagePullPolicy == "" {
+			c.ImagePullPolicy = v1.IfNotPresentImagePullPolicy
+		}
+		if c.Resources == nil {
+			c.Resources = make(map[string]string)
+		}
+		if _, exist := c.Resources["cpu"]; !exist {
+			c.Resources["cpu"] = defaultContainerCPU
+		}
+		if _, exist := c.Resources["memory"]; !exist {
+			c.Resources["memory"] = defaultContainerMemory
+		}
+	}
+}
+
+func validatePodSpec(spec *v1.PodSpec, path string) FieldErrors {
+	var errs FieldErrors
+	switch spec.RestartPolicy {
+	case "", v1.RestartPolicyAlways, v1.RestartPolicyOnFailure, v1.RestartPolicyNever:
+	default:
+		errs = append(errs, FieldError{path + ".restartPolicy", "unsupported value " + strconv.Quote(string(spec.RestartPolicy)) +
+			", must be one of Always, OnFailure, Never"})
+	}
+	if len(spec.Containers) == 0 {
+		errs = append(errs, FieldError{path + ".containers", "at least one container is required"})
+	}
+	for i, c := range spec.Containers {
+		field := fmt.Sprintf("%s.containers[%d]", path, i)
+		if c == nil {
+			errs = append(errs, FieldError{field, "must not be null"})
+			continue
+		}
+		if c.Image == "" {
+			errs = append(errs, FieldError{field + ".image", "must not be empty"})
+		}
+		switch c.ImagePullPolicy {
+		case "", v1.AlwaysImagePullPolicy, v1.IfNotPresentImagePullPolicy, v1.NeverPullPolicy:
+		default:
+			errs = append(errs, FieldError{field + ".imagepullpolicy", "unsupported value " + strconv.Quote(c.ImagePullPolicy) +
+				", must be one of Always, IfNotPresent, Never"})
+		}
+		if cpu, exist := c.Resources["cpu"]; exist {
+			if num, err := strconv.Atoi(cpu); err != nil || num <= 0 {
+				errs = append(errs, FieldError{field + ".resources.cpu", "must be a positive integer"})
+			}
+		}
+		if mem, exist := c.Resources["memory"]; exist {
+			if _, err := bytesize.Parse(mem); err != nil {
+				errs = append(errs, FieldError{field + ".resources.memory", "invalid size " + strconv.Quote(mem)})
+			}
+		}
+	}
+	for i, port := range spec.ExposedPorts {
+		errs = append(errs, validateContainerPort(fmt.Sprintf("%s.exposedports[%d]", path, i), port)...)
+	}
+	for port, hostAddr := range spec.BindPorts {
+		field := path + ".bindports[" + port + "]"
+		errs = append(errs, validateContainerPort(field, port)...)
+		host, hostPort, err := net.SplitHostPort(hostAddr)
+		if err != nil || (host != "" && net.ParseIP(host) == nil) {
+			errs = append(errs, FieldError{field, "invalid host address " + strconv.Quote(hostAddr) + ", must be <ip>:<port>"})
+			continue
+		}
+		num, _ := strconv.Atoi(hostPort)
+		errs = append(errs, validatePort(field, num)...)
+	}
+	return errs
+}
+
+// validateContainerPort checks a port of the form <port>[/<protocol>], e.g. 80/tcp
+func validateContainerPort(field, port string) FieldErrors {
+	num, proto, _ := strings.Cut(port, "/")
+	switch proto {
+	case "", "tcp", "udp", "sctp":
+	default:
+		return FieldErrors{{field, "unsupported protocol " + strconv.Quote(proto) + ", must be one of tcp, udp, sctp"}}
+	}
+	n, err := strconv.Atoi(num)
+	if err != nil {
+		return FieldErrors{{field, "invalid port " + strconv.Quote(port)}}
+	}
+	return validatePort(field, n)
+}
+
+func validatePort(field string, port int) FieldErrors {
+	if port < 1 || port > 65535 {
+		return FieldErrors{{field, "must be between 1 and 65535, inclusive"}}
+	}
+	return nil
+}
+
+func validateHorizontalPodAutoscaler(obj v1.Object) FieldErrors {
+	hpa := obj.(*v1.HorizontalPodAutoscaler)
+	var errs FieldErrors
+	if hpa.Spec.ScaleTargetRef.Name == "" {
+		errs = append(errs, FieldError{"spec.scaleTargetRef.name", "must not be empty"})
+	}
+	if hpa.Spec.MinReplicas < 1 {
+		errs = append(errs, FieldError{"spec.minReplicas", "must be greater than or equal to 1"})
+	}
+	if hpa.Spec.MaxReplicas < hpa.Spec.MinReplicas {
+		errs = append(errs, FieldError{"spec.maxReplicas", "must be greater than or equal to minReplicas"})
+	}
+	for i, metric := range hpa.Spec.Metrics {
+		field := fmt.Sprintf("spec.metrics[%d]", i)
+		if metric.Type != v1.ResourceMetricSourceType {
+			errs = append(errs, FieldError{field + ".type", "unsupported value " + strconv.Quote(string(metric.Type)) + ", must be Resource"})
+		}
+		switch metric.Resource.Name {
+		case "cpu", "memory":
+		default:
+			errs = append(errs, FieldError{field + ".resource.name", "unsupported value " + strconv.Quote(metric.Resource.Name) +
+				", must be one of cpu, memory"})
+		}
+		if metric.Resource.Target.Type != v1.UtilizationMetricType {
+			errs = append(errs, FieldError{field + ".resource.target.type", "unsupported value " +
+				strconv.Quote(string(metric.Resource.Target.Type)) + ", must be Utilization"})
+		} else if metric.Resource.Target.AverageUtilization <= 0 {
+			errs = append(errs, FieldError{field + ".resource.target.averageUtilization", "must be greater than 0"})
+		}
+	}
+	if behavior := hpa.Spec.Behavior; behavior != nil {
+		errs = append(errs, validateScalingRules("spec.behavior.scaleUp", behavior.ScaleUp)...)
+		errs = append(errs, validateScalingRules("spec.behavior.scaleDown", behavior.ScaleDown)...)
+	}
+	return errs
+}
+
+func validateScalingRules(path string, rules *v1.HPAScalingRules) FieldErrors {
+	if rules == nil {
+		return nil
+	}
+	var errs FieldErrors
+	if rules.StabilizationWindowSeconds < 0 || rules.StabilizationWindowSeconds > 3600 {
+		errs = append(errs, FieldError{path + ".stabilizationWindowSeconds", "must be between 0 and 3600, inclusive"})
+	}
+	switch rules.SelectPolicy {
+	case "", v1.MaxChangePolicySelect, v1.MinChangePolicySelect, v1.DisabledPolicySelect:
+	default:
+		errs = append(errs, FieldError{path + ".selectPolicy", "unsupported value " + strconv.Quote(string(rules.SelectPolicy)) +
+			", must be one of Max, Min, Disabled"})
+	}
+	for i, policy := range rules.Policies {
+		field := fmt.Sprintf("%s.policies[%d]", path, i)
+		if policy.Type != v1.PodsScalingPolicy && policy.Type != v1.PercentScalingPolicy {
+			errs = append(errs, FieldError{field + ".type", "unsupported value " + strconv.Quote(string(policy.Type)) +
+				", must be one of Pods, Percent"})
+		}
+		if policy.Value <= 0 {
+			errs = append(errs, FieldError{field + ".value", "must be greater than 0"})
+		}
+		if policy.PeriodSeconds <= 0 || policy.PeriodSeconds > 1800 {
+			errs = append(errs, FieldError{field + ".periodSeconds", "must be between 1 and 1800, inclusive"})
+		}
+	}
+	return errs
+}
+
+func validateService(obj v1.Object) FieldErrors {
+	svc := obj.(*v1.Service)
+	var errs FieldErrors
+	if svc.Spec.ClusterIP != "" && net.ParseIP(svc.Spec.ClusterIP).To4() == nil {
+		errs = append(errs, FieldError{"spec.clusterIP", "invalid IPv4 address " + strconv.Quote(svc.Spec.ClusterIP)})
+	}
+	for i, port := range svc.Spec.Ports {
+		field := fmt.Sprintf("spec.ports[%d]", i)
+		switch strings.ToUpper(port.Protocol) {
+		case "", "TCP", "UDP":
+		default:
+			errs = append(errs, FieldError{field + ".protocol", "unsupported value " + strconv.Quote(port.Protocol) + ", must be one of TCP, UDP"})
+		}
+		errs = append(errs, validatePort(field+".port", int(port.Port))...)
+		if port.TargetPort != 0 {
+			errs = append(errs, validatePort(field+".targetPort", int(port.TargetPort))...)
+		}
+		if port.NodePort != 0 {
+			errs = append(errs, validatePort(field+".nodePort", int(port.NodePort))...)
+		}
+	}
+	return errs
+}
+
+// validateClusterIPUnique rejects a service whose cluster ip is taken by another service
+func validateClusterIPUnique(obj v1.Object) FieldErrors {
+	svc := obj.(*v1.Service)
+	if svc.Spec.ClusterIP == "" {
+		return nil
+	}
+	kvs, _, err := storeList(resourcesByKind["Service"].prefix(""))
+	if err != nil {
+		return nil
+	}
+	for _, kv := range kvs {
+		other := v1.Service{}
+		if unmarshalErr := json.Unmarshal(kv.Value, &other); unmarshalErr != nil ||
+			(other.Name == svc.Name && v1.SameNamespace(&other.ObjectMeta, &svc.ObjectMeta)) {
+			continue
+		}
+		if other.Spec.ClusterIP == svc.Spec.ClusterIP {
+			return FieldErrors{{"spec.clusterIP", "cluster ip " + svc.Spec.ClusterIP + " is already allocated to service " +
+				v1.NamespaceOf(&other.ObjectMeta) + "/" + other.Name}}
+		}
+	}
+	return nil
+}
+
+// restrictNode labels a node registered by a kubelet with its name, which is what the
+// Node authorizer checks the later requests of the kubelet against
+func restrictNode(user UserInfo, obj v1.Object) FieldErrors {
+	nodeName, isNode := nodeNameOf(user)
+	if !isNode {
+		return nil
+	}
+	meta := obj.GetObjectMeta()
+	if host, exist := meta.Labels[v1.LabelHostname]; exist && host != nodeName {
+		return FieldErrors{{"metadata.labels[" + v1.LabelHostname + "]", "a node may not label itself as another node " + host}}
+	}
+	if meta.Labels == nil {
+		meta.Labels = map[string]string{}
+	}
+	meta.Labels[v1.LabelHostname] = nodeName
+	return nil
+}
+
+func validateRules(obj v1.Object) FieldErrors {
+	var rules []v1.PolicyRule
+	switch role := obj.(type) {
+	case *v1.Role:
+		rules = role.Rules
+	case *v1.ClusterRole:
+		rules = role.Rules
+	}
+	_, isRole := obj.(*v1.Role)
+	var errs FieldErrors
+	for i, rule := range rules {
+		field := fmt.Sprintf("rules[%d]", i)
+		if len(rule.Verbs) == 0 {
+			errs = append(errs, FieldError{field + ".verbs", "must not be empty"})
+		}
+		if len(rule.Resources) == 0 && len(rule.NonResourceURLs) == 0 {
+			errs = append(errs, FieldError{field, "either resources or nonResourceURLs must be set"})
+		}
+		if isRole && len(rule.NonResourceURLs) != 0 {
+			errs = append(errs, FieldError{field + ".nonResourceURLs", "only a ClusterRole may have them"})
+		}
+	}
+	return errs
+}
+
+// validateBinding checks the subjects and that the role referred to is of one of the kinds
+func validateBinding(subjects []v1.Subject, ref v1.RoleRef, kinds ...string) FieldErrors {
+	var errs FieldErrors
+	for i, subject := range subjects {
+		field := fmt.Sprintf("subjects[%d]", i)
+		if subject.Kind != v1.UserKind && subject.Kind != v1.GroupKind {
+			errs = append(errs, FieldError{field + ".kind", "must be one of User, Group"})
+		}
+		if subject.Name == "" {
+			errs = append(errs, FieldError{field + ".name", "must not be empty"})
+		}
+	}
+	valid := false
+	for _, kind := range kinds {
+		valid = valid || ref.Kind == kind
+	}
+	if !valid {
+		errs = append(errs, FieldError{"roleRef.kind", "must be one of " + strings.Join(kinds, ", ")})
+	}
+	if ref.Name == "" {
+		errs = append(errs, FieldError{"roleRef.name", "must not be empty"})
+	}
+	return errs
+}
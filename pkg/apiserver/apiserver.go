@@ -1,27 +1,41 @@
 package apiserver
 
-import "minik8s.com/minik8s/utils/random"
+import (
+	"k8s.io/klog"
+	"minik8s.com/minik8s/utils/random"
+)
 
-func Run() {
+func Run(opts Options) {
 	random.Init()
-	initEtcd()
-	defer closeEtcd()
-	runHttpServer()
+	if err := initStorage(opts); err != nil {
+		klog.Fatalf("create storage failed, err: %v", err)
+	}
+	defer closeStorage()
+	watchCacheSize = opts.WatchCacheSize
+	blobDir, maxBlobSize, blobQuota = opts.BlobDir, opts.MaxBlobSize, opts.BlobQuota
+	ensureDefaultNamespace()
+	ensureBootstrapPolicy()
+	go runCompaction(opts.CompactionInterval)
+	go runDefragmentation(opts.DefragInterval)
+	go runBlobSweep()
+	go syncCustomResources()
+	go resumeTerminations()
+	runHttpServer(opts)
 }
 
 //------------------------ API SERVER TEST -----------------------------
 
 //
 //func TestEtcd() {
-//	initEtcd()
-//	defer closeEtcd()
-//	wch := etcdWatch("hello")
+//	initStorage(opts)
+//	defer closeStorage()
+//	wch := storeWatch("hello")
 //	go handleWatchResult(wch)
-//	etcdPut("hello", "world")
-//	etcdPut("hello1", "world1")
-//	etcdPut("hello2", "world2")
-//	etcdPut("hello3", "world3")
-//	etcdGetPrefix("hello")
+//	storePut("hello", "world")
+//	storePut("hello1", "world1")
+//	storePut("hello2", "world2")
+//	storePut("hello3", "world3")
+//	storeGetPrefix("hello")
 //}
 //
 //func handleWatchResult(wch chan KV) {
@@ -31,5 +45,5 @@ func Run() {
 //}
 //
 //func TestHttp() {
-//	runHttpServer()
+//	runHttpServer(opts)
 //}
@@ -0,0 +1,419 @@
+/*
+	server-side apply与dry run：apply提交完整的配置，与存储中的对象合并，
+	managedFields记录每个manager拥有的字段，apply把别的manager拥有的字段设成不同的值时报告冲突
+*/
+package apiserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"io"
+	v1 "minik8s.com/minik8s/pkg/api/v1"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// applyPatchType is the Content-Type of a PATCH applying a configuration
+const applyPatchType = "application/apply-patch+json"
+
+// dryRunAll is the only value of ?dryRun=, the request goes through admission and
+// validation but nothing is stored
+const dryRunAll = "All"
+
+// writeOptions are the options of a write shared by its handlers
+type writeOptions struct {
+	dryRun bool
+	// manager is given the fields the write changes, empty if the write sets the managed
+	// fields itself
+	manager string
+}
+
+// dryRunOf parses ?dryRun=, it replies 400 and returns false if the value is unknown
+func dryRunOf(c *gin.Context) (bool, bool) {
+	values, exist := c.GetQueryArray("dryRun")
+	if !exist {
+		return false, true
+	}
+	for _, value := range values {
+		if value != dryRunAll {
+			c.JSON(400, gin.H{"status": "ERR", "error": "unsupported dryRun " + strconv.Quote(value) + ", want " + dryRunAll})
+			return false, false
+		}
+	}
+	return true, true
+}
+
+// fieldManagerOf returns the manager of the fields a write changes, ?fieldManager= or
+// the user sending it
+func fieldManagerOf(c *gin.Context) string {
+	if manager := c.Query("fieldManager"); manager != "" {
+		return manager
+	}
+	return userOf(c).Name
+}
+
+// replyDryRun replies the object as it would have been stored
+func replyDryRun(c *gin.Context, obj v1.Object) {
+	meta := obj.GetObjectMeta()
+	c.JSON(200, gin.H{"status": "OK", "id": meta.Name, "uid": meta.UID, "dryRun": true, "object": obj})
+}
+
+// apply merges the configuration in the body into the object, which is created if it does
+// not exist. ?fieldManager= names the manager applying it and ?force=true takes over the
+// conflicting fields from the other managers.
+func (res *Resource) apply(c *gin.Context, dryRun bool) {
+	manager := c.Query("fieldManager")
+	if manager == "" {
+		c.JSON(400, gin.H{"status": "ERR", "error": "fieldManager is required to apply"})
+		return
+	}
+	force := c.Query("force") == "true"
+	buf, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(500, gin.H{"status": "ERR", "error": err.Error()})
+		return
+	}
+	var config map[string]any
+	if err = decodeJSON(buf, &config); err != nil || config == nil {
+		c.JSON(400, gin.H{"status": "ERR", "error": "the configuration is not a json object"})
+		return
+	}
+	if kind, _ := config["kind"].(string); kind != "" && kind != res.Kind {
+		c.JSON(400, gin.H{"status": "ERR", "error": "the configuration is a " + kind + ", not a " + res.Kind})
+		return
+	}
+	name := c.Param("name")
+	namespace := res.namespace(c)
+	meta, _ := config["metadata"].(map[string]any)
+	if configName, _ := meta["name"].(string); configName != name {
+		c.JSON(400, gin.H{"status": "ERR", "error": "metadata.name of the configuration must be " + strconv.Quote(name)})
+		return
+	}
+	if configNamespace, _ := meta["namespace"].(string); res.Namespaced && configNamespace != "" && configNamespace != namespace {
+		c.JSON(400, gin.H{"status": "ERR", "error": "metadata.namespace of the configuration must be " + strconv.Quote(namespace)})
+		return
+	}
+	// the status is written by the controllers through its subresource
+	if res.CopyStatus != nil {
+		delete(config, "status")
+	}
+
+	if !storeTest(res.key(namespace, name)) {
+		if ok, msg := authorizedTo(c, v1.VerbCreate); !ok {
+			c.JSON(403, gin.H{"status": "ERR", "reason": "Forbidden", "error": msg})
+			return
+		}
+		obj := res.New()
+		buf, _ = json.Marshal(config)
+		if err = json.Unmarshal(buf, obj); err != nil {
+			c.JSON(422, gin.H{"status": "ERR", "error": "the configuration is invalid: " + err.Error()})
+			return
+		}
+		now := time.Now()
+		obj.GetObjectMeta().ManagedFields = []v1.ManagedFieldsEntry{{
+			Manager:   manager,
+			Operation: v1.ManagedFieldsOperationApply,
+			Time:      &now,
+			FieldsV1:  fieldsOf(config, false),
+		}}
+		res.create(c, obj, dryRun)
+		return
+	}
+
+	res.updateObject(c, writeOptions{dryRun: dryRun}, func(stored v1.Object, cur KV) (v1.Object, bool) {
+		var live map[string]any
+		if err := decodeJSON(cur.Value, &live); err != nil {
+			c.JSON(500, gin.H{"status": "ERR", "error": err.Error()})
+			return nil, false
+		}
+		entries, conflicts := applyConfig(live, config, stored.GetObjectMeta().ManagedFields, manager, force)
+		if len(conflicts) != 0 {
+			replyConflicts(c, conflicts)
+			return nil, false
+		}
+		merged, _ := json.Marshal(live)
+		obj := res.New()
+		if err := json.Unmarshal(merged, obj); err != nil {
+			c.JSON(422, gin.H{"status": "ERR", "error": "the applied object is invalid: " + err.Error()})
+			return nil, false
+		}
+		meta := obj.GetObjectMeta()
+		meta.ManagedFields = entries
+		meta.ResourceVersion = ""
+		return res.withStatus(obj, stored, false), true
+	})
+}
+
+// fieldConflict is a field applied with a value other than the one set by its manager
+type fieldConflict struct {
+	Field   string `json:"field"`
+	Manager string `json:"manager"`
+}
+
+func replyConflicts(c *gin.Context, conflicts []fieldConflict) {
+	var msgs []string
+	for _, conflict := range conflicts {
+		msgs = append(msgs, fmt.Sprintf("%s (owned by %q)", conflict.Field, conflict.Manager))
+	}
+	c.JSON(409, gin.H{"status": "ERR", "reason": "Conflict", "details": conflicts,
+		"error": "apply failed with conflicts: " + strings.Join(msgs, ", ") + ", apply again with force=true to take them over"})
+}
+
+// applyConfig merges the configuration applied by the manager into the live document, and
+// returns the managed fields afterwards. The fields the manager applied last time but
+// left out of the configuration are removed unless another manager owns them. Setting a
+// field owned by another manager to another value is a conflict, which is returned
+// unless force is set, then the field is taken over.
+func applyConfig(live, config map[string]any, entries []v1.ManagedFieldsEntry, manager string, force bool) ([]v1.ManagedFieldsEntry, []fieldConflict) {
+	var conflicts []fieldConflict
+	walkFields(config, func(path []string, value any) {
+		if cur, exist := valueAt(live, path); exist && sameValue(cur, value) {
+			return
+		}
+		for i := range entries {
+			entry := &entries[i]
+			if entry.Manager != manager && entry.FieldsV1.Overlaps(path) {
+				conflicts = append(conflicts, fieldConflict{Field: strings.Join(path, "."), Manager: entry.Manager})
+				if force {
+					entry.FieldsV1.Remove(path)
+				}
+			}
+		}
+	})
+	if len(conflicts) != 0 && !force {
+		return nil, conflicts
+	}
+
+	applied := fieldsOf(config, false)
+	own := -1
+	for i, entry := range entries {
+		if entry.Manager == manager && entry.Operation == v1.ManagedFieldsOperationApply {
+			own = i
+		}
+	}
+	if own >= 0 {
+		entries[own].FieldsV1.Leaves(func(path []string) {
+			if applied.Overlaps(path) {
+				return
+			}
+			for i, entry := range entries {
+				if i != own && entry.FieldsV1.Overlaps(path) {
+					return
+				}
+			}
+			removeAt(live, path)
+		})
+	}
+	walkFields(config, func(path []string, value any) {
+		setAt(live, path, value)
+	})
+
+	now := time.Now()
+	if own >= 0 {
+		entries[own].FieldsV1 = applied
+		entries[own].Time = &now
+	} else {
+		entries = append(entries, v1.ManagedFieldsEntry{
+			Manager:   manager,
+			Operation: v1.ManagedFieldsOperationApply,
+			Time:      &now,
+			FieldsV1:  applied,
+		})
+	}
+	return pruneManagedFields(entries), nil
+}
+
+// trackUpdate gives the manager of a write the fields it changed from the document before
+// to the one after, and takes them from the other managers. The fields removed are no
+// longer owned by anyone. It returns the managed fields after the write.
+func trackUpdate(entries []v1.ManagedFieldsEntry, before, after []byte, manager string) []v1.ManagedFieldsEntry {
+	var old, cur map[string]any
+	if decodeJSON(before, &old) != nil || decodeJSON(after, &cur) != nil {
+		return entries
+	}
+	changed := v1.FieldSet{}
+	walkFields(cur, func(path []string, value any) {
+		if prev, exist := valueAt(old, path); !exist || !sameValue(prev, value) {
+			changed.Insert(path)
+		}
+	})
+	var removed [][]string
+	walkFields(old, func(path []string, _ any) {
+		if _, exist := valueAt(cur, path); !exist {
+			removed = append(removed, path)
+		}
+	})
+	if len(changed) == 0 && len(removed) == 0 {
+		return entries
+	}
+
+	now := time.Now()
+	found := false
+	for i := range entries {
+		entry := &entries[i]
+		for _, path := range removed {
+			entry.FieldsV1.Remove(path)
+		}
+		if entry.Manager == manager && entry.Operation == v1.ManagedFieldsOperationUpdate {
+			found = true
+			if entry.FieldsV1 == nil {
+				entry.FieldsV1 = v1.FieldSet{}
+			}
+			changed.Leaves(entry.FieldsV1.Insert)
+			entry.Time = &now
+		} else {
+			changed.Leaves(entry.FieldsV1.Remove)
+		}
+	}
+	if !found && len(changed) != 0 {
+		entries = append(entries, v1.ManagedFieldsEntry{
+			Manager:   manager,
+			Operation: v1.ManagedFieldsOperationUpdate,
+			Time:      &now,
+			FieldsV1:  changed,
+		})
+	}
+	return pruneManagedFields(entries)
+}
+
+// createdFields returns the managed fields of an object created by a POST, the manager
+// owns the fields it has set
+func createdFields(obj v1.Object, manager string) []v1.ManagedFieldsEntry {
+	buf, _ := json.Marshal(obj)
+	var doc map[string]any
+	if decodeJSON(buf, &doc) != nil {
+		return nil
+	}
+	fields := fieldsOf(doc, true)
+	if len(fields) == 0 {
+		return nil
+	}
+	now := time.Now()
+	return []v1.ManagedFieldsEntry{{Manager: manager, Operation: v1.ManagedFieldsOperationUpdate, Time: &now, FieldsV1: fields}}
+}
+
+// pruneManagedFields drops the entries left without fields
+func pruneManagedFields(entries []v1.ManagedFieldsEntry) []v1.ManagedFieldsEntry {
+	var pruned []v1.ManagedFieldsEntry
+	for _, entry := range entries {
+		if len(entry.FieldsV1) != 0 {
+			pruned = append(pruned, entry)
+		}
+	}
+	return pruned
+}
+
+// fieldsOf returns the fields of the document, without the zero ones if skipZero is set
+func fieldsOf(doc map[string]any, skipZero bool) v1.FieldSet {
+	fields := v1.FieldSet{}
+	walkFields(doc, func(path []string, value any) {
+		if !skipZero || !isZero(value) {
+			fields.Insert(path)
+		}
+	})
+	return fields
+}
+
+// walkFields calls fn with the path and the value of every field a manager may own, in
+// order. Those are the leaves of the document but its kind, apiversion and metadata, of
+// which only the labels are owned.
+func walkFields(doc map[string]any, fn func(path []string, value any)) {
+	for _, name := range sortedFields(doc) {
+		switch name {
+		case "kind", "apiversion":
+		case "metadata":
+			meta, _ := doc[name].(map[string]any)
+			if labels, exist := meta["labels"]; exist {
+				walkValue([]string{"metadata", "labels"}, labels, fn)
+			}
+		default:
+			walkValue([]string{name}, doc[name], fn)
+		}
+	}
+}
+
+func walkValue(path []string, value any, fn func(path []string, value any)) {
+	obj, ok := value.(map[string]any)
+	if !ok || len(obj) == 0 {
+		fn(path, value)
+		return
+	}
+	for _, name := range sortedFields(obj) {
+		walkValue(append(path[:len(path):len(path)], name), obj[name], fn)
+	}
+}
+
+func sortedFields(obj map[string]any) []string {
+	keys := make([]string, 0, len(obj))
+	for key := range obj {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func valueAt(doc map[string]any, path []string) (any, bool) {
+	var cur any = doc
+	for _, name := range path {
+		obj, ok := cur.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if cur, ok = obj[name]; !ok {
+			return nil, false
+		}
+	}
+	return cur, true
+}
+
+// setAt sets the field at the path, creating the objects holding it
+func setAt(doc map[string]any, path []string, value any) {
+	for _, name := range path[:len(path)-1] {
+		child, ok := doc[name].(map[string]any)
+		if !ok {
+			child = map[string]any{}
+			doc[name] = child
+		}
+		doc = child
+	}
+	doc[path[len(path)-1]] = value
+}
+
+func removeAt(doc map[string]any, path []string) {
+	for _, name := range path[:len(path)-1] {
+		child, ok := doc[name].(map[string]any)
+		if !ok {
+			return
+		}
+		doc = child
+	}
+	delete(doc, path[len(path)-1])
+}
+
+func sameValue(a, b any) bool {
+	return reflect.DeepEqual(normalize(a), normalize(b))
+}
+
+// isZero tells whether the json value is the zero value of its type
+func isZero(value any) bool {
+	switch value := value.(type) {
+	case nil:
+		return true
+	case string:
+		return value == ""
+	case bool:
+		return !value
+	case json.Number:
+		f, err := value.Float64()
+		return err == nil && f == 0
+	case []any:
+		return len(value) == 0
+	case map[string]any:
+		return len(value) == 0
+	}
+	return false
+}
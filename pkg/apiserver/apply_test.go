@@ -0,0 +1,241 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	v1 "minik8s.com/minik8s/pkg/api/v1"
+)
+
+// managed returns an entry of the manager owning the dotted fields
+func managed(manager, operation string, fields ...string) v1.ManagedFieldsEntry {
+	set := v1.FieldSet{}
+	for _, field := range fields {
+		set.Insert(strings.Split(field, "."))
+	}
+	return v1.ManagedFieldsEntry{Manager: manager, Operation: operation, FieldsV1: set}
+}
+
+// ownedFields returns the sorted dotted fields of every entry by manager and operation
+func ownedFields(entries []v1.ManagedFieldsEntry) map[string][]string {
+	owned := map[string][]string{}
+	for _, entry := range entries {
+		var fields []string
+		entry.FieldsV1.Leaves(func(path []string) {
+			fields = append(fields, strings.Join(path, "."))
+		})
+		sort.Strings(fields)
+		owned[entry.Manager+"/"+entry.Operation] = fields
+	}
+	return owned
+}
+
+func TestApplyConfig(t *testing.T) {
+	const apply, update = v1.ManagedFieldsOperationApply, v1.ManagedFieldsOperationUpdate
+	tests := []struct {
+		name    string
+		live    string
+		config  string
+		entries []v1.ManagedFieldsEntry
+		force   bool
+		// the manager applying is always "a"
+		want          string
+		wantOwned     map[string][]string
+		wantConflicts []fieldConflict
+	}{
+		{name: "first apply",
+			live: `{"spec":{"x":1}}`, config: `{"spec":{"y":2}}`,
+			want:      `{"spec":{"x":1,"y":2}}`,
+			wantOwned: map[string][]string{"a/Apply": {"spec.y"}}},
+		{name: "same value as another manager",
+			live: `{"spec":{"x":1}}`, config: `{"spec":{"x":1}}`,
+			entries:   []v1.ManagedFieldsEntry{managed("b", apply, "spec.x")},
+			want:      `{"spec":{"x":1}}`,
+			wantOwned: map[string][]string{"a/Apply": {"spec.x"}, "b/Apply": {"spec.x"}}},
+		{name: "conflict with an apply",
+			live: `{"spec":{"x":1}}`, config: `{"spec":{"x":2}}`,
+			entries:       []v1.ManagedFieldsEntry{managed("b", apply, "spec.x")},
+			want:          `{"spec":{"x":1}}`,
+			wantConflicts: []fieldConflict{{Field: "spec.x", Manager: "b"}}},
+		{name: "conflict with an update of a field holding it",
+			live: `{"spec":{"x":{"y":1}}}`, config: `{"spec":{"x":{"y":2}}}`,
+			entries:       []v1.ManagedFieldsEntry{managed("b", update, "spec.x")},
+			want:          `{"spec":{"x":{"y":1}}}`,
+			wantConflicts: []fieldConflict{{Field: "spec.x.y", Manager: "b"}}},
+		{name: "forced over the conflict",
+			live: `{"spec":{"x":1,"y":1}}`, config: `{"spec":{"x":2}}`, force: true,
+			entries:   []v1.ManagedFieldsEntry{managed("b", apply, "spec.x", "spec.y")},
+			want:      `{"spec":{"x":2,"y":1}}`,
+			wantOwned: map[string][]string{"a/Apply": {"spec.x"}, "b/Apply": {"spec.y"}}},
+		{name: "forced takes the only field",
+			live: `{"spec":{"x":1}}`, config: `{"spec":{"x":2}}`, force: true,
+			entries:   []v1.ManagedFieldsEntry{managed("b", update, "spec.x")},
+			want:      `{"spec":{"x":2}}`,
+			wantOwned: map[string][]string{"a/Apply": {"spec.x"}}},
+		{name: "a field applied before and omitted is removed",
+			live: `{"spec":{"x":1,"y":1}}`, config: `{"spec":{"x":1}}`,
+			entries:   []v1.ManagedFieldsEntry{managed("a", apply, "spec.x", "spec.y")},
+			want:      `{"spec":{"x":1}}`,
+			wantOwned: map[string][]string{"a/Apply": {"spec.x"}}},
+		{name: "an omitted field another manager owns is kept",
+			live: `{"spec":{"x":1,"y":1}}`, config: `{"spec":{"x":1}}`,
+			entries: []v1.ManagedFieldsEntry{
+				managed("a", apply, "spec.x", "spec.y"),
+				managed("b", update, "spec.y"),
+			},
+			want:      `{"spec":{"x":1,"y":1}}`,
+			wantOwned: map[string][]string{"a/Apply": {"spec.x"}, "b/Update": {"spec.y"}}},
+		{name: "only the labels of the metadata are owned",
+			live:      `{"kind":"Pod","metadata":{"name":"p"}}`,
+			config:    `{"kind":"Pod","metadata":{"name":"p","labels":{"app":"web"}}}`,
+			want:      `{"kind":"Pod","metadata":{"name":"p","labels":{"app":"web"}}}`,
+			wantOwned: map[string][]string{"a/Apply": {"metadata.labels.app"}}},
+		{name: "a label owned by another manager",
+			live: `{"metadata":{"labels":{"app":"web"}}}`, config: `{"metadata":{"labels":{"app":"db"}}}`,
+			entries:       []v1.ManagedFieldsEntry{managed("b", update, "metadata.labels.app")},
+			want:          `{"metadata":{"labels":{"app":"web"}}}`,
+			wantConflicts: []fieldConflict{{Field: "metadata.labels.app", Manager: "b"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var live, config, want map[string]any
+			if err := decodeJSON([]byte(tt.live), &live); err != nil {
+				t.Fatal(err)
+			}
+			if err := decodeJSON([]byte(tt.config), &config); err != nil {
+				t.Fatal(err)
+			}
+			if err := decodeJSON([]byte(tt.want), &want); err != nil {
+				t.Fatal(err)
+			}
+			entries, conflicts := applyConfig(live, config, tt.entries, "a", tt.force)
+			if !reflect.DeepEqual(conflicts, tt.wantConflicts) {
+				t.Errorf("conflicts = %+v, want %+v", conflicts, tt.wantConflicts)
+			}
+			if tt.wantConflicts != nil {
+				if entries != nil {
+					t.Errorf("entries = %+v after a conflict, want none", entries)
+				}
+				return
+			}
+			if got := ownedFields(entries); !reflect.DeepEqual(got, tt.wantOwned) {
+				t.Errorf("owned = %v, want %v", got, tt.wantOwned)
+			}
+			if !reflect.DeepEqual(live, want) {
+				got, _ := json.Marshal(live)
+				t.Errorf("applied = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// podConfig returns the configuration of the pod a with the labels, its container has the
+// defaults already so that applying it again does not change the containers
+func podConfig(labels string) string {
+	meta := `{"name":"a"}`
+	if labels != "" {
+		meta = `{"name":"a","labels":{` + labels + `}}`
+	}
+	return `{"kind":"Pod","metadata":` + meta + `,"spec":{"containers":[` +
+		`{"name":"c","image":"busybox","imagepullpolicy":"IfNotPresent","resources":{"cpu":"4","memory":"512MB"}}]}}`
+}
+
+func TestApplyRequests(t *testing.T) {
+	// the steps run in order against the same server
+	steps := []struct {
+		name        string
+		method      string
+		path        string
+		contentType string
+		body        string
+		wantCode    int
+		wantBody    string
+		wantLabels  map[string]string
+		// wantOwners are the managers owning the labels afterwards
+		wantOwners map[string][]string
+	}{
+		{name: "without a field manager", method: http.MethodPatch, path: "/pod/a", contentType: applyPatchType,
+			body: podConfig(`"app":"web"`), wantCode: 400, wantBody: "fieldManager"},
+		{name: "of another name", method: http.MethodPatch, path: "/pod/b?fieldManager=m1", contentType: applyPatchType,
+			body: podConfig(`"app":"web"`), wantCode: 400, wantBody: "metadata.name"},
+		{name: "apply creates", method: http.MethodPatch, path: "/pod/a?fieldManager=m1", contentType: applyPatchType,
+			body: podConfig(`"app":"web"`), wantCode: 200,
+			wantLabels: map[string]string{"app": "web"},
+			wantOwners: map[string][]string{"app": {"m1"}}},
+		{name: "apply again", method: http.MethodPatch, path: "/pod/a?fieldManager=m1", contentType: applyPatchType,
+			body: podConfig(`"app":"web"`), wantCode: 200,
+			wantLabels: map[string]string{"app": "web"},
+			wantOwners: map[string][]string{"app": {"m1"}}},
+		{name: "conflict", method: http.MethodPatch, path: "/pod/a?fieldManager=m2", contentType: applyPatchType,
+			body: podConfig(`"app":"db"`), wantCode: 409, wantBody: `{"field":"metadata.labels.app","manager":"m1"}`,
+			wantLabels: map[string]string{"app": "web"},
+			wantOwners: map[string][]string{"app": {"m1"}}},
+		{name: "dry run of a forced apply", method: http.MethodPatch, path: "/pod/a?fieldManager=m2&force=true&dryRun=All", contentType: applyPatchType,
+			body: podConfig(`"app":"db"`), wantCode: 200, wantBody: `"dryRun":true`,
+			wantLabels: map[string]string{"app": "web"},
+			wantOwners: map[string][]string{"app": {"m1"}}},
+		{name: "forced apply", method: http.MethodPatch, path: "/pod/a?fieldManager=m2&force=true", contentType: applyPatchType,
+			body: podConfig(`"app":"db"`), wantCode: 200,
+			wantLabels: map[string]string{"app": "db"},
+			wantOwners: map[string][]string{"app": {"m2"}}},
+		{name: "omitting a field taken over keeps it", method: http.MethodPatch, path: "/pod/a?fieldManager=m1", contentType: applyPatchType,
+			body: podConfig(``), wantCode: 200,
+			wantLabels: map[string]string{"app": "db"},
+			wantOwners: map[string][]string{"app": {"m2"}}},
+		{name: "update by a merge patch", method: http.MethodPatch, path: "/pod/a?fieldManager=editor", contentType: mergePatchType,
+			body: `{"metadata":{"labels":{"tier":"front"}}}`, wantCode: 200,
+			wantLabels: map[string]string{"app": "db", "tier": "front"},
+			wantOwners: map[string][]string{"app": {"m2"}, "tier": {"editor"}}},
+		{name: "conflict with an update", method: http.MethodPatch, path: "/pod/a?fieldManager=m2", contentType: applyPatchType,
+			body: podConfig(`"app":"db","tier":"back"`), wantCode: 409, wantBody: `{"field":"metadata.labels.tier","manager":"editor"}`,
+			wantLabels: map[string]string{"app": "db", "tier": "front"},
+			wantOwners: map[string][]string{"app": {"m2"}, "tier": {"editor"}}},
+		{name: "update takes over an applied field", method: http.MethodPatch, path: "/pod/a", contentType: mergePatchType,
+			body: `{"metadata":{"labels":{"app":"cache"}}}`, wantCode: 200,
+			wantLabels: map[string]string{"app": "cache", "tier": "front"},
+			wantOwners: map[string][]string{"app": {"system:anonymous"}, "tier": {"editor"}}},
+		{name: "apply another label", method: http.MethodPatch, path: "/pod/a?fieldManager=m1", contentType: applyPatchType,
+			body: podConfig(`"role":"x"`), wantCode: 200,
+			wantLabels: map[string]string{"app": "cache", "tier": "front", "role": "x"},
+			wantOwners: map[string][]string{"app": {"system:anonymous"}, "tier": {"editor"}, "role": {"m1"}}},
+		{name: "omitting an applied label removes it", method: http.MethodPatch, path: "/pod/a?fieldManager=m1", contentType: applyPatchType,
+			body: podConfig(``), wantCode: 200,
+			wantLabels: map[string]string{"app": "cache", "tier": "front"},
+			wantOwners: map[string][]string{"app": {"system:anonymous"}, "tier": {"editor"}}},
+	}
+	r := newTestServer(t)
+	for _, step := range steps {
+		w := serve(r, step.method, step.path, step.contentType, step.body, time.Second)
+		if w.Code != step.wantCode || !strings.Contains(w.Body.String(), step.wantBody) {
+			t.Fatalf("%s: got %d %s, want %d with %s", step.name, w.Code, w.Body, step.wantCode, step.wantBody)
+		}
+		if step.wantLabels == nil {
+			continue
+		}
+		w = serve(r, http.MethodGet, "/pod/a", "", "", time.Second)
+		var kv KV
+		var pod v1.Pod
+		if err := json.Unmarshal(w.Body.Bytes(), &kv); err != nil || json.Unmarshal(kv.Value, &pod) != nil {
+			t.Fatalf("%s: %v in %s", step.name, err, w.Body)
+		}
+		if !reflect.DeepEqual(pod.Labels, step.wantLabels) {
+			t.Errorf("%s: labels = %v, want %v", step.name, pod.Labels, step.wantLabels)
+		}
+		owners := map[string][]string{}
+		for _, entry := range pod.ManagedFields {
+			for label := range pod.Labels {
+				if entry.FieldsV1.Has([]string{"metadata", "labels", label}) {
+					owners[label] = append(owners[label], entry.Manager)
+				}
+			}
+		}
+		if !reflect.DeepEqual(owners, step.wantOwners) {
+			t.Errorf("%s: owners = %v, want %v", step.name, owners, step.wantOwners)
+		}
+	}
+}
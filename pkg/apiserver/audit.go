@@ -0,0 +1,303 @@
+/*
+	audit：每个请求结束后依照audit policy决定记录的level，以JSON lines写入audit log，
+	日志超过大小上限时轮转为<path>.1 ... <path>.N
+*/
+package apiserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"io"
+	"k8s.io/klog"
+	v1 "minik8s.com/minik8s/pkg/api/v1"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// AuditLevel is how much of a request is recorded
+type AuditLevel string
+
+const (
+	// AuditLevelNone records nothing
+	AuditLevelNone AuditLevel = "None"
+	// AuditLevelMetadata records who did what to which object, and the response code
+	AuditLevelMetadata AuditLevel = "Metadata"
+	// AuditLevelRequest also records the request body
+	AuditLevelRequest AuditLevel = "Request"
+	// AuditLevelRequestResponse also records the response body
+	AuditLevelRequestResponse AuditLevel = "RequestResponse"
+)
+
+var auditLevels = map[AuditLevel]int{
+	AuditLevelNone:            0,
+	AuditLevelMetadata:        1,
+	AuditLevelRequest:         2,
+	AuditLevelRequestResponse: 3,
+}
+
+// AuditRule matches the requests with all of its non-empty fields, and records them at
+// its level
+type AuditRule struct {
+	Level AuditLevel `json:"level"`
+
+	Users      []string `json:"users,omitempty"`
+	UserGroups []string `json:"userGroups,omitempty"`
+	Verbs      []string `json:"verbs,omitempty"`
+	// Resources are the plurals of the kinds, e.g. pods or pods/status
+	Resources  []string `json:"resources,omitempty"`
+	Namespaces []string `json:"namespaces,omitempty"`
+	// NonResourceURLs may end with * to match any suffix
+	NonResourceURLs []string `json:"nonResourceURLs,omitempty"`
+}
+
+// AuditPolicy is the json file of the audit rules, the first rule matching a request
+// decides its level, and a request matching none is not recorded
+type AuditPolicy struct {
+	Rules []AuditRule `json:"rules"`
+}
+
+// defaultAuditPolicy records the metadata of every mutating request
+var defaultAuditPolicy = AuditPolicy{
+	Rules: []AuditRule{{
+		Level: AuditLevelMetadata,
+		Verbs: []string{v1.VerbCreate, v1.VerbUpdate, v1.VerbPatch, v1.VerbDelete},
+	}},
+}
+
+// AuditEvent is a record of the audit log
+type AuditEvent struct {
+	Level                    AuditLevel      `json:"level"`
+	AuditID                  string          `json:"auditID"`
+	RequestReceivedTimestamp time.Time       `json:"requestReceivedTimestamp"`
+	User                     UserInfo        `json:"user"`
+	SourceIP                 string          `json:"sourceIP"`
+	Method                   string          `json:"method"`
+	RequestURI               string          `json:"requestURI"`
+	Verb                     string          `json:"verb"`
+	Resource                 string          `json:"resource,omitempty"`
+	Subresource              string          `json:"subresource,omitempty"`
+	Namespace                string          `json:"namespace,omitempty"`
+	Name                     string          `json:"name,omitempty"`
+	ResponseCode             int             `json:"responseCode"`
+	Latency                  string          `json:"latency"`
+	RequestObject            json.RawMessage `json:"requestObject,omitempty"`
+	ResponseObject           json.RawMessage `json:"responseObject,omitempty"`
+}
+
+// auditor writes the audit events of the requests
+type auditor struct {
+	policy AuditPolicy
+	out    io.Writer
+}
+
+func newAuditor(opts Options) (*auditor, error) {
+	if opts.AuditLogPath == "" {
+		return nil, nil
+	}
+	a := &auditor{policy: defaultAuditPolicy}
+	if opts.AuditPolicyFile != "" {
+		buf, err := os.ReadFile(opts.AuditPolicyFile)
+		if err != nil {
+			return nil, err
+		}
+		a.policy = AuditPolicy{}
+		if err = json.Unmarshal(buf, &a.policy); err != nil {
+			return nil, fmt.Errorf("decode audit policy %s: %v", opts.AuditPolicyFile, err)
+		}
+		for i, rule := range a.policy.Rules {
+			if _, ok := auditLevels[rule.Level]; !ok {
+				return nil, fmt.Errorf("audit policy rules[%d]: unknown level %q", i, rule.Level)
+			}
+		}
+	}
+	if opts.AuditLogPath == "-" {
+		a.out = os.Stdout
+		return a, nil
+	}
+	out, err := newRotatingFile(opts.AuditLogPath, int64(opts.AuditLogMaxSize)<<20, opts.AuditLogMaxBackups)
+	if err != nil {
+		return nil, err
+	}
+	a.out = out
+	return a, nil
+}
+
+// levelOf returns the level of the first rule matching the request
+func (policy *AuditPolicy) levelOf(a *attributes) AuditLevel {
+	for _, rule := range policy.Rules {
+		if rule.matches(a) {
+			return rule.Level
+		}
+	}
+	return AuditLevelNone
+}
+
+func (rule *AuditRule) matches(a *attributes) bool {
+	if len(rule.Users) != 0 && !contains(rule.Users, a.user.Name, "") {
+		return false
+	}
+	if len(rule.UserGroups) != 0 {
+		matched := false
+		for _, group := range rule.UserGroups {
+			matched = matched || hasGroup(a.user, group)
+		}
+		if !matched {
+			return false
+		}
+	}
+	if len(rule.Verbs) != 0 && !contains(rule.Verbs, a.verb, v1.VerbAll) {
+		return false
+	}
+	if a.res == nil {
+		// a rule of resources does not match the other requests, and the other way round
+		return len(rule.Resources) == 0 && len(rule.Namespaces) == 0 &&
+			(len(rule.NonResourceURLs) == 0 || matchURL(rule.NonResourceURLs, a.path))
+	}
+	if len(rule.NonResourceURLs) != 0 {
+		return false
+	}
+	if len(rule.Resources) != 0 && !contains(rule.Resources, a.resource(), v1.ResourceAll) {
+		return false
+	}
+	return len(rule.Namespaces) == 0 || contains(rule.Namespaces, a.namespace, "")
+}
+
+// bodyRecorder keeps a copy of the response body
+type bodyRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *bodyRecorder) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+// audit is the middleware recording the requests, it runs before the authentication so
+// that the rejected requests are recorded as well
+func (auditor *auditor) audit(c *gin.Context) {
+	received := time.Now()
+	var reqBody []byte
+	if c.Request.Body != nil {
+		reqBody, _ = io.ReadAll(c.Request.Body)
+		c.Request.Body = io.NopCloser(bytes.NewReader(reqBody))
+	}
+	// a watch streams events rather than replying an object, which are not kept
+	recorder := &bodyRecorder{ResponseWriter: c.Writer}
+	if attributesOf(c).verb != v1.VerbWatch {
+		c.Writer = recorder
+	}
+
+	c.Next()
+
+	a := attributesOf(c)
+	level := auditor.policy.levelOf(a)
+	if level == AuditLevelNone {
+		return
+	}
+	event := AuditEvent{
+		Level:                    level,
+		AuditID:                  uuid.NewString(),
+		RequestReceivedTimestamp: received,
+		User:                     a.user,
+		SourceIP:                 c.ClientIP(),
+		Method:                   c.Request.Method,
+		RequestURI:               c.Request.RequestURI,
+		Verb:                     a.verb,
+		Namespace:                a.namespace,
+		Name:                     a.name,
+		ResponseCode:             c.Writer.Status(),
+		Latency:                  time.Since(received).String(),
+	}
+	if a.res != nil {
+		event.Resource = a.res.Plural
+		event.Subresource = a.subresource
+	}
+	if auditLevels[level] >= auditLevels[AuditLevelRequest] {
+		event.RequestObject = rawJSON(reqBody)
+	}
+	if auditLevels[level] >= auditLevels[AuditLevelRequestResponse] {
+		event.ResponseObject = rawJSON(recorder.body.Bytes())
+	}
+
+	buf, _ := json.Marshal(event)
+	if _, err := auditor.out.Write(append(buf, '\n')); err != nil {
+		klog.Errorf("write audit log error: %v", err)
+	}
+}
+
+// rawJSON embeds the body in the event, a body which is not json is embedded as a string
+func rawJSON(body []byte) json.RawMessage {
+	if len(body) == 0 {
+		return nil
+	}
+	if json.Valid(body) {
+		return body
+	}
+	buf, _ := json.Marshal(string(body))
+	return buf
+}
+
+// rotatingFile appends to path, and once it grows over maxSize renames it to path.1,
+// path.1 to path.2 and so on, keeping maxBackups of them
+type rotatingFile struct {
+	mtx        sync.Mutex
+	path       string
+	maxSize    int64
+	maxBackups int
+	file       *os.File
+	size       int64
+}
+
+func newRotatingFile(path string, maxSize int64, maxBackups int) (*rotatingFile, error) {
+	f := &rotatingFile{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *rotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file, f.size = file, info.Size()
+	return nil
+}
+
+func (f *rotatingFile) Write(b []byte) (int, error) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	if f.maxSize > 0 && f.size > 0 && f.size+int64(len(b)) > f.maxSize {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(b)
+	f.size += int64(n)
+	return n, err
+}
+
+func (f *rotatingFile) rotate() error {
+	f.file.Close()
+	if f.maxBackups > 0 {
+		for i := f.maxBackups - 1; i > 0; i-- {
+			_ = os.Rename(f.path+"."+strconv.Itoa(i), f.path+"."+strconv.Itoa(i+1))
+		}
+		_ = os.Rename(f.path, f.path+".1")
+	} else {
+		_ = os.Remove(f.path)
+	}
+	return f.open()
+}
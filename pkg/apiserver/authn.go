@@ -0,0 +1,159 @@
+/*
+	authentication：请求依次尝试client certificate与bearer token，认证得到的用户放入gin context，
+	两者都没有配置时退化为匿名访问，便于本地开发
+*/
+package apiserver
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"k8s.io/klog"
+	"os"
+	"strings"
+)
+
+const (
+	// AnonymousUser is the user of the requests without credentials
+	AnonymousUser = "system:anonymous"
+	// GroupAuthenticated is the group of every authenticated user
+	GroupAuthenticated = "system:authenticated"
+	// GroupUnauthenticated is the group of the anonymous user
+	GroupUnauthenticated = "system:unauthenticated"
+
+	// the gin context key of the UserInfo of a request
+	userKey = "user"
+)
+
+// UserInfo is the identity a request is authenticated as
+type UserInfo struct {
+	Name   string   `json:"username"`
+	UID    string   `json:"uid,omitempty"`
+	Groups []string `json:"groups,omitempty"`
+}
+
+// userOf returns the user the request is authenticated as
+func userOf(c *gin.Context) UserInfo {
+	if user, ok := c.Get(userKey); ok {
+		return user.(UserInfo)
+	}
+	return UserInfo{Name: AnonymousUser, Groups: []string{GroupUnauthenticated}}
+}
+
+type authenticator struct {
+	// users by their bearer token
+	tokens    map[string]UserInfo
+	certs     bool
+	anonymous bool
+}
+
+func newAuthenticator(opts Options) (*authenticator, error) {
+	authn := &authenticator{
+		tokens:    map[string]UserInfo{},
+		certs:     opts.ClientCAFile != "",
+		anonymous: opts.AnonymousAuth,
+	}
+	if opts.TokenAuthFile != "" {
+		tokens, err := loadTokens(opts.TokenAuthFile)
+		if err != nil {
+			return nil, err
+		}
+		authn.tokens = tokens
+	}
+	if !authn.certs && len(authn.tokens) == 0 {
+		klog.Warning("neither client certificates nor tokens are configured, every request is anonymous")
+		authn.anonymous = true
+	}
+	return authn, nil
+}
+
+// loadTokens reads the static token file
+func loadTokens(path string) (map[string]UserInfo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	r.Comment = '#'
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("read token file %s: %v", path, err)
+	}
+	tokens := map[string]UserInfo{}
+	for i, record := range records {
+		if len(record) < 3 || record[0] == "" || record[1] == "" {
+			return nil, fmt.Errorf("token file %s line %d: want token,user,uid[,groups]", path, i+1)
+		}
+		user := UserInfo{Name: record[1], UID: record[2]}
+		if len(record) > 3 && record[3] != "" {
+			user.Groups = strings.Split(record[3], ",")
+		}
+		tokens[record[0]] = user
+	}
+	return tokens, nil
+}
+
+// authenticate is the middleware putting the user of the request in the context, it
+// replies 401 if the credentials are wrong, or missing while anonymous is not allowed
+func (authn *authenticator) authenticate(c *gin.Context) {
+	user, err := authn.userOfRequest(c)
+	if err != nil {
+		c.AbortWithStatusJSON(401, gin.H{"status": "ERR", "error": "Unauthorized: " + err.Error()})
+		return
+	}
+	c.Set(userKey, user)
+	c.Next()
+}
+
+func (authn *authenticator) userOfRequest(c *gin.Context) (UserInfo, error) {
+	if authn.certs && c.Request.TLS != nil && len(c.Request.TLS.VerifiedChains) > 0 {
+		cert := c.Request.TLS.VerifiedChains[0][0]
+		if cert.Subject.CommonName != "" {
+			groups := append([]string{}, cert.Subject.Organization...)
+			return UserInfo{Name: cert.Subject.CommonName, Groups: append(groups, GroupAuthenticated)}, nil
+		}
+	}
+
+	if header := c.GetHeader("Authorization"); header != "" {
+		token := strings.TrimPrefix(header, "Bearer ")
+		if token == header {
+			return UserInfo{}, errors.New("unsupported authorization scheme")
+		}
+		user, ok := authn.tokens[strings.TrimSpace(token)]
+		if !ok {
+			return UserInfo{}, errors.New("invalid bearer token")
+		}
+		user.Groups = append(append([]string{}, user.Groups...), GroupAuthenticated)
+		return user, nil
+	}
+
+	if !authn.anonymous {
+		return UserInfo{}, errors.New("no credentials")
+	}
+	return UserInfo{Name: AnonymousUser, Groups: []string{GroupUnauthenticated}}, nil
+}
+
+// tlsConfig is the tls config of the server, client certificates are verified if given
+func tlsConfig(opts Options) (*tls.Config, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if opts.ClientCAFile == "" {
+		return cfg, nil
+	}
+	pem, err := os.ReadFile(opts.ClientCAFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificate found in %s", opts.ClientCAFile)
+	}
+	cfg.ClientCAs = pool
+	cfg.ClientAuth = tls.VerifyClientCertIfGiven
+	return cfg, nil
+}
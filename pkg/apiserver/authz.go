@@ -0,0 +1,600 @@
+/*
+	authorization：--authorization-mode中的authorizer依次判断请求，任一允许即放行，全部拒绝时返回403。
+	Node authorizer限制kubelet只能修改自己的node及其/innode路径，RBAC依照Role与RoleBinding判断
+*/
+package apiserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"k8s.io/klog"
+	"minik8s.com/minik8s/config"
+	v1 "minik8s.com/minik8s/pkg/api/v1"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// the authorization modes
+const (
+	ModeAlwaysAllow = "AlwaysAllow"
+	ModeNode        = "Node"
+	ModeRBAC        = "RBAC"
+)
+
+const (
+	// GroupNodes is the group of the kubelets, which authenticate as system:node:<name>
+	GroupNodes     = "system:nodes"
+	NodeUserPrefix = "system:node:"
+	// GroupMasters is bound to cluster-admin
+	GroupMasters = "system:masters"
+)
+
+// attributes of a request that an authorizer looks at
+type attributes struct {
+	user UserInfo
+	verb string
+
+	// res is nil for a non-resource request
+	res *Resource
+	// subresource of the object, e.g. status, empty for the object itself
+	subresource string
+	// namespace is empty for a cluster scoped object, or a request spanning all namespaces
+	namespace string
+	name      string
+
+	// path of a non-resource request
+	path string
+}
+
+func (a *attributes) String() string {
+	if a.res == nil {
+		return fmt.Sprintf("user %q cannot %s path %q", a.user.Name, a.verb, a.path)
+	}
+	s := fmt.Sprintf("user %q cannot %s resource %q", a.user.Name, a.verb, a.resource())
+	if a.name != "" {
+		s += fmt.Sprintf(" named %q", a.name)
+	}
+	if a.namespace != "" {
+		s += fmt.Sprintf(" in the namespace %q", a.namespace)
+	} else if a.res.Namespaced {
+		s += " in all namespaces"
+	}
+	return s
+}
+
+// resource is the plural of the kind, followed by /<subresource> for a subresource
+func (a *attributes) resource() string {
+	if a.subresource == "" {
+		return a.res.Plural
+	}
+	return a.res.Plural + "/" + a.subresource
+}
+
+type decision int
+
+const (
+	// decisionNoOpinion leaves the request to the next authorizer
+	decisionNoOpinion decision = iota
+	decisionAllow
+	decisionDeny
+)
+
+// authorizer decides a request, the string is the reason of a denial
+type authorizer func(a *attributes) (decision, string)
+
+// resourceRoute is a route mounted by installResources
+type resourceRoute struct {
+	res         *Resource
+	subresource string
+	verb        string
+	// custom routes serve the custom resources, which are told by the path
+	custom bool
+}
+
+// the routes of the resources by method and path, the other routes are non-resource ones
+var resourceRoutes = map[string]resourceRoute{}
+
+// handle mounts the route of the resource and records the verb it is authorized as
+func handle(r *gin.Engine, method, path string, res *Resource, verb string, handler gin.HandlerFunc) {
+	handleSubresource(r, method, path, res, "", verb, handler)
+}
+
+// handleSubresource is handle on a subresource of the objects, which the rules address
+// as <plural>/<subresource>
+func handleSubresource(r *gin.Engine, method, path string, res *Resource, subresource, verb string, handler gin.HandlerFunc) {
+	resourceRoutes[method+" "+path] = resourceRoute{res: res, subresource: subresource, verb: verb}
+	r.Handle(method, path, handler)
+}
+
+// handleCustom mounts a route of the custom resources, the resource and the verb of a
+// request are parsed from its path
+func handleCustom(r *gin.Engine, method, path string, handler gin.HandlerFunc) {
+	resourceRoutes[method+" "+path] = resourceRoute{custom: true}
+	r.Handle(method, path, handler)
+}
+
+// verbs of the non-resource requests
+var methodVerbs = map[string]string{
+	http.MethodGet:    v1.VerbGet,
+	http.MethodPost:   v1.VerbCreate,
+	http.MethodPut:    v1.VerbUpdate,
+	http.MethodPatch:  v1.VerbPatch,
+	http.MethodDelete: v1.VerbDelete,
+}
+
+func attributesOf(c *gin.Context) *attributes {
+	a := &attributes{user: userOf(c)}
+	route, ok := resourceRoutes[c.Request.Method+" "+c.FullPath()]
+	namespace := c.Param("ns")
+	if ok && route.custom {
+		var custom *customRoute
+		if custom, ok = parseCustomRoute(c.Request.Method, c.Request.URL.Path); ok {
+			route = resourceRoute{res: custom.res.Resource, verb: custom.verb}
+			namespace = custom.namespace
+			a.name = custom.name
+		}
+	} else {
+		a.name = c.Param("name")
+	}
+	if !ok {
+		// a custom resource which does not exist is authorized as a non-resource url
+		a.verb = methodVerbs[c.Request.Method]
+		a.path = c.Request.URL.Path
+		a.name = ""
+		return a
+	}
+	a.verb, a.res, a.subresource = route.verb, route.res, route.subresource
+	if route.res.Namespaced {
+		a.namespace = namespace
+		// a single object addressed without a namespace is in the default one
+		if a.namespace == "" && a.name != "" {
+			a.namespace = v1.NamespaceDefault
+		}
+	}
+	return a
+}
+
+// newAuthorizers returns the authorizers of the comma separated modes
+func newAuthorizers(modes string) ([]authorizer, error) {
+	var authorizers []authorizer
+	for _, mode := range strings.Split(modes, ",") {
+		switch strings.TrimSpace(mode) {
+		case ModeAlwaysAllow:
+			authorizers = append(authorizers, func(a *attributes) (decision, string) { return decisionAllow, "" })
+		case ModeNode:
+			authorizers = append(authorizers, authorizeNode)
+		case ModeRBAC:
+			authorizers = append(authorizers, authorizeRBAC)
+		default:
+			return nil, fmt.Errorf("unknown authorization mode %q", mode)
+		}
+	}
+	return authorizers, nil
+}
+
+// authorizersKey holds the authorizers in the context, for the handlers authorizing a
+// request for another verb as well
+const authorizersKey = "authorizers"
+
+// authorize is the middleware asking the authorizers in turn, it replies 403 unless one
+// of them allows the request
+func authorize(authorizers []authorizer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(authorizersKey, authorizers)
+		if ok, msg := decide(authorizers, attributesOf(c)); !ok {
+			klog.Infof("%s %s: %s", c.Request.Method, c.Request.URL.Path, msg)
+			c.AbortWithStatusJSON(403, gin.H{"status": "ERR", "reason": "Forbidden", "error": msg})
+			return
+		}
+		c.Next()
+	}
+}
+
+// authorizedTo tells whether the request is allowed as the verb too, e.g. an apply, which
+// is a patch, creating the object. Otherwise it also returns why not.
+func authorizedTo(c *gin.Context, verb string) (bool, string) {
+	authorizers, exist := c.Get(authorizersKey)
+	if !exist {
+		return true, ""
+	}
+	a := attributesOf(c)
+	a.verb = verb
+	return decide(authorizers.([]authorizer), a)
+}
+
+// decide asks the authorizers in turn, it returns false and the message of the denial
+// unless one of them allows the request
+func decide(authorizers []authorizer, a *attributes) (bool, string) {
+	var reasons []string
+	for _, authz := range authorizers {
+		d, reason := authz(a)
+		if d == decisionAllow {
+			return true, ""
+		}
+		if reason != "" {
+			reasons = append(reasons, reason)
+		}
+		if d == decisionDeny {
+			break
+		}
+	}
+	msg := "Forbidden: " + a.String()
+	if len(reasons) != 0 {
+		msg += ": " + strings.Join(reasons, "; ")
+	}
+	return false, msg
+}
+
+//------------------------------- NODE ----------------------------------
+
+// authorizeNode decides the requests of the kubelets. A kubelet reads the nodes, pods,
+// services and endpoints, registers a node and only writes its own node, the pods bound
+// to it, the /innode paths of its node and the events it records.
+func authorizeNode(a *attributes) (decision, string) {
+	nodeName, isNode := nodeNameOf(a.user)
+	if !isNode {
+		return decisionNoOpinion, ""
+	}
+	readOnly := a.verb == v1.VerbGet || a.verb == v1.VerbList || a.verb == v1.VerbWatch
+
+	if a.res == nil {
+		path := strings.TrimPrefix(a.path, "/watch")
+		if !strings.HasPrefix(path, "/innode/") {
+			return decisionNoOpinion, ""
+		}
+		node := strings.SplitN(strings.TrimPrefix(path, "/innode/"), "/", 2)[0]
+		if nodeOwnedBy(node, nodeName) {
+			return decisionAllow, ""
+		}
+		return decisionDeny, "node " + node + " is not registered by " + a.user.Name
+	}
+
+	switch a.res.Kind {
+	case "Node":
+		if readOnly || a.verb == v1.VerbCreate {
+			return decisionAllow, ""
+		}
+		if a.name != "" && nodeOwnedBy(a.name, nodeName) {
+			return decisionAllow, ""
+		}
+		return decisionDeny, "a node may only modify its own node object"
+	case "Pod":
+		if readOnly {
+			return decisionAllow, ""
+		}
+		if (a.verb == v1.VerbUpdate || a.verb == v1.VerbPatch) && a.name != "" && podBoundTo(a.namespace, a.name, nodeName) {
+			return decisionAllow, ""
+		}
+		return decisionDeny, "a node may only update the pods bound to it"
+	case "Service", "Endpoint":
+		if readOnly {
+			return decisionAllow, ""
+		}
+	case "Event":
+		if a.verb == v1.VerbCreate || a.verb == v1.VerbPatch || a.verb == v1.VerbGet {
+			return decisionAllow, ""
+		}
+	}
+	return decisionNoOpinion, ""
+}
+
+// nodeNameOf returns the name of the kubelet the user is
+func nodeNameOf(user UserInfo) (string, bool) {
+	if !strings.HasPrefix(user.Name, NodeUserPrefix) || !hasGroup(user, GroupNodes) {
+		return "", false
+	}
+	return strings.TrimPrefix(user.Name, NodeUserPrefix), true
+}
+
+func hasGroup(user UserInfo, group string) bool {
+	for _, g := range user.Groups {
+		if g == group {
+			return true
+		}
+	}
+	return false
+}
+
+// nodeOwnedBy tells whether the node object was registered by the kubelet
+func nodeOwnedBy(name, nodeName string) bool {
+	node := &v1.Node{}
+	if !getObject(resourcesByKind["Node"].key("", name), node) {
+		return false
+	}
+	return node.Labels[v1.LabelHostname] == nodeName
+}
+
+// podBoundTo tells whether the pod is scheduled to a node registered by the kubelet
+func podBoundTo(namespace, name, nodeName string) bool {
+	pod := &v1.Pod{}
+	if !getObject(resourcesByKind["Pod"].key(namespace, name), pod) {
+		return false
+	}
+	return pod.Spec.NodeName != "" && nodeOwnedBy(pod.Spec.NodeName, nodeName)
+}
+
+// getObject decodes the object at key, it returns false if there is none
+func getObject(key string, obj any) bool {
+	kv, err := storeGet(key)
+	if err != nil || kv.Type == config.AS_OP_ERROR_String {
+		return false
+	}
+	return json.Unmarshal(kv.Value, obj) == nil
+}
+
+//------------------------------- RBAC ----------------------------------
+
+// authorizeRBAC allows the request if a rule of a role bound to the user allows it. The
+// ClusterRoleBindings grant their rules everywhere, the RoleBindings only in their
+// namespace.
+func authorizeRBAC(a *attributes) (decision, string) {
+	refs, err := clusterRoleBindings.rolesOf("", a.user)
+	if err != nil {
+		return decisionNoOpinion, err.Error()
+	}
+	for _, ref := range refs {
+		if rulesAllow(clusterRoleRules(ref.Name), a, true) {
+			return decisionAllow, ""
+		}
+	}
+
+	if a.res == nil || a.namespace == "" {
+		return decisionNoOpinion, "no RBAC rule allows it"
+	}
+	refs, err = roleBindings.rolesOf(a.namespace, a.user)
+	if err != nil {
+		return decisionNoOpinion, err.Error()
+	}
+	for _, ref := range refs {
+		var rules []v1.PolicyRule
+		if ref.Kind == "ClusterRole" {
+			rules = clusterRoleRules(ref.Name)
+		} else {
+			role := &v1.Role{}
+			if getCachedObject(resourcesByKind["Role"], a.namespace, ref.Name, role) {
+				rules = role.Rules
+			}
+		}
+		if rulesAllow(rules, a, false) {
+			return decisionAllow, ""
+		}
+	}
+	return decisionNoOpinion, "no RBAC rule allows it"
+}
+
+func clusterRoleRules(name string) []v1.PolicyRule {
+	role := &v1.ClusterRole{}
+	if !getCachedObject(resourcesByKind["ClusterRole"], "", name, role) {
+		return nil
+	}
+	return role.Rules
+}
+
+// getCachedObject is getObject served by the watch cache of the resource
+func getCachedObject(res *Resource, namespace, name string, obj any) bool {
+	kv, err := cachedGet(res.EtcdPrefix, res.key(namespace, name))
+	if err != nil || kv.Type == config.AS_OP_ERROR_String {
+		return false
+	}
+	return json.Unmarshal(kv.Value, obj) == nil
+}
+
+// subjectKey is a subject of the bindings in a namespace, empty for the
+// ClusterRoleBindings
+type subjectKey struct {
+	namespace string
+	kind      string
+	name      string
+}
+
+// bindingIndex holds the role refs of the bindings of a kind by their subjects, as of
+// revision rev of the watch cache of the kind
+type bindingIndex struct {
+	kind string
+
+	mtx       sync.Mutex
+	rev       int64
+	bySubject map[subjectKey][]v1.RoleRef
+}
+
+var (
+	clusterRoleBindings = &bindingIndex{kind: "ClusterRoleBinding"}
+	roleBindings        = &bindingIndex{kind: "RoleBinding"}
+)
+
+// rolesOf returns the roles bound in the namespace to the user or to one of its groups
+func (idx *bindingIndex) rolesOf(namespace string, user UserInfo) ([]v1.RoleRef, error) {
+	if err := idx.refresh(); err != nil {
+		return nil, err
+	}
+	idx.mtx.Lock()
+	defer idx.mtx.Unlock()
+	var refs []v1.RoleRef
+	refs = append(refs, idx.bySubject[subjectKey{namespace, v1.UserKind, user.Name}]...)
+	for _, group := range user.Groups {
+		refs = append(refs, idx.bySubject[subjectKey{namespace, v1.GroupKind, group}]...)
+	}
+	return refs, nil
+}
+
+// refresh rebuilds the index if the watch cache has moved on since it was built. Without
+// the watch caches the bindings are listed from the storage every time.
+func (idx *bindingIndex) refresh() error {
+	prefix := resourcesByKind[idx.kind].EtcdPrefix
+	if c := watchCacheOf(prefix); c != nil {
+		if rev, ok := c.revision(); ok {
+			idx.mtx.Lock()
+			built := idx.bySubject != nil && idx.rev == rev
+			idx.mtx.Unlock()
+			if built {
+				return nil
+			}
+		}
+	}
+	kvs, rev, _, err := cachedListRange(prefix, prefix, prefix, 0, 0)
+	if err != nil {
+		return err
+	}
+	bySubject := map[subjectKey][]v1.RoleRef{}
+	for _, kv := range kvs {
+		// a RoleBinding has the same subjects and role ref as a ClusterRoleBinding
+		binding := &v1.RoleBinding{}
+		if json.Unmarshal(kv.Value, binding) != nil {
+			continue
+		}
+		namespace := ""
+		if idx.kind == "RoleBinding" {
+			namespace = v1.NamespaceOf(&binding.ObjectMeta)
+		}
+		for _, subject := range binding.Subjects {
+			key := subjectKey{namespace, subject.Kind, subject.Name}
+			bySubject[key] = append(bySubject[key], binding.RoleRef)
+		}
+	}
+	idx.mtx.Lock()
+	defer idx.mtx.Unlock()
+	if idx.bySubject == nil || rev >= idx.rev {
+		idx.rev, idx.bySubject = rev, bySubject
+	}
+	return nil
+}
+
+// rulesAllow tells whether one of the rules allows the request, the non-resource urls
+// only count in the whole cluster
+func rulesAllow(rules []v1.PolicyRule, a *attributes, clusterWide bool) bool {
+	for _, rule := range rules {
+		if !contains(rule.Verbs, a.verb, v1.VerbAll) {
+			continue
+		}
+		if a.res == nil {
+			if clusterWide && matchURL(rule.NonResourceURLs, a.path) {
+				return true
+			}
+			continue
+		}
+		if !contains(rule.Resources, a.resource(), v1.ResourceAll) {
+			continue
+		}
+		if len(rule.ResourceNames) == 0 || (a.name != "" && contains(rule.ResourceNames, a.name, "")) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(list []string, s string, wildcard string) bool {
+	for _, item := range list {
+		if item == s || (wildcard != "" && item == wildcard) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchURL matches the path against the urls, a trailing * matches any suffix
+func matchURL(urls []string, path string) bool {
+	for _, url := range urls {
+		if url == path || (strings.HasSuffix(url, "*") && strings.HasPrefix(path, strings.TrimSuffix(url, "*"))) {
+			return true
+		}
+	}
+	return false
+}
+
+//------------------------------- BOOTSTRAP ----------------------------------
+
+// the users of the components, set as the common name of their client certificates or
+// the user of their tokens
+const (
+	UserScheduler  = "system:kube-scheduler"
+	UserController = "system:kube-controller-manager"
+	UserServerless = "system:serverless"
+)
+
+// bootstrapClusterRoles are created at startup unless they exist, the ClusterRoleBinding
+// of each one is named after it and binds it to the subject
+var bootstrapClusterRoles = []struct {
+	role    v1.ClusterRole
+	subject v1.Subject
+}{
+	{
+		role: v1.ClusterRole{
+			ObjectMeta: v1.ObjectMeta{Name: "cluster-admin"},
+			Rules: []v1.PolicyRule{
+				{Verbs: []string{v1.VerbAll}, Resources: []string{v1.ResourceAll}},
+				{Verbs: []string{v1.VerbAll}, NonResourceURLs: []string{"*"}},
+			},
+		},
+		subject: v1.Subject{Kind: v1.GroupKind, Name: GroupMasters},
+	},
+	{
+		// every user may discover the resources served
+		role: v1.ClusterRole{
+			ObjectMeta: v1.ObjectMeta{Name: "system:discovery"},
+			Rules: []v1.PolicyRule{
+				{Verbs: []string{v1.VerbGet}, NonResourceURLs: []string{"/apis", "/openapi/*"}},
+			},
+		},
+		subject: v1.Subject{Kind: v1.GroupKind, Name: GroupAuthenticated},
+	},
+	{
+		// the scheduler binds the pods, hands them to the nodes, records its events and
+		// elects its leader by a lease
+		role: v1.ClusterRole{
+			ObjectMeta: v1.ObjectMeta{Name: UserScheduler},
+			Rules: []v1.PolicyRule{
+				{Verbs: []string{v1.VerbCreate, v1.VerbGet, v1.VerbUpdate}, Resources: []string{"leases"}},
+				{Verbs: []string{v1.VerbGet, v1.VerbList, v1.VerbWatch, v1.VerbUpdate, v1.VerbPatch}, Resources: []string{"pods"}},
+				{Verbs: []string{v1.VerbGet, v1.VerbList, v1.VerbWatch}, Resources: []string{"nodes"}},
+				{Verbs: []string{v1.VerbCreate, v1.VerbGet, v1.VerbPatch}, Resources: []string{"events"}},
+				{Verbs: []string{v1.VerbAll}, NonResourceURLs: []string{"/innode/*"}},
+			},
+		},
+		subject: v1.Subject{Kind: v1.UserKind, Name: UserScheduler},
+	},
+	{
+		// the controllers manage every kind and read the status of the pods in the nodes
+		role: v1.ClusterRole{
+			ObjectMeta: v1.ObjectMeta{Name: UserController},
+			Rules: []v1.PolicyRule{
+				{Verbs: []string{v1.VerbAll}, Resources: []string{v1.ResourceAll}},
+				{Verbs: []string{v1.VerbGet}, NonResourceURLs: []string{"/innode/*"}},
+			},
+		},
+		subject: v1.Subject{Kind: v1.UserKind, Name: UserController},
+	},
+	{
+		// the serverless controller is limited to pods, it creates the pods of its pool
+		// and reads back and removes them
+		role: v1.ClusterRole{
+			ObjectMeta: v1.ObjectMeta{Name: UserServerless},
+			Rules: []v1.PolicyRule{
+				{Verbs: []string{v1.VerbCreate, v1.VerbGet, v1.VerbDelete}, Resources: []string{"pods"}},
+			},
+		},
+		subject: v1.Subject{Kind: v1.UserKind, Name: UserServerless},
+	},
+}
+
+// ensureBootstrapPolicy creates the bootstrap ClusterRoles and ClusterRoleBindings that
+// do not exist yet, those modified by the administrator are kept
+func ensureBootstrapPolicy() {
+	for _, bootstrap := range bootstrapClusterRoles {
+		role := bootstrap.role
+		role.TypeMeta = v1.TypeMeta{Kind: "ClusterRole", APIVersion: "v1"}
+		role.UID = newUID()
+		buf, _ := json.Marshal(role)
+		_, _ = storeCreate(resourcesByKind["ClusterRole"].key("", role.Name), string(buf))
+
+		binding := v1.ClusterRoleBinding{
+			TypeMeta:   v1.TypeMeta{Kind: "ClusterRoleBinding", APIVersion: "v1"},
+			ObjectMeta: v1.ObjectMeta{Name: role.Name, UID: newUID()},
+			Subjects:   []v1.Subject{bootstrap.subject},
+			RoleRef:    v1.RoleRef{Kind: "ClusterRole", Name: role.Name},
+		}
+		buf, _ = json.Marshal(binding)
+		_, _ = storeCreate(resourcesByKind["ClusterRoleBinding"].key("", binding.Name), string(buf))
+	}
+}
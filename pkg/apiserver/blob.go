@@ -0,0 +1,353 @@
+/*
+	blob：Blob对象的内容以sha256为地址保存在本地目录中，同一命名空间内相同的内容只保存一份。
+	上传时校验大小与checksum，下载与上传都经过认证与鉴权，没有Blob引用的内容会被定期清理
+*/
+package apiserver
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"io"
+	"io/fs"
+	"k8s.io/klog/v2"
+	"mime"
+	"minik8s.com/minik8s/config"
+	v1 "minik8s.com/minik8s/pkg/api/v1"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+const (
+	// DefaultBlobDir is the directory the content of the blobs is stored in
+	DefaultBlobDir = "./blobs"
+	// DefaultMaxBlobSize is the largest content of a blob in bytes
+	DefaultMaxBlobSize = 64 << 20
+	// DefaultBlobQuota is the total size in bytes of the blobs of a namespace
+	DefaultBlobQuota = 1 << 30
+	// how often the content no blob refers to is removed, the content written within
+	// the last interval is kept for the blobs being created
+	blobSweepInterval = 10 * time.Minute
+	// the subresource the content of a blob is uploaded to and downloaded from
+	blobDataSubresource = "data"
+	// the directory of the uploads not verified yet, namespaces may not start with a dot
+	blobTmpDir = ".tmp"
+)
+
+// the options of the blobs, set by Run
+var (
+	blobDir     = DefaultBlobDir
+	maxBlobSize = int64(DefaultMaxBlobSize)
+	// blobQuota is the total size of the blobs of a namespace, 0 means no quota
+	blobQuota = int64(DefaultBlobQuota)
+)
+
+var sha256Regexp = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// errBlobMismatch is returned when the content uploaded is not the one of the blob
+var errBlobMismatch = errors.New("the content does not match the blob")
+
+// installBlobs mounts the data subresource of the blobs
+func installBlobs(r *gin.Engine) {
+	res := resourcesByKind["Blob"]
+	for _, path := range []string{"/" + res.Singular + "/:name/data", "/namespaces/:ns/" + res.Plural + "/:name/data"} {
+		handleSubresource(r, http.MethodPut, path, res, blobDataSubresource, v1.VerbUpdate, res.handleUploadBlob)
+		handleSubresource(r, http.MethodGet, path, res, blobDataSubresource, v1.VerbGet, res.handleDownloadBlob)
+	}
+}
+
+// blobPath returns the file of the content of the checksum in the namespace
+func blobPath(namespace, sum string) string {
+	return filepath.Join(blobDir, namespace, sum)
+}
+
+// blobExists tells whether the content is stored, and keeps it from being swept for
+// another interval if it is
+func blobExists(namespace, sum string) bool {
+	if !sha256Regexp.MatchString(sum) {
+		return false
+	}
+	now := time.Now()
+	return os.Chtimes(blobPath(namespace, sum), now, now) == nil
+}
+
+// writeBlob stores the content read from r if it has the size and the checksum. It is
+// written to a temporary file first, so a partial upload is never served.
+func writeBlob(namespace, sum string, size int64, r io.Reader) error {
+	tmpDir := filepath.Join(blobDir, blobTmpDir)
+	if err := os.MkdirAll(tmpDir, 0700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(tmpDir, sum+"-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	hash := sha256.New()
+	n, err := io.Copy(io.MultiWriter(tmp, hash), io.LimitReader(r, size+1))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if n > size {
+		return fmt.Errorf("%w: the content is larger than %d bytes", errBlobMismatch, size)
+	} else if n < size {
+		return fmt.Errorf("%w: the content has %d bytes, want %d", errBlobMismatch, n, size)
+	}
+	if got := hex.EncodeToString(hash.Sum(nil)); got != sum {
+		return fmt.Errorf("%w: the sha256 of the content is %s, want %s", errBlobMismatch, got, sum)
+	}
+
+	path := blobPath(namespace, sum)
+	if err = os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// handleUploadBlob stores the content in the body and marks the blob Ready
+func (res *Resource) handleUploadBlob(c *gin.Context) {
+	namespace, name := res.namespace(c), c.Param("name")
+	key := res.key(namespace, name)
+	var blob v1.Blob
+	if !getObject(key, &blob) {
+		c.JSON(404, gin.H{"status": "ERR", "error": "No such " + res.Singular})
+		return
+	}
+	if c.Request.ContentLength > blob.Spec.Size {
+		c.JSON(413, gin.H{"status": "ERR", "error": fmt.Sprintf("the content is larger than the %d bytes of the blob", blob.Spec.Size)})
+		return
+	}
+	// the content already stored is not uploaded again
+	if !blobExists(namespace, blob.Spec.SHA256) {
+		err := writeBlob(namespace, blob.Spec.SHA256, blob.Spec.Size, c.Request.Body)
+		if errors.Is(err, errBlobMismatch) {
+			c.JSON(422, gin.H{"status": "ERR", "error": err.Error()})
+			return
+		} else if err != nil {
+			klog.Errorf("store blob %v failed, err: %v", key, err)
+			c.JSON(500, gin.H{"status": "ERR", "error": err.Error()})
+			return
+		}
+	}
+	rev, err := markBlobReady(key)
+	if err != nil {
+		c.JSON(500, gin.H{"status": "ERR", "error": err.Error()})
+		return
+	}
+	c.JSON(200, gin.H{"status": "OK", "id": name, "uid": blob.UID, "resourceVersion": strconv.FormatInt(rev, 10)})
+}
+
+// markBlobReady sets the phase of the blob to Ready, it retries on conflicts
+func markBlobReady(key string) (int64, error) {
+	for {
+		kv, err := storeGet(key)
+		if err != nil {
+			return 0, err
+		} else if kv.Type == config.AS_OP_ERROR_String {
+			return 0, errNotFound
+		}
+		var blob v1.Blob
+		if err = json.Unmarshal(kv.Value, &blob); err != nil {
+			return 0, err
+		}
+		if blob.Status.Phase == v1.BlobReady {
+			return kv.Revision, nil
+		}
+		now := time.Now()
+		blob.Status = v1.BlobStatus{Phase: v1.BlobReady, UploadTime: &now}
+		buf, _ := json.Marshal(&blob)
+		rev, err := storeUpdate(key, string(buf), kv.Revision)
+		if err != errConflict {
+			return rev, err
+		}
+	}
+}
+
+// handleDownloadBlob serves the content of the blob, ranges and conditional requests
+// included, the checksum is its ETag
+func (res *Resource) handleDownloadBlob(c *gin.Context) {
+	namespace, name := res.namespace(c), c.Param("name")
+	var blob v1.Blob
+	if !getObject(res.key(namespace, name), &blob) {
+		c.JSON(404, gin.H{"status": "ERR", "error": "No such " + res.Singular})
+		return
+	}
+	if !sha256Regexp.MatchString(blob.Spec.SHA256) {
+		c.JSON(404, gin.H{"status": "ERR", "error": "the content of blob " + name + " has not been uploaded"})
+		return
+	}
+	file, err := os.Open(blobPath(namespace, blob.Spec.SHA256))
+	if errors.Is(err, fs.ErrNotExist) {
+		c.JSON(404, gin.H{"status": "ERR", "error": "the content of blob " + name + " has not been uploaded"})
+		return
+	} else if err != nil {
+		c.JSON(500, gin.H{"status": "ERR", "error": err.Error()})
+		return
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		c.JSON(500, gin.H{"status": "ERR", "error": err.Error()})
+		return
+	}
+
+	contentType := blob.Spec.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	filename := blob.Spec.Filename
+	if filename == "" {
+		filename = name
+	}
+	c.Header("Content-Type", contentType)
+	c.Header("ETag", strconv.Quote(blob.Spec.SHA256))
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	http.ServeContent(c.Writer, c.Request, filename, info.ModTime(), file)
+}
+
+// beforeCreateBlob checks the quota of the namespace, a blob of content already stored
+// is Ready at once
+func beforeCreateBlob(obj v1.Object) error {
+	blob := obj.(*v1.Blob)
+	namespace := v1.NamespaceOf(&blob.ObjectMeta)
+	if blobQuota > 0 {
+		sizes, err := blobSizes(namespace)
+		if err != nil {
+			return err
+		}
+		var used int64
+		for _, size := range sizes {
+			used += size
+		}
+		// the content already stored for the namespace takes no more space
+		if _, stored := sizes[blob.Spec.SHA256]; !stored && used+blob.Spec.Size > blobQuota {
+			return FieldErrors{{"spec.size", fmt.Sprintf("the blobs of namespace %s would take %d bytes, exceeding the quota of %d bytes",
+				namespace, used+blob.Spec.Size, blobQuota)}}
+		}
+	}
+	blob.Status = v1.BlobStatus{Phase: v1.BlobPending}
+	if blobExists(namespace, blob.Spec.SHA256) {
+		now := time.Now()
+		blob.Status = v1.BlobStatus{Phase: v1.BlobReady, UploadTime: &now}
+	}
+	return nil
+}
+
+// blobSizes returns the size of the content of the blobs of the namespace by checksum,
+// the blobs of the same content share it and it is charged once
+func blobSizes(namespace string) (map[string]int64, error) {
+	kvs, _, err := storeList(resourcesByKind["Blob"].prefix(namespace))
+	if err != nil {
+		return nil, err
+	}
+	sizes := map[string]int64{}
+	for _, kv := range kvs {
+		var blob v1.Blob
+		if json.Unmarshal(kv.Value, &blob) == nil {
+			sizes[blob.Spec.SHA256] = blob.Spec.Size
+		}
+	}
+	return sizes, nil
+}
+
+// beforeUpdateBlob keeps the spec, the content of a blob never changes, and the status,
+// which only the uploads of the content set
+func beforeUpdateBlob(obj v1.Object) error {
+	blob := obj.(*v1.Blob)
+	stored := &v1.Blob{}
+	if !getObject(resourcesByKind["Blob"].key(v1.NamespaceOf(&blob.ObjectMeta), blob.Name), stored) {
+		return nil
+	}
+	if blob.Spec != stored.Spec {
+		return FieldErrors{{"spec", "field is immutable"}}
+	}
+	if blob.Status.Phase != stored.Status.Phase || !equalTime(blob.Status.UploadTime, stored.Status.UploadTime) {
+		return FieldErrors{{"status", "is set by uploading the content to the " + blobDataSubresource + " subresource"}}
+	}
+	return nil
+}
+
+func equalTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+// beforeCreateGPUJob requires the files of the job to be Ready blobs of its namespace,
+// so the gpu server never waits for them
+func beforeCreateGPUJob(obj v1.Object) error {
+	job := obj.(*v1.GPUJob)
+	namespace := v1.NamespaceOf(&job.ObjectMeta)
+	var errs FieldErrors
+	check := func(field, name string) {
+		var blob v1.Blob
+		if name == "" {
+			errs = append(errs, FieldError{field, "required, the name of the blob holding the file"})
+		} else if !getObject(resourcesByKind["Blob"].key(namespace, name), &blob) {
+			errs = append(errs, FieldError{field, "blob " + name + " does not exist"})
+		} else if blob.Status.Phase != v1.BlobReady {
+			errs = append(errs, FieldError{field, "the content of blob " + name + " has not been uploaded"})
+		}
+	}
+	check("scriptBlob", job.ScriptBlob)
+	for i, file := range job.Files {
+		check(fmt.Sprintf("files[%d].blob", i), file.Blob)
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// runBlobSweep periodically removes the content no blob refers to
+func runBlobSweep() {
+	for range time.Tick(blobSweepInterval) {
+		if err := sweepBlobs(time.Now().Add(-blobSweepInterval)); err != nil {
+			klog.Errorf("sweep blobs failed, err: %v", err)
+		}
+	}
+}
+
+// sweepBlobs removes the content no blob refers to and the uploads left unfinished, of
+// those modified before the deadline
+func sweepBlobs(deadline time.Time) error {
+	kvs, _, err := storeList(resourcesByKind["Blob"].EtcdPrefix)
+	if err != nil {
+		return err
+	}
+	referenced := map[string]bool{}
+	for _, kv := range kvs {
+		var blob v1.Blob
+		if json.Unmarshal(kv.Value, &blob) == nil {
+			referenced[blobPath(v1.NamespaceOf(&blob.ObjectMeta), blob.Spec.SHA256)] = true
+		}
+	}
+	return filepath.WalkDir(blobDir, func(path string, d fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		} else if err != nil || d.IsDir() || referenced[path] {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil || info.ModTime().After(deadline) {
+			return nil
+		}
+		klog.Infof("remove blob content %v, no blob refers to it\n", path)
+		if err = os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		return nil
+	})
+}
@@ -0,0 +1,293 @@
+/*
+	custom resources：由CustomResourceDefinition在运行时定义的kind，
+	对象作为未结构化的json存储，由/apis/<group>/<version>/...下的通用路由提供REST与watch
+*/
+package apiserver
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"k8s.io/klog"
+	"minik8s.com/minik8s/config"
+	v1 "minik8s.com/minik8s/pkg/api/v1"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// customResource is a kind defined by a CustomResourceDefinition
+type customResource struct {
+	*Resource
+	group string
+	// schemas of the served versions, a nil schema accepts anything
+	versions map[string]*v1.JSONSchemaProps
+}
+
+// the custom resources by <group>/<plural>, kept in sync with the CustomResourceDefinitions
+var customResources = struct {
+	sync.RWMutex
+	byName map[string]*customResource
+}{byName: map[string]*customResource{}}
+
+// customPrefix returns the key prefix of the objects of the CustomResourceDefinition named
+// <plural>.<group>
+func customPrefix(crdName string) string {
+	plural, group, _ := strings.Cut(crdName, ".")
+	return "/apis/" + group + "/" + plural + "/"
+}
+
+func newCustomResource(crd *v1.CustomResourceDefinition) *customResource {
+	names := crd.Spec.Names
+	singular := names.Singular
+	if singular == "" {
+		singular = strings.ToLower(names.Kind)
+	}
+	cr := &customResource{
+		Resource: &Resource{
+			Kind:       names.Kind,
+			Singular:   singular,
+			Plural:     names.Plural,
+			ShortNames: names.ShortNames,
+			EtcdPrefix: customPrefix(crd.Name),
+			Namespaced: crd.Spec.Scope == v1.NamespaceScoped,
+			New:        func() v1.Object { return &v1.Unstructured{} },
+		},
+		group:    crd.Spec.Group,
+		versions: map[string]*v1.JSONSchemaProps{},
+	}
+	for _, version := range crd.Spec.Versions {
+		if !version.Served {
+			continue
+		}
+		var schema *v1.JSONSchemaProps
+		if version.Schema != nil {
+			schema = version.Schema.OpenAPIV3Schema
+		}
+		cr.versions[version.Name] = schema
+	}
+	return cr
+}
+
+// forVersion returns the resource serving the version, which sets the kind and
+// apiversion of the objects and validates them with the schema of the version
+func (cr *customResource) forVersion(version string) *Resource {
+	res := *cr.Resource
+	schema := cr.versions[version]
+	apiVersion := cr.group + "/" + version
+	prepare := func(obj v1.Object) error {
+		u := obj.(*v1.Unstructured)
+		if u.Kind != "" && u.Kind != res.Kind {
+			return FieldErrors{{"kind", "must be " + res.Kind}}
+		}
+		u.Kind, u.APIVersion = res.Kind, apiVersion
+		return validateCustomObject(schema, u)
+	}
+	res.BeforeCreate = func(obj v1.Object) error {
+		crd := &v1.CustomResourceDefinition{}
+		crdName := cr.Plural + "." + cr.group
+		if getObject(resourcesByKind["CustomResourceDefinition"].key("", crdName), crd) && crd.DeletionTimestamp != nil {
+			return errors.New("unable to create new " + cr.Plural + " because " + crdName + " is being terminated")
+		}
+		return prepare(obj)
+	}
+	res.BeforeUpdate = prepare
+	return &res
+}
+
+func registerCustomResource(crd *v1.CustomResourceDefinition) *customResource {
+	cr := newCustomResource(crd)
+	customResources.Lock()
+	customResources.byName[cr.group+"/"+cr.Plural] = cr
+	customResources.Unlock()
+	return cr
+}
+
+func unregisterCustomResource(crdName string) {
+	plural, group, _ := strings.Cut(crdName, ".")
+	customResources.Lock()
+	delete(customResources.byName, group+"/"+plural)
+	customResources.Unlock()
+}
+
+// customResourceOf returns the custom resource of the group and plural. A definition
+// just created may not have been seen by syncCustomResources yet, so it is read from the
+// storage if it is unknown.
+func customResourceOf(group, plural string) *customResource {
+	customResources.RLock()
+	cr := customResources.byName[group+"/"+plural]
+	customResources.RUnlock()
+	if cr != nil {
+		return cr
+	}
+	crd := &v1.CustomResourceDefinition{}
+	if !getObject(resourcesByKind["CustomResourceDefinition"].key("", plural+"."+group), crd) {
+		return nil
+	}
+	return registerCustomResource(crd)
+}
+
+// allResources returns the built-in resources followed by the custom ones
+func allResources() []*Resource {
+	all := append([]*Resource{}, resources...)
+	customResources.RLock()
+	for _, cr := range customResources.byName {
+		all = append(all, cr.Resource)
+	}
+	customResources.RUnlock()
+	return all
+}
+
+// syncCustomResources keeps the custom resources in sync with the CustomResourceDefinitions
+// in the storage, it never returns
+func syncCustomResources() {
+	prefix := resourcesByKind["CustomResourceDefinition"].prefix("")
+	for {
+		kvs, rev, err := storeList(prefix)
+		if err != nil {
+			klog.Errorf("list CustomResourceDefinitions error: %v", err)
+			time.Sleep(time.Second)
+			continue
+		}
+		listed := map[string]bool{}
+		for _, kv := range kvs {
+			crd := &v1.CustomResourceDefinition{}
+			if err = json.Unmarshal(kv.Value, crd); err != nil {
+				klog.Errorf("decode %v error: %v", kv.Key, err)
+				continue
+			}
+			registerCustomResource(crd)
+			listed[crd.Name] = true
+		}
+		customResources.Lock()
+		for name, cr := range customResources.byName {
+			if !listed[cr.Plural+"."+cr.group] {
+				delete(customResources.byName, name)
+			}
+		}
+		customResources.Unlock()
+
+		wch, cancel := storeWatchPrefix(prefix, rev)
+		for kv := range wch {
+			if kv.Type == eventError {
+				break
+			}
+			name := strings.TrimPrefix(kv.Key, prefix)
+			switch kv.Type {
+			case config.AS_OP_PUT_String:
+				crd := &v1.CustomResourceDefinition{}
+				if err = json.Unmarshal(kv.Value, crd); err != nil {
+					klog.Errorf("decode %v error: %v", kv.Key, err)
+					continue
+				}
+				registerCustomResource(crd)
+			case config.AS_OP_DELETE_String:
+				unregisterCustomResource(name)
+			}
+		}
+		cancel()
+	}
+}
+
+// customRoute is a request to a custom resource, parsed from the path
+type customRoute struct {
+	res       *customResource
+	version   string
+	namespace string
+	name      string
+	verb      string
+}
+
+// parseCustomRoute parses the path of a request to a custom resource, which is
+// /apis/<group>/<version>[/namespaces/<namespace>]/<plural>[/<name>] or the same
+// under /watch. It returns false if the path addresses no served custom resource.
+func parseCustomRoute(method, path string) (*customRoute, bool) {
+	watch := strings.HasPrefix(path, "/watch/")
+	segments := strings.Split(strings.Trim(strings.TrimPrefix(path, "/watch"), "/"), "/")
+	if len(segments) < 4 || segments[0] != "apis" {
+		return nil, false
+	}
+	route := &customRoute{version: segments[2]}
+	group, rest := segments[1], segments[3:]
+	if rest[0] == "namespaces" && len(rest) >= 3 {
+		route.namespace, rest = rest[1], rest[2:]
+	}
+	if len(rest) > 2 {
+		return nil, false
+	}
+	if len(rest) == 2 {
+		route.name = rest[1]
+	}
+	route.res = customResourceOf(group, rest[0])
+	if route.res == nil || (route.namespace != "" && !route.res.Namespaced) {
+		return nil, false
+	}
+	if _, served := route.res.versions[route.version]; !served {
+		return nil, false
+	}
+
+	switch {
+	case watch && method == http.MethodGet:
+		route.verb = v1.VerbWatch
+	case watch:
+		return nil, false
+	case method == http.MethodGet && route.name == "":
+		route.verb = v1.VerbList
+	case method == http.MethodPost && route.name == "":
+		route.verb = v1.VerbCreate
+	case route.name == "":
+		return nil, false
+	case method == http.MethodGet:
+		route.verb = v1.VerbGet
+	case method == http.MethodPut:
+		route.verb = v1.VerbUpdate
+	case method == http.MethodPatch:
+		route.verb = v1.VerbPatch
+	case method == http.MethodDelete:
+		route.verb = v1.VerbDelete
+	default:
+		return nil, false
+	}
+	return route, true
+}
+
+// installCustomResources mounts the routes serving every custom resource
+func installCustomResources(r *gin.Engine) {
+	for _, method := range []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete} {
+		handleCustom(r, method, "/apis/*path", handleCustomResource)
+	}
+	handleCustom(r, http.MethodGet, "/watch/apis/*path", handleCustomResource)
+}
+
+// handleCustomResource serves the request with the generic handlers, as if the custom
+// resource had routes of its own
+func handleCustomResource(c *gin.Context) {
+	route, ok := parseCustomRoute(c.Request.Method, c.Request.URL.Path)
+	if !ok {
+		c.JSON(404, gin.H{"status": "ERR", "error": "No such resource " + c.Request.URL.Path})
+		return
+	}
+	c.Params = append(c.Params, gin.Param{Key: "ns", Value: route.namespace}, gin.Param{Key: "name", Value: route.name})
+	res := route.res.forVersion(route.version)
+	switch route.verb {
+	case v1.VerbList:
+		res.handleList(c)
+	case v1.VerbWatch:
+		if route.name == "" {
+			res.handleWatchList(c)
+		} else {
+			res.handleWatch(c)
+		}
+	case v1.VerbCreate:
+		res.handleCreate(c)
+	case v1.VerbGet:
+		res.handleGet(c)
+	case v1.VerbUpdate:
+		res.handleUpdate(c)
+	case v1.VerbPatch:
+		res.handlePatch(c)
+	case v1.VerbDelete:
+		res.handleDelete(c)
+	}
+}
@@ -0,0 +1,260 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"k8s.io/klog"
+	v1 "minik8s.com/minik8s/pkg/api/v1"
+	"regexp"
+	"sort"
+	"strconv"
+	"unicode/utf8"
+)
+
+var (
+	// a group is a dns subdomain with at least one dot, e.g. example.com
+	groupRegexp = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)+$`)
+	kindRegexp  = regexp.MustCompile(`^[A-Z][A-Za-z0-9]*$`)
+)
+
+// the json schema types
+var schemaTypes = map[string]bool{
+	"": true, "object": true, "array": true, "string": true, "integer": true, "number": true, "boolean": true,
+}
+
+func validateCustomResourceDefinition(obj v1.Object) FieldErrors {
+	crd := obj.(*v1.CustomResourceDefinition)
+	spec := &crd.Spec
+	var errs FieldErrors
+	if !groupRegexp.MatchString(spec.Group) {
+		errs = append(errs, FieldError{"spec.group", "invalid group " + strconv.Quote(spec.Group) +
+			", it must be a lowercase dns subdomain with at least one dot"})
+	}
+	if !kindRegexp.MatchString(spec.Names.Kind) {
+		errs = append(errs, FieldError{"spec.names.kind", "invalid kind " + strconv.Quote(spec.Names.Kind) +
+			", it must start with an upper case letter followed by letters and digits"})
+	}
+	if !namespaceNameRegexp.MatchString(spec.Names.Plural) {
+		errs = append(errs, FieldError{"spec.names.plural", "invalid plural " + strconv.Quote(spec.Names.Plural) +
+			", it must be a lowercase RFC 1123 label"})
+	}
+	if spec.Names.Singular != "" && !namespaceNameRegexp.MatchString(spec.Names.Singular) {
+		errs = append(errs, FieldError{"spec.names.singular", "invalid singular " + strconv.Quote(spec.Names.Singular) +
+			", it must be a lowercase RFC 1123 label"})
+	}
+	for i, shortName := range spec.Names.ShortNames {
+		if !namespaceNameRegexp.MatchString(shortName) {
+			errs = append(errs, FieldError{fmt.Sprintf("spec.names.shortNames[%d]", i), "invalid short name " +
+				strconv.Quote(shortName) + ", it must be a lowercase RFC 1123 label"})
+		}
+	}
+	if crd.Name != spec.Names.Plural+"."+spec.Group {
+		errs = append(errs, FieldError{"metadata.name", "must be spec.names.plural+\".\"+spec.group"})
+	}
+	if spec.Scope != v1.NamespaceScoped && spec.Scope != v1.ClusterScoped {
+		errs = append(errs, FieldError{"spec.scope", "unsupported value " + strconv.Quote(string(spec.Scope)) +
+			", want " + string(v1.NamespaceScoped) + " or " + string(v1.ClusterScoped)})
+	}
+	if len(spec.Versions) == 0 {
+		errs = append(errs, FieldError{"spec.versions", "must have at least one version"})
+	}
+	seen := map[string]bool{}
+	for i, version := range spec.Versions {
+		field := fmt.Sprintf("spec.versions[%d]", i)
+		if !namespaceNameRegexp.MatchString(version.Name) {
+			errs = append(errs, FieldError{field + ".name", "invalid version " + strconv.Quote(version.Name)})
+		} else if seen[version.Name] {
+			errs = append(errs, FieldError{field + ".name", "duplicate version " + version.Name})
+		}
+		seen[version.Name] = true
+		if version.Schema != nil && version.Schema.OpenAPIV3Schema != nil {
+			errs = append(errs, validateSchemaProps(version.Schema.OpenAPIV3Schema, field+".schema.openAPIV3Schema")...)
+		}
+	}
+	return append(errs, validateCustomNames(crd)...)
+}
+
+// validateCustomNames checks that the kind and the names of the definition are not taken
+// by a built-in resource or by another definition, the rules of the roles tell the
+// resources apart by their plurals only
+func validateCustomNames(crd *v1.CustomResourceDefinition) FieldErrors {
+	names := crd.Spec.Names
+	var errs FieldErrors
+	if _, exist := resourcesByKind[names.Kind]; exist {
+		errs = append(errs, FieldError{"spec.names.kind", "kind " + names.Kind + " is a built-in kind"})
+	}
+	for _, res := range resources {
+		if names.Plural == res.Plural || names.Plural == res.Singular {
+			errs = append(errs, FieldError{"spec.names.plural", names.Plural + " is taken by the built-in kind " + res.Kind})
+		}
+	}
+	kvs, _, err := storeList(resourcesByKind["CustomResourceDefinition"].prefix(""))
+	if err != nil {
+		return append(errs, FieldError{"spec.names", "cannot check the other definitions: " + err.Error()})
+	}
+	for _, kv := range kvs {
+		other := &v1.CustomResourceDefinition{}
+		if err = json.Unmarshal(kv.Value, other); err != nil {
+			klog.Errorf("decode %v error: %v", kv.Key, err)
+			continue
+		}
+		if other.Name == crd.Name {
+			continue
+		}
+		if other.Spec.Names.Plural == names.Plural {
+			errs = append(errs, FieldError{"spec.names.plural", names.Plural + " is taken by " + other.Name})
+		}
+		if other.Spec.Names.Kind == names.Kind {
+			errs = append(errs, FieldError{"spec.names.kind", "kind " + names.Kind + " is defined by " + other.Name})
+		}
+	}
+	return errs
+}
+
+// validateSchemaProps checks that the schema itself is valid
+func validateSchemaProps(schema *v1.JSONSchemaProps, field string) FieldErrors {
+	var errs FieldErrors
+	if !schemaTypes[schema.Type] {
+		errs = append(errs, FieldError{field + ".type", "unsupported type " + strconv.Quote(schema.Type)})
+	}
+	if schema.Pattern != "" {
+		if _, err := regexp.Compile(schema.Pattern); err != nil {
+			errs = append(errs, FieldError{field + ".pattern", err.Error()})
+		}
+	}
+	for name, prop := range schema.Properties {
+		prop := prop
+		errs = append(errs, validateSchemaProps(&prop, field+".properties."+name)...)
+	}
+	if schema.Items != nil {
+		errs = append(errs, validateSchemaProps(schema.Items, field+".items")...)
+	}
+	return errs
+}
+
+// validateCustomObject validates the object with the schema, except its kind, apiversion
+// and metadata. A nil schema accepts any object.
+func validateCustomObject(schema *v1.JSONSchemaProps, u *v1.Unstructured) error {
+	if schema == nil {
+		return nil
+	}
+	object := map[string]any{}
+	for k, v := range u.Object {
+		if k != "kind" && k != "apiversion" && k != "metadata" {
+			object[k] = v
+		}
+	}
+	if errs := validateValue(schema, object, ""); len(errs) != 0 {
+		return errs
+	}
+	return nil
+}
+
+// validateValue validates the json value decoded with json.Number at the field
+func validateValue(schema *v1.JSONSchemaProps, value any, field string) FieldErrors {
+	name := field
+	if name == "" {
+		name = "<root>"
+	}
+	var errs FieldErrors
+	switch schema.Type {
+	case "object":
+		object, ok := value.(map[string]any)
+		if !ok {
+			return FieldErrors{{name, "must be of type object"}}
+		}
+		for _, required := range schema.Required {
+			if _, exist := object[required]; !exist {
+				errs = append(errs, FieldError{childField(field, required), "is required"})
+			}
+		}
+		keys := make([]string, 0, len(schema.Properties))
+		for key := range schema.Properties {
+			keys = append(keys, key)
+		}
+		// sorted, so that the errors are always in the same order
+		sort.Strings(keys)
+		for _, key := range keys {
+			if v, exist := object[key]; exist {
+				prop := schema.Properties[key]
+				errs = append(errs, validateValue(&prop, v, childField(field, key))...)
+			}
+		}
+	case "array":
+		array, ok := value.([]any)
+		if !ok {
+			return FieldErrors{{name, "must be of type array"}}
+		}
+		if schema.MinItems != nil && int64(len(array)) < *schema.MinItems {
+			errs = append(errs, FieldError{name, fmt.Sprintf("must have at least %d items", *schema.MinItems)})
+		}
+		if schema.MaxItems != nil && int64(len(array)) > *schema.MaxItems {
+			errs = append(errs, FieldError{name, fmt.Sprintf("must have at most %d items", *schema.MaxItems)})
+		}
+		if schema.Items != nil {
+			for i, item := range array {
+				errs = append(errs, validateValue(schema.Items, item, fmt.Sprintf("%s[%d]", field, i))...)
+			}
+		}
+	case "string":
+		s, ok := value.(string)
+		if !ok {
+			return FieldErrors{{name, "must be of type string"}}
+		}
+		length := int64(utf8.RuneCountInString(s))
+		if schema.MinLength != nil && length < *schema.MinLength {
+			errs = append(errs, FieldError{name, fmt.Sprintf("must be at least %d characters long", *schema.MinLength)})
+		}
+		if schema.MaxLength != nil && length > *schema.MaxLength {
+			errs = append(errs, FieldError{name, fmt.Sprintf("must be at most %d characters long", *schema.MaxLength)})
+		}
+		if schema.Pattern != "" {
+			if re, err := regexp.Compile(schema.Pattern); err == nil && !re.MatchString(s) {
+				errs = append(errs, FieldError{name, "must match the pattern " + strconv.Quote(schema.Pattern)})
+			}
+		}
+	case "integer", "number":
+		n, ok := value.(json.Number)
+		if !ok {
+			return FieldErrors{{name, "must be of type " + schema.Type}}
+		}
+		if _, err := n.Int64(); err != nil && schema.Type == "integer" {
+			return FieldErrors{{name, "must be of type integer"}}
+		}
+		f, _ := n.Float64()
+		if schema.Minimum != nil && f < *schema.Minimum {
+			errs = append(errs, FieldError{name, "must be greater than or equal to " + strconv.FormatFloat(*schema.Minimum, 'g', -1, 64)})
+		}
+		if schema.Maximum != nil && f > *schema.Maximum {
+			errs = append(errs, FieldError{name, "must be less than or equal to " + strconv.FormatFloat(*schema.Maximum, 'g', -1, 64)})
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return FieldErrors{{name, "must be of type boolean"}}
+		}
+	}
+	if len(schema.Enum) != 0 && !inEnum(schema.Enum, value) {
+		buf, _ := json.Marshal(schema.Enum)
+		errs = append(errs, FieldError{name, "must be one of " + string(buf)})
+	}
+	return errs
+}
+
+func childField(field, name string) string {
+	if field == "" {
+		return name
+	}
+	return field + "." + name
+}
+
+// inEnum compares the values as json, so that the numbers of the object, which are
+// json.Number, equal those of the schema
+func inEnum(enum []any, value any) bool {
+	buf, _ := json.Marshal(value)
+	for _, e := range enum {
+		if b, _ := json.Marshal(e); string(b) == string(buf) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,320 @@
+/*
+	删除对象时依照propagationPolicy处理其dependents，即ownerReferences指向该对象的对象。
+	Background由controller中的garbage collector在删除后回收；Foreground为对象加上foregroundDeletion
+	finalizer，由garbage collector删除其控制的dependents后再移除；Orphan在此同步完成。
+	带有finalizers的对象只会被标记deletionTimestamp，待finalizers全部移除后才真正删除。
+	namespace与CustomResourceDefinition删除时进入Terminating，其中的对象逐个删除后才删除其本身
+*/
+package apiserver
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"k8s.io/klog"
+	"minik8s.com/minik8s/config"
+	v1 "minik8s.com/minik8s/pkg/api/v1"
+	"strconv"
+	"time"
+)
+
+// how long a Terminating object waits for its contents with finalizers to go
+const terminationRetryInterval = time.Second
+
+// dependent is an object that references an owner
+type dependent struct {
+	res *Resource
+	key string
+	// controlled tells whether the reference marks the owner as the controller
+	controlled bool
+}
+
+// propagationPolicy parses ?propagationPolicy=, it replies 400 and returns false if it is invalid
+func propagationPolicy(c *gin.Context) (v1.DeletionPropagation, bool) {
+	policy := v1.DeletionPropagation(c.DefaultQuery("propagationPolicy", string(v1.DeletePropagationBackground)))
+	switch policy {
+	case v1.DeletePropagationOrphan, v1.DeletePropagationBackground, v1.DeletePropagationForeground:
+		return policy, true
+	}
+	c.JSON(400, gin.H{"status": "ERR", "error": "invalid propagationPolicy " + string(policy) +
+		", must be one of Orphan, Background, Foreground"})
+	return "", false
+}
+
+// dependentsOf returns the objects referencing the owner. The dependents of a namespaced
+// owner are in its namespace, those of a cluster scoped one in any namespace.
+func dependentsOf(namespace, uid string) ([]dependent, error) {
+	var deps []dependent
+	for _, res := range allResources() {
+		kvs, _, err := storeList(res.prefix(namespace))
+		if err != nil {
+			return nil, err
+		}
+		for _, kv := range kvs {
+			obj := res.New()
+			if err = json.Unmarshal(kv.Value, obj); err != nil {
+				klog.Errorf("decode %v error: %v", res.Kind, err)
+				continue
+			}
+			refs := obj.GetObjectMeta().OwnerReferences
+			if i := v1.CheckOwner(refs, uid); i >= 0 {
+				deps = append(deps, dependent{res: res, key: kv.Key, controlled: refs[i].Controller})
+			}
+		}
+	}
+	return deps, nil
+}
+
+// deleteOptions are the ?propagationPolicy= and ?gracePeriodSeconds= of a DELETE request
+type deleteOptions struct {
+	policy v1.DeletionPropagation
+	// gracePeriodSeconds is nil if the grace period of the kind applies
+	gracePeriodSeconds *int64
+}
+
+// deleteOptionsOf parses the options of the DELETE request, it replies 400 and returns
+// false if they are invalid
+func deleteOptionsOf(c *gin.Context) (deleteOptions, bool) {
+	policy, ok := propagationPolicy(c)
+	if !ok {
+		return deleteOptions{}, false
+	}
+	opts := deleteOptions{policy: policy}
+	if s, exist := c.GetQuery("gracePeriodSeconds"); exist {
+		grace, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || grace < 0 {
+			c.JSON(400, gin.H{"status": "ERR", "error": "invalid gracePeriodSeconds " + s})
+			return deleteOptions{}, false
+		}
+		opts.gracePeriodSeconds = &grace
+	}
+	return opts, true
+}
+
+// deleteObject deletes the object at key, and applies the policy to its dependents. An
+// object with finalizers or contents is only marked for deletion, in which case it
+// returns true. In the foreground an owner controlling dependents is marked with the
+// foregroundDeletion finalizer, which the garbage collector removes once they are gone.
+func (res *Resource) deleteObject(key, name string, opts deleteOptions) (bool, error) {
+	for {
+		kv, err := storeGet(key)
+		if err != nil {
+			return false, err
+		} else if kv.Type == config.AS_OP_ERROR_String {
+			return false, errNotFound
+		}
+		obj := res.New()
+		if err = json.Unmarshal(kv.Value, obj); err != nil {
+			return false, err
+		}
+		meta := obj.GetObjectMeta()
+		namespace := ""
+		if res.Namespaced {
+			namespace = v1.NamespaceOf(meta)
+		}
+		blocked := false
+		switch {
+		case opts.policy == v1.DeletePropagationOrphan:
+			err = orphanDependents(namespace, meta.UID)
+		case opts.policy == v1.DeletePropagationForeground && !meta.HasFinalizer(v1.FinalizerForegroundDeletion):
+			blocked, err = controlsDependents(namespace, meta.UID)
+		}
+		if err != nil {
+			return false, err
+		}
+		if blocked {
+			meta.AddFinalizer(v1.FinalizerForegroundDeletion)
+		}
+
+		marked := len(meta.Finalizers) != 0 || res.Contents != nil
+		if marked {
+			// the contents are terminated once, when the object starts terminating, a
+			// later deletion only shortens the grace period
+			terminate := res.Contents != nil && meta.DeletionTimestamp == nil
+			if !res.markDeletion(meta, opts.gracePeriodSeconds) && !blocked {
+				return true, nil
+			}
+			if terminate {
+				meta.AddFinalizer(v1.FinalizerContents)
+				if res.Terminate != nil {
+					res.Terminate(obj)
+				}
+			}
+			buf, _ := json.Marshal(obj)
+			if _, err = storeUpdate(key, string(buf), kv.Revision); err == nil && terminate {
+				go res.terminateContents(key, name)
+			}
+		} else {
+			_, err = storeDelIf(key, kv.Revision)
+		}
+		// modified meanwhile, e.g. a finalizer has been added or removed
+		if err != errConflict {
+			return marked, err
+		}
+	}
+}
+
+// markDeletion sets the deletionTimestamp and the grace period of the object. A grace
+// period may only be shortened, it returns false if there is nothing to change.
+func (res *Resource) markDeletion(meta *v1.ObjectMeta, gracePeriodSeconds *int64) bool {
+	grace := res.GracePeriodSeconds
+	if gracePeriodSeconds != nil {
+		grace = *gracePeriodSeconds
+	}
+	if meta.DeletionTimestamp == nil {
+		now := time.Now()
+		meta.DeletionTimestamp = &now
+	} else if meta.DeletionGracePeriodSeconds != nil && *meta.DeletionGracePeriodSeconds <= grace {
+		return false
+	}
+	meta.DeletionGracePeriodSeconds = &grace
+	return true
+}
+
+// orphanDependents drops the references to the owner from its dependents
+func orphanDependents(namespace, uid string) error {
+	deps, err := dependentsOf(namespace, uid)
+	if err != nil {
+		return err
+	}
+	for _, dep := range deps {
+		// a dependent deleted meanwhile needs nothing more
+		if err = removeOwnerReference(dep.res, dep.key, uid); err != nil && !errors.Is(err, errNotFound) {
+			return err
+		}
+	}
+	return nil
+}
+
+// controlsDependents tells whether the owner controls some of its dependents, which a
+// foreground deletion waits for
+func controlsDependents(namespace, uid string) (bool, error) {
+	deps, err := dependentsOf(namespace, uid)
+	if err != nil {
+		return false, err
+	}
+	for _, dep := range deps {
+		if dep.controlled {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// removeOwnerReference drops the references to the owner from the object at key
+func removeOwnerReference(res *Resource, key, uid string) error {
+	for {
+		kv, err := storeGet(key)
+		if err != nil {
+			return err
+		} else if kv.Type == config.AS_OP_ERROR_String {
+			return errNotFound
+		}
+		obj := res.New()
+		if err = json.Unmarshal(kv.Value, obj); err != nil {
+			return err
+		}
+		meta := obj.GetObjectMeta()
+		if v1.CheckOwner(meta.OwnerReferences, uid) < 0 {
+			return nil
+		}
+		var refs []v1.OwnerReference
+		for _, ref := range meta.OwnerReferences {
+			if ref.UID != uid {
+				refs = append(refs, ref)
+			}
+		}
+		meta.OwnerReferences = refs
+		buf, _ := json.Marshal(obj)
+		_, err = storeUpdate(key, string(buf), kv.Revision)
+		if err != errConflict {
+			return err
+		}
+	}
+}
+
+// terminateContents deletes the objects contained in the Terminating object at key, each
+// like a DELETE request would, until none is left. It then removes the contents finalizer
+// so that the object goes once its other finalizers are gone too.
+func (res *Resource) terminateContents(key, name string) {
+	for !res.deleteContents(name) {
+		time.Sleep(terminationRetryInterval)
+	}
+	for {
+		kv, err := storeGet(key)
+		if err != nil || kv.Type == config.AS_OP_ERROR_String {
+			return
+		}
+		obj := res.New()
+		if err = json.Unmarshal(kv.Value, obj); err != nil {
+			klog.Errorf("decode %v error: %v", key, err)
+			return
+		}
+		meta := obj.GetObjectMeta()
+		if !meta.RemoveFinalizer(v1.FinalizerContents) {
+			return
+		}
+		if len(meta.Finalizers) == 0 {
+			_, err = storeDelIf(key, kv.Revision)
+		} else {
+			buf, _ := json.Marshal(obj)
+			_, err = storeUpdate(key, string(buf), kv.Revision)
+		}
+		if err != errConflict {
+			if err != nil && err != errNotFound {
+				klog.Errorf("finalize %v error: %v", key, err)
+			}
+			return
+		}
+	}
+}
+
+// deleteContents deletes the objects contained in the object, it returns true once none
+// is left. The objects with finalizers are only marked for deletion and waited for.
+func (res *Resource) deleteContents(name string) bool {
+	empty := true
+	for prefix, content := range res.Contents(name) {
+		kvs, _, err := storeList(prefix)
+		if err != nil {
+			klog.Errorf("list %v error: %v", prefix, err)
+			return false
+		}
+		for _, kv := range kvs {
+			empty = false
+			obj := content.New()
+			if err = json.Unmarshal(kv.Value, obj); err != nil {
+				klog.Errorf("decode %v error: %v", kv.Key, err)
+				continue
+			}
+			meta := obj.GetObjectMeta()
+			if meta.DeletionTimestamp != nil {
+				continue
+			}
+			_, err = content.deleteObject(kv.Key, meta.Name, deleteOptions{policy: v1.DeletePropagationBackground})
+			if err != nil && !errors.Is(err, errNotFound) {
+				klog.Errorf("delete %v error: %v", kv.Key, err)
+			}
+		}
+	}
+	return empty
+}
+
+// resumeTerminations carries on with the objects left Terminating by a previous run
+func resumeTerminations() {
+	for _, res := range resources {
+		if res.Contents == nil {
+			continue
+		}
+		kvs, _, err := storeList(res.prefix(""))
+		if err != nil {
+			klog.Errorf("list %v error: %v", res.Kind, err)
+			continue
+		}
+		for _, kv := range kvs {
+			obj := res.New()
+			if json.Unmarshal(kv.Value, obj) == nil && obj.GetObjectMeta().HasFinalizer(v1.FinalizerContents) {
+				go res.terminateContents(kv.Key, obj.GetObjectMeta().Name)
+			}
+		}
+	}
+}
@@ -0,0 +1,106 @@
+/*
+	discovery：/apis列出api server提供的所有资源（包括custom resources），
+	/openapi/v3为它们生成OpenAPI v3文档，客户端据此找到资源的路由
+*/
+package apiserver
+
+import (
+	"github.com/gin-gonic/gin"
+	v1 "minik8s.com/minik8s/pkg/api/v1"
+	"sort"
+)
+
+// builtinVersion is the version of the built-in resources, which have no group
+const builtinVersion = "v1"
+
+// the verbs of every resource, of the status subresources and of the data of the blobs
+var (
+	resourceVerbs = []string{v1.VerbCreate, v1.VerbDelete, v1.VerbGet, v1.VerbList, v1.VerbPatch, v1.VerbUpdate, v1.VerbWatch}
+	statusVerbs   = []string{v1.VerbPatch, v1.VerbUpdate}
+	blobDataVerbs = []string{v1.VerbGet, v1.VerbUpdate}
+)
+
+func installDiscovery(r *gin.Engine) {
+	r.GET("/apis", handleDiscovery)
+	r.GET("/openapi/v3", handleOpenAPI)
+}
+
+func handleDiscovery(c *gin.Context) {
+	c.JSON(200, v1.APIResourceList{
+		TypeMeta:  v1.TypeMeta{Kind: "APIResourceList", APIVersion: "v1"},
+		Resources: discoverResources(),
+	})
+}
+
+// discoverResources lists the built-in resources followed by the served versions of the
+// custom ones
+func discoverResources() []v1.APIResource {
+	var list []v1.APIResource
+	for _, res := range resources {
+		list = append(list, apiResourceOf(res, "", builtinVersion))
+		if res.CopyStatus != nil {
+			list = append(list, v1.APIResource{
+				Name:       res.Plural + "/status",
+				Kind:       res.Kind,
+				Version:    builtinVersion,
+				Namespaced: res.Namespaced,
+				Verbs:      statusVerbs,
+			})
+		}
+		if res.Kind == "Blob" {
+			list = append(list, v1.APIResource{
+				Name:       res.Plural + "/" + blobDataSubresource,
+				Kind:       res.Kind,
+				Version:    builtinVersion,
+				Namespaced: res.Namespaced,
+				Verbs:      blobDataVerbs,
+			})
+		}
+	}
+	for _, cr := range sortedCustomResources() {
+		for _, version := range cr.servedVersions() {
+			list = append(list, apiResourceOf(cr.Resource, cr.group, version))
+		}
+	}
+	return list
+}
+
+func apiResourceOf(res *Resource, group, version string) v1.APIResource {
+	return v1.APIResource{
+		Name:         res.Plural,
+		SingularName: res.Singular,
+		Kind:         res.Kind,
+		Group:        group,
+		Version:      version,
+		Namespaced:   res.Namespaced,
+		Verbs:        resourceVerbs,
+		ShortNames:   res.ShortNames,
+	}
+}
+
+// sortedCustomResources returns the custom resources sorted by group and plural
+func sortedCustomResources() []*customResource {
+	customResources.RLock()
+	crs := make([]*customResource, 0, len(customResources.byName))
+	for _, cr := range customResources.byName {
+		crs = append(crs, cr)
+	}
+	customResources.RUnlock()
+	sort.Slice(crs, func(i, j int) bool {
+		if crs[i].group != crs[j].group {
+			return crs[i].group < crs[j].group
+		}
+		return crs[i].Plural < crs[j].Plural
+	})
+	return crs
+}
+
+// servedVersions returns the names of the served versions, sorted
+func (cr *customResource) servedVersions() []string {
+	versions := make([]string, 0, len(cr.versions))
+	for version := range cr.versions {
+		versions = append(versions, version)
+	}
+	sort.Strings(versions)
+	return versions
+}
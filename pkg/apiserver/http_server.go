@@ -1,26 +1,31 @@
 package apiserver
 
 import (
-	"fmt"
 	"github.com/gin-gonic/gin"
 	"k8s.io/klog"
-	"log"
 	"minik8s.com/minik8s/config"
 	"net/http"
 	"strconv"
 )
 
-var objCount int = 1000
+func runHttpServer(opts Options) {
+	authn, err := newAuthenticator(opts)
+	if err != nil {
+		klog.Fatalf("load authenticator failed, err: %v", err)
+	}
+	authorizers, err := newAuthorizers(opts.AuthorizationMode)
+	if err != nil {
+		klog.Fatalf("load authorizers failed, err: %v", err)
+	}
+	if opts.ClientCAFile != "" && opts.TLSCertFile == "" {
+		klog.Fatal("client certificates require --tls-cert-file")
+	}
 
-func nextObjNum() int {
-	objCount++
-	if objCount > 9999 {
-		objCount = 1000
+	auditor, err := newAuditor(opts)
+	if err != nil {
+		klog.Fatalf("load audit failed, err: %v", err)
 	}
-	return objCount
-}
 
-func runHttpServer() {
 	gin.SetMode(gin.ReleaseMode)
 	r := gin.Default()
 
@@ -29,20 +34,17 @@ func runHttpServer() {
 	//a simple handler to test connection
 	r.GET("/test", handleGetTest)
 
-	//------------------ REST API ----------------------
-	// service
-	r.GET("/services", handleGetServices)
-	r.GET("/service/:name", handleGetService)
-	r.POST("/service", handlePostService)
-	r.PUT("/service/:name", handlePutService)
-	r.DELETE("/service/:name", handleDeleteService)
+	// 之后注册的路由都会被审计，并需要认证与鉴权
+	if auditor != nil {
+		r.Use(auditor.audit)
+	}
+	r.Use(authn.authenticate, authorize(authorizers))
 
-	// pod
-	r.GET("/pods", handleGetPods)
-	r.GET("/pod/:name", handleGetPod)
-	r.POST("/pod", handlePostPod)
-	r.PUT("/pod/:name", handlePutPod)
-	r.DELETE("/pod/:name", handleDeletePod)
+	//------------------ REST & WATCH API ----------------------
+	installResources(r)
+	installBlobs(r)
+	installCustomResources(r)
+	installDiscovery(r)
 
 	// pod in certain namespace
 	r.GET("/innode/:nname/pods", handleGetPodsByNode)
@@ -51,98 +53,25 @@ func runHttpServer() {
 	r.PUT("/innode/:nname/pod/:pname", handlePutPodByNode)
 	r.DELETE("/innode/:nname/pod/:pname", handleDeletePodByNode)
 
-	r.GET("/innode/:nname/podstatuses", handleGetPodStatusesByNode)
-	r.GET("/innode/:nname/podstatus/:pname", handleGetPodStatusByNode)
-	r.PUT("/innode/:nname/podstatus/:pname", handlePutPodStatusByNode)
-	r.DELETE("/innode/:nname/podstatus/:pname", handleDeletePodStatusByNode)
-
-	// replica
-	r.GET("/replicas", handleGetReplicas)
-	r.GET("/replica/:name", handleGetReplica)
-	r.POST("/replica", handlePostReplica)
-	r.PUT("/replica/:name", handlePutReplica)
-	r.DELETE("/replica/:name", handleDeleteReplica)
-
-	// replica
-	r.GET("/hpas", handleGetHPAs)
-	r.GET("/hpa/:name", handleGetHPA)
-	r.POST("/hpa", handlePostHPA)
-	r.PUT("/hpa/:name", handlePutHPA)
-	r.DELETE("/hpa/:name", handleDeleteHPA)
-
-	// node
-	r.GET("/nodes", handleGetNodes)
-	r.GET("/node/:name/", handleGetNode)
-	r.POST("/node", handlePostNode)
-	r.PUT("/node/:name", handlePutNode)
-	r.DELETE("/node/:name", handleDeleteNode)
-
-	// endpoint
-	r.GET("/endpoints", handleGetEndpoints)
-	r.GET("/endpoint/:name", handleGetEndpoint)
-	r.POST("/endpoint", handlePostEndpoint)
-	r.PUT("/endpoint/:name", handlePutEndpoint)
-	r.DELETE("/endpoint/:name", handleDeleteEndpoint)
-
-	// dns
-	r.GET("/dnss", handleGetDNSs)
-	r.GET("/dns/:name/", handleGetDNS)
-	r.POST("/dns", handlePostDNS)
-	r.PUT("/dns/:name", handlePutDNS)
-	r.DELETE("/dns/:name", handleDeleteDNS)
 
-	// gpu
-	r.GET("/gpus", handleGetGPUs)
-	r.GET("/gpu/:name/", handleGetGPU)
-	r.POST("/gpu", handlePostGPU)
-	r.PUT("/gpu/:name", handlePutGPU)
-	r.DELETE("/gpu/:name", handleDeleteGPU)
-
-	//clear all
-	r.DELETE("/", handleDeleteAll)
+	//------------------ STORAGE ADMIN ----------------------
+	installMaintenance(r)
 
 	//------------------ WATCH API ----------------------
-	r.GET("/watch/services", handleWatchServices)
-	r.GET("/watch/service/:name", handleWatchService)
-
-	r.GET("/watch/endpoints", handleWatchEndpoints)
-	r.GET("/watch/endpoint/:name", handleWatchEndpoint)
-
-	r.GET("/watch/dnss", handleWatchDNSs)
-	r.GET("/watch/gpus", handleWatchGPUs)
-
-	r.GET("/watch/pods", handleWatchPods)
-	r.GET("/watch/pod/:name", handleWatchPod)
-
-	r.GET("/watch/nodes", handleWatchNodes)
-	r.GET("/watch/node/:name", handleWatchNode)
-
 	r.GET("/watch/innode/:nname/pods", handleWatchPodsByNode)
 
-	r.GET("/watch/replicas", handleWatchReplicas)
-	r.GET("/watch/replica/:name", handleWatchReplica)
-
-	r.GET("/watch/hpas", handleWatchHPAs)
-	r.GET("/watch/hpa/:name", handleWatchHPA)
-
 	//------------------ HEARTBEAT -----------------------
 	r.GET("/heartbeat/:name/:num", handleHeartbeat)
 
-	r.POST("/upload", func(c *gin.Context) {
-		file, _ := c.FormFile("file")
-		log.Println(file.Filename)
-		dst := "./uploads/" + file.Filename
-		err := c.SaveUploadedFile(file, dst)
-		if err != nil {
-			c.String(http.StatusOK, fmt.Sprintf("error: %v", err.Error()))
-			return
+	addr := ":" + strconv.Itoa(config.AS_HttpListenPort)
+	if opts.TLSCertFile == "" {
+		err = r.Run(addr)
+	} else {
+		srv := &http.Server{Addr: addr, Handler: r}
+		if srv.TLSConfig, err = tlsConfig(opts); err == nil {
+			err = srv.ListenAndServeTLS(opts.TLSCertFile, opts.TLSPrivateKeyFile)
 		}
-		c.String(http.StatusOK, fmt.Sprintf("'%s' uploaded!", file.Filename))
-	})
-
-	r.Static("/public", "./uploads")
-
-	err := r.Run(":" + strconv.Itoa(config.AS_HttpListenPort))
+	}
 	if err != nil {
 		klog.Errorf("gin server failed to start, err: %v", err)
 	}
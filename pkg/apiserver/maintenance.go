@@ -0,0 +1,284 @@
+/*
+	maintenance：存储的运维接口，包括快照、恢复、压缩与碎片整理，
+	以及在api server进程内定期运行的压缩与碎片整理
+*/
+package apiserver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"k8s.io/klog/v2"
+	v1 "minik8s.com/minik8s/pkg/api/v1"
+	"minik8s.com/minik8s/pkg/apiserver/storage"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultCompactionInterval is how often the history is compacted, the revisions of
+	// the last interval are kept for the watches to resume from
+	DefaultCompactionInterval = 5 * time.Minute
+	// DefaultDefragInterval is how often the storage is checked for defragmentation
+	DefaultDefragInterval = time.Hour
+	// a defragmentation is only run once this fraction of the database is free
+	defragFreeRatio = 0.5
+	// the keys are read by pages of this size while taking a snapshot
+	snapshotPageSize = 500
+	// how long a snapshot, a restore, a compaction or a defragmentation may take
+	maintenanceTimeout = time.Minute
+)
+
+// snapshotPrefix is the prefix of every key of minik8s
+const snapshotPrefix = "/"
+
+// maintenance records the compactions and defragmentations run by this server
+var maintenance struct {
+	sync.Mutex
+	compactedRevision int64
+	lastCompaction    *time.Time
+	lastDefrag        *time.Time
+}
+
+func installMaintenance(r *gin.Engine) {
+	r.GET("/admin/status", handleStorageStatus)
+	r.GET("/admin/snapshot", handleSnapshot)
+	r.POST("/admin/restore", handleRestore)
+	r.POST("/admin/compact", handleCompact)
+	r.POST("/admin/defrag", handleDefrag)
+}
+
+func handleStorageStatus(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), maintenanceTimeout)
+	defer cancel()
+	status, err := store.Status(ctx)
+	if err != nil {
+		c.JSON(500, gin.H{"status": "ERR", "error": err.Error()})
+		return
+	}
+	maintenance.Lock()
+	defer maintenance.Unlock()
+	c.JSON(200, v1.StorageStatus{
+		Backend:                 storageBackend,
+		Revision:                status.Revision,
+		DBSize:                  status.DBSize,
+		DBSizeInUse:             status.DBSizeInUse,
+		CompactedRevision:       maintenance.compactedRevision,
+		LastCompactionTime:      maintenance.lastCompaction,
+		LastDefragmentationTime: maintenance.lastDefrag,
+	})
+}
+
+// handleSnapshot replies every key of minik8s as of the current revision
+func handleSnapshot(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), maintenanceTimeout)
+	defer cancel()
+	snapshot, err := takeSnapshot(ctx)
+	if err != nil {
+		c.JSON(500, gin.H{"status": "ERR", "error": err.Error()})
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=minik8s-snapshot-%d.json", snapshot.Revision))
+	c.JSON(200, snapshot)
+}
+
+// takeSnapshot lists the keys page by page, all of them at the revision of the first page
+func takeSnapshot(ctx context.Context) (*v1.Snapshot, error) {
+	snapshot := &v1.Snapshot{Version: v1.SnapshotVersion, Time: time.Now(), Entries: []v1.SnapshotEntry{}}
+	from := snapshotPrefix
+	for {
+		kvs, rev, more, err := store.List(ctx, snapshotPrefix, from, snapshot.Revision, snapshotPageSize)
+		if err != nil {
+			return nil, err
+		}
+		snapshot.Revision = rev
+		for _, kv := range kvs {
+			snapshot.Entries = append(snapshot.Entries, v1.SnapshotEntry{Key: kv.Key, Value: kv.Value})
+		}
+		if !more || len(kvs) == 0 {
+			return snapshot, nil
+		}
+		from = kvs[len(kvs)-1].Key + "\x00"
+	}
+}
+
+// handleRestore writes the keys of the snapshot in the body into an empty storage. The
+// objects keep their uids, they are given the revisions of the storage restored into.
+func handleRestore(c *gin.Context) {
+	var snapshot v1.Snapshot
+	if err := json.NewDecoder(c.Request.Body).Decode(&snapshot); err != nil {
+		c.JSON(400, gin.H{"status": "ERR", "error": "decode snapshot: " + err.Error()})
+		return
+	}
+	if snapshot.Version != v1.SnapshotVersion {
+		c.JSON(400, gin.H{"status": "ERR", "error": fmt.Sprintf("unsupported snapshot version %d, want %d", snapshot.Version, v1.SnapshotVersion)})
+		return
+	}
+	ctx, cancel := context.WithTimeout(c.Request.Context(), maintenanceTimeout)
+	defer cancel()
+
+	// the objects created by the server at startup are replaced by those in the snapshot
+	kvs, _, _, err := store.List(ctx, snapshotPrefix, snapshotPrefix, 0, 0)
+	if err != nil {
+		c.JSON(500, gin.H{"status": "ERR", "error": err.Error()})
+		return
+	}
+	bootstrap := bootstrapKeys()
+	for _, kv := range kvs {
+		if !bootstrap[kv.Key] {
+			c.JSON(409, gin.H{"status": "ERR", "error": "the storage is not empty, it holds " + kv.Key +
+				", restore into a new storage or clear it first"})
+			return
+		}
+	}
+
+	var rev int64
+	for i, entry := range snapshot.Entries {
+		if rev, err = store.Put(ctx, entry.Key, withoutResourceVersion(entry.Value)); err != nil {
+			klog.Errorf("restore %v failed, err: %v", entry.Key, err)
+			c.JSON(500, gin.H{"status": "ERR", "error": fmt.Sprintf("restore %v: %v, %d of %d keys restored",
+				entry.Key, err, i, len(snapshot.Entries))})
+			return
+		}
+	}
+	noteWrite(rev, snapshotPrefix)
+	klog.Infof("restored %d keys of the snapshot at revision %d\n", len(snapshot.Entries), snapshot.Revision)
+	c.JSON(200, gin.H{"status": "OK", "entries": len(snapshot.Entries), "snapshotRevision": snapshot.Revision,
+		"resourceVersion": strconv.FormatInt(rev, 10)})
+}
+
+// bootstrapKeys are the keys of the objects the server creates at startup
+func bootstrapKeys() map[string]bool {
+	keys := map[string]bool{resourcesByKind["Namespace"].key("", v1.NamespaceDefault): true}
+	for _, bootstrap := range bootstrapClusterRoles {
+		keys[resourcesByKind["ClusterRole"].key("", bootstrap.role.Name)] = true
+		keys[resourcesByKind["ClusterRoleBinding"].key("", bootstrap.role.Name)] = true
+	}
+	return keys
+}
+
+// withoutResourceVersion drops the resourceVersion an object of an older snapshot may
+// carry, the objects read are given the revision they are stored at instead
+func withoutResourceVersion(value []byte) []byte {
+	var obj map[string]json.RawMessage
+	if json.Unmarshal(value, &obj) != nil {
+		return value
+	}
+	var meta map[string]json.RawMessage
+	if json.Unmarshal(obj["metadata"], &meta) != nil || meta["resourceVersion"] == nil {
+		return value
+	}
+	delete(meta, "resourceVersion")
+	obj["metadata"], _ = json.Marshal(meta)
+	buf, err := json.Marshal(obj)
+	if err != nil {
+		return value
+	}
+	return buf
+}
+
+// handleCompact compacts the history before ?revision, the current revision if not set
+func handleCompact(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), maintenanceTimeout)
+	defer cancel()
+	rev, err := parseResourceVersion(c.Query("revision"))
+	if err != nil || rev < 0 {
+		c.JSON(400, gin.H{"status": "ERR", "error": "invalid revision " + strconv.Quote(c.Query("revision"))})
+		return
+	}
+	if rev == 0 {
+		status, err := store.Status(ctx)
+		if err != nil {
+			c.JSON(500, gin.H{"status": "ERR", "error": err.Error()})
+			return
+		}
+		rev = status.Revision
+	}
+	if err = compact(ctx, rev); err == storage.ErrCompacted {
+		c.JSON(409, gin.H{"status": "ERR", "error": fmt.Sprintf("revision %d has been compacted already", rev)})
+	} else if err != nil {
+		c.JSON(500, gin.H{"status": "ERR", "error": err.Error()})
+	} else {
+		c.JSON(200, gin.H{"status": "OK", "resourceVersion": strconv.FormatInt(rev, 10)})
+	}
+}
+
+func handleDefrag(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), maintenanceTimeout)
+	defer cancel()
+	if err := defragment(ctx); err != nil {
+		c.JSON(500, gin.H{"status": "ERR", "error": err.Error()})
+	} else {
+		c.JSON(200, gin.H{"status": "OK"})
+	}
+}
+
+func compact(ctx context.Context, rev int64) error {
+	if err := store.Compact(ctx, rev); err != nil {
+		return err
+	}
+	now := time.Now()
+	maintenance.Lock()
+	maintenance.compactedRevision, maintenance.lastCompaction = rev, &now
+	maintenance.Unlock()
+	klog.Infof("storage compacted at revision %d\n", rev)
+	return nil
+}
+
+func defragment(ctx context.Context) error {
+	if err := store.Defragment(ctx); err != nil {
+		return err
+	}
+	now := time.Now()
+	maintenance.Lock()
+	maintenance.lastDefrag = &now
+	maintenance.Unlock()
+	klog.Info("storage defragmented\n")
+	return nil
+}
+
+// runCompaction compacts the history every interval at the revision seen an interval
+// before, so that the watches can resume from any revision of the last interval. The
+// other api servers may have compacted it already, which is fine.
+func runCompaction(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	var last int64
+	for range time.Tick(interval) {
+		ctx, cancel := context.WithTimeout(context.Background(), maintenanceTimeout)
+		status, err := store.Status(ctx)
+		if err == nil && last > 0 {
+			if err = compact(ctx, last); err == storage.ErrCompacted {
+				err = nil
+			}
+		}
+		cancel()
+		if err != nil {
+			klog.Errorf("storage compaction failed, err: %v", err)
+			continue
+		}
+		last = status.Revision
+	}
+}
+
+// runDefragmentation defragments the storage every interval if enough of it is free,
+// since a defragmentation blocks the storage for a while
+func runDefragmentation(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	for range time.Tick(interval) {
+		ctx, cancel := context.WithTimeout(context.Background(), maintenanceTimeout)
+		status, err := store.Status(ctx)
+		if err == nil && status.DBSize > 0 && float64(status.DBSize-status.DBSizeInUse) >= defragFreeRatio*float64(status.DBSize) {
+			err = defragment(ctx)
+		}
+		cancel()
+		if err != nil {
+			klog.Errorf("storage defragmentation failed, err: %v", err)
+		}
+	}
+}
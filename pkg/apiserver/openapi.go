@@ -0,0 +1,354 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	v1 "minik8s.com/minik8s/pkg/api/v1"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// schema is a json schema in the OpenAPI document
+type schema = map[string]any
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func handleOpenAPI(c *gin.Context) {
+	c.JSON(200, openAPIDocument())
+}
+
+// openAPIDocument generates the OpenAPI v3 document of every resource, the schemas of the
+// built-in kinds are made from their go types and those of the custom kinds from their
+// CustomResourceDefinitions
+func openAPIDocument() gin.H {
+	g := &schemaGenerator{schemas: schema{}, names: map[reflect.Type]string{}}
+	g.schemas["Status"] = schema{
+		"type": "object",
+		"properties": schema{
+			"status":          schema{"type": "string", "enum": []string{"OK", "ERR"}},
+			"id":              schema{"type": "string"},
+			"uid":             schema{"type": "string"},
+			"error":           schema{"type": "string"},
+			"resourceVersion": schema{"type": "string"},
+		},
+	}
+	paths := schema{}
+	for _, res := range resources {
+		ref := g.ref(reflect.TypeOf(res.New()))
+		addResourcePaths(paths, res, ref, "", "", res.CopyStatus != nil)
+		if res.Kind == "Blob" {
+			addBlobDataPaths(paths, res)
+		}
+	}
+	for _, cr := range sortedCustomResources() {
+		for _, version := range cr.servedVersions() {
+			name := cr.group + "." + version + "." + cr.Kind
+			g.schemas[name] = g.customSchema(cr.versions[version])
+			ref := schema{"$ref": "#/components/schemas/" + name}
+			addResourcePaths(paths, cr.Resource, ref, "/apis/"+cr.group+"/"+version, version, false)
+		}
+	}
+	return gin.H{
+		"openapi":    "3.0.0",
+		"info":       gin.H{"title": "minik8s", "version": builtinVersion},
+		"paths":      paths,
+		"components": gin.H{"schemas": g.schemas},
+	}
+}
+
+// addResourcePaths adds the routes of the resource, served under base. The built-in
+// resources have no base, their objects are at /<singular>/{name}.
+func addResourcePaths(paths schema, res *Resource, ref schema, base, version string, status bool) {
+	kv := schema{
+		"type": "object",
+		"properties": schema{
+			"key":             schema{"type": "string"},
+			"type":            schema{"type": "string"},
+			"resourceVersion": schema{"type": "string"},
+			"value":           ref,
+		},
+	}
+	collection := schema{
+		"get":  operation("list "+res.Plural, schema{"type": "array", "items": kv}, nil, listParameters),
+		"post": operation("create a "+res.Kind, statusRef, ref, writeParameters),
+	}
+	object := schema{
+		"get":    operation("read a "+res.Kind, kv, nil, nil),
+		"put":    operation("replace a "+res.Kind, statusRef, ref, writeParameters),
+		"patch":  patchOperation("patch a "+res.Kind, true),
+		"delete": operation("delete a "+res.Kind, statusRef, nil, deleteParameters),
+	}
+	watch := schema{"get": watchOperation("watch " + res.Plural)}
+
+	if base == "" {
+		paths["/"+res.Plural] = schema{"get": collection["get"]}
+		paths["/"+res.Singular] = schema{"post": collection["post"]}
+		paths["/"+res.Singular+"/{name}"] = withParameters(object, "name")
+		paths["/watch/"+res.Plural] = watch
+		paths["/watch/"+res.Singular+"/{name}"] = withParameters(watch, "name")
+		if status {
+			paths["/"+res.Singular+"/{name}/status"] = withParameters(statusOperations(res, ref), "name")
+		}
+	} else {
+		paths[base+"/"+res.Plural] = collection
+		paths[base+"/"+res.Plural+"/{name}"] = withParameters(object, "name")
+		paths["/watch"+base+"/"+res.Plural] = watch
+		paths["/watch"+base+"/"+res.Plural+"/{name}"] = withParameters(watch, "name")
+	}
+	if !res.Namespaced {
+		return
+	}
+	ns := base + "/namespaces/{namespace}/" + res.Plural
+	paths[ns] = withParameters(collection, "namespace")
+	paths[ns+"/{name}"] = withParameters(object, "namespace", "name")
+	paths["/watch"+ns] = withParameters(watch, "namespace")
+	paths["/watch"+ns+"/{name}"] = withParameters(watch, "namespace", "name")
+	if status {
+		paths[ns+"/{name}/status"] = withParameters(statusOperations(res, ref), "namespace", "name")
+	}
+}
+
+var statusRef = schema{"$ref": "#/components/schemas/Status"}
+
+var (
+	listParameters = []schema{
+		queryParameter("labelSelector", "select the objects by their labels, e.g. app=web,tier!=db"),
+		queryParameter("fieldSelector", "select the objects by their fields, e.g. spec.nodeName=N1001"),
+		queryParameter("limit", "the maximum number of objects returned"),
+		queryParameter("continue", "the token of the next page, from the X-Continue header"),
+	}
+	deleteParameters = []schema{
+		queryParameter("propagationPolicy", "Background, Foreground or Orphan"),
+		queryParameter("gracePeriodSeconds", "how long the object is given to terminate"),
+		queryParameter("dryRun", "All to check the request without persisting it"),
+	}
+	writeParameters = []schema{
+		queryParameter("dryRun", "All to check the request without persisting it"),
+		queryParameter("fieldManager", "the name of the writer the changed fields are recorded for"),
+	}
+	applyParameters = append(append([]schema{}, writeParameters...),
+		queryParameter("force", "true to take over the fields owned by other managers on apply"))
+	watchParameters = []schema{
+		queryParameter("resourceVersion", "only send the changes made after it"),
+		queryParameter("labelSelector", "select the objects by their labels"),
+		queryParameter("fieldSelector", "select the objects by their fields"),
+	}
+)
+
+func queryParameter(name, description string) schema {
+	return schema{"name": name, "in": "query", "description": description, "schema": schema{"type": "string"}}
+}
+
+func operation(summary string, response schema, body schema, parameters []schema) schema {
+	op := schema{
+		"summary": summary,
+		"responses": schema{
+			"200": schema{"description": "OK", "content": schema{"application/json": schema{"schema": response}}},
+		},
+	}
+	if body != nil {
+		op["requestBody"] = schema{"required": true, "content": schema{"application/json": schema{"schema": body}}}
+	}
+	if parameters != nil {
+		op["parameters"] = parameters
+	}
+	return op
+}
+
+// patchOperation describes a patch, which takes an applied configuration as well if apply is set
+func patchOperation(summary string, apply bool) schema {
+	op := operation(summary, statusRef, nil, writeParameters)
+	content := schema{
+		mergePatchType: schema{"schema": schema{"type": "object"}},
+		jsonPatchType:  schema{"schema": schema{"type": "array", "items": schema{"type": "object"}}},
+	}
+	if apply {
+		op["parameters"] = applyParameters
+		content[applyPatchType] = schema{"schema": schema{"type": "object"}}
+	}
+	op["requestBody"] = schema{"required": true, "content": content}
+	return op
+}
+
+// addBlobDataPaths adds the routes the content of the blobs is uploaded to and
+// downloaded from
+func addBlobDataPaths(paths schema, res *Resource) {
+	content := schema{"application/octet-stream": schema{"schema": schema{"type": "string", "format": "binary"}}}
+	upload := operation("upload the content of a "+res.Kind+", which must match its size and sha256", statusRef, nil, nil)
+	upload["requestBody"] = schema{"required": true, "content": content}
+	download := schema{
+		"summary":   "download the content of a " + res.Kind,
+		"responses": schema{"200": schema{"description": "the content", "content": content}},
+	}
+	data := schema{"put": upload, "get": download}
+	paths["/"+res.Singular+"/{name}/"+blobDataSubresource] = withParameters(data, "name")
+	paths["/namespaces/{namespace}/"+res.Plural+"/{name}/"+blobDataSubresource] = withParameters(data, "namespace", "name")
+}
+
+func watchOperation(summary string) schema {
+	event := schema{"schema": schema{"type": "string"}}
+	return schema{
+		"summary":    summary,
+		"parameters": watchParameters,
+		"responses": schema{
+			"200": schema{"description": "a stream of events", "content": schema{
+				watchJSONLines.contentType:  event,
+				watchEventStream.contentType: event,
+				watchLegacy.contentType:      event,
+			}},
+		},
+	}
+}
+
+func statusOperations(res *Resource, ref schema) schema {
+	patch := patchOperation("patch the status of a "+res.Kind, false)
+	return schema{
+		"put":   operation("replace the status of a "+res.Kind, statusRef, ref, writeParameters),
+		"patch": patch,
+	}
+}
+
+// withParameters returns the operations with the path parameters added to each one
+func withParameters(operations schema, names ...string) schema {
+	var parameters []schema
+	for _, name := range names {
+		parameters = append(parameters, schema{"name": name, "in": "path", "required": true, "schema": schema{"type": "string"}})
+	}
+	result := schema{}
+	for method, op := range operations {
+		op := op.(schema)
+		copied := schema{}
+		for k, v := range op {
+			copied[k] = v
+		}
+		if query, ok := op["parameters"].([]schema); ok {
+			copied["parameters"] = append(append([]schema{}, parameters...), query...)
+		} else {
+			copied["parameters"] = parameters
+		}
+		result[method] = copied
+	}
+	return result
+}
+
+// schemaGenerator makes the schemas of the go types, every named struct is a schema of
+// the components referred to by $ref
+type schemaGenerator struct {
+	schemas schema
+	names   map[reflect.Type]string
+}
+
+// ref returns the schema of the type
+func (g *schemaGenerator) ref(t reflect.Type) schema {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch {
+	case t == timeType:
+		return schema{"type": "string", "format": "date-time"}
+	case t == reflect.TypeOf(json.RawMessage{}):
+		return schema{}
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.structSchema(t)
+		}
+		name, exist := g.names[t]
+		if !exist {
+			name = g.nameOf(t)
+			g.names[t] = name
+			// registered before its fields, so that a recursive type refers to itself
+			g.schemas[name] = schema{}
+			g.schemas[name] = g.structSchema(t)
+		}
+		return schema{"$ref": "#/components/schemas/" + name}
+	case reflect.Map:
+		return schema{"type": "object", "additionalProperties": g.ref(t.Elem())}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return schema{"type": "string", "format": "byte"}
+		}
+		return schema{"type": "array", "items": g.ref(t.Elem())}
+	case reflect.String:
+		return schema{"type": "string"}
+	case reflect.Bool:
+		return schema{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return schema{"type": "integer", "format": "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return schema{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return schema{"type": "number"}
+	}
+	// an interface may hold anything
+	return schema{}
+}
+
+// nameOf names the schema of the type after it, prefixed with its package if another
+// type of the same name has been met
+func (g *schemaGenerator) nameOf(t reflect.Type) string {
+	name := t.Name()
+	if _, taken := g.schemas[name]; !taken {
+		return name
+	}
+	pkg := t.PkgPath()
+	return pkg[strings.LastIndex(pkg, "/")+1:] + "." + name
+}
+
+func (g *schemaGenerator) structSchema(t reflect.Type) schema {
+	properties := schema{}
+	g.addFields(properties, t)
+	return schema{"type": "object", "properties": properties}
+}
+
+// addFields adds the fields encoded by encoding/json, those of the embedded structs
+// without a json name are inlined
+func (g *schemaGenerator) addFields(properties schema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				g.addFields(properties, embedded)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = g.ref(field.Type)
+	}
+}
+
+// customSchema returns the schema of the objects of a custom kind, made of the schema of
+// the version with the kind, apiversion and metadata added
+func (g *schemaGenerator) customSchema(props *v1.JSONSchemaProps) schema {
+	s := schema{"type": "object"}
+	if props != nil {
+		buf, _ := json.Marshal(props)
+		_ = json.Unmarshal(buf, &s)
+	}
+	properties, _ := s["properties"].(map[string]any)
+	if properties == nil {
+		properties = schema{}
+	}
+	properties["kind"] = schema{"type": "string"}
+	properties["apiversion"] = schema{"type": "string"}
+	properties["metadata"] = g.ref(reflect.TypeOf(v1.ObjectMeta{}))
+	s["properties"] = properties
+	return s
+}
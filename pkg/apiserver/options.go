@@ -0,0 +1,92 @@
+/*
+	options：api server的所有配置项及其命令行参数，按子系统分组
+*/
+package apiserver
+
+import (
+	"flag"
+	"strings"
+	"time"
+)
+
+// Options configure the api server, the authentication and authorization, the audit log,
+// the storage and the blobs
+type Options struct {
+	// TLSCertFile and TLSPrivateKeyFile make the server serve https
+	TLSCertFile       string
+	TLSPrivateKeyFile string
+	// ClientCAFile verifies the client certificates, the common name of a certificate is
+	// the user and its organizations are the groups. It requires https.
+	ClientCAFile string
+	// TokenAuthFile is a csv file of static bearer tokens, one per line:
+	// token,user,uid,"group1,group2"
+	TokenAuthFile string
+	// AnonymousAuth lets the requests without credentials in as system:anonymous. It
+	// is implied if neither client certificates nor tokens are configured.
+	AnonymousAuth bool
+	// AuthorizationMode is the comma separated authorizers asked in turn, of AlwaysAllow,
+	// Node and RBAC
+	AuthorizationMode string
+
+	// AuditLogPath is the file of the audit log, - means stdout and empty disables it
+	AuditLogPath string
+	// AuditPolicyFile is the json AuditPolicy, the metadata of the mutating requests are
+	// recorded without one
+	AuditPolicyFile string
+	// AuditLogMaxSize is the size in megabytes the audit log is rotated at, 0 never rotates
+	AuditLogMaxSize int
+	// AuditLogMaxBackups is the number of rotated audit logs kept
+	AuditLogMaxBackups int
+
+	// StorageBackend is where the objects are kept, etcd3 or memory
+	StorageBackend string
+	// EtcdServers are the etcd endpoints, the one in config is used if empty
+	EtcdServers []string
+	// WatchCacheSize is the number of recent events cached per resource, the lists and
+	// watches are served by the storage if it is 0
+	WatchCacheSize int
+	// CompactionInterval is how often the history of the storage is compacted, 0 never
+	// compacts it
+	CompactionInterval time.Duration
+	// DefragInterval is how often the storage is defragmented if enough of it is free, 0
+	// never defragments it
+	DefragInterval time.Duration
+
+	// BlobDir is the directory the content of the blobs is stored in
+	BlobDir string
+	// MaxBlobSize is the largest content of a blob in bytes
+	MaxBlobSize int64
+	// BlobQuota is the total size in bytes of the blobs of a namespace, 0 means no quota
+	BlobQuota int64
+}
+
+// AddFlags binds the options to the command line flags of fs, with their defaults
+func (opts *Options) AddFlags(fs *flag.FlagSet) {
+	fs.StringVar(&opts.TLSCertFile, "tls-cert-file", "", "certificate of the server, serve https if set")
+	fs.StringVar(&opts.TLSPrivateKeyFile, "tls-private-key-file", "", "private key of the server certificate")
+	fs.StringVar(&opts.ClientCAFile, "client-ca-file", "", "CA verifying the client certificates")
+	fs.StringVar(&opts.TokenAuthFile, "token-auth-file", "", "csv file of bearer tokens: token,user,uid,\"group1,group2\"")
+	fs.BoolVar(&opts.AnonymousAuth, "anonymous-auth", false, "let the requests without credentials in as system:anonymous")
+	fs.StringVar(&opts.AuthorizationMode, "authorization-mode", ModeAlwaysAllow, "comma separated authorizers of AlwaysAllow, Node, RBAC, e.g. Node,RBAC")
+
+	fs.StringVar(&opts.AuditLogPath, "audit-log-path", "", "file of the audit log, - means stdout, disabled if empty")
+	fs.StringVar(&opts.AuditPolicyFile, "audit-policy-file", "", "json audit policy, the metadata of the mutating requests are recorded without one")
+	fs.IntVar(&opts.AuditLogMaxSize, "audit-log-maxsize", 100, "size in megabytes the audit log is rotated at")
+	fs.IntVar(&opts.AuditLogMaxBackups, "audit-log-maxbackup", 10, "number of rotated audit logs kept")
+
+	fs.StringVar(&opts.StorageBackend, "storage-backend", StorageEtcd, "where the objects are kept, etcd3 or memory")
+	fs.Func("etcd-servers", "comma separated etcd endpoints, the one in config is used if empty", func(value string) error {
+		opts.EtcdServers = nil
+		if value != "" {
+			opts.EtcdServers = strings.Split(value, ",")
+		}
+		return nil
+	})
+	fs.IntVar(&opts.WatchCacheSize, "watch-cache-size", DefaultWatchCacheSize, "number of recent events cached per resource, 0 disables the watch cache")
+	fs.DurationVar(&opts.CompactionInterval, "etcd-compaction-interval", DefaultCompactionInterval, "how often the history of the storage is compacted, 0 disables the compaction")
+	fs.DurationVar(&opts.DefragInterval, "etcd-defrag-interval", DefaultDefragInterval, "how often the storage is defragmented if half of it is free, 0 disables the defragmentation")
+
+	fs.StringVar(&opts.BlobDir, "blob-dir", DefaultBlobDir, "directory the content of the blobs is stored in")
+	fs.Int64Var(&opts.MaxBlobSize, "max-blob-size", DefaultMaxBlobSize, "largest content of a blob in bytes")
+	fs.Int64Var(&opts.BlobQuota, "blob-namespace-quota", DefaultBlobQuota, "total size in bytes of the blobs of a namespace, 0 means no quota")
+}
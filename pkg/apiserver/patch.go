@@ -0,0 +1,323 @@
+/*
+	patch：PATCH请求的两种格式，json merge patch (RFC 7386) 与 json patch (RFC 6902)，
+	都作用在存储中对象的json上
+*/
+package apiserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// the Content-Types of the patches
+const (
+	mergePatchType = "application/merge-patch+json"
+	jsonPatchType  = "application/json-patch+json"
+)
+
+// applyPatch returns the json of the document with the patch applied
+func applyPatch(patchType string, doc, patch []byte) ([]byte, error) {
+	var target interface{}
+	if err := decodeJSON(doc, &target); err != nil {
+		return nil, err
+	}
+	var err error
+	switch patchType {
+	case mergePatchType:
+		var p interface{}
+		if err = decodeJSON(patch, &p); err != nil {
+			return nil, err
+		}
+		target = mergePatch(target, p)
+	case jsonPatchType:
+		var ops []jsonPatchOp
+		if err = decodeJSON(patch, &ops); err != nil {
+			return nil, err
+		}
+		target, err = applyJSONPatch(target, ops)
+	default:
+		err = fmt.Errorf("unsupported patch type %q", patchType)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(target)
+}
+
+// decodeJSON keeps the numbers as they are, so that large integers survive a patch
+func decodeJSON(buf []byte, v interface{}) error {
+	d := json.NewDecoder(bytes.NewReader(buf))
+	d.UseNumber()
+	return d.Decode(v)
+}
+
+// mergePatch merges the patch into the target: a null removes the field, an object is
+// merged field by field and anything else, arrays included, replaces the field
+func mergePatch(target, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = map[string]interface{}{}
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(t, k)
+		} else {
+			t[k] = mergePatch(t[k], v)
+		}
+	}
+	return t
+}
+
+// jsonPatchOp is an operation of a json patch
+type jsonPatchOp struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// applyJSONPatch applies the operations in order, the first failing one fails the patch
+func applyJSONPatch(doc interface{}, ops []jsonPatchOp) (interface{}, error) {
+	for i, op := range ops {
+		var err error
+		doc, err = op.apply(doc)
+		if err != nil {
+			return nil, fmt.Errorf("operation %d (%s %s): %v", i, op.Op, op.Path, err)
+		}
+	}
+	return doc, nil
+}
+
+func (op *jsonPatchOp) value() (interface{}, error) {
+	if op.Value == nil {
+		return nil, errors.New("missing value")
+	}
+	var v interface{}
+	err := decodeJSON(op.Value, &v)
+	return v, err
+}
+
+func (op *jsonPatchOp) apply(doc interface{}) (interface{}, error) {
+	switch op.Op {
+	case "add", "replace", "test":
+		v, err := op.value()
+		if err != nil {
+			return nil, err
+		}
+		if op.Op == "add" {
+			return addValue(doc, op.Path, v)
+		}
+		cur, err := getValue(doc, op.Path)
+		if err != nil {
+			return nil, err
+		}
+		if op.Op == "test" {
+			if !reflect.DeepEqual(normalize(cur), normalize(v)) {
+				return nil, errors.New("test failed")
+			}
+			return doc, nil
+		}
+		if op.Path == "" {
+			return v, nil
+		}
+		if doc, err = removeValue(doc, op.Path); err != nil {
+			return nil, err
+		}
+		return addValue(doc, op.Path, v)
+	case "remove":
+		return removeValue(doc, op.Path)
+	case "move", "copy":
+		v, err := getValue(doc, op.From)
+		if err != nil {
+			return nil, err
+		}
+		if op.Op == "move" {
+			if strings.HasPrefix(op.Path, op.From+"/") {
+				return nil, errors.New("cannot move a value into itself")
+			}
+			if doc, err = removeValue(doc, op.From); err != nil {
+				return nil, err
+			}
+		} else {
+			// the copy must not share the containers of the original
+			buf, _ := json.Marshal(v)
+			_ = decodeJSON(buf, &v)
+		}
+		return addValue(doc, op.Path, v)
+	default:
+		return nil, fmt.Errorf("unknown op %q", op.Op)
+	}
+}
+
+// normalize makes numbers written differently, e.g. 1 and 1.0, compare equal
+func normalize(v interface{}) interface{} {
+	switch v := v.(type) {
+	case json.Number:
+		f, err := v.Float64()
+		if err != nil {
+			return v.String()
+		}
+		return f
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			m[k] = normalize(e)
+		}
+		return m
+	case []interface{}:
+		a := make([]interface{}, len(v))
+		for i, e := range v {
+			a[i] = normalize(e)
+		}
+		return a
+	}
+	return v
+}
+
+// splitPointer splits a json pointer into its unescaped tokens, "" is the whole document
+func splitPointer(path string) ([]string, error) {
+	if path == "" {
+		return nil, nil
+	}
+	if path[0] != '/' {
+		return nil, fmt.Errorf("invalid path %q", path)
+	}
+	tokens := strings.Split(path[1:], "/")
+	for i, t := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(t, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+// arrayIndex parses the index of an array of length n, end allows "-" and n for an add
+func arrayIndex(token string, n int, end bool) (int, error) {
+	if end && token == "-" {
+		return n, nil
+	}
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || i > n || (i == n && !end) || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	return i, nil
+}
+
+func getValue(doc interface{}, path string) (interface{}, error) {
+	tokens, err := splitPointer(path)
+	if err != nil {
+		return nil, err
+	}
+	cur := doc
+	for _, t := range tokens {
+		switch c := cur.(type) {
+		case map[string]interface{}:
+			v, ok := c[t]
+			if !ok {
+				return nil, fmt.Errorf("path %q does not exist", path)
+			}
+			cur = v
+		case []interface{}:
+			i, err := arrayIndex(t, len(c), false)
+			if err != nil {
+				return nil, err
+			}
+			cur = c[i]
+		default:
+			return nil, fmt.Errorf("path %q does not exist", path)
+		}
+	}
+	return cur, nil
+}
+
+// setChild calls set on the parent of the path, and puts the container set returns
+// back where the parent was, since appending to an array makes a new slice
+func setChild(doc interface{}, path string, set func(parent interface{}, token string) (interface{}, error)) (interface{}, error) {
+	tokens, err := splitPointer(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return set(nil, "")
+	}
+	parentPath := ""
+	for _, t := range tokens[:len(tokens)-1] {
+		parentPath += "/" + strings.ReplaceAll(strings.ReplaceAll(t, "~", "~0"), "/", "~1")
+	}
+	parent, err := getValue(doc, parentPath)
+	if err != nil {
+		return nil, err
+	}
+	parent, err = set(parent, tokens[len(tokens)-1])
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 1 {
+		return parent, nil
+	}
+	grand, err := getValue(doc, parentPath[:strings.LastIndex(parentPath, "/")])
+	if err != nil {
+		return nil, err
+	}
+	switch g := grand.(type) {
+	case map[string]interface{}:
+		g[tokens[len(tokens)-2]] = parent
+	case []interface{}:
+		i, _ := arrayIndex(tokens[len(tokens)-2], len(g), false)
+		g[i] = parent
+	}
+	return doc, nil
+}
+
+func addValue(doc interface{}, path string, v interface{}) (interface{}, error) {
+	if path == "" {
+		return v, nil
+	}
+	return setChild(doc, path, func(parent interface{}, token string) (interface{}, error) {
+		switch p := parent.(type) {
+		case map[string]interface{}:
+			p[token] = v
+			return p, nil
+		case []interface{}:
+			i, err := arrayIndex(token, len(p), true)
+			if err != nil {
+				return nil, err
+			}
+			p = append(p, nil)
+			copy(p[i+1:], p[i:])
+			p[i] = v
+			return p, nil
+		}
+		return nil, fmt.Errorf("the parent of path %q is not an object or array", path)
+	})
+}
+
+func removeValue(doc interface{}, path string) (interface{}, error) {
+	if path == "" {
+		return nil, errors.New("cannot remove the whole document")
+	}
+	return setChild(doc, path, func(parent interface{}, token string) (interface{}, error) {
+		switch p := parent.(type) {
+		case map[string]interface{}:
+			if _, ok := p[token]; !ok {
+				return nil, fmt.Errorf("path %q does not exist", path)
+			}
+			delete(p, token)
+			return p, nil
+		case []interface{}:
+			i, err := arrayIndex(token, len(p), false)
+			if err != nil {
+				return nil, err
+			}
+			return append(p[:i], p[i+1:]...), nil
+		}
+		return nil, fmt.Errorf("path %q does not exist", path)
+	})
+}
@@ -0,0 +1,149 @@
+package apiserver
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestApplyPatch(t *testing.T) {
+	tests := []struct {
+		name      string
+		patchType string
+		doc       string
+		patch     string
+		want      string
+		wantErr   bool
+	}{
+		// json merge patch, RFC 7386
+		{name: "merge replaces a field", patchType: mergePatchType,
+			doc: `{"a":"b"}`, patch: `{"a":"c"}`, want: `{"a":"c"}`},
+		{name: "merge adds a field", patchType: mergePatchType,
+			doc: `{"a":"b"}`, patch: `{"b":"c"}`, want: `{"a":"b","b":"c"}`},
+		{name: "merge null removes a field", patchType: mergePatchType,
+			doc: `{"a":"b","b":"c"}`, patch: `{"a":null}`, want: `{"b":"c"}`},
+		{name: "merge objects field by field", patchType: mergePatchType,
+			doc: `{"a":{"b":"c","d":"e"}}`, patch: `{"a":{"d":null,"f":"g"}}`, want: `{"a":{"b":"c","f":"g"}}`},
+		{name: "merge replaces arrays", patchType: mergePatchType,
+			doc: `{"a":[1,2,3]}`, patch: `{"a":[4]}`, want: `{"a":[4]}`},
+		{name: "merge an object over a scalar", patchType: mergePatchType,
+			doc: `{"a":"b"}`, patch: `{"a":{"c":null,"d":"e"}}`, want: `{"a":{"d":"e"}}`},
+		{name: "merge keeps large integers", patchType: mergePatchType,
+			doc: `{"a":9007199254740993}`, patch: `{"b":1}`, want: `{"a":9007199254740993,"b":1}`},
+		{name: "merge an invalid patch", patchType: mergePatchType,
+			doc: `{"a":"b"}`, patch: `{"a":`, wantErr: true},
+
+		// json patch, RFC 6902
+		{name: "add a field", patchType: jsonPatchType,
+			doc: `{"a":"b"}`, patch: `[{"op":"add","path":"/c","value":"d"}]`, want: `{"a":"b","c":"d"}`},
+		{name: "add into an array", patchType: jsonPatchType,
+			doc: `{"a":[1,3]}`, patch: `[{"op":"add","path":"/a/1","value":2}]`, want: `{"a":[1,2,3]}`},
+		{name: "add at the end of an array", patchType: jsonPatchType,
+			doc: `{"a":[1]}`, patch: `[{"op":"add","path":"/a/-","value":2}]`, want: `{"a":[1,2]}`},
+		{name: "add past the end of an array", patchType: jsonPatchType,
+			doc: `{"a":[1]}`, patch: `[{"op":"add","path":"/a/3","value":2}]`, wantErr: true},
+		{name: "remove a field", patchType: jsonPatchType,
+			doc: `{"a":"b","c":"d"}`, patch: `[{"op":"remove","path":"/a"}]`, want: `{"c":"d"}`},
+		{name: "remove an array element", patchType: jsonPatchType,
+			doc: `{"a":[1,2,3]}`, patch: `[{"op":"remove","path":"/a/1"}]`, want: `{"a":[1,3]}`},
+		{name: "remove a missing field", patchType: jsonPatchType,
+			doc: `{"a":"b"}`, patch: `[{"op":"remove","path":"/c"}]`, wantErr: true},
+		{name: "replace a field", patchType: jsonPatchType,
+			doc: `{"a":"b"}`, patch: `[{"op":"replace","path":"/a","value":{"c":1}}]`, want: `{"a":{"c":1}}`},
+		{name: "replace a missing field", patchType: jsonPatchType,
+			doc: `{"a":"b"}`, patch: `[{"op":"replace","path":"/c","value":1}]`, wantErr: true},
+		{name: "move a field", patchType: jsonPatchType,
+			doc: `{"a":{"b":1},"c":{}}`, patch: `[{"op":"move","from":"/a/b","path":"/c/d"}]`, want: `{"a":{},"c":{"d":1}}`},
+		{name: "copy a field", patchType: jsonPatchType,
+			doc: `{"a":[1]}`, patch: `[{"op":"copy","from":"/a","path":"/b"}]`, want: `{"a":[1],"b":[1]}`},
+		{name: "test a value", patchType: jsonPatchType,
+			doc: `{"a":1}`, patch: `[{"op":"test","path":"/a","value":1.0},{"op":"add","path":"/b","value":2}]`, want: `{"a":1,"b":2}`},
+		{name: "test a different value", patchType: jsonPatchType,
+			doc: `{"a":1}`, patch: `[{"op":"test","path":"/a","value":2},{"op":"add","path":"/b","value":2}]`, wantErr: true},
+		{name: "escaped pointer", patchType: jsonPatchType,
+			doc: `{"a/b":{"c~d":1}}`, patch: `[{"op":"replace","path":"/a~1b/c~0d","value":2}]`, want: `{"a/b":{"c~d":2}}`},
+		{name: "unknown op", patchType: jsonPatchType,
+			doc: `{"a":1}`, patch: `[{"op":"frobnicate","path":"/a"}]`, wantErr: true},
+		{name: "a failing op fails the whole patch", patchType: jsonPatchType,
+			doc: `{"a":1}`, patch: `[{"op":"add","path":"/b","value":2},{"op":"remove","path":"/c"}]`, wantErr: true},
+
+		{name: "unsupported patch type", patchType: "application/json",
+			doc: `{"a":1}`, patch: `{"a":2}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := applyPatch(tt.patchType, []byte(tt.doc), []byte(tt.patch))
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("applyPatch = %s, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("applyPatch error: %v", err)
+			}
+			var gotDoc, wantDoc interface{}
+			if err = decodeJSON(got, &gotDoc); err != nil {
+				t.Fatal(err)
+			}
+			if err = decodeJSON([]byte(tt.want), &wantDoc); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(gotDoc, wantDoc) {
+				t.Errorf("applyPatch = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPatchObject(t *testing.T) {
+	tests := []struct {
+		name        string
+		path        string
+		contentType string
+		patch       string
+		wantCode    int
+		// wantStored is a part of the pod stored afterwards
+		wantStored string
+	}{
+		{name: "merge patch", path: "/pod/a", contentType: mergePatchType,
+			patch: `{"metadata":{"labels":{"app":"web"}}}`, wantCode: 200, wantStored: `"labels":{"app":"web"}`},
+		{name: "json patch", path: "/pod/a", contentType: jsonPatchType,
+			patch: `[{"op":"add","path":"/metadata/labels","value":{"app":"db"}}]`, wantCode: 200, wantStored: `"labels":{"app":"db"}`},
+		{name: "patch at the current resourceVersion", path: "/pod/a", contentType: mergePatchType,
+			patch: `{"metadata":{"resourceVersion":"2","labels":{"app":"web"}}}`, wantCode: 200, wantStored: `"labels":{"app":"web"}`},
+		{name: "patch at a stale resourceVersion", path: "/pod/a", contentType: mergePatchType,
+			patch: `{"metadata":{"resourceVersion":"1","labels":{"app":"web"}}}`, wantCode: 409},
+		{name: "patch of the uid", path: "/pod/a", contentType: mergePatchType,
+			patch: `{"metadata":{"uid":"other"}}`, wantCode: 422},
+		{name: "failing json patch", path: "/pod/a", contentType: jsonPatchType,
+			patch: `[{"op":"test","path":"/metadata/name","value":"b"}]`, wantCode: 422},
+		{name: "patch of the status only", path: "/pod/a/status", contentType: mergePatchType,
+			patch: `{"metadata":{"labels":{"app":"web"}},"status":{"phase":"Running"}}`, wantCode: 200, wantStored: `"phase":"Running"`},
+		{name: "unsupported content type", path: "/pod/a", contentType: "application/json",
+			patch: `{"metadata":{"labels":{"app":"web"}}}`, wantCode: 415},
+		{name: "missing object", path: "/pod/b", contentType: mergePatchType,
+			patch: `{"metadata":{"labels":{"app":"web"}}}`, wantCode: 404},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestServer(t)
+			createPods(t, r, "a")
+			w := serve(r, http.MethodPatch, tt.path, tt.contentType, tt.patch, time.Second)
+			if w.Code != tt.wantCode {
+				t.Fatalf("got %d %s, want %d", w.Code, w.Body, tt.wantCode)
+			}
+			w = serve(r, http.MethodGet, "/pod/a", "", "", time.Second)
+			stored := w.Body.String()
+			if tt.wantStored != "" && !strings.Contains(stored, tt.wantStored) {
+				t.Errorf("stored %s, want it to contain %s", stored, tt.wantStored)
+			}
+			// neither a failed patch nor a patch of the status changes the labels
+			if (tt.wantCode != 200 || strings.HasSuffix(tt.path, "/status")) && strings.Contains(stored, `"labels"`) {
+				t.Errorf("the labels have been patched: %s", stored)
+			}
+		})
+	}
+}
@@ -0,0 +1,155 @@
+package apiserver
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	v1 "minik8s.com/minik8s/pkg/api/v1"
+	"minik8s.com/minik8s/utils/random"
+	"net/http"
+	"strings"
+)
+
+// Resource describes one kind served by the generic REST and watch handlers.
+// Registering a Resource is all it takes to expose a new kind.
+type Resource struct {
+	// Kind is the go type name of the object, e.g. "Pod"
+	Kind string
+
+	// Singular addresses a single object: /<Singular>/:name
+	Singular string
+
+	// Plural addresses the whole collection: /<Plural>
+	Plural string
+
+	// ShortNames are the abbreviations of the kind listed by the discovery, e.g. "po"
+	ShortNames []string
+
+	// EtcdPrefix is the etcd key prefix of the objects, it must end with "/"
+	EtcdPrefix string
+
+	// Namespaced objects are stored under <EtcdPrefix><namespace>/ and are also served at
+	// /namespaces/:ns/<Plural>. The other kinds are cluster scoped.
+	Namespaced bool
+
+	// New returns a pointer to an empty object of this kind
+	New func() v1.Object
+
+	// Fields returns the fields of the object selectable by ?fieldSelector besides
+	// metadata.name, metadata.namespace and metadata.uid
+	Fields func(obj v1.Object) map[string]string
+
+	// BeforeCreate is called after the object is decoded and its UID is assigned
+	BeforeCreate func(obj v1.Object) error
+
+	// BeforeUpdate is called after the object is decoded, before it is persisted
+	BeforeUpdate func(obj v1.Object) error
+
+	// BeforeDelete may forbid deleting the object, namespace is empty for the cluster
+	// scoped kinds
+	BeforeDelete func(namespace, name string) error
+
+	// Contents returns the resources of the objects contained in the object by their key
+	// prefixes. Deleting the object marks it Terminating, its contents are then deleted
+	// one by one and the object goes once they are all gone.
+	Contents func(name string) map[string]*Resource
+
+	// Terminate is called on the object marked Terminating
+	Terminate func(obj v1.Object)
+
+	// CopyStatus copies the status of src into dst. A kind setting it has a status
+	// subresource at /<Singular>/:name/status: updates of the object keep the stored
+	// status, and updates of the status keep everything else.
+	CopyStatus func(dst, src v1.Object)
+
+	// GracePeriodSeconds is the deletionGracePeriodSeconds of an object of this kind marked
+	// for deletion, unless the DELETE request asks for another one
+	GracePeriodSeconds int64
+}
+
+var resources []*Resource
+
+var resourcesByKind = map[string]*Resource{}
+
+func registerResource(res *Resource) {
+	if _, exist := resourcesByKind[res.Kind]; exist {
+		panic("resource " + res.Kind + " registered twice")
+	}
+	resources = append(resources, res)
+	resourcesByKind[res.Kind] = res
+}
+
+// key returns the etcd key of the object, namespace is ignored for cluster scoped kinds
+func (res *Resource) key(namespace, name string) string {
+	return res.prefix(namespace) + name
+}
+
+// prefix returns the etcd key prefix of the objects in the namespace, or of all the
+// objects if namespace is empty
+func (res *Resource) prefix(namespace string) string {
+	if !res.Namespaced || namespace == "" {
+		return res.EtcdPrefix
+	}
+	return res.EtcdPrefix + namespace + "/"
+}
+
+// newUID returns the UID of a new object, which is unique in time and space
+func newUID() string {
+	return uuid.NewString()
+}
+
+// generateName appends a random suffix to the generateName prefix of an object
+func generateName(prefix string) string {
+	return prefix + strings.ToLower(random.String(5))
+}
+
+// installResources mounts the REST and watch routes of every registered resource.
+// Lists and watches of /<Plural> span all namespaces, while the objects of a
+// namespaced kind at /<Singular>/:name are those of the default namespace.
+func installResources(r *gin.Engine) {
+	for _, res := range resources {
+		handle(r, http.MethodGet, "/"+res.Plural, res, v1.VerbList, res.handleList)
+		handle(r, http.MethodGet, "/"+res.Singular+"/:name", res, v1.VerbGet, res.handleGet)
+		handle(r, http.MethodPost, "/"+res.Singular, res, v1.VerbCreate, res.handleCreate)
+		handle(r, http.MethodPut, "/"+res.Singular+"/:name", res, v1.VerbUpdate, res.handleUpdate)
+		handle(r, http.MethodPatch, "/"+res.Singular+"/:name", res, v1.VerbPatch, res.handlePatch)
+		handle(r, http.MethodDelete, "/"+res.Singular+"/:name", res, v1.VerbDelete, res.handleDelete)
+
+		handle(r, http.MethodGet, "/watch/"+res.Plural, res, v1.VerbWatch, res.handleWatchList)
+		handle(r, http.MethodGet, "/watch/"+res.Singular+"/:name", res, v1.VerbWatch, res.handleWatch)
+
+		if res.CopyStatus != nil {
+			handleSubresource(r, http.MethodPut, "/"+res.Singular+"/:name/status", res, "status", v1.VerbUpdate, res.handleUpdateStatus)
+			handleSubresource(r, http.MethodPatch, "/"+res.Singular+"/:name/status", res, "status", v1.VerbPatch, res.handlePatchStatus)
+		}
+
+		if !res.Namespaced {
+			continue
+		}
+		handle(r, http.MethodGet, "/namespaces/:ns/"+res.Plural, res, v1.VerbList, res.handleList)
+		handle(r, http.MethodGet, "/namespaces/:ns/"+res.Plural+"/:name", res, v1.VerbGet, res.handleGet)
+		handle(r, http.MethodPost, "/namespaces/:ns/"+res.Plural, res, v1.VerbCreate, res.handleCreate)
+		handle(r, http.MethodPut, "/namespaces/:ns/"+res.Plural+"/:name", res, v1.VerbUpdate, res.handleUpdate)
+		handle(r, http.MethodPatch, "/namespaces/:ns/"+res.Plural+"/:name", res, v1.VerbPatch, res.handlePatch)
+		handle(r, http.MethodDelete, "/namespaces/:ns/"+res.Plural+"/:name", res, v1.VerbDelete, res.handleDelete)
+
+		handle(r, http.MethodGet, "/watch/namespaces/:ns/"+res.Plural, res, v1.VerbWatch, res.handleWatchList)
+		handle(r, http.MethodGet, "/watch/namespaces/:ns/"+res.Plural+"/:name", res, v1.VerbWatch, res.handleWatch)
+
+		if res.CopyStatus != nil {
+			handleSubresource(r, http.MethodPut, "/namespaces/:ns/"+res.Plural+"/:name/status", res, "status", v1.VerbUpdate, res.handleUpdateStatus)
+			handleSubresource(r, http.MethodPatch, "/namespaces/:ns/"+res.Plural+"/:name/status", res, "status", v1.VerbPatch, res.handlePatchStatus)
+		}
+	}
+}
+
+// namespaceContents returns the resources of all the objects in the namespace by their
+// key prefixes, those of the custom resources included
+func namespaceContents(namespace string) map[string]*Resource {
+	contents := map[string]*Resource{}
+	for _, res := range allResources() {
+		if res.Namespaced {
+			contents[res.prefix(namespace)] = res
+		}
+	}
+	return contents
+}
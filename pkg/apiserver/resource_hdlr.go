@@ -0,0 +1,684 @@
+/*
+	通用的REST与watch handler，所有通过registerResource注册的资源共用这些接口
+*/
+package apiserver
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"io"
+	"k8s.io/klog"
+	"minik8s.com/minik8s/config"
+	v1 "minik8s.com/minik8s/pkg/api/v1"
+	"minik8s.com/minik8s/pkg/apiserver/storage"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// handleList replies the objects as a json array. With ?limit=N at most N objects are
+// replied, and if there are more the X-Continue header carries the token to get the
+// next page with ?continue=. All the pages are read at the revision of the first one.
+func (res *Resource) handleList(c *gin.Context) {
+	filter, ok := res.filter(c)
+	if !ok {
+		return
+	}
+	prefix := res.prefix(c.Param("ns"))
+	limit, token, ok := listPage(c, prefix)
+	if !ok {
+		return
+	}
+	kvs, rev, more, err := cachedListRange(res.EtcdPrefix, prefix, token.Start, token.Rev, limit)
+	if err == storage.ErrCompacted {
+		c.JSON(410, gin.H{"status": "ERR", "error": "the continue token has expired, list again from the beginning"})
+		return
+	} else if err != nil {
+		c.JSON(500, gin.H{"status": "ERR", "error": err.Error()})
+		return
+	}
+	if more && len(kvs) != 0 {
+		next := continueToken{Rev: rev, Start: kvs[len(kvs)-1].Key + "\x00"}
+		c.Header(continueHeader, next.encode())
+	}
+	kvs = filter.filterList(kvs)
+	if kvs == nil {
+		kvs = []KV{}
+	}
+	for i := range kvs {
+		withResourceVersion(&kvs[i], res.New)
+	}
+	c.Header(resourceVersionHeader, strconv.FormatInt(rev, 10))
+	c.JSON(200, kvs)
+}
+
+func (res *Resource) handleGet(c *gin.Context) {
+	kv, err := cachedGet(res.EtcdPrefix, res.key(res.namespace(c), c.Param("name")))
+	if err != nil {
+		c.JSON(500, gin.H{"status": "ERR", "error": err.Error()})
+	} else if kv.Type == config.AS_OP_ERROR_String {
+		c.JSON(404, gin.H{"status": "ERR", "error": "No such " + res.Singular})
+	} else {
+		withResourceVersion(&kv, res.New)
+		c.JSON(200, kv)
+	}
+}
+
+func (res *Resource) handleCreate(c *gin.Context) {
+	dryRun, ok := dryRunOf(c)
+	if !ok {
+		return
+	}
+	obj, err := res.decode(c)
+	if err != nil {
+		c.JSON(500, gin.H{"status": "ERR", "error": err.Error()})
+		return
+	}
+	obj.GetObjectMeta().ManagedFields = createdFields(obj, fieldManagerOf(c))
+	res.create(c, obj, dryRun)
+}
+
+// create stores the object posted or applied, or only replies it if dryRun is set
+func (res *Resource) create(c *gin.Context, obj v1.Object, dryRun bool) {
+	meta := obj.GetObjectMeta()
+	namespace := res.namespace(c)
+	if res.Namespaced && c.Param("ns") == "" {
+		// posted without a namespace in the url, the object tells where it goes
+		namespace = v1.NamespaceOf(meta)
+	}
+	if !res.bindNamespace(c, meta, namespace) {
+		return
+	}
+	if res.Namespaced {
+		ns := &v1.Namespace{}
+		if !getObject(resourcesByKind["Namespace"].key("", namespace), ns) {
+			c.JSON(404, gin.H{"status": "ERR", "error": "No such namespace " + namespace})
+			return
+		} else if ns.Status.Phase == v1.NamespaceTerminating {
+			c.JSON(403, gin.H{"status": "ERR", "error": "unable to create new content in namespace " +
+				namespace + " because it is being terminated"})
+			return
+		}
+	}
+	meta.UID = newUID()
+	meta.ResourceVersion = ""
+	meta.DeletionTimestamp = nil
+	meta.DeletionGracePeriodSeconds = nil
+	if res.BeforeCreate != nil {
+		if err := res.BeforeCreate(obj); err != nil {
+			replyRejected(c, err)
+			return
+		}
+	}
+	if !res.admit(c, obj) {
+		return
+	}
+	// a generated name that happens to be taken is generated again
+	generated := meta.Name == ""
+	if dryRun {
+		if generated {
+			meta.Name = generateName(meta.GenerateName)
+		}
+		if storeTest(res.key(namespace, meta.Name)) {
+			c.JSON(409, gin.H{"status": "ERR", "reason": "AlreadyExists",
+				"error": res.Singular + " \"" + meta.Name + "\" already exists"})
+			return
+		}
+		replyDryRun(c, obj)
+		return
+	}
+	var rev int64
+	var err error
+	for i := 0; ; i++ {
+		if generated {
+			meta.Name = generateName(meta.GenerateName)
+		}
+		buf, _ := json.Marshal(obj)
+		rev, err = storeCreate(res.key(namespace, meta.Name), string(buf))
+		if err != errExists || !generated || i >= maxGenerateNameRetries {
+			break
+		}
+	}
+	if err == errExists {
+		c.JSON(409, gin.H{"status": "ERR", "reason": "AlreadyExists",
+			"error": res.Singular + " \"" + meta.Name + "\" already exists"})
+	} else if err != nil {
+		c.JSON(500, gin.H{"status": "ERR", "error": err.Error()})
+	} else {
+		c.JSON(200, gin.H{"status": "OK", "id": meta.Name, "uid": meta.UID, "resourceVersion": strconv.FormatInt(rev, 10)})
+	}
+}
+
+// how many times a name is generated again if the generated one is taken
+const maxGenerateNameRetries = 5
+
+func (res *Resource) handleUpdate(c *gin.Context) {
+	res.update(c, false)
+}
+
+// handleUpdateStatus replaces the status of the object, everything else is kept
+func (res *Resource) handleUpdateStatus(c *gin.Context) {
+	res.update(c, true)
+}
+
+func (res *Resource) handlePatch(c *gin.Context) {
+	res.patch(c, false)
+}
+
+// handlePatchStatus patches the status of the object, the changes elsewhere are ignored
+func (res *Resource) handlePatchStatus(c *gin.Context) {
+	res.patch(c, true)
+}
+
+// update replaces the object, or its status if status is set, with the one in the body
+func (res *Resource) update(c *gin.Context, status bool) {
+	dryRun, ok := dryRunOf(c)
+	if !ok {
+		return
+	}
+	obj, err := res.decode(c)
+	if err != nil {
+		c.JSON(500, gin.H{"status": "ERR", "error": err.Error()})
+		return
+	}
+	// the UID never changes, an update without one keeps the stored one
+	uid := obj.GetObjectMeta().UID
+	res.updateObject(c, writeOptions{dryRun: dryRun, manager: fieldManagerOf(c)}, func(stored v1.Object, cur KV) (v1.Object, bool) {
+		if uid != "" && uid != stored.GetObjectMeta().UID {
+			errs := FieldErrors{{"metadata.uid", "field is immutable"}}
+			c.JSON(422, gin.H{"status": "ERR", "error": errs.Error(), "details": errs})
+			return nil, false
+		}
+		return res.withStatus(obj, stored, status), true
+	})
+}
+
+// patch applies the json merge patch or json patch in the body, as told by the
+// Content-Type, to the stored object, or only to its status if status is set. A patch
+// setting metadata.resourceVersion only applies to that version, the others are
+// applied again to the latest version on a conflict. A configuration applied with the
+// apply Content-Type is merged by server-side apply.
+func (res *Resource) patch(c *gin.Context, status bool) {
+	dryRun, ok := dryRunOf(c)
+	if !ok {
+		return
+	}
+	patchType := strings.TrimSpace(strings.SplitN(c.GetHeader("Content-Type"), ";", 2)[0])
+	if patchType == applyPatchType && !status {
+		res.apply(c, dryRun)
+		return
+	}
+	if patchType != mergePatchType && patchType != jsonPatchType {
+		c.JSON(415, gin.H{"status": "ERR", "error": "unsupported patch type " + strconv.Quote(patchType) +
+			", want " + mergePatchType + ", " + jsonPatchType + " or " + applyPatchType + " on the object"})
+		return
+	}
+	patch, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(500, gin.H{"status": "ERR", "error": err.Error()})
+		return
+	}
+	res.updateObject(c, writeOptions{dryRun: dryRun, manager: fieldManagerOf(c)}, func(stored v1.Object, cur KV) (v1.Object, bool) {
+		withResourceVersion(&cur, res.New)
+		patched, err := applyPatch(patchType, cur.Value, patch)
+		if err != nil {
+			c.JSON(422, gin.H{"status": "ERR", "error": "apply patch: " + err.Error()})
+			return nil, false
+		}
+		obj := res.New()
+		if err = json.Unmarshal(patched, obj); err != nil {
+			c.JSON(422, gin.H{"status": "ERR", "error": "the patched object is invalid: " + err.Error()})
+			return nil, false
+		}
+		meta := obj.GetObjectMeta()
+		if meta.UID != "" && meta.UID != stored.GetObjectMeta().UID {
+			errs := FieldErrors{{"metadata.uid", "field is immutable"}}
+			c.JSON(422, gin.H{"status": "ERR", "error": errs.Error(), "details": errs})
+			return nil, false
+		}
+		if meta.ResourceVersion == cur.ResourceVersion {
+			// left as it was read, the patch is not bound to this version
+			meta.ResourceVersion = ""
+		}
+		return res.withStatus(obj, stored, status), true
+	})
+}
+
+// withStatus returns the object to store for an update of obj, which keeps the stored
+// status. With status set it is an update of the status instead, which keeps all but
+// the status and the resourceVersion of obj. Kinds without a status subresource store
+// obj as it is.
+func (res *Resource) withStatus(obj, stored v1.Object, status bool) v1.Object {
+	if res.CopyStatus == nil {
+		return obj
+	}
+	if !status {
+		res.CopyStatus(obj, stored)
+		return obj
+	}
+	res.CopyStatus(stored, obj)
+	stored.GetObjectMeta().ResourceVersion = obj.GetObjectMeta().ResourceVersion
+	return stored
+}
+
+// updateObject stores the object tryUpdate makes from the stored one, which is read
+// again and passed to tryUpdate again if someone else modified it meanwhile. If the
+// object carries a resourceVersion the update only applies to that version, and a
+// conflict is replied instead. tryUpdate replies the error itself if it returns false.
+func (res *Resource) updateObject(c *gin.Context, opts writeOptions, tryUpdate func(stored v1.Object, cur KV) (v1.Object, bool)) {
+	name := c.Param("name")
+	namespace := res.namespace(c)
+	key := res.key(namespace, name)
+	var meta *v1.ObjectMeta
+	var rev int64
+	var err error
+	for {
+		var cur KV
+		cur, err = storeGet(key)
+		if err != nil {
+			c.JSON(500, gin.H{"status": "ERR", "error": err.Error()})
+			return
+		} else if cur.Type == config.AS_OP_ERROR_String {
+			err = errNotFound
+			break
+		}
+		stored := res.New()
+		if err = json.Unmarshal(cur.Value, stored); err != nil {
+			c.JSON(500, gin.H{"status": "ERR", "error": err.Error()})
+			return
+		}
+		obj, ok := tryUpdate(stored, cur)
+		if !ok {
+			return
+		}
+		meta = obj.GetObjectMeta()
+		if !res.bindNamespace(c, meta, namespace) {
+			return
+		}
+		// the object is always addressed by the url
+		meta.Name = name
+		meta.GenerateName = ""
+		rev, err = parseResourceVersion(meta.ResourceVersion)
+		if err != nil {
+			c.JSON(400, gin.H{"status": "ERR", "error": "invalid resourceVersion " + meta.ResourceVersion})
+			return
+		}
+		meta.ResourceVersion = ""
+		storedMeta := stored.GetObjectMeta()
+		meta.UID = storedMeta.UID
+		// only a DELETE request marks the object for deletion
+		meta.DeletionTimestamp = storedMeta.DeletionTimestamp
+		meta.DeletionGracePeriodSeconds = storedMeta.DeletionGracePeriodSeconds
+		if meta.DeletionTimestamp != nil {
+			for i, f := range meta.Finalizers {
+				if !storedMeta.HasFinalizer(f) {
+					errs := FieldErrors{{"metadata.finalizers[" + strconv.Itoa(i) + "]",
+						"no new finalizers can be added if the object is being deleted"}}
+					c.JSON(422, gin.H{"status": "ERR", "error": errs.Error(), "details": errs})
+					return
+				}
+			}
+		}
+		if opts.manager != "" {
+			// the managed fields are kept by the server, those in the request are ignored
+			buf, _ := json.Marshal(obj)
+			meta.ManagedFields = trackUpdate(storedMeta.ManagedFields, cur.Value, buf, opts.manager)
+		}
+		if res.BeforeUpdate != nil {
+			if err = res.BeforeUpdate(obj); err != nil {
+				replyRejected(c, err)
+				return
+			}
+		}
+		if !res.admit(c, obj) {
+			return
+		}
+		if opts.dryRun {
+			replyDryRun(c, obj)
+			return
+		}
+		expected := rev
+		if expected == 0 {
+			expected = cur.Revision
+		}
+		var newRev int64
+		if meta.DeletionTimestamp != nil && len(meta.Finalizers) == 0 {
+			// the last finalizer is removed, the object goes away
+			newRev, err = storeDelIf(key, expected)
+		} else {
+			buf, _ := json.Marshal(obj)
+			newRev, err = storeUpdate(key, string(buf), expected)
+		}
+		// an unconditional update only conflicts with the read above, read again
+		if err == errConflict && rev == 0 {
+			continue
+		}
+		rev = newRev
+		break
+	}
+	switch err {
+	case nil:
+		c.JSON(200, gin.H{"status": "OK", "id": name, "uid": meta.UID, "resourceVersion": strconv.FormatInt(rev, 10)})
+	case errNotFound:
+		c.JSON(404, gin.H{"status": "ERR", "error": "No such " + res.Singular})
+	case errConflict:
+		c.JSON(409, gin.H{"status": "ERR", "reason": "Conflict", "error": err.Error()})
+	default:
+		c.JSON(500, gin.H{"status": "ERR", "error": err.Error()})
+	}
+}
+
+// handleDelete deletes the object, ?propagationPolicy= tells what happens to its dependents.
+// An object with finalizers or contents is marked for deletion and replied with 202, it
+// is given ?gracePeriodSeconds= to terminate.
+func (res *Resource) handleDelete(c *gin.Context) {
+	dryRun, ok := dryRunOf(c)
+	if !ok {
+		return
+	}
+	opts, ok := deleteOptionsOf(c)
+	if !ok {
+		return
+	}
+	name := c.Param("name")
+	namespace := res.namespace(c)
+	key := res.key(namespace, name)
+	if !storeTest(key) {
+		c.JSON(404, gin.H{"status": "ERR", "error": "No such " + res.Singular})
+		return
+	}
+	if res.BeforeDelete != nil {
+		if err := res.BeforeDelete(namespace, name); err != nil {
+			c.JSON(403, gin.H{"status": "ERR", "error": err.Error()})
+			return
+		}
+	}
+	if dryRun {
+		// nothing happens to the dependents either, only whether the object would be
+		// marked for deletion is replied
+		kv, err := storeGet(key)
+		obj := res.New()
+		if err == nil {
+			err = json.Unmarshal(kv.Value, obj)
+		}
+		if err != nil {
+			c.JSON(500, gin.H{"status": "ERR", "error": err.Error()})
+		} else if len(obj.GetObjectMeta().Finalizers) != 0 || res.Contents != nil {
+			c.JSON(202, gin.H{"status": "OK", "dryRun": true})
+		} else {
+			c.JSON(200, gin.H{"status": "OK", "dryRun": true})
+		}
+		return
+	}
+	marked, err := res.deleteObject(key, name, opts)
+	if err == errNotFound {
+		c.JSON(404, gin.H{"status": "ERR", "error": "No such " + res.Singular})
+	} else if err != nil {
+		c.JSON(500, gin.H{"status": "ERR", "error": err.Error()})
+	} else if marked {
+		c.JSON(202, gin.H{"status": "OK"})
+	} else {
+		c.JSON(200, gin.H{"status": "OK"})
+	}
+}
+
+func (res *Resource) handleWatchList(c *gin.Context) {
+	rev, ok := watchRevision(c)
+	if !ok {
+		return
+	}
+	filter, ok := res.filter(c)
+	if !ok {
+		return
+	}
+	wch, cancel := cachedWatch(res.EtcdPrefix, res.prefix(c.Param("ns")), true, rev)
+	serveWatch(c, wch, cancel, res.New, filter)
+}
+
+func (res *Resource) handleWatch(c *gin.Context) {
+	rev, ok := watchRevision(c)
+	if !ok {
+		return
+	}
+	filter, ok := res.filter(c)
+	if !ok {
+		return
+	}
+	key := res.key(res.namespace(c), c.Param("name"))
+	// a resumed watch must still see the deletion of the object
+	if rev == 0 && !storeTest(key) {
+		c.JSON(404, gin.H{"status": "ERR", "error": "No such " + res.Singular})
+		return
+	}
+	wch, cancel := cachedWatch(res.EtcdPrefix, key, false, rev)
+	serveWatch(c, wch, cancel, res.New, filter)
+}
+
+// namespace returns the namespace addressed by the request, which is the default
+// namespace on the routes without one, and empty for cluster scoped kinds
+func (res *Resource) namespace(c *gin.Context) string {
+	if !res.Namespaced {
+		return ""
+	}
+	if namespace := c.Param("ns"); namespace != "" {
+		return namespace
+	}
+	return v1.NamespaceDefault
+}
+
+// bindNamespace sets the namespace of the object to the one addressed, it replies 400
+// and returns false if the object itself names another namespace. Cluster scoped
+// objects have no namespace.
+func (res *Resource) bindNamespace(c *gin.Context, meta *v1.ObjectMeta, namespace string) bool {
+	if !res.Namespaced {
+		meta.Namespace = ""
+		return true
+	}
+	if meta.Namespace != "" && meta.Namespace != namespace {
+		c.JSON(400, gin.H{"status": "ERR", "error": "the namespace of the object (" + meta.Namespace +
+			") does not match the namespace of the request (" + namespace + ")"})
+		return false
+	}
+	meta.Namespace = namespace
+	return true
+}
+
+// admit runs the admission chain of the kind on the object, it replies 422 with the
+// invalid fields and returns false if the object is rejected
+func (res *Resource) admit(c *gin.Context, obj v1.Object) bool {
+	if errs := admit(res.Kind, obj, userOf(c)); len(errs) != 0 {
+		c.JSON(422, gin.H{"status": "ERR", "error": errs.Error(), "details": errs})
+		return false
+	}
+	return true
+}
+
+// replyRejected replies the error of a BeforeCreate or BeforeUpdate hook, 422 with the
+// invalid fields if it is FieldErrors and 400 otherwise
+func replyRejected(c *gin.Context, err error) {
+	if errs, ok := err.(FieldErrors); ok {
+		c.JSON(422, gin.H{"status": "ERR", "error": errs.Error(), "details": errs})
+		return
+	}
+	c.JSON(400, gin.H{"status": "ERR", "error": err.Error()})
+}
+
+// decode reads the request body into a new object of the resource's kind,
+// an empty body decodes to an empty object.
+func (res *Resource) decode(c *gin.Context) (v1.Object, error) {
+	buf, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		klog.Errorf("error: %v", err)
+		return nil, err
+	}
+	obj := res.New()
+	if len(buf) == 0 {
+		return obj, nil
+	}
+	err = json.Unmarshal(buf, obj)
+	return obj, err
+}
+
+// resourceVersionHeader carries the revision of a list, watch from it to get every
+// change made after the list
+const resourceVersionHeader = "X-Resource-Version"
+
+// withResourceVersion sets kv.ResourceVersion and the resourceVersion of the object
+// in kv.Value to the revision kv was read at. Values of deleted keys are left
+// untouched, and so is the object when newObj is nil.
+func withResourceVersion(kv *KV, newObj func() v1.Object) {
+	if kv.Revision == 0 {
+		return
+	}
+	kv.ResourceVersion = strconv.FormatInt(kv.Revision, 10)
+	if newObj == nil || len(kv.Value) == 0 {
+		return
+	}
+	obj := newObj()
+	if err := json.Unmarshal(kv.Value, obj); err != nil {
+		klog.Errorf("decode %v error: %v", kv.Key, err)
+		return
+	}
+	obj.GetObjectMeta().ResourceVersion = strconv.FormatInt(kv.Revision, 10)
+	if buf, err := json.Marshal(obj); err == nil {
+		kv.Value = buf
+	}
+}
+
+func parseResourceVersion(rv string) (int64, error) {
+	if rv == "" {
+		return 0, nil
+	}
+	return strconv.ParseInt(rv, 10, 64)
+}
+
+// continueHeader carries the token of the next page of a list, it is absent on the last page
+const continueHeader = "X-Continue"
+
+// continueToken tells where the next page of a list starts, and the revision all the
+// pages are read at
+type continueToken struct {
+	Rev   int64  `json:"rev"`
+	Start string `json:"start"`
+}
+
+func (token continueToken) encode() string {
+	buf, _ := json.Marshal(token)
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
+
+// listPage parses ?limit= and ?continue= of a list of the prefix, it replies 400 and
+// returns false if they are invalid. Without ?continue= the list starts from the prefix
+// at the latest revision.
+func listPage(c *gin.Context, prefix string) (int64, continueToken, bool) {
+	token := continueToken{Start: prefix}
+	var limit int64
+	if l := c.Query("limit"); l != "" {
+		var err error
+		limit, err = strconv.ParseInt(l, 10, 64)
+		if err != nil || limit < 0 {
+			c.JSON(400, gin.H{"status": "ERR", "error": "invalid limit " + l})
+			return 0, token, false
+		}
+	}
+	if cont := c.Query("continue"); cont != "" {
+		buf, err := base64.RawURLEncoding.DecodeString(cont)
+		if err == nil {
+			err = json.Unmarshal(buf, &token)
+		}
+		// the token must continue a list of the same collection
+		if err != nil || token.Rev <= 0 || !strings.HasPrefix(token.Start, prefix) {
+			c.JSON(400, gin.H{"status": "ERR", "error": "invalid continue token"})
+			return 0, token, false
+		}
+	}
+	return limit, token, true
+}
+
+// watchRevision parses the ?resourceVersion= the watch resumes from, or the
+// Last-Event-ID header sent by a reconnecting EventSource, it replies 400 and returns
+// false if it is invalid
+func watchRevision(c *gin.Context) (int64, bool) {
+	rv := c.Query("resourceVersion")
+	if rv == "" {
+		rv = c.GetHeader("Last-Event-ID")
+	}
+	rev, err := parseResourceVersion(rv)
+	if err != nil || rev < 0 {
+		c.JSON(400, gin.H{"status": "ERR", "error": "invalid resourceVersion " + rv})
+		return 0, false
+	}
+	return rev, true
+}
+
+// serveWatch streams the watch events to the client in the format negotiated by the
+// Accept header, newline-delimited json by default. Besides PUT and DELETE, BOOKMARK
+// events tell the client the latest revision, and an ERROR event ends the watch if the
+// requested revision has been compacted. If nothing has been sent yet the latter is
+// replied as 410 Gone instead. Only the events of the objects selected by filter are
+// sent, a nil filter selects everything. It returns when the client closes the connection.
+func serveWatch(c *gin.Context, wch chan *KV, cancel context.CancelFunc, newObj func() v1.Object, filter *objectFilter) {
+	defer cancel()
+	format := negotiateWatchFormat(c.GetHeader("Accept"))
+	flusher, _ := c.Writer.(http.Flusher)
+	// the headers are sent with the first event, so that a compacted revision can
+	// still be replied as 410
+	writeHeader := func() {
+		if !c.Writer.Written() {
+			c.Header("Content-Type", format.contentType)
+			c.Header("Cache-Control", "no-cache")
+		}
+	}
+
+	var heartbeat <-chan time.Time
+	if format.heartbeat != nil {
+		ticker := time.NewTicker(watchHeartbeatInterval)
+		defer ticker.Stop()
+		heartbeat = ticker.C
+	}
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			klog.Infof("connection closed, cancel watch task...\n")
+			return
+		case <-heartbeat:
+			writeHeader()
+			if err := format.heartbeat(c.Writer); err != nil {
+				klog.Infof("fail to write to client, cancel watch task...\n")
+				return
+			}
+			flusher.Flush()
+		case kv, ok := <-wch:
+			if !ok {
+				klog.Infof("etcd watch closed, cancel watch task...\n")
+				return
+			}
+			if kv.Type == eventError {
+				msg := "too old resource version, compacted to " + strconv.FormatInt(kv.Revision, 10)
+				if !c.Writer.Written() {
+					c.JSON(410, gin.H{"status": "ERR", "error": msg})
+					return
+				}
+				kv.Value, _ = json.Marshal(gin.H{"code": 410, "error": msg})
+				kv.Revision = 0
+			} else if !filter.filterEvent(kv) {
+				continue
+			}
+			withResourceVersion(kv, newObj)
+			info, err := json.Marshal(kv)
+			if err != nil {
+				klog.Infof("json parse error, cancel watch task...\n")
+				return
+			}
+			writeHeader()
+			if err = format.encode(c.Writer, kv, info); err != nil {
+				klog.Infof("fail to write to client, cancel watch task...\n")
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package apiserver
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"minik8s.com/minik8s/pkg/apiserver/storage"
+)
+
+// newTestServer serves the built-in resources from an empty memory storage, with fresh
+// watch caches which are stopped once the test is done
+func newTestServer(t *testing.T) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	s := storage.NewMemory()
+	useStorage(s)
+	t.Cleanup(func() {
+		resetWatchCaches(nil)
+		_ = s.Close()
+	})
+	ensureDefaultNamespace()
+	r := gin.New()
+	installResources(r)
+	return r
+}
+
+// serve sends the request to the server and returns the recorded response, a request
+// still running after timeout is cancelled
+func serve(r http.Handler, method, path, contentType, body string, timeout time.Duration) *httptest.ResponseRecorder {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	req := httptest.NewRequest(method, path, strings.NewReader(body)).WithContext(ctx)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// createPods creates the pods in the default namespace and returns the revision of the last
+func createPods(t *testing.T, r http.Handler, names ...string) int64 {
+	t.Helper()
+	var rev int64
+	for _, name := range names {
+		body := `{"metadata":{"name":"` + name + `"},"spec":{"containers":[{"name":"c","image":"busybox"}]}}`
+		if w := serve(r, http.MethodPost, "/pod", "application/json", body, time.Second); w.Code != 200 {
+			t.Fatalf("create pod %s: %d %s", name, w.Code, w.Body)
+		}
+		rev = currentRevision(t)
+	}
+	return rev
+}
+
+func currentRevision(t *testing.T) int64 {
+	t.Helper()
+	status, err := store.Status(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return status.Revision
+}
+
+func TestListAndWatchAfterCompaction(t *testing.T) {
+	tests := []struct {
+		name string
+		// request returns the path requested once the pods a, b, c and d exist, listed
+		// is the revision the pods a and b were listed at and compacted the revision c
+		// was created at, which the history has been compacted to
+		request  func(listed, compacted int64) string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name: "continue a list compacted meanwhile",
+			request: func(listed, compacted int64) string {
+				return "/pods?limit=1&continue=" + url.QueryEscape(continueToken{Rev: listed, Start: "/pod/default/a\x00"}.encode())
+			},
+			wantCode: 410,
+			wantBody: "expired",
+		},
+		{
+			name: "continue a list not compacted",
+			request: func(listed, compacted int64) string {
+				return "/pods?limit=1&continue=" + url.QueryEscape(continueToken{Rev: compacted + 1, Start: "/pod/default/a\x00"}.encode())
+			},
+			wantCode: 200,
+			wantBody: `"/pod/default/b"`,
+		},
+		{
+			name: "watch from a compacted revision",
+			request: func(listed, compacted int64) string {
+				return "/watch/pods?resourceVersion=" + strconv.FormatInt(listed, 10)
+			},
+			wantCode: 410,
+			wantBody: "too old resource version",
+		},
+		{
+			name: "watch from the compacted revision",
+			request: func(listed, compacted int64) string {
+				return "/watch/pods?resourceVersion=" + strconv.FormatInt(compacted, 10)
+			},
+			wantCode: 200,
+			wantBody: `"/pod/default/d"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestServer(t)
+			listed := createPods(t, r, "a", "b")
+			compacted := createPods(t, r, "c")
+			createPods(t, r, "d")
+			if err := store.Compact(context.Background(), compacted); err != nil {
+				t.Fatal(err)
+			}
+			w := serve(r, http.MethodGet, tt.request(listed, compacted), "", "", 200*time.Millisecond)
+			if w.Code != tt.wantCode || !strings.Contains(w.Body.String(), tt.wantBody) {
+				t.Errorf("got %d %s, want %d with %s", w.Code, w.Body, tt.wantCode, tt.wantBody)
+			}
+		})
+	}
+}
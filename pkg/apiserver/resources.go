@@ -0,0 +1,297 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"errors"
+	v1 "minik8s.com/minik8s/pkg/api/v1"
+	"regexp"
+	"strings"
+)
+
+// built-in kinds served by the api server
+func init() {
+	registerResource(&Resource{
+		Kind:       "Service",
+		Singular:   "service",
+		Plural:     "services",
+		ShortNames: []string{"svc"},
+		EtcdPrefix: "/service/",
+		Namespaced: true,
+		New:        func() v1.Object { return &v1.Service{} },
+		Fields: func(obj v1.Object) map[string]string {
+			svc := obj.(*v1.Service)
+			return map[string]string{
+				"spec.clusterIP": svc.Spec.ClusterIP,
+				"spec.type":      svc.Spec.Type,
+			}
+		},
+	})
+
+	registerResource(&Resource{
+		Kind:       "Pod",
+		Singular:   "pod",
+		Plural:     "pods",
+		ShortNames: []string{"po"},
+		EtcdPrefix: "/pod/",
+		Namespaced: true,
+		New:        func() v1.Object { return &v1.Pod{} },
+		Fields: func(obj v1.Object) map[string]string {
+			pod := obj.(*v1.Pod)
+			return map[string]string{
+				"spec.nodeName":      pod.Spec.NodeName,
+				"spec.restartPolicy": string(pod.Spec.RestartPolicy),
+				"status.phase":       string(pod.Status.Phase),
+				"status.podIP":       pod.Status.PodIP,
+			}
+		},
+		CopyStatus: func(dst, src v1.Object) {
+			dst.(*v1.Pod).Status = src.(*v1.Pod).Status
+		},
+		GracePeriodSeconds: v1.DefaultTerminationGracePeriodSeconds,
+	})
+
+	registerResource(&Resource{
+		Kind:       "ReplicaSet",
+		Singular:   "replica",
+		Plural:     "replicas",
+		ShortNames: []string{"rs"},
+		EtcdPrefix: "/replica/",
+		Namespaced: true,
+		New:        func() v1.Object { return &v1.ReplicaSet{} },
+		CopyStatus: func(dst, src v1.Object) {
+			dst.(*v1.ReplicaSet).Status = src.(*v1.ReplicaSet).Status
+		},
+	})
+
+	registerResource(&Resource{
+		Kind:       "HorizontalPodAutoscaler",
+		Singular:   "hpa",
+		Plural:     "hpas",
+		EtcdPrefix: "/hpa/",
+		Namespaced: true,
+		New:        func() v1.Object { return &v1.HorizontalPodAutoscaler{} },
+		CopyStatus: func(dst, src v1.Object) {
+			dst.(*v1.HorizontalPodAutoscaler).Status = src.(*v1.HorizontalPodAutoscaler).Status
+		},
+	})
+
+	registerResource(&Resource{
+		Kind:       "Endpoint",
+		Singular:   "endpoint",
+		Plural:     "endpoints",
+		ShortNames: []string{"ep"},
+		EtcdPrefix: "/endpoint/",
+		Namespaced: true,
+		New:        func() v1.Object { return &v1.Endpoint{} },
+	})
+
+	registerResource(&Resource{
+		Kind:       "DNS",
+		Singular:   "dns",
+		Plural:     "dnss",
+		EtcdPrefix: "/dns/",
+		Namespaced: true,
+		New:        func() v1.Object { return &v1.DNS{} },
+	})
+
+	registerResource(&Resource{
+		Kind:       "GPUJob",
+		Singular:   "gpu",
+		Plural:     "gpus",
+		EtcdPrefix: "/gpu/",
+		Namespaced: true,
+		New:        func() v1.Object { return &v1.GPUJob{} },
+		// the job number and the results are reported by the gpu server
+		CopyStatus: func(dst, src v1.Object) {
+			job, from := dst.(*v1.GPUJob), src.(*v1.GPUJob)
+			job.JobNum, job.Output, job.Error = from.JobNum, from.Output, from.Error
+		},
+		BeforeCreate: beforeCreateGPUJob,
+	})
+
+	registerResource(&Resource{
+		Kind:       "Blob",
+		Singular:   "blob",
+		Plural:     "blobs",
+		EtcdPrefix: "/blob/",
+		Namespaced: true,
+		New:        func() v1.Object { return &v1.Blob{} },
+		Fields: func(obj v1.Object) map[string]string {
+			blob := obj.(*v1.Blob)
+			return map[string]string{
+				"spec.sha256":   blob.Spec.SHA256,
+				"spec.filename": blob.Spec.Filename,
+				"status.phase":  string(blob.Status.Phase),
+			}
+		},
+		// the phase is set by the uploads of the content
+		CopyStatus: func(dst, src v1.Object) {
+			dst.(*v1.Blob).Status = src.(*v1.Blob).Status
+		},
+		BeforeCreate: beforeCreateBlob,
+		BeforeUpdate: beforeUpdateBlob,
+	})
+
+	registerResource(&Resource{
+		Kind:       "Node",
+		Singular:   "node",
+		Plural:     "nodes",
+		ShortNames: []string{"no"},
+		EtcdPrefix: "/node/",
+		New:        func() v1.Object { return &v1.Node{} },
+		Fields: func(obj v1.Object) map[string]string {
+			return map[string]string{"status.phase": obj.(*v1.Node).Status.Phase}
+		},
+		CopyStatus: func(dst, src v1.Object) {
+			dst.(*v1.Node).Status = src.(*v1.Node).Status
+		},
+		// a node registers itself with an empty body and is named after its UID
+		BeforeCreate: func(obj v1.Object) error {
+			meta := obj.GetObjectMeta()
+			if meta.Name == "" && meta.GenerateName == "" {
+				meta.Name = meta.UID
+			}
+			return nil
+		},
+	})
+
+	registerResource(&Resource{
+		Kind:       "Event",
+		Singular:   "event",
+		Plural:     "events",
+		ShortNames: []string{"ev"},
+		EtcdPrefix: "/event/",
+		Namespaced: true,
+		New:        func() v1.Object { return &v1.Event{} },
+		Fields: func(obj v1.Object) map[string]string {
+			event := obj.(*v1.Event)
+			return map[string]string{
+				"involvedObject.kind": event.InvolvedObject.Kind,
+				"involvedObject.name": event.InvolvedObject.Name,
+				"involvedObject.uid":  event.InvolvedObject.UID,
+				"reason":              event.Reason,
+				"type":                event.Type,
+			}
+		},
+	})
+
+	registerResource(&Resource{
+		Kind:       "Lease",
+		Singular:   "lease",
+		Plural:     "leases",
+		EtcdPrefix: "/lease/",
+		Namespaced: true,
+		New:        func() v1.Object { return &v1.Lease{} },
+		Fields: func(obj v1.Object) map[string]string {
+			return map[string]string{"spec.holderIdentity": obj.(*v1.Lease).Spec.HolderIdentity}
+		},
+	})
+
+	registerResource(&Resource{
+		Kind:       "Role",
+		Singular:   "role",
+		Plural:     "roles",
+		EtcdPrefix: "/role/",
+		Namespaced: true,
+		New:        func() v1.Object { return &v1.Role{} },
+	})
+
+	registerResource(&Resource{
+		Kind:       "RoleBinding",
+		Singular:   "rolebinding",
+		Plural:     "rolebindings",
+		EtcdPrefix: "/rolebinding/",
+		Namespaced: true,
+		New:        func() v1.Object { return &v1.RoleBinding{} },
+	})
+
+	registerResource(&Resource{
+		Kind:       "ClusterRole",
+		Singular:   "clusterrole",
+		Plural:     "clusterroles",
+		EtcdPrefix: "/clusterrole/",
+		New:        func() v1.Object { return &v1.ClusterRole{} },
+	})
+
+	registerResource(&Resource{
+		Kind:       "ClusterRoleBinding",
+		Singular:   "clusterrolebinding",
+		Plural:     "clusterrolebindings",
+		EtcdPrefix: "/clusterrolebinding/",
+		New:        func() v1.Object { return &v1.ClusterRoleBinding{} },
+	})
+
+	registerResource(&Resource{
+		Kind:       "CustomResourceDefinition",
+		Singular:   "customresourcedefinition",
+		Plural:     "customresourcedefinitions",
+		ShortNames: []string{"crd"},
+		EtcdPrefix: "/customresourcedefinition/",
+		New:        func() v1.Object { return &v1.CustomResourceDefinition{} },
+		// the objects stored are kept as they were, so they must stay of the same kind and scope
+		BeforeUpdate: func(obj v1.Object) error {
+			crd := obj.(*v1.CustomResourceDefinition)
+			stored := &v1.CustomResourceDefinition{}
+			if !getObject(resourcesByKind["CustomResourceDefinition"].key("", crd.Name), stored) {
+				return nil
+			}
+			var errs FieldErrors
+			if crd.Spec.Scope != stored.Spec.Scope {
+				errs = append(errs, FieldError{"spec.scope", "field is immutable"})
+			}
+			if crd.Spec.Names.Kind != stored.Spec.Names.Kind {
+				errs = append(errs, FieldError{"spec.names.kind", "field is immutable"})
+			}
+			if len(errs) != 0 {
+				return errs
+			}
+			return nil
+		},
+		// the objects of the kind go before it
+		Contents: func(name string) map[string]*Resource {
+			plural, group, _ := strings.Cut(name, ".")
+			cr := customResourceOf(group, plural)
+			if cr == nil {
+				return nil
+			}
+			return map[string]*Resource{cr.EtcdPrefix: cr.Resource}
+		},
+	})
+
+	registerResource(&Resource{
+		Kind:       "Namespace",
+		Singular:   "namespace",
+		Plural:     "namespaces",
+		ShortNames: []string{"ns"},
+		EtcdPrefix: "/namespace/",
+		New:        func() v1.Object { return &v1.Namespace{} },
+		BeforeCreate: func(obj v1.Object) error {
+			obj.(*v1.Namespace).Status.Phase = v1.NamespaceActive
+			return nil
+		},
+		BeforeDelete: func(_, name string) error {
+			if name == v1.NamespaceDefault {
+				return errors.New("the default namespace may not be deleted")
+			}
+			return nil
+		},
+		// everything in the namespace goes before it
+		Contents: namespaceContents,
+		Terminate: func(obj v1.Object) {
+			obj.(*v1.Namespace).Status.Phase = v1.NamespaceTerminating
+		},
+	})
+}
+
+var namespaceNameRegexp = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]{0,61}[a-z0-9])?$`)
+
+// ensureDefaultNamespace creates the default namespace if it does not exist yet
+func ensureDefaultNamespace() {
+	ns := v1.Namespace{
+		TypeMeta:   v1.TypeMeta{Kind: "Namespace", APIVersion: "v1"},
+		ObjectMeta: v1.ObjectMeta{Name: v1.NamespaceDefault, UID: newUID()},
+		Status:     v1.NamespaceStatus{Phase: v1.NamespaceActive},
+	}
+	buf, _ := json.Marshal(ns)
+	_, _ = storeCreate(resourcesByKind["Namespace"].key("", ns.Name), string(buf))
+}
@@ -0,0 +1,126 @@
+package apiserver
+
+import (
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"k8s.io/klog"
+	v1 "minik8s.com/minik8s/pkg/api/v1"
+	"sort"
+	"strings"
+)
+
+// objectFilter selects the objects of a list or watch by ?labelSelector and ?fieldSelector
+type objectFilter struct {
+	res    *Resource
+	labels v1.Selector
+	fields v1.Selector
+}
+
+// filter parses the selectors of the request, it replies 400 and returns false if they
+// are invalid. The filter is nil if the request selects everything.
+func (res *Resource) filter(c *gin.Context) (*objectFilter, bool) {
+	labels, err := v1.ParseSelector(c.Query("labelSelector"))
+	if err != nil {
+		c.JSON(400, gin.H{"status": "ERR", "error": "invalid labelSelector: " + err.Error()})
+		return nil, false
+	}
+	fields, err := v1.ParseSelector(c.Query("fieldSelector"))
+	if err != nil {
+		c.JSON(400, gin.H{"status": "ERR", "error": "invalid fieldSelector: " + err.Error()})
+		return nil, false
+	}
+	supported := res.fields(res.New())
+	for _, req := range fields {
+		if _, ok := supported[req.Key]; !ok {
+			c.JSON(400, gin.H{"status": "ERR", "error": "field label not supported: " + req.Key +
+				", must be one of " + strings.Join(sortedKeys(supported), ", ")})
+			return nil, false
+		}
+	}
+	if len(labels) == 0 && len(fields) == 0 {
+		return nil, true
+	}
+	return &objectFilter{res: res, labels: labels, fields: fields}, true
+}
+
+// fields returns the selectable fields of the object, the metadata fields are common
+// to all kinds
+func (res *Resource) fields(obj v1.Object) map[string]string {
+	meta := obj.GetObjectMeta()
+	fields := map[string]string{
+		"metadata.name": meta.Name,
+		"metadata.uid":  meta.UID,
+	}
+	if res.Namespaced {
+		fields["metadata.namespace"] = v1.NamespaceOf(meta)
+	}
+	if res.Fields != nil {
+		for key, value := range res.Fields(obj) {
+			fields[key] = value
+		}
+	}
+	return fields
+}
+
+// matches tells whether the stored object satisfies both selectors
+func (f *objectFilter) matches(value []byte) bool {
+	obj := f.res.New()
+	if err := json.Unmarshal(value, obj); err != nil {
+		klog.Errorf("decode %v error: %v", f.res.Kind, err)
+		return false
+	}
+	fields := f.res.fields(obj)
+	return f.labels.MatchesLabels(obj.GetObjectMeta().Labels) && f.fields.Matches(func(key string) (string, bool) {
+		value, exist := fields[key]
+		return value, exist
+	})
+}
+
+// filterList drops the objects that do not match
+func (f *objectFilter) filterList(kvs []KV) []KV {
+	if f == nil {
+		return kvs
+	}
+	filtered := []KV{}
+	for _, kv := range kvs {
+		if f.matches(kv.Value) {
+			filtered = append(filtered, kv)
+		}
+	}
+	return filtered
+}
+
+// filterEvent translates a watch event for a watcher that only sees the matching
+// objects: an object modified to no longer match is deleted for the watcher, and one
+// modified to match appears as put. It returns false if the event is not to be sent.
+func (f *objectFilter) filterEvent(kv *KV) bool {
+	if f == nil {
+		return true
+	}
+	prevMatched := kv.PrevValue != nil && f.matches(kv.PrevValue)
+	switch kv.Type {
+	case "PUT":
+		if f.matches(kv.Value) {
+			return true
+		}
+		if prevMatched {
+			kv.Type = "DELETE"
+			kv.Value = nil
+			return true
+		}
+		return false
+	case "DELETE":
+		// without the previous value it is unknown whether the watcher has seen the object
+		return kv.PrevValue == nil || prevMatched
+	}
+	return true
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
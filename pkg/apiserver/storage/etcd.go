@@ -0,0 +1,221 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"k8s.io/klog/v2"
+	"time"
+)
+
+type etcd struct {
+	client *clientv3.Client
+}
+
+// NewEtcd connects to the etcd endpoints
+func NewEtcd(endpoints []string) (Interface, error) {
+	client, err := clientv3.New(clientv3.Config{
+		Endpoints:   endpoints,
+		DialTimeout: 10 * time.Second,
+	})
+	if err != nil {
+		return nil, err
+	}
+	s := &etcd{client: client}
+	go s.requestProgress()
+	return s, nil
+}
+
+// requestProgress periodically asks etcd to notify all watchers of its current
+// revision, which is sent to them as bookmarks
+func (s *etcd) requestProgress() {
+	ticker := time.NewTicker(BookmarkInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.client.Ctx().Done():
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			err := s.client.RequestProgress(ctx)
+			cancel()
+			if err != nil {
+				klog.Errorf("etcd request progress failed, err: %v", err)
+			}
+		}
+	}
+}
+
+func (s *etcd) Close() error {
+	return s.client.Close()
+}
+
+func (s *etcd) Get(ctx context.Context, key string) (KeyValue, error) {
+	resp, err := s.client.Get(ctx, key)
+	if err != nil {
+		return KeyValue{}, err
+	}
+	if resp.Count == 0 {
+		return KeyValue{}, ErrNotFound
+	}
+	kv := resp.Kvs[0]
+	return KeyValue{Key: key, Value: kv.Value, Revision: kv.ModRevision}, nil
+}
+
+func (s *etcd) List(ctx context.Context, prefix, from string, rev, limit int64) ([]KeyValue, int64, bool, error) {
+	opts := []clientv3.OpOption{clientv3.WithRange(clientv3.GetPrefixRangeEnd(prefix)), clientv3.WithLimit(limit)}
+	if rev != 0 {
+		opts = append(opts, clientv3.WithRev(rev))
+	}
+	resp, err := s.client.Get(ctx, from, opts...)
+	if err == rpctypes.ErrCompacted {
+		return nil, 0, false, ErrCompacted
+	} else if err != nil {
+		return nil, 0, false, err
+	}
+	var kvs []KeyValue
+	for _, kv := range resp.Kvs {
+		kvs = append(kvs, KeyValue{Key: string(kv.Key), Value: kv.Value, Revision: kv.ModRevision})
+	}
+	if rev == 0 {
+		rev = resp.Header.Revision
+	}
+	return kvs, rev, resp.More, nil
+}
+
+func (s *etcd) Put(ctx context.Context, key string, value []byte) (int64, error) {
+	resp, err := s.client.Put(ctx, key, string(value))
+	if err != nil {
+		return 0, err
+	}
+	return resp.Header.Revision, nil
+}
+
+func (s *etcd) Create(ctx context.Context, key string, value []byte) (int64, error) {
+	resp, err := s.client.Txn(ctx).
+		If(clientv3.Compare(clientv3.CreateRevision(key), "=", 0)).
+		Then(clientv3.OpPut(key, string(value))).
+		Commit()
+	if err != nil {
+		return 0, err
+	}
+	if !resp.Succeeded {
+		return 0, ErrExists
+	}
+	return resp.Header.Revision, nil
+}
+
+func (s *etcd) Update(ctx context.Context, key string, value []byte, rev int64) (int64, error) {
+	return s.txnIf(ctx, key, rev, clientv3.OpPut(key, string(value)))
+}
+
+func (s *etcd) Delete(ctx context.Context, key string, rev int64) (int64, error) {
+	return s.txnIf(ctx, key, rev, clientv3.OpDelete(key))
+}
+
+// txnIf runs op if the key exists and, when rev is not 0, its mod revision equals rev
+func (s *etcd) txnIf(ctx context.Context, key string, rev int64, op clientv3.Op) (int64, error) {
+	cmp := clientv3.Compare(clientv3.CreateRevision(key), ">", 0)
+	if rev != 0 {
+		cmp = clientv3.Compare(clientv3.ModRevision(key), "=", rev)
+	}
+	resp, err := s.client.Txn(ctx).
+		If(cmp).
+		Then(op).
+		Else(clientv3.OpGet(key, clientv3.WithCountOnly())).
+		Commit()
+	if err != nil {
+		return 0, err
+	}
+	if !resp.Succeeded {
+		if resp.Responses[0].GetResponseRange().Count == 0 {
+			return 0, ErrNotFound
+		}
+		return 0, ErrConflict
+	}
+	return resp.Header.Revision, nil
+}
+
+func (s *etcd) Watch(ctx context.Context, key string, prefix bool, rev int64) <-chan Event {
+	opts := []clientv3.OpOption{clientv3.WithProgressNotify(), clientv3.WithPrevKV()}
+	if rev != 0 {
+		opts = append(opts, clientv3.WithRev(rev+1))
+	}
+	if prefix {
+		opts = append(opts, clientv3.WithPrefix())
+	}
+	ch := make(chan Event)
+	go forwardWatch(ctx, ch, s.client.Watch(ctx, key, opts...))
+	return ch
+}
+
+// forwardWatch forwards the etcd watch responses to ch, and closes ch when the watch ends
+func forwardWatch(ctx context.Context, ch chan Event, rch clientv3.WatchChan) {
+	defer close(ch)
+	send := func(ev Event) bool {
+		select {
+		case ch <- ev:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+	for resp := range rch {
+		if resp.CompactRevision != 0 {
+			klog.Infof("etcd watch revision has been compacted to %v\n", resp.CompactRevision)
+			send(Event{Type: EventError, Revision: resp.CompactRevision})
+			return
+		}
+		if err := resp.Err(); err != nil {
+			klog.Errorf("etcd watch failed, err: %v", err)
+			return
+		}
+		if resp.IsProgressNotify() {
+			if !send(Event{Type: EventBookmark, Revision: resp.Header.Revision}) {
+				return
+			}
+			continue
+		}
+		for _, e := range resp.Events {
+			ev := Event{Type: EventType(e.Type.String()), Key: string(e.Kv.Key), Value: e.Kv.Value, Revision: e.Kv.ModRevision}
+			if e.PrevKv != nil {
+				ev.PrevValue = e.PrevKv.Value
+			}
+			if !send(ev) {
+				return
+			}
+		}
+	}
+}
+
+func (s *etcd) Compact(ctx context.Context, rev int64) error {
+	_, err := s.client.Compact(ctx, rev, clientv3.WithCompactPhysical())
+	if err == rpctypes.ErrCompacted {
+		return ErrCompacted
+	}
+	return err
+}
+
+// Defragment defragments the endpoints one by one, each one blocks its reads and writes
+// meanwhile
+func (s *etcd) Defragment(ctx context.Context) error {
+	for _, endpoint := range s.client.Endpoints() {
+		if _, err := s.client.Defragment(ctx, endpoint); err != nil {
+			return fmt.Errorf("defragment %v: %w", endpoint, err)
+		}
+	}
+	return nil
+}
+
+// Status returns the status of the first endpoint answering
+func (s *etcd) Status(ctx context.Context) (Status, error) {
+	var err error
+	for _, endpoint := range s.client.Endpoints() {
+		var resp *clientv3.StatusResponse
+		if resp, err = s.client.Status(ctx, endpoint); err == nil {
+			return Status{Revision: resp.Header.Revision, DBSize: resp.DbSize, DBSizeInUse: resp.DbSizeInUse}, nil
+		}
+	}
+	return Status{}, err
+}
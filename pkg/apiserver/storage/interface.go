@@ -0,0 +1,104 @@
+/*
+	storage：api server持久化对象所用的key-value存储。etcd是生产环境的实现，
+	memory在进程内实现了相同的revision与watch语义，用于没有etcd的测试环境
+*/
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	ErrNotFound = errors.New("the object does not exist")
+	ErrExists   = errors.New("the object already exists")
+	ErrConflict = errors.New("the object has been modified, please apply your changes to the latest version and try again")
+	// ErrCompacted is returned when reading at a revision no longer kept
+	ErrCompacted = errors.New("the requested revision has been compacted")
+)
+
+// how often the watchers are sent a bookmark of the current revision
+const BookmarkInterval = 30 * time.Second
+
+type EventType string
+
+const (
+	EventPut    EventType = "PUT"
+	EventDelete EventType = "DELETE"
+	// a Bookmark carries no key, only the revision the watch has caught up with
+	EventBookmark EventType = "BOOKMARK"
+	// an Error ends the watch, Revision is the compacted revision
+	EventError EventType = "ERROR"
+)
+
+// KeyValue is a key read from the storage
+type KeyValue struct {
+	Key   string
+	Value []byte
+	// Revision is the revision the key was last modified at
+	Revision int64
+}
+
+// Event is a change of a watched key
+type Event struct {
+	Type  EventType
+	Key   string
+	Value []byte
+	// PrevValue is the value before the change, nil if the key did not exist
+	PrevValue []byte
+	Revision  int64
+}
+
+// Interface is a key-value store of which every change increments a global revision.
+// The revision preconditions of Update and Delete make up the optimistic concurrency of
+// the api server, and a watch can be resumed from any revision not compacted.
+type Interface interface {
+	// Get returns ErrNotFound if the key does not exist
+	Get(ctx context.Context, key string) (KeyValue, error)
+
+	// List returns at most limit keys under the prefix, starting from the key from, as of
+	// revision rev. 0 means no limit and the latest revision respectively. It also
+	// returns the revision listed at and whether there are more keys left.
+	List(ctx context.Context, prefix, from string, rev, limit int64) ([]KeyValue, int64, bool, error)
+
+	// Put sets the key unconditionally and returns the new revision
+	Put(ctx context.Context, key string, value []byte) (int64, error)
+
+	// Create sets the key only if it does not exist, ErrExists otherwise
+	Create(ctx context.Context, key string, value []byte) (int64, error)
+
+	// Update sets the key only if it exists and, when rev is not 0, was last modified at
+	// rev. It returns ErrNotFound or ErrConflict otherwise.
+	Update(ctx context.Context, key string, value []byte, rev int64) (int64, error)
+
+	// Delete deletes the key if, when rev is not 0, it was last modified at rev. It
+	// returns ErrNotFound or ErrConflict otherwise.
+	Delete(ctx context.Context, key string, rev int64) (int64, error)
+
+	// Watch sends the changes of the key, or of the keys under it if prefix is set, made
+	// after revision rev, 0 meaning from now on. The channel is closed when the watch
+	// ends or ctx is done. An EventError is sent first if rev has been compacted.
+	Watch(ctx context.Context, key string, prefix bool, rev int64) <-chan Event
+
+	// Compact discards the history before revision rev, the reads and watches of the
+	// revisions before it fail with ErrCompacted afterwards
+	Compact(ctx context.Context, rev int64) error
+
+	// Defragment gives the space freed by the compactions back to the file system
+	Defragment(ctx context.Context) error
+
+	// Status returns the current revision and the size of the database
+	Status(ctx context.Context) (Status, error)
+
+	Close() error
+}
+
+// Status is the state of the storage reported by Status
+type Status struct {
+	Revision int64
+	// DBSize is the size of the database in bytes, DBSizeInUse the part of it holding
+	// the keys and the history kept, the rest is freed by defragmentation
+	DBSize      int64
+	DBSizeInUse int64
+}
@@ -0,0 +1,337 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// how many changes the memory storage keeps to serve the watches and lists of past
+// revisions, the older ones are compacted
+const defaultMemoryHistory = 10000
+
+type memoryItem struct {
+	value    []byte
+	revision int64
+}
+
+// memoryChange is a change kept in the history, with what it replaced to roll it back
+type memoryChange struct {
+	Event
+	prevRevision int64
+}
+
+type memory struct {
+	mtx      sync.Mutex
+	revision int64
+	items    map[string]memoryItem
+	// the changes after revision compacted, in order
+	history    []memoryChange
+	compacted  int64
+	maxHistory int
+	watchers   map[*memoryWatcher]bool
+	done       chan struct{}
+	closeOnce  sync.Once
+}
+
+// NewMemory returns a storage holding everything in memory, which is lost on exit
+func NewMemory() Interface {
+	s := &memory{
+		items:      map[string]memoryItem{},
+		maxHistory: defaultMemoryHistory,
+		watchers:   map[*memoryWatcher]bool{},
+		done:       make(chan struct{}),
+	}
+	go s.sendBookmarks()
+	return s
+}
+
+func (s *memory) Close() error {
+	s.closeOnce.Do(func() { close(s.done) })
+	return nil
+}
+
+func (s *memory) Get(ctx context.Context, key string) (KeyValue, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	item, ok := s.items[key]
+	if !ok {
+		return KeyValue{}, ErrNotFound
+	}
+	return KeyValue{Key: key, Value: item.value, Revision: item.revision}, nil
+}
+
+func (s *memory) List(ctx context.Context, prefix, from string, rev, limit int64) ([]KeyValue, int64, bool, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	items := s.items
+	if rev == 0 {
+		rev = s.revision
+	} else if rev < s.compacted {
+		return nil, 0, false, ErrCompacted
+	} else if rev < s.revision {
+		items = s.itemsAt(rev)
+	}
+
+	var kvs []KeyValue
+	for key, item := range items {
+		if strings.HasPrefix(key, prefix) && key >= from {
+			kvs = append(kvs, KeyValue{Key: key, Value: item.value, Revision: item.revision})
+		}
+	}
+	sort.Slice(kvs, func(i, j int) bool { return kvs[i].Key < kvs[j].Key })
+	more := false
+	if limit > 0 && int64(len(kvs)) > limit {
+		kvs, more = kvs[:limit], true
+	}
+	return kvs, rev, more, nil
+}
+
+// itemsAt rolls the changes after rev back on a copy of the items
+func (s *memory) itemsAt(rev int64) map[string]memoryItem {
+	items := make(map[string]memoryItem, len(s.items))
+	for key, item := range s.items {
+		items[key] = item
+	}
+	for i := len(s.history) - 1; i >= 0 && s.history[i].Revision > rev; i-- {
+		change := s.history[i]
+		if change.PrevValue == nil {
+			delete(items, change.Key)
+		} else {
+			items[change.Key] = memoryItem{value: change.PrevValue, revision: change.prevRevision}
+		}
+	}
+	return items
+}
+
+func (s *memory) Put(ctx context.Context, key string, value []byte) (int64, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.revision++
+	s.set(key, value)
+	return s.revision, nil
+}
+
+func (s *memory) Create(ctx context.Context, key string, value []byte) (int64, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if _, exist := s.items[key]; exist {
+		return 0, ErrExists
+	}
+	s.revision++
+	s.set(key, value)
+	return s.revision, nil
+}
+
+func (s *memory) Update(ctx context.Context, key string, value []byte, rev int64) (int64, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if err := s.precondition(key, rev); err != nil {
+		return 0, err
+	}
+	s.revision++
+	s.set(key, value)
+	return s.revision, nil
+}
+
+func (s *memory) Delete(ctx context.Context, key string, rev int64) (int64, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if err := s.precondition(key, rev); err != nil {
+		return 0, err
+	}
+	s.revision++
+	s.delete(key)
+	return s.revision, nil
+}
+
+func (s *memory) precondition(key string, rev int64) error {
+	item, exist := s.items[key]
+	if !exist {
+		return ErrNotFound
+	}
+	if rev != 0 && item.revision != rev {
+		return ErrConflict
+	}
+	return nil
+}
+
+// set and delete change the key at the current revision, the lock is held
+func (s *memory) set(key string, value []byte) {
+	prev := s.items[key]
+	s.items[key] = memoryItem{value: value, revision: s.revision}
+	s.record(memoryChange{
+		Event:        Event{Type: EventPut, Key: key, Value: value, PrevValue: prev.value, Revision: s.revision},
+		prevRevision: prev.revision,
+	})
+}
+
+func (s *memory) delete(key string) {
+	prev := s.items[key]
+	delete(s.items, key)
+	s.record(memoryChange{
+		Event:        Event{Type: EventDelete, Key: key, PrevValue: prev.value, Revision: s.revision},
+		prevRevision: prev.revision,
+	})
+}
+
+// record appends the change to the history, compacting the oldest one if it is full,
+// and hands it to the watchers
+func (s *memory) record(change memoryChange) {
+	s.history = append(s.history, change)
+	if len(s.history) > s.maxHistory {
+		s.compacted = s.history[0].Revision
+		s.history = s.history[1:]
+	}
+	for w := range s.watchers {
+		if w.matches(change.Key) {
+			w.push(change.Event)
+		}
+	}
+}
+
+func (s *memory) Watch(ctx context.Context, key string, prefix bool, rev int64) <-chan Event {
+	w := &memoryWatcher{key: key, prefix: prefix, notify: make(chan struct{}, 1)}
+	ch := make(chan Event)
+
+	s.mtx.Lock()
+	if rev != 0 && rev < s.compacted {
+		compacted := s.compacted
+		s.mtx.Unlock()
+		go func() {
+			defer close(ch)
+			select {
+			case ch <- Event{Type: EventError, Revision: compacted}:
+			case <-ctx.Done():
+			}
+		}()
+		return ch
+	}
+	if rev != 0 {
+		for _, change := range s.history {
+			if change.Revision > rev && w.matches(change.Key) {
+				w.push(change.Event)
+			}
+		}
+	}
+	s.watchers[w] = true
+	s.mtx.Unlock()
+
+	go func() {
+		defer close(ch)
+		defer func() {
+			s.mtx.Lock()
+			delete(s.watchers, w)
+			s.mtx.Unlock()
+		}()
+		for {
+			for _, ev := range w.pop() {
+				select {
+				case ch <- ev:
+				case <-ctx.Done():
+					return
+				case <-s.done:
+					return
+				}
+			}
+			select {
+			case <-w.notify:
+			case <-ctx.Done():
+				return
+			case <-s.done:
+				return
+			}
+		}
+	}()
+	return ch
+}
+
+func (s *memory) Compact(ctx context.Context, rev int64) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if rev <= s.compacted {
+		return ErrCompacted
+	}
+	if rev > s.revision {
+		return fmt.Errorf("revision %d is newer than the current revision %d", rev, s.revision)
+	}
+	i := sort.Search(len(s.history), func(i int) bool { return s.history[i].Revision > rev })
+	s.history = append([]memoryChange(nil), s.history[i:]...)
+	s.compacted = rev
+	return nil
+}
+
+// Defragment has nothing to do, the memory of the history dropped is freed by the gc
+func (s *memory) Defragment(ctx context.Context) error {
+	return nil
+}
+
+func (s *memory) Status(ctx context.Context) (Status, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	var size int64
+	for key, item := range s.items {
+		size += int64(len(key) + len(item.value))
+	}
+	for _, change := range s.history {
+		size += int64(len(change.Key) + len(change.Value) + len(change.PrevValue))
+	}
+	return Status{Revision: s.revision, DBSize: size, DBSizeInUse: size}, nil
+}
+
+// sendBookmarks periodically tells the watchers the current revision
+func (s *memory) sendBookmarks() {
+	ticker := time.NewTicker(BookmarkInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			s.mtx.Lock()
+			for w := range s.watchers {
+				w.push(Event{Type: EventBookmark, Revision: s.revision})
+			}
+			s.mtx.Unlock()
+		}
+	}
+}
+
+// memoryWatcher queues the events of a watch, so that a slow watcher never blocks the
+// changes
+type memoryWatcher struct {
+	key    string
+	prefix bool
+
+	mtx    sync.Mutex
+	queue  []Event
+	notify chan struct{}
+}
+
+func (w *memoryWatcher) matches(key string) bool {
+	if w.prefix {
+		return strings.HasPrefix(key, w.key)
+	}
+	return key == w.key
+}
+
+func (w *memoryWatcher) push(ev Event) {
+	w.mtx.Lock()
+	w.queue = append(w.queue, ev)
+	w.mtx.Unlock()
+	select {
+	case w.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (w *memoryWatcher) pop() []Event {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	queue := w.queue
+	w.queue = nil
+	return queue
+}
@@ -0,0 +1,247 @@
+package storage
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// newFilled returns a memory storage holding the keys, written in order at revisions 1..n
+func newFilled(t *testing.T, keys ...string) Interface {
+	t.Helper()
+	s := NewMemory()
+	t.Cleanup(func() { _ = s.Close() })
+	for _, key := range keys {
+		if _, err := s.Create(context.Background(), key, []byte("v-"+key)); err != nil {
+			t.Fatalf("Create(%q) error: %v", key, err)
+		}
+	}
+	return s
+}
+
+func TestMemoryCreateUpdateDelete(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name string
+		// op runs against a storage holding /a at revision 1 and /b at revision 2
+		op      func(s Interface) (int64, error)
+		wantRev int64
+		wantErr error
+	}{
+		{name: "create new", op: func(s Interface) (int64, error) { return s.Create(ctx, "/c", []byte("c")) }, wantRev: 3},
+		{name: "create existing", op: func(s Interface) (int64, error) { return s.Create(ctx, "/a", []byte("a")) }, wantErr: ErrExists},
+		{name: "update at its revision", op: func(s Interface) (int64, error) { return s.Update(ctx, "/a", []byte("a2"), 1) }, wantRev: 3},
+		{name: "update unconditionally", op: func(s Interface) (int64, error) { return s.Update(ctx, "/a", []byte("a2"), 0) }, wantRev: 3},
+		{name: "update at a stale revision", op: func(s Interface) (int64, error) { return s.Update(ctx, "/a", []byte("a2"), 2) }, wantErr: ErrConflict},
+		{name: "update missing", op: func(s Interface) (int64, error) { return s.Update(ctx, "/c", []byte("c"), 0) }, wantErr: ErrNotFound},
+		{name: "delete at its revision", op: func(s Interface) (int64, error) { return s.Delete(ctx, "/b", 2) }, wantRev: 3},
+		{name: "delete unconditionally", op: func(s Interface) (int64, error) { return s.Delete(ctx, "/b", 0) }, wantRev: 3},
+		{name: "delete at a stale revision", op: func(s Interface) (int64, error) { return s.Delete(ctx, "/b", 1) }, wantErr: ErrConflict},
+		{name: "delete missing", op: func(s Interface) (int64, error) { return s.Delete(ctx, "/c", 0) }, wantErr: ErrNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newFilled(t, "/a", "/b")
+			rev, err := tt.op(s)
+			if err != tt.wantErr {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+			if rev != tt.wantRev {
+				t.Errorf("revision = %d, want %d", rev, tt.wantRev)
+			}
+			// a failed write keeps the revision
+			want := tt.wantRev
+			if tt.wantErr != nil {
+				want = 2
+			}
+			if status, _ := s.Status(ctx); status.Revision != want {
+				t.Errorf("current revision = %d, want %d", status.Revision, want)
+			}
+		})
+	}
+}
+
+func TestMemoryGetAfterWrites(t *testing.T) {
+	ctx := context.Background()
+	s := newFilled(t, "/a")
+	rev, err := s.Update(ctx, "/a", []byte("a2"), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kv, err := s.Get(ctx, "/a")
+	if err != nil || string(kv.Value) != "a2" || kv.Revision != rev {
+		t.Errorf("Get = %+v, %v, want a2 at revision %d", kv, err, rev)
+	}
+	if _, err = s.Delete(ctx, "/a", rev); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.Get(ctx, "/a"); err != ErrNotFound {
+		t.Errorf("Get of a deleted key error = %v, want %v", err, ErrNotFound)
+	}
+}
+
+func TestMemoryList(t *testing.T) {
+	ctx := context.Background()
+	s := newFilled(t, "/pod/b", "/pod/a", "/pod/c", "/pods", "/service/a")
+	// revision 6 deletes /pod/c, so revision 5 still has it
+	if _, err := s.Delete(ctx, "/pod/c", 0); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name      string
+		prefix    string
+		from      string
+		rev       int64
+		limit     int64
+		wantKeys  []string
+		wantRev   int64
+		wantMore  bool
+		wantError error
+	}{
+		{name: "all", prefix: "/pod/", wantKeys: []string{"/pod/a", "/pod/b"}, wantRev: 6},
+		{name: "first page", prefix: "/pod/", limit: 1, wantKeys: []string{"/pod/a"}, wantRev: 6, wantMore: true},
+		{name: "next page", prefix: "/pod/", from: "/pod/a\x00", rev: 6, limit: 1, wantKeys: []string{"/pod/b"}, wantRev: 6},
+		{name: "exact page", prefix: "/pod/", limit: 2, wantKeys: []string{"/pod/a", "/pod/b"}, wantRev: 6},
+		{name: "past revision", prefix: "/pod/", rev: 5, wantKeys: []string{"/pod/a", "/pod/b", "/pod/c"}, wantRev: 5},
+		{name: "before a key was created", prefix: "/pod/", rev: 2, wantKeys: []string{"/pod/a", "/pod/b"}, wantRev: 2},
+		{name: "page of a past revision", prefix: "/pod/", from: "/pod/b\x00", rev: 5, limit: 5, wantKeys: []string{"/pod/c"}, wantRev: 5},
+		{name: "no match", prefix: "/node/", wantRev: 6},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kvs, rev, more, err := s.List(ctx, tt.prefix, tt.from, tt.rev, tt.limit)
+			if err != tt.wantError {
+				t.Fatalf("error = %v, want %v", err, tt.wantError)
+			}
+			var keys []string
+			for _, kv := range kvs {
+				keys = append(keys, kv.Key)
+			}
+			if !reflect.DeepEqual(keys, tt.wantKeys) || rev != tt.wantRev || more != tt.wantMore {
+				t.Errorf("List = %v at %d, more %v, want %v at %d, more %v", keys, rev, more, tt.wantKeys, tt.wantRev, tt.wantMore)
+			}
+		})
+	}
+}
+
+// receive reads n events from the watch, failing on a timeout
+func receive(t *testing.T, ch <-chan Event, n int) []Event {
+	t.Helper()
+	var evs []Event
+	for len(evs) < n {
+		select {
+		case ev, ok := <-ch:
+			if !ok {
+				t.Fatalf("watch closed after %v", evs)
+			}
+			evs = append(evs, ev)
+		case <-time.After(time.Second):
+			t.Fatalf("got %v, want %d events", evs, n)
+		}
+	}
+	return evs
+}
+
+func TestMemoryWatchFromRevision(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name   string
+		key    string
+		prefix bool
+		rev    int64
+		want   []Event
+	}{
+		{name: "prefix from the start", key: "/pod/", prefix: true, rev: 1, want: []Event{
+			{Type: EventPut, Key: "/pod/b", Value: []byte("v-/pod/b"), Revision: 2},
+			{Type: EventPut, Key: "/pod/a", Value: []byte("a2"), PrevValue: []byte("v-/pod/a"), Revision: 4},
+			{Type: EventDelete, Key: "/pod/b", PrevValue: []byte("v-/pod/b"), Revision: 5},
+		}},
+		{name: "prefix from a later revision", key: "/pod/", prefix: true, rev: 4, want: []Event{
+			{Type: EventDelete, Key: "/pod/b", PrevValue: []byte("v-/pod/b"), Revision: 5},
+		}},
+		{name: "single key", key: "/pod/a", rev: 1, want: []Event{
+			{Type: EventPut, Key: "/pod/a", Value: []byte("a2"), PrevValue: []byte("v-/pod/a"), Revision: 4},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newFilled(t, "/pod/a", "/pod/b", "/service/a")
+			if _, err := s.Update(ctx, "/pod/a", []byte("a2"), 1); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := s.Delete(ctx, "/pod/b", 2); err != nil {
+				t.Fatal(err)
+			}
+			wctx, cancel := context.WithCancel(ctx)
+			defer cancel()
+			ch := s.Watch(wctx, tt.key, tt.prefix, tt.rev)
+			if got := receive(t, ch, len(tt.want)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("events = %+v, want %+v", got, tt.want)
+			}
+
+			// the changes made afterwards follow
+			rev, _ := s.Put(ctx, "/pod/a", []byte("a3"))
+			want := Event{Type: EventPut, Key: "/pod/a", Value: []byte("a3"), PrevValue: []byte("a2"), Revision: rev}
+			if got := receive(t, ch, 1)[0]; !reflect.DeepEqual(got, want) {
+				t.Errorf("event = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestMemoryCompaction(t *testing.T) {
+	ctx := context.Background()
+	s := newFilled(t, "/a", "/b", "/c", "/d")
+	if err := s.Compact(ctx, 3); err != nil {
+		t.Fatalf("Compact error: %v", err)
+	}
+	tests := []struct {
+		name    string
+		rev     int64
+		wantErr error
+		// wantExpired tells whether a watch from rev ends with an EventError
+		wantExpired bool
+	}{
+		{name: "before the compaction", rev: 1, wantErr: ErrCompacted, wantExpired: true},
+		{name: "at the compaction", rev: 3},
+		{name: "after the compaction", rev: 4},
+		{name: "latest", rev: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, _, err := s.List(ctx, "/", "", tt.rev, 0); err != tt.wantErr {
+				t.Errorf("List at %d error = %v, want %v", tt.rev, err, tt.wantErr)
+			}
+			wctx, cancel := context.WithCancel(ctx)
+			defer cancel()
+			ch := s.Watch(wctx, "/", true, tt.rev)
+			select {
+			case ev, ok := <-ch:
+				expired := ok && ev.Type == EventError
+				if expired != tt.wantExpired {
+					t.Errorf("watch from %d got %+v, want expired %v", tt.rev, ev, tt.wantExpired)
+				}
+				if expired {
+					if ev.Revision != 3 {
+						t.Errorf("compacted revision = %d, want 3", ev.Revision)
+					}
+					if _, ok = <-ch; ok {
+						t.Error("the watch goes on after its error")
+					}
+				}
+			case <-time.After(100 * time.Millisecond):
+				if tt.wantExpired {
+					t.Errorf("watch from %d did not expire", tt.rev)
+				}
+			}
+		})
+	}
+
+	if err := s.Compact(ctx, 2); err != ErrCompacted {
+		t.Errorf("compacting an older revision error = %v, want %v", err, ErrCompacted)
+	}
+	if err := s.Compact(ctx, 10); err == nil {
+		t.Error("compacting a future revision succeeded")
+	}
+}
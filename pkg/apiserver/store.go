@@ -0,0 +1,283 @@
+/*
+	store：api server对storage.Interface的封装，后端可以是etcd或者内存，
+	读写都以KV的形式交给handler
+*/
+package apiserver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"k8s.io/klog/v2"
+	"minik8s.com/minik8s/config"
+	"minik8s.com/minik8s/pkg/apiserver/storage"
+	"strconv"
+	"time"
+)
+
+type KV struct {
+	Key   string          `json:"key"`
+	Value json.RawMessage `json:"value"`
+	Type  string          `json:"type"`
+	// ResourceVersion is the revision the key was read or modified at, clients resume
+	// their watches from the last one they have seen
+	ResourceVersion string `json:"resourceVersion,omitempty"`
+	// Revision is the storage mod revision of the key, exposed to clients as resourceVersion
+	Revision int64 `json:"-"`
+	// PrevValue is the value before a watch event, nil if the key did not exist
+	PrevValue json.RawMessage `json:"-"`
+}
+
+// watch events other than PUT and DELETE
+const (
+	// a BOOKMARK carries no object, only the revision the watch has caught up with
+	eventBookmark = string(storage.EventBookmark)
+	// an ERROR ends the watch, Revision is the compacted revision
+	eventError = config.AS_OP_ERROR_String
+)
+
+// storage backends
+const (
+	StorageEtcd   = "etcd3"
+	StorageMemory = "memory"
+)
+
+var (
+	errNotFound = storage.ErrNotFound
+	errExists   = storage.ErrExists
+	errConflict = storage.ErrConflict
+)
+
+var store storage.Interface
+
+// storageBackend is the backend of store, etcd3 or memory
+var storageBackend string
+
+func initStorage(opts Options) error {
+	var s storage.Interface
+	var err error
+	switch opts.StorageBackend {
+	case "", StorageEtcd:
+		storageBackend = StorageEtcd
+		endpoints := opts.EtcdServers
+		if len(endpoints) == 0 {
+			endpoints = []string{config.AS_EtcdAddr + ":" + strconv.Itoa(config.AS_EtcdPort)}
+		}
+		s, err = storage.NewEtcd(endpoints)
+	case StorageMemory:
+		klog.Warning("the memory storage is used, every object is lost once the api server exits")
+		storageBackend = StorageMemory
+		s = storage.NewMemory()
+	default:
+		err = fmt.Errorf("unknown storage backend %q, want %s or %s", opts.StorageBackend, StorageEtcd, StorageMemory)
+	}
+	if err != nil {
+		return err
+	}
+	useStorage(s)
+	klog.Info("successfully started storage\n\n")
+	return nil
+}
+
+// useStorage makes s the storage of the api server, the watch caches of the previous
+// storage are stopped and the new ones are served from s
+func useStorage(s storage.Interface) {
+	resetWatchCaches(s)
+	store = s
+}
+
+func closeStorage() {
+	resetWatchCaches(nil)
+	err := store.Close()
+	if err != nil {
+		klog.Errorf("close storage failed, err:%v\n", err)
+	} else {
+		klog.Info("storage closed\n")
+	}
+}
+
+func storePut(key, val string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	rev, err := store.Put(ctx, key, []byte(val))
+	cancel()
+	if err != nil {
+		klog.Errorf("storage put failed, err: %v", err)
+	} else {
+		noteWrite(rev, key)
+		klog.Infof("storage put key: %v, value: %v\n", key, val)
+	}
+	return err
+}
+
+// storeGet returns a KV of type ERROR, and a nil error, if the key does not exist
+func storeGet(key string) (KV, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	kv, err := store.Get(ctx, key)
+	cancel()
+	if err != nil {
+		if err == errNotFound {
+			err = nil
+		} else {
+			klog.Errorf("storage get failed, key: %v err: %v", key, err)
+		}
+		return KV{
+			Key:   "",
+			Value: []byte{},
+			Type:  config.AS_OP_ERROR_String,
+		}, err
+	}
+	klog.Infof("storage get key: %v, value: %s\n", key, kv.Value)
+	return KV{
+		Key:      key,
+		Value:    kv.Value,
+		Type:     config.AS_OP_GET_String,
+		Revision: kv.Revision,
+	}, nil
+}
+
+func storeTest(key string) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	_, err := store.Get(ctx, key)
+	cancel()
+	if err != nil {
+		if err != errNotFound {
+			klog.Errorf("storage test failed, key: %v err: %v", key, err)
+		}
+		return false
+	}
+	klog.Infof("storage test key: %v\n", key)
+	return true
+}
+
+func storeGetPrefix(key string) ([]KV, error) {
+	kvList, _, err := storeList(key)
+	return kvList, err
+}
+
+// storeList is storeGetPrefix that also returns the revision of the whole list, a watch
+// started from it misses no change made after the list
+func storeList(key string) ([]KV, int64, error) {
+	kvList, rev, _, err := storeListRange(key, key, 0, 0)
+	return kvList, rev, err
+}
+
+// storeListRange lists at most limit keys under the prefix, starting from the key from,
+// as of revision rev. 0 means no limit and the latest revision respectively. It also
+// returns the revision listed at and whether there are more keys left.
+func storeListRange(prefix, from string, rev, limit int64) ([]KV, int64, bool, error) {
+	return listRange(store, prefix, from, rev, limit)
+}
+
+// listRange is storeListRange from the storage s
+func listRange(s storage.Interface, prefix, from string, rev, limit int64) ([]KV, int64, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	kvs, rev, more, err := s.List(ctx, prefix, from, rev, limit)
+	cancel()
+	if err != nil {
+		klog.Errorf("storage list failed, err: %v", err)
+		return []KV{}, 0, false, err
+	}
+	var kvList []KV
+	for _, kv := range kvs {
+		kvList = append(kvList, KV{Key: kv.Key, Value: kv.Value, Type: config.AS_OP_GET_String, Revision: kv.Revision})
+		klog.Infof("storage get with prefix: %s, key: %s, value: %s\n", prefix, kv.Key, kv.Value)
+	}
+	return kvList, rev, more, nil
+}
+
+// storeCreate puts the key only if it does not exist yet, and returns the new revision
+func storeCreate(key, val string) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	rev, err := store.Create(ctx, key, []byte(val))
+	cancel()
+	if err != nil {
+		klog.Infof("storage create key: %v failed, err: %v\n", key, err)
+		return 0, err
+	}
+	noteWrite(rev, key)
+	klog.Infof("storage create key: %v, value: %v\n", key, val)
+	return rev, nil
+}
+
+// storeUpdate puts the key only if it exists and, when rev is not 0, its mod revision
+// still equals rev. It returns the new revision.
+func storeUpdate(key, val string, rev int64) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	newRev, err := store.Update(ctx, key, []byte(val), rev)
+	cancel()
+	if err != nil {
+		klog.Infof("storage update key: %v with revision %v failed, err: %v\n", key, rev, err)
+		return 0, err
+	}
+	noteWrite(newRev, key)
+	klog.Infof("storage update key: %v, value: %v\n", key, val)
+	return newRev, nil
+}
+
+// storeDelIf deletes the key only if its mod revision still equals rev, and returns the
+// revision of the deletion
+func storeDelIf(key string, rev int64) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	newRev, err := store.Delete(ctx, key, rev)
+	cancel()
+	if err != nil {
+		klog.Infof("storage delete key: %v with revision %v failed, err: %v\n", key, rev, err)
+		return 0, err
+	}
+	noteWrite(newRev, key)
+	klog.Infof("storage delete key: %v\n", key)
+	return newRev, nil
+}
+
+// storeDel deletes the key, a key that does not exist is not an error
+func storeDel(key string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	rev, err := store.Delete(ctx, key, 0)
+	cancel()
+	if err == errNotFound {
+		err = nil
+	}
+	if err != nil {
+		klog.Errorf("storage delete failed, err: %v", err)
+	} else {
+		noteWrite(rev, key)
+		klog.Infof("storage delete key: %v\n", key)
+	}
+	return err
+}
+
+// storeWatch watches the key for changes after revision rev, 0 means from now on
+func storeWatch(key string, rev int64) (chan *KV, context.CancelFunc) {
+	klog.Infof("storage watch start key: %v, revision: %v\n", key, rev)
+	return watchStorage(context.Background(), store, key, false, rev)
+}
+
+// storeWatchPrefix watches the prefix for changes after revision rev, 0 means from now on
+func storeWatchPrefix(key string, rev int64) (chan *KV, context.CancelFunc) {
+	klog.Infof("storage watch start prefix: %v, revision: %v\n", key, rev)
+	return watchStorage(context.Background(), store, key, true, rev)
+}
+
+// watchStorage forwards the events of the storage s to the returned channel as KVs, which
+// is closed when the watch ends, is canceled or parent is done
+func watchStorage(parent context.Context, s storage.Interface, key string, prefix bool, rev int64) (chan *KV, context.CancelFunc) {
+	ch := make(chan *KV)
+	ctx, cancel := context.WithCancel(parent)
+	events := s.Watch(ctx, key, prefix, rev)
+	go func() {
+		defer close(ch)
+		for ev := range events {
+			kv := &KV{Type: string(ev.Type), Key: ev.Key, Value: ev.Value, Revision: ev.Revision, PrevValue: ev.PrevValue}
+			if ev.Type == storage.EventError {
+				kv.Type = eventError
+			}
+			klog.Infof("storage watch emitted -- type: %s key: %s val: %s\n", ev.Type, ev.Key, ev.Value)
+			select {
+			case ch <- kv:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch, cancel
+}
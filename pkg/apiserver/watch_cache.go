@@ -0,0 +1,467 @@
+/*
+	watch cache：每个资源前缀一个，在内存中保存对象与最近的事件，
+	一个storage watch分发给所有watch该前缀的客户端，list与get也由内存提供
+*/
+package apiserver
+
+import (
+	"context"
+	"k8s.io/klog/v2"
+	"minik8s.com/minik8s/config"
+	"minik8s.com/minik8s/pkg/apiserver/storage"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultWatchCacheSize is the number of recent events kept by each watch cache
+	DefaultWatchCacheSize = 1000
+	// how many events a watcher may lag behind before it is dropped
+	watcherBufferSize = 100
+	// how long a request waits for the cache to be listed or to catch up with the
+	// writes of this server, before it is served by the storage instead
+	watchCacheWaitTimeout = time.Second
+)
+
+// watchCacheSize is the capacity of the event ring of the caches, 0 disables them
+var watchCacheSize = DefaultWatchCacheSize
+
+// watchCaches are the caches by their prefix, created on first use and served from
+// store. They run until ctx is done, running counts those not stopped yet.
+var watchCaches = struct {
+	sync.Mutex
+	byPrefix map[string]*watchCache
+	store    storage.Interface
+	ctx      context.Context
+	cancel   context.CancelFunc
+	running  sync.WaitGroup
+}{byPrefix: map[string]*watchCache{}}
+
+// resetWatchCaches stops the caches and waits for them to end, the caches created
+// afterwards are served from s. There are none while s is nil.
+func resetWatchCaches(s storage.Interface) {
+	watchCaches.Lock()
+	defer watchCaches.Unlock()
+	if watchCaches.cancel != nil {
+		watchCaches.cancel()
+	}
+	watchCaches.running.Wait()
+	watchCaches.byPrefix = map[string]*watchCache{}
+	watchCaches.store = s
+	watchCaches.ctx, watchCaches.cancel = context.WithCancel(context.Background())
+}
+
+// watchCache holds the objects under a prefix of the storage as of revision rev, and
+// the events made after revision oldest
+type watchCache struct {
+	prefix string
+	store  storage.Interface
+
+	mtx     sync.Mutex
+	objects map[string]KV
+	rev     int64
+	// written is the latest revision this server wrote under the prefix, the cache
+	// serves reads once it has caught up with it
+	written int64
+	// events is a ring of the latest events, every event after oldest is in it
+	events []*KV
+	start  int
+	count  int
+	oldest int64
+	// progress is closed and replaced whenever rev advances
+	progress chan struct{}
+	watchers map[*cacheWatcher]bool
+	// ready is closed once the objects have been listed
+	ready chan struct{}
+}
+
+// watchCacheOf returns the cache of the prefix, nil if the caches are disabled
+func watchCacheOf(prefix string) *watchCache {
+	if watchCacheSize <= 0 {
+		return nil
+	}
+	watchCaches.Lock()
+	defer watchCaches.Unlock()
+	if watchCaches.store == nil {
+		return nil
+	}
+	c, exist := watchCaches.byPrefix[prefix]
+	if !exist {
+		c = &watchCache{
+			prefix:   prefix,
+			store:    watchCaches.store,
+			objects:  map[string]KV{},
+			events:   make([]*KV, watchCacheSize),
+			progress: make(chan struct{}),
+			watchers: map[*cacheWatcher]bool{},
+			ready:    make(chan struct{}),
+		}
+		watchCaches.byPrefix[prefix] = c
+		watchCaches.running.Add(1)
+		go func(ctx context.Context) {
+			defer watchCaches.running.Done()
+			c.run(ctx)
+		}(watchCaches.ctx)
+	}
+	return c
+}
+
+// noteWrite tells the caches overlapping the keys or prefixes that this server wrote
+// them at revision rev
+func noteWrite(rev int64, keys ...string) {
+	watchCaches.Lock()
+	defer watchCaches.Unlock()
+	for prefix, c := range watchCaches.byPrefix {
+		for _, key := range keys {
+			if key != "" && (strings.HasPrefix(key, prefix) || strings.HasPrefix(prefix, key)) {
+				c.mtx.Lock()
+				if rev > c.written {
+					c.written = rev
+				}
+				c.mtx.Unlock()
+				break
+			}
+		}
+	}
+}
+
+// run keeps the cache in sync with the storage, it lists again whenever the watch ends.
+// Once ctx is done it stops watching and drops the watchers.
+func (c *watchCache) run(ctx context.Context) {
+	defer func() {
+		c.mtx.Lock()
+		for w := range c.watchers {
+			c.drop(w)
+		}
+		c.mtx.Unlock()
+	}()
+	for {
+		rev, ok := c.relist()
+		if !ok {
+			select {
+			case <-time.After(time.Second):
+				continue
+			case <-ctx.Done():
+				return
+			}
+		}
+		wch, cancel := watchStorage(ctx, c.store, c.prefix, true, rev)
+		for kv := range wch {
+			if kv.Type == eventError {
+				break
+			}
+			c.apply(kv)
+		}
+		cancel()
+		if ctx.Err() != nil {
+			return
+		}
+		klog.Warningf("watch cache of %v lost its watch, relist\n", c.prefix)
+	}
+}
+
+// relist replaces the objects with those in the storage. The events missed meanwhile are
+// unknown, so the watchers are dropped and they resume from the storage.
+func (c *watchCache) relist() (int64, bool) {
+	kvs, rev, _, err := listRange(c.store, c.prefix, c.prefix, 0, 0)
+	if err != nil {
+		klog.Errorf("watch cache of %v list error: %v", c.prefix, err)
+		return 0, false
+	}
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.objects = make(map[string]KV, len(kvs))
+	for _, kv := range kvs {
+		c.objects[kv.Key] = kv
+	}
+	c.start, c.count, c.oldest = 0, 0, rev
+	for w := range c.watchers {
+		c.drop(w)
+	}
+	c.advance(rev)
+	select {
+	case <-c.ready:
+	default:
+		close(c.ready)
+	}
+	return rev, true
+}
+
+// apply applies the storage event to the objects and hands it to the watchers
+func (c *watchCache) apply(kv *KV) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	switch kv.Type {
+	case eventBookmark:
+		for w := range c.watchers {
+			w.sendBookmark(kv)
+		}
+		c.advance(kv.Revision)
+		return
+	case config.AS_OP_PUT_String:
+		c.objects[kv.Key] = KV{Key: kv.Key, Value: kv.Value, Type: config.AS_OP_GET_String, Revision: kv.Revision}
+	case config.AS_OP_DELETE_String:
+		delete(c.objects, kv.Key)
+	}
+
+	if c.count == len(c.events) {
+		c.oldest = c.events[c.start].Revision
+		c.start = (c.start + 1) % len(c.events)
+		c.count--
+	}
+	c.events[(c.start+c.count)%len(c.events)] = kv
+	c.count++
+	for w := range c.watchers {
+		if w.matches(kv) && !w.send(kv) {
+			klog.Warningf("watcher of %v lags behind, drop it\n", c.prefix)
+			c.drop(w)
+		}
+	}
+	c.advance(kv.Revision)
+}
+
+// advance moves the revision of the cache forward, the caller holds the lock
+func (c *watchCache) advance(rev int64) {
+	if rev > c.rev {
+		c.rev = rev
+	}
+	close(c.progress)
+	c.progress = make(chan struct{})
+}
+
+// waitFresh waits until the cache has been listed and has caught up with the writes of
+// this server, it returns false if it does not in time
+func (c *watchCache) waitFresh() bool {
+	timeout := time.NewTimer(watchCacheWaitTimeout)
+	defer timeout.Stop()
+	select {
+	case <-c.ready:
+	case <-timeout.C:
+		return false
+	}
+	for {
+		c.mtx.Lock()
+		fresh, progress := c.rev >= c.written, c.progress
+		c.mtx.Unlock()
+		if fresh {
+			return true
+		}
+		select {
+		case <-progress:
+		case <-timeout.C:
+			return false
+		}
+	}
+}
+
+// revision returns the revision of the cache once it is fresh, false if it is not in time
+func (c *watchCache) revision() (int64, bool) {
+	if !c.waitFresh() {
+		return 0, false
+	}
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.rev, true
+}
+
+// get returns the object at the key, a KV of type ERROR if it does not exist like storeGet
+func (c *watchCache) get(key string) (KV, bool) {
+	if !c.waitFresh() {
+		return KV{}, false
+	}
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	kv, exist := c.objects[key]
+	if !exist {
+		return KV{Value: []byte{}, Type: config.AS_OP_ERROR_String}, true
+	}
+	return kv, true
+}
+
+// list is storeListRange served by the cache, which only has the objects as of its
+// revision: a list at another revision is not served
+func (c *watchCache) list(prefix, from string, rev, limit int64) ([]KV, int64, bool, bool) {
+	if !c.waitFresh() {
+		return nil, 0, false, false
+	}
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if rev != 0 && rev != c.rev {
+		return nil, 0, false, false
+	}
+	var keys []string
+	for key := range c.objects {
+		if strings.HasPrefix(key, prefix) && key >= from {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	more := limit > 0 && int64(len(keys)) > limit
+	if more {
+		keys = keys[:limit]
+	}
+	kvs := make([]KV, 0, len(keys))
+	for _, key := range keys {
+		kvs = append(kvs, c.objects[key])
+	}
+	return kvs, c.rev, more, true
+}
+
+// watch is storeWatch, or storeWatchPrefix if prefix is set, served by the cache. It
+// returns false if the events after rev are no longer in the cache.
+func (c *watchCache) watch(key string, prefix bool, rev int64) (chan *KV, context.CancelFunc, bool) {
+	if !c.waitFresh() {
+		return nil, nil, false
+	}
+	c.mtx.Lock()
+	if rev == 0 {
+		rev = c.rev
+	}
+	if rev < c.oldest {
+		c.mtx.Unlock()
+		return nil, nil, false
+	}
+	w := &cacheWatcher{
+		key:    key,
+		prefix: prefix,
+		after:  rev,
+		input:  make(chan *KV, watcherBufferSize),
+		done:   make(chan struct{}),
+	}
+	var replay []*KV
+	for i := 0; i < c.count; i++ {
+		kv := c.events[(c.start+i)%len(c.events)]
+		if w.matches(kv) {
+			replay = append(replay, kv)
+		}
+	}
+	c.watchers[w] = true
+	c.mtx.Unlock()
+
+	out := make(chan *KV)
+	go w.run(out, replay)
+	cancel := func() {
+		c.mtx.Lock()
+		c.drop(w)
+		c.mtx.Unlock()
+		w.stop.Do(func() { close(w.done) })
+	}
+	return out, cancel, true
+}
+
+// drop stops handing the events to the watcher, which ends its watch once it has sent
+// those already handed. The caller holds the lock.
+func (c *watchCache) drop(w *cacheWatcher) {
+	if c.watchers[w] {
+		delete(c.watchers, w)
+		close(w.input)
+	}
+}
+
+// cacheWatcher is a watch served by a watch cache
+type cacheWatcher struct {
+	key    string
+	prefix bool
+	// after is the revision the watch starts after
+	after int64
+	input chan *KV
+	done  chan struct{}
+	stop  sync.Once
+}
+
+func (w *cacheWatcher) matches(kv *KV) bool {
+	if kv.Revision <= w.after {
+		return false
+	}
+	if w.prefix {
+		return strings.HasPrefix(kv.Key, w.key)
+	}
+	return kv.Key == w.key
+}
+
+// send queues the event, it returns false if the watcher lags too far behind
+func (w *cacheWatcher) send(kv *KV) bool {
+	select {
+	case w.input <- kv:
+		return true
+	default:
+		return false
+	}
+}
+
+// sendBookmark queues the bookmark unless the watcher is busy, then it is not needed
+func (w *cacheWatcher) sendBookmark(kv *KV) {
+	if kv.Revision <= w.after {
+		return
+	}
+	select {
+	case w.input <- kv:
+	default:
+	}
+}
+
+// run sends the events replayed and then those queued to out, each one copied since
+// serveWatch modifies them. out is closed when the watcher is dropped or canceled.
+func (w *cacheWatcher) run(out chan *KV, replay []*KV) {
+	defer close(out)
+	send := func(kv *KV) bool {
+		copied := *kv
+		select {
+		case out <- &copied:
+			return true
+		case <-w.done:
+			return false
+		}
+	}
+	for _, kv := range replay {
+		if !send(kv) {
+			return
+		}
+	}
+	for {
+		select {
+		case kv, ok := <-w.input:
+			if !ok || !send(kv) {
+				return
+			}
+		case <-w.done:
+			return
+		}
+	}
+}
+
+// cachedGet is storeGet served by the cache of cachePrefix if it can be
+func cachedGet(cachePrefix, key string) (KV, error) {
+	if c := watchCacheOf(cachePrefix); c != nil {
+		if kv, ok := c.get(key); ok {
+			return kv, nil
+		}
+	}
+	return storeGet(key)
+}
+
+// cachedListRange is storeListRange served by the cache of cachePrefix if it can be
+func cachedListRange(cachePrefix, prefix, from string, rev, limit int64) ([]KV, int64, bool, error) {
+	if c := watchCacheOf(cachePrefix); c != nil {
+		if kvs, listRev, more, ok := c.list(prefix, from, rev, limit); ok {
+			return kvs, listRev, more, nil
+		}
+	}
+	return storeListRange(prefix, from, rev, limit)
+}
+
+// cachedWatch is storeWatch, or storeWatchPrefix if prefix is set, served by the cache of
+// cachePrefix if it still has the events after rev
+func cachedWatch(cachePrefix, key string, prefix bool, rev int64) (chan *KV, context.CancelFunc) {
+	if c := watchCacheOf(cachePrefix); c != nil {
+		if wch, cancel, ok := c.watch(key, prefix, rev); ok {
+			return wch, cancel
+		}
+	}
+	if prefix {
+		return storeWatchPrefix(key, rev)
+	}
+	return storeWatch(key, rev)
+}
@@ -0,0 +1,191 @@
+package apiserver
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+const testCachePrefix = "/test/"
+
+// newTestCache returns a listed cache of testCachePrefix holding events at most, over an
+// empty memory storage in which the default namespace is revision 1
+func newTestCache(t *testing.T, events int) *watchCache {
+	t.Helper()
+	size := watchCacheSize
+	watchCacheSize = events
+	t.Cleanup(func() { watchCacheSize = size })
+	newTestServer(t)
+	c := watchCacheOf(testCachePrefix)
+	if !c.waitFresh() {
+		t.Fatal("the cache has not been listed")
+	}
+	return c
+}
+
+// createKeys creates the keys under testCachePrefix and returns the revision of the last
+func createKeys(t *testing.T, keys ...string) int64 {
+	t.Helper()
+	var rev int64
+	for _, key := range keys {
+		var err error
+		if rev, err = storeCreate(testCachePrefix+key, `"`+key+`"`); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return rev
+}
+
+// revisionsOf reads the watch until it has been quiet for a while, and returns the
+// revisions of the events and whether the watch has ended
+func revisionsOf(out chan *KV) ([]int64, bool) {
+	var revs []int64
+	for {
+		select {
+		case kv, ok := <-out:
+			if !ok {
+				return revs, true
+			}
+			revs = append(revs, kv.Revision)
+		case <-time.After(100 * time.Millisecond):
+			return revs, false
+		}
+	}
+}
+
+func TestWatchCacheRing(t *testing.T) {
+	tests := []struct {
+		name string
+		// the keys a..e are created at revisions 2..6 in a ring of 3 events, so the
+		// events after revision 3 are kept
+		rev      int64
+		wantOK   bool
+		wantRevs []int64
+	}{
+		{name: "evicted", rev: 2, wantOK: false},
+		{name: "oldest kept", rev: 3, wantOK: true, wantRevs: []int64{4, 5, 6}},
+		{name: "in the ring", rev: 5, wantOK: true, wantRevs: []int64{6}},
+		{name: "latest", rev: 6, wantOK: true},
+		{name: "from now on", rev: 0, wantOK: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestCache(t, 3)
+			createKeys(t, "a", "b", "c", "d", "e")
+			if !c.waitFresh() {
+				t.Fatal("the cache has not caught up")
+			}
+			out, cancel, ok := c.watch(testCachePrefix, true, tt.rev)
+			if ok != tt.wantOK {
+				t.Fatalf("watch from %d ok = %v, want %v", tt.rev, ok, tt.wantOK)
+			}
+			if !ok {
+				return
+			}
+			defer cancel()
+			if revs, _ := revisionsOf(out); !reflect.DeepEqual(revs, tt.wantRevs) {
+				t.Errorf("replayed %v, want %v", revs, tt.wantRevs)
+			}
+
+			// the ring moves on while watching
+			rev := createKeys(t, "f")
+			if revs, _ := revisionsOf(out); !reflect.DeepEqual(revs, []int64{rev}) {
+				t.Errorf("got %v, want [%d]", revs, rev)
+			}
+			kvs, listRev, _, ok := c.list(testCachePrefix, testCachePrefix, 0, 0)
+			if !ok || listRev != rev || len(kvs) != 6 {
+				t.Errorf("list = %d keys at %d, %v, want 6 keys at %d", len(kvs), listRev, ok, rev)
+			}
+		})
+	}
+}
+
+func TestWatchCacheWaitFresh(t *testing.T) {
+	tests := []struct {
+		name string
+		// write is done before waiting
+		write func(t *testing.T)
+		want  bool
+	}{
+		{name: "nothing written", write: func(t *testing.T) {}, want: true},
+		{name: "written by this server", write: func(t *testing.T) {
+			createKeys(t, "a")
+		}, want: true},
+		{name: "written under another prefix", write: func(t *testing.T) {
+			noteWrite(100, "/other/a")
+		}, want: true},
+		{name: "written but never seen", write: func(t *testing.T) {
+			noteWrite(100, testCachePrefix+"a")
+		}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestCache(t, DefaultWatchCacheSize)
+			tt.write(t)
+			if got := c.waitFresh(); got != tt.want {
+				t.Errorf("waitFresh = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWatchCacheReadsItsWrites(t *testing.T) {
+	c := newTestCache(t, DefaultWatchCacheSize)
+	for i := 0; i < 20; i++ {
+		key := strconv.Itoa(i)
+		rev := createKeys(t, key)
+		kv, ok := c.get(testCachePrefix + key)
+		if !ok || kv.Revision != rev {
+			t.Fatalf("get right after the write = %+v, %v, want revision %d", kv, ok, rev)
+		}
+	}
+}
+
+func TestWatchCacheDropsSlowWatcher(t *testing.T) {
+	c := newTestCache(t, DefaultWatchCacheSize)
+	slow, cancelSlow, _ := c.watch(testCachePrefix, true, 0)
+	defer cancelSlow()
+	fast, cancelFast, _ := c.watch(testCachePrefix, true, 0)
+	defer cancelFast()
+
+	// the fast watcher keeps up, the slow one is not read until the writes are done
+	total := watcherBufferSize + 10
+	fastRevs := make(chan []int64)
+	go func() {
+		var revs []int64
+		for len(revs) < total {
+			kv, ok := <-fast
+			if !ok {
+				break
+			}
+			revs = append(revs, kv.Revision)
+		}
+		fastRevs <- revs
+	}()
+	for i := 0; i < total; i++ {
+		createKeys(t, strconv.Itoa(i))
+	}
+	if revs := <-fastRevs; len(revs) != total {
+		t.Errorf("the fast watcher got %d events, want %d", len(revs), total)
+	}
+
+	revs, ended := revisionsOf(slow)
+	if !ended {
+		t.Fatalf("the slow watcher is still watching after %d events", len(revs))
+	}
+	if len(revs) == 0 || len(revs) >= total {
+		t.Errorf("the slow watcher got %d events before it was dropped, want fewer than %d", len(revs), total)
+	}
+	for i := 1; i < len(revs); i++ {
+		if revs[i] != revs[i-1]+1 {
+			t.Fatalf("the slow watcher skipped from %d to %d", revs[i-1], revs[i])
+		}
+	}
+	c.mtx.Lock()
+	watchers := len(c.watchers)
+	c.mtx.Unlock()
+	if watchers != 1 {
+		t.Errorf("%d watchers left, want the fast one", watchers)
+	}
+}
@@ -0,0 +1,83 @@
+package apiserver
+
+import (
+	"io"
+	"mime"
+	"minik8s.com/minik8s/config"
+	"strings"
+	"time"
+)
+
+// watchHeartbeatInterval is how often an event stream sends a comment, so that the
+// proxies in between do not close a watch that has nothing to send
+const watchHeartbeatInterval = 15 * time.Second
+
+// watchFormat is a way of writing the events of a watch
+type watchFormat struct {
+	contentType string
+	// encode writes an event, info is the json of kv
+	encode func(w io.Writer, kv *KV, info []byte) error
+	// heartbeat writes something the clients ignore to keep the stream alive, it is
+	// nil if the format has nothing like that
+	heartbeat func(w io.Writer) error
+}
+
+// watchJSONLines writes each event as a line of json
+var watchJSONLines = &watchFormat{
+	contentType: config.AS_WatchJSONLines_Type,
+	encode: func(w io.Writer, kv *KV, info []byte) error {
+		_, err := w.Write(append(info, '\n'))
+		return err
+	},
+}
+
+// watchEventStream writes server-sent events, named after the event type and with the
+// resourceVersion as the id, so that a reconnecting EventSource resumes from it
+var watchEventStream = &watchFormat{
+	contentType: config.AS_WatchEventStream_Type,
+	encode: func(w io.Writer, kv *KV, info []byte) error {
+		var b strings.Builder
+		b.WriteString("event: " + kv.Type + "\n")
+		if kv.ResourceVersion != "" {
+			b.WriteString("id: " + kv.ResourceVersion + "\n")
+		}
+		b.WriteString("data: ")
+		b.Write(info)
+		b.WriteString("\n\n")
+		_, err := io.WriteString(w, b.String())
+		return err
+	},
+	heartbeat: func(w io.Writer) error {
+		_, err := io.WriteString(w, ": heartbeat\n\n")
+		return err
+	},
+}
+
+// watchLegacy writes each event followed by the 0x1A byte, for the old clients
+var watchLegacy = &watchFormat{
+	contentType: config.AS_WatchLegacy_Type,
+	encode: func(w io.Writer, kv *KV, info []byte) error {
+		_, err := w.Write(append(info, 0x1A))
+		return err
+	},
+}
+
+// negotiateWatchFormat returns the first format in the Accept header the server
+// supports, newline-delimited json if there is none
+func negotiateWatchFormat(accept string) *watchFormat {
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		switch mediaType {
+		case config.AS_WatchJSONLines_Type, "application/json":
+			return watchJSONLines
+		case config.AS_WatchEventStream_Type:
+			return watchEventStream
+		case config.AS_WatchLegacy_Type:
+			return watchLegacy
+		}
+	}
+	return watchJSONLines
+}
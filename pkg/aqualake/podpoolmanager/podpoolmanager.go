@@ -25,7 +25,7 @@ type GetPodResponse struct {
 type PodEntry struct {
 	PodIP       string
 	NeedInstall bool
-	uid         string
+	name        string
 	cancel      context.CancelFunc
 	mtx         sync.Mutex
 }
@@ -130,14 +130,14 @@ func newGenericPodEntry(env string) (*PodEntry, error) {
 		klog.Errorf(errInfo)
 		return nil, errors.New(errInfo)
 	} else {
-		pod.ObjectMeta.UID = stat.Id
+		pod.ObjectMeta.Name = stat.Id
 	}
 
 	// wait pod IP ready
 	for iter := 0; iter < 20; iter++ {
 		time.Sleep(6 * time.Second)
 
-		resp = apiclient.Rest(pod.UID, "", apiclient.OBJ_POD, apiclient.OP_GET)
+		resp = apiclient.Rest(pod.Name, "", apiclient.OBJ_POD, apiclient.OP_GET)
 
 		var getPodResp GetPodResponse
 		err = json.Unmarshal(resp, &getPodResp)
@@ -150,12 +150,12 @@ func newGenericPodEntry(env string) (*PodEntry, error) {
 
 		if pod.Status.PodIP != "" {
 			klog.Infof("Pod %s is Ready to go", pod.ObjectMeta.Name)
-			return &PodEntry{PodIP: pod.Status.PodIP, NeedInstall: true, mtx: sync.Mutex{}, uid: pod.UID, cancel: func() {}}, nil
+			return &PodEntry{PodIP: pod.Status.PodIP, NeedInstall: true, mtx: sync.Mutex{}, name: pod.Name, cancel: func() {}}, nil
 		}
 	}
 
 	errInfo := fmt.Sprintf("Pod %s has no response for a long time", pod.ObjectMeta.Name)
-	deregisterPod(&PodEntry{PodIP: pod.Status.PodIP, NeedInstall: true, mtx: sync.Mutex{}, uid: pod.UID, cancel: func() {}})
+	deregisterPod(&PodEntry{PodIP: pod.Status.PodIP, NeedInstall: true, mtx: sync.Mutex{}, name: pod.Name, cancel: func() {}})
 	klog.Error(errInfo)
 	return nil, errors.New(errInfo)
 }
@@ -233,5 +233,5 @@ func (ppm *PodPoolManager) DeletePod(pe *PodEntry, action actionchain.Action) {
 }
 
 func deregisterPod(pe *PodEntry) {
-	_ = apiclient.Rest(pe.uid, "", apiclient.OBJ_POD, apiclient.OP_DELETE)
+	_ = apiclient.Rest(pe.name, "", apiclient.OBJ_POD, apiclient.OP_DELETE)
 }
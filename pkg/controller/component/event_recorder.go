@@ -0,0 +1,194 @@
+package component
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"k8s.io/klog"
+	v1 "minik8s.com/minik8s/pkg/api/v1"
+	"minik8s.com/minik8s/pkg/apiclient"
+)
+
+const (
+	// how many events an object may report at once, and how often it may report one
+	// more after that
+	eventBurst          = 25
+	eventRefillInterval = 5 * time.Minute
+
+	// the events waiting to be sent, those recorded while it is full are dropped
+	eventQueueSize = 1000
+
+	// how many recorded events are remembered to count their repetitions
+	maxRecordedEvents = 4096
+)
+
+// EventRecorder reports the events of the objects to the api server in the background.
+// The repetitions of an event, i.e. of the same reason, type and message about the same
+// object, increase the count of the Event sent the first time rather than making a new
+// one. Each object may report a burst of events, and is limited to one per
+// eventRefillInterval after that.
+type EventRecorder struct {
+	source v1.EventSource
+	queue  chan *v1.Event
+
+	// the following are only touched by the sending goroutine
+
+	// the Events sent, by the involved object and what happened
+	recorded map[string]*v1.Event
+	// the tokens left to the involved objects
+	buckets map[string]*tokenBucket
+}
+
+// NewEventRecorder returns the recorder of the component, host is the node it runs on
+// and is empty for the components of the control plane
+func NewEventRecorder(component string, host string) *EventRecorder {
+	r := &EventRecorder{
+		source:   v1.EventSource{Component: component, Host: host},
+		queue:    make(chan *v1.Event, eventQueueSize),
+		recorded: map[string]*v1.Event{},
+		buckets:  map[string]*tokenBucket{},
+	}
+	go r.run()
+	return r
+}
+
+// Event records that something of the type, Normal or Warning, happened to the object
+func (r *EventRecorder) Event(obj v1.ObjectReference, eventType, reason, message string) {
+	now := time.Now()
+	event := &v1.Event{
+		TypeMeta:       v1.TypeMeta{Kind: "Event", APIVersion: "v1"},
+		InvolvedObject: obj,
+		Reason:         reason,
+		Message:        message,
+		Type:           eventType,
+		Count:          1,
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Source:         r.source,
+	}
+	select {
+	case r.queue <- event:
+	default:
+		klog.Warningf("event queue is full, drop event %s of %s %s: %s", reason, obj.Kind, obj.Name, message)
+	}
+}
+
+// Eventf is Event with a formatted message
+func (r *EventRecorder) Eventf(obj v1.ObjectReference, eventType, reason, format string, args ...any) {
+	r.Event(obj, eventType, reason, fmt.Sprintf(format, args...))
+}
+
+func (r *EventRecorder) run() {
+	for event := range r.queue {
+		obj := event.InvolvedObject
+		objKey := obj.Kind + "/" + obj.Namespace + "/" + obj.Name + "/" + obj.UID
+		if !r.bucketOf(objKey).take(event.LastTimestamp) {
+			klog.Warningf("too many events of %s %s, drop event %s: %s", obj.Kind, obj.Name, event.Reason, event.Message)
+			continue
+		}
+		key := objKey + "/" + event.Type + "/" + event.Reason + "/" + event.Message
+		if prev, ok := r.recorded[key]; ok && r.increase(prev, event.LastTimestamp) {
+			continue
+		}
+		r.create(key, event)
+	}
+}
+
+// create sends a new Event, which is remembered to count its repetitions
+func (r *EventRecorder) create(key string, event *v1.Event) {
+	event.Namespace = event.InvolvedObject.Namespace
+	if event.Namespace == "" {
+		// the events of the cluster scoped objects, e.g. nodes
+		event.Namespace = v1.NamespaceDefault
+	}
+	event.GenerateName = event.InvolvedObject.Name + "."
+	name := apiclient.PostEvent(event)
+	if name == "" {
+		klog.Errorf("send event %s of %s %s failed", event.Reason, event.InvolvedObject.Kind, event.InvolvedObject.Name)
+		return
+	}
+	event.Name = name
+	if len(r.recorded) >= maxRecordedEvents {
+		r.forgetOldest()
+	}
+	r.recorded[key] = event
+}
+
+// increase counts one more repetition of the Event sent before, it returns false if
+// the Event is gone
+func (r *EventRecorder) increase(event *v1.Event, now time.Time) bool {
+	patch, _ := json.Marshal(map[string]any{"count": event.Count + 1, "lastTimestamp": now})
+	res, err := apiclient.ResourceFor("Event")
+	if err == nil {
+		err = apiclient.PatchResource(res, event.Namespace, event.Name, apiclient.MergePatchType, patch)
+	}
+	if err == apiclient.ErrNotFound {
+		return false
+	} else if err != nil {
+		klog.Errorf("update event %s failed: %v", event.Name, err)
+		return true
+	}
+	event.Count++
+	event.LastTimestamp = now
+	return true
+}
+
+func (r *EventRecorder) forgetOldest() {
+	var oldestKey string
+	var oldest time.Time
+	for key, event := range r.recorded {
+		if oldestKey == "" || event.LastTimestamp.Before(oldest) {
+			oldestKey, oldest = key, event.LastTimestamp
+		}
+	}
+	delete(r.recorded, oldestKey)
+}
+
+func (r *EventRecorder) bucketOf(objKey string) *tokenBucket {
+	bucket, ok := r.buckets[objKey]
+	if !ok {
+		if len(r.buckets) >= maxRecordedEvents {
+			// the full buckets are those of the objects quiet for a while
+			for key, b := range r.buckets {
+				if b.full(time.Now()) {
+					delete(r.buckets, key)
+				}
+			}
+		}
+		bucket = &tokenBucket{tokens: eventBurst, last: time.Now()}
+		r.buckets[objKey] = bucket
+	}
+	return bucket
+}
+
+// tokenBucket holds up to eventBurst tokens, refilled one per eventRefillInterval
+type tokenBucket struct {
+	tokens int
+	last   time.Time
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	refilled := int(now.Sub(b.last) / eventRefillInterval)
+	if refilled > 0 {
+		b.tokens += refilled
+		b.last = b.last.Add(time.Duration(refilled) * eventRefillInterval)
+	}
+	if b.tokens >= eventBurst {
+		b.tokens, b.last = eventBurst, now
+	}
+}
+
+func (b *tokenBucket) take(now time.Time) bool {
+	b.refill(now)
+	if b.tokens == 0 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+func (b *tokenBucket) full(now time.Time) bool {
+	b.refill(now)
+	return b.tokens == eventBurst
+}
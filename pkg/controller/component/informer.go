@@ -21,7 +21,9 @@ type Informer struct {
 	synced         bool
 }
 
-func NewInformer(kind string) (inf *Informer) {
+// NewInformer returns an informer of the objects of the kind, opts is optional and lets
+// the api server narrow the objects down to a namespace or by selectors
+func NewInformer(kind string, opts ...apiclient.ListOptions) (inf *Informer) {
 	inf = &Informer{
 		Kind:   kind,
 		synced: false,
@@ -30,11 +32,23 @@ func NewInformer(kind string) (inf *Informer) {
 	inf.transportQueue.Init()
 	inf.Handlers = []EventHandler{}
 	inf.reflector.Kind = kind
+	if len(opts) != 0 {
+		inf.reflector.options = opts[0]
+	}
 	inf.reflector.transportQueue = &inf.transportQueue
 	inf.store.Init()
 	return inf
 }
 
+// NewCustomInformer returns an informer of the objects of a kind defined by a
+// CustomResourceDefinition, which are stored as v1.Unstructured. Its Kind is the name
+// of the definition, i.e. <plural>.<group>.
+func NewCustomInformer(cr *apiclient.CustomResource, opts ...apiclient.ListOptions) *Informer {
+	inf := NewInformer(cr.Plural+"."+cr.Group, opts...)
+	inf.reflector.custom = cr
+	return inf
+}
+
 func (inf *Informer) Run(stopChan chan bool) {
 	reflectorStopChan := make(chan bool)
 	syncChan := make(chan bool)
@@ -118,15 +132,28 @@ func (inf *Informer) GetItem(key string) any {
 
 func (inf *Informer) DeleteItem(key string) {
 	var flag bool
+	obj, exist := inf.store.Get(key)
+	if !exist {
+		klog.Errorf("Delete %s failed: not found", key)
+		return
+	}
 	switch inf.Kind {
 	case "Endpoint":
-		flag = apiclient.DeleteEndpoint(key)
+		ep := obj.(v1.Endpoint)
+		flag = apiclient.DeleteEndpoint(v1.NamespaceOf(&ep.ObjectMeta), ep.Name)
 	case "Pod":
-		flag = apiclient.DeletePod(key)
+		pod := obj.(v1.Pod)
+		flag = apiclient.DeletePod(v1.NamespaceOf(&pod.ObjectMeta), pod.Name)
 	case "GPUJob":
-		flag = apiclient.DeleteGPUJob(key)
+		job := obj.(v1.GPUJob)
+		flag = apiclient.DeleteGPUJob(v1.NamespaceOf(&job.ObjectMeta), job.Name)
 	default:
-		klog.Warningf("Delete %s not handled", inf.Kind)
+		if inf.reflector.custom == nil {
+			klog.Warningf("Delete %s not handled", inf.Kind)
+			break
+		}
+		u := obj.(v1.Unstructured)
+		flag = apiclient.DeleteCustom(inf.reflector.custom, v1.NamespaceOf(&u.ObjectMeta), u.Name) == nil
 	}
 
 	if flag {
@@ -137,74 +164,99 @@ func (inf *Informer) DeleteItem(key string) {
 	}
 }
 
-func (inf *Informer) UpdateItem(key string, obj any) {
-	var flag bool
+// UpdateItem puts obj to the api server. It returns apiclient.ErrConflict if obj
+// is stale, in which case the caller should re-read it from the store and retry.
+func (inf *Informer) UpdateItem(key string, obj any) error {
+	var err error
 	switch inf.Kind {
 	case "Pod":
 		{
 			pod := obj.(v1.Pod)
-			flag = apiclient.UpdatePod(&pod)
+			err = apiclient.UpdatePod(&pod)
 		}
 	case "Endpoint":
 		{
 			ep := obj.(v1.Endpoint)
-			flag = apiclient.UpdateEndpoint(&ep)
+			err = apiclient.UpdateEndpoint(&ep)
 		}
 	case "ReplicaSet":
 		{
 			rs := obj.(v1.ReplicaSet)
-			flag = apiclient.UpdateReplicaSet(&rs)
+			err = apiclient.UpdateReplicaSet(&rs)
 		}
 	case "HorizontalPodAutoscaler":
 		{
 			hpa := obj.(v1.HorizontalPodAutoscaler)
-			flag = apiclient.UpdateHorizontalPodAutoscaler(&hpa)
+			err = apiclient.UpdateHorizontalPodAutoscaler(&hpa)
 		}
 	default:
-		klog.Warningf("Update %s not handled", inf.Kind)
+		if inf.reflector.custom == nil {
+			klog.Warningf("Update %s not handled", inf.Kind)
+			return nil
+		}
+		u := obj.(v1.Unstructured)
+		err = apiclient.UpdateCustom(inf.reflector.custom, &u)
+	}
+
+	if err != nil {
+		klog.Errorf("Update %s failed: %v", key, err)
+	}
+	return err
+}
+
+// UpdateItemStatus puts the status of obj to the api server, the rest of obj is ignored.
+// Like UpdateItem it returns apiclient.ErrConflict if obj is stale.
+func (inf *Informer) UpdateItemStatus(key string, obj any) error {
+	var err error
+	switch inf.Kind {
+	case "Pod":
+		pod := obj.(v1.Pod)
+		err = apiclient.UpdatePodStatus(&pod)
+	case "ReplicaSet":
+		rs := obj.(v1.ReplicaSet)
+		err = apiclient.UpdateReplicaSetStatus(&rs)
+	case "HorizontalPodAutoscaler":
+		hpa := obj.(v1.HorizontalPodAutoscaler)
+		err = apiclient.UpdateHorizontalPodAutoscalerStatus(&hpa)
+	default:
+		klog.Warningf("Update status of %s not handled", inf.Kind)
+		return nil
 	}
 
-	if !flag {
-		klog.Errorf("Update %s failed", key)
+	if err != nil {
+		klog.Errorf("Update status of %s failed: %v", key, err)
 	}
+	return err
 }
 
 func (inf *Informer) AddItem(obj any) {
-	var uid string
+	var name string
 	switch inf.Kind {
 	case "Pod":
 		{
 			pod := obj.(v1.Pod)
-			uid = apiclient.PostPod(&pod)
+			name = apiclient.PostPod(&pod)
 		}
 	case "Endpoint":
 		{
 			ep := obj.(v1.Endpoint)
-			uid = apiclient.PostEndpoint(&ep)
+			name = apiclient.PostEndpoint(&ep)
 		}
 	default:
-		klog.Warningf("Add %s not handled", inf.Kind)
-	}
-
-	if uid != "" {
-		switch inf.Kind {
-		case "Pod":
-			{
-				pod := obj.(v1.Pod)
-				pod.UID = uid
-				// inf.store.Add(uid, pod)
-				klog.Infof("Add Pod %s", pod.UID)
-			}
-		case "Endpoint":
-			{
-				ep := obj.(v1.Endpoint)
-				ep.UID = uid
-				// inf.store.Add(uid, ep)
-				klog.Infof("Add Endpoint %s", ep.UID)
-			}
-		default:
+		if inf.reflector.custom == nil {
 			klog.Warningf("Add %s not handled", inf.Kind)
+			break
 		}
+		u := obj.(v1.Unstructured)
+		var err error
+		if name, err = apiclient.CreateCustom(inf.reflector.custom, &u); err != nil {
+			klog.Errorf("Add %s failed: %v", inf.Kind, err)
+		}
+	}
+
+	if name != "" {
+		// the object reaches the store through the watch
+		klog.Infof("Add %s %s", inf.Kind, name)
 	} else {
 		klog.Error("Add Object failed ", obj)
 	}
@@ -6,12 +6,24 @@ import (
 	"k8s.io/klog"
 	v1 "minik8s.com/minik8s/pkg/api/v1"
 	"minik8s.com/minik8s/pkg/apiclient"
+	"time"
 )
 
 type Reflector struct {
 	// object type the reflector list/watch
-	Kind           string
+	Kind string
+	// custom addresses the objects of a custom kind, which are decoded as v1.Unstructured,
+	// nil for the built-in kinds
+	custom *apiclient.CustomResource
+	// namespace and selectors of the objects listed and watched
+	options        apiclient.ListOptions
 	transportQueue *WorkQueue
+	// resourceVersion of the last list, the watch starts from it
+	resourceVersion string
+	// keys of the objects pushed to the queue and not deleted yet
+	known map[string]bool
+	// UIDs of the objects by their etcd keys, the informer stores the objects by UID
+	uids map[string]string
 }
 
 // Run list and watch
@@ -21,7 +33,9 @@ func (r *Reflector) Run(stopChan chan bool, syncChan chan bool) {
 	r.watch(stopChan)
 }
 
-func (r *Reflector) list() {
+// objType returns the type of the built-in kinds addressed by ObjType, false for the
+// kinds found by discovery
+func (r *Reflector) objType() (apiclient.ObjType, bool) {
 	var objType apiclient.ObjType
 
 	switch r.Kind {
@@ -37,199 +51,260 @@ func (r *Reflector) list() {
 		objType = apiclient.OBJ_ALL_HPAS
 	case "GPUJob":
 		objType = apiclient.OBJ_ALL_GPUS
+	default:
+		return 0, false
+	}
+	return objType, true
+}
+
+// resource returns the resource of the kinds not addressed by ObjType, nil for the others
+func (r *Reflector) resource() (*v1.APIResource, error) {
+	if r.custom != nil {
+		return r.custom.APIResource(), nil
+	}
+	if _, ok := r.objType(); ok {
+		return nil, nil
+	}
+	return apiclient.ResourceFor(r.Kind)
+}
+
+// rekey replaces the etcd key of the delta with the UID of the object. A deleted
+// object carries no value, its UID is the one last seen at the key.
+func (r *Reflector) rekey(dp *DeltaPart, uid string) {
+	if r.uids == nil {
+		r.uids = make(map[string]string)
+	}
+	key := dp.Key
+	if dp.Type == "DELETE" {
+		dp.Key = r.uids[key]
+		delete(r.uids, key)
+		return
 	}
+	r.uids[key] = uid
+	dp.Key = uid
+}
+
+// list pushes all objects as PUT deltas, and a DELETE delta for every object pushed
+// before which no longer exists
+func (r *Reflector) list() {
+	var objects []byte
+	var resourceVersion string
+	res, err := r.resource()
+	if res != nil {
+		objects, resourceVersion, err = apiclient.ListResource(res, r.options)
+	} else if err == nil {
+		objType, _ := r.objType()
+		objects, resourceVersion, err = apiclient.List(objType, r.options)
+	}
+	if err != nil {
+		klog.Errorf("Reflector list %s error: %v\n", r.Kind, err)
+		return
+	}
+	r.resourceVersion = resourceVersion
+	r.uids = make(map[string]string)
 
-	objects := apiclient.GetAll(objType)
+	var deltas []Delta
 	switch r.Kind {
 	case "Pod":
 		var fmtObjs []PodObject
 
-		err := json.Unmarshal(objects, &fmtObjs)
-		if err != nil {
-			klog.Error("Reflector parse error\n")
-		}
-
+		err = json.Unmarshal(objects, &fmtObjs)
 		for _, podObj := range fmtObjs {
 			podObj.Type = "PUT"
-			podObj.StripKey()
-			r.transportQueue.Push(podObj)
+			r.rekey(&podObj.DeltaPart, podObj.Pod.UID)
+			deltas = append(deltas, podObj)
 		}
 	case "ReplicaSet":
 		var fmtObjs []ReplicaSetObject
 
-		err := json.Unmarshal(objects, &fmtObjs)
-		if err != nil {
-			klog.Error("Reflector parse error\n")
-		}
-
+		err = json.Unmarshal(objects, &fmtObjs)
 		for _, rsObj := range fmtObjs {
 			rsObj.Type = "PUT"
-			rsObj.StripKey()
-			r.transportQueue.Push(rsObj)
+			r.rekey(&rsObj.DeltaPart, rsObj.ReplicaSet.UID)
+			deltas = append(deltas, rsObj)
 		}
 	case "Service":
 		var fmtObjs []ServiceObject
 
-		err := json.Unmarshal(objects, &fmtObjs)
-		if err != nil {
-			klog.Error("Reflector parse error\n")
-		}
-
+		err = json.Unmarshal(objects, &fmtObjs)
 		for _, serviceObj := range fmtObjs {
 			serviceObj.Type = "PUT"
-			serviceObj.StripKey()
-			r.transportQueue.Push(serviceObj)
+			r.rekey(&serviceObj.DeltaPart, serviceObj.Service.UID)
+			deltas = append(deltas, serviceObj)
 		}
 	case "Endpoint":
 		var fmtObjs []EndpointObject
 
-		err := json.Unmarshal(objects, &fmtObjs)
-		if err != nil {
-			klog.Error("Reflector parse error\n")
-		}
-
+		err = json.Unmarshal(objects, &fmtObjs)
 		for _, epObj := range fmtObjs {
 			epObj.Type = "PUT"
-			epObj.StripKey()
-			r.transportQueue.Push(epObj)
+			r.rekey(&epObj.DeltaPart, epObj.Endpoint.UID)
+			deltas = append(deltas, epObj)
 		}
 	case "HorizontalPodAutoscaler":
 		var fmtObjs []HPAObject
 
-		err := json.Unmarshal(objects, &fmtObjs)
-		if err != nil {
-			klog.Error("Reflector parse error\n")
-		}
-
+		err = json.Unmarshal(objects, &fmtObjs)
 		for _, hpaObj := range fmtObjs {
 			hpaObj.Type = "PUT"
-			hpaObj.StripKey()
-			r.transportQueue.Push(hpaObj)
+			r.rekey(&hpaObj.DeltaPart, hpaObj.HPA.UID)
+			deltas = append(deltas, hpaObj)
 		}
 	case "GPUJob":
 		var fmtObjs []JobObject
 
-		err := json.Unmarshal(objects, &fmtObjs)
-		if err != nil {
-			klog.Error("Reflector parse error\n")
-		}
-
+		err = json.Unmarshal(objects, &fmtObjs)
 		for _, jobObj := range fmtObjs {
 			jobObj.Type = "PUT"
-			jobObj.StripKey()
-			r.transportQueue.Push(jobObj)
+			r.rekey(&jobObj.DeltaPart, jobObj.Job.UID)
+			deltas = append(deltas, jobObj)
 		}
-	}
-}
+	case "Blob":
+		var fmtObjs []BlobObject
+
+		err = json.Unmarshal(objects, &fmtObjs)
+		for _, blobObj := range fmtObjs {
+			blobObj.Type = "PUT"
+			r.rekey(&blobObj.DeltaPart, blobObj.Blob.UID)
+			deltas = append(deltas, blobObj)
+		}
+	default:
+		if r.custom == nil {
+			break
+		}
+		var fmtObjs []UnstructuredObject
 
-func (r *Reflector) watch(stopChan chan bool) {
-	var objType apiclient.ObjType
+		err = json.Unmarshal(objects, &fmtObjs)
+		for _, obj := range fmtObjs {
+			obj.Type = "PUT"
+			r.rekey(&obj.DeltaPart, obj.Object.UID)
+			deltas = append(deltas, obj)
+		}
+	}
+	if err != nil {
+		klog.Error("Reflector parse error\n")
+	}
 
-	switch r.Kind {
-	case "Pod":
-		objType = apiclient.OBJ_ALL_PODS
-	case "Service":
-		objType = apiclient.OBJ_ALL_SERVICES
-	case "ReplicaSet":
-		objType = apiclient.OBJ_ALL_REPLICAS
-	case "Endpoint":
-		objType = apiclient.OBJ_ALL_ENDPOINTS
-	case "HorizontalPodAutoscaler":
-		objType = apiclient.OBJ_ALL_HPAS
-	case "GPUJob":
-		objType = apiclient.OBJ_ALL_GPUS
+	listed := make(map[string]bool)
+	for _, delta := range deltas {
+		listed[delta.GetKey()] = true
+		r.transportQueue.Push(delta)
+	}
+	for key := range r.known {
+		if !listed[key] {
+			r.transportQueue.Push(DeletedObject{DeltaPart{Type: "DELETE", Key: key}})
+		}
 	}
+	r.known = listed
+}
 
-	ctx, cl := context.WithCancel(context.Background())
-	watchChan := make(chan []byte)
-	go apiclient.Watch(ctx, watchChan, objType)
+// watch resumes from the last list. It only lists again when the api server can
+// no longer resume the watch.
+func (r *Reflector) watch(stopChan chan bool) {
 	for {
-		select {
-		case <-stopChan:
-			cl()
-			return
-		case bytes := <-watchChan:
-			r.parseJsonAndNotify(bytes)
+		ctx, cl := context.WithCancel(context.Background())
+		watchChan := make(chan []byte)
+		errChan := make(chan error, 1)
+		go func(resourceVersion string) {
+			res, err := r.resource()
+			if res != nil {
+				err = apiclient.WatchResourceFrom(ctx, watchChan, res, resourceVersion, r.options)
+			} else if err == nil {
+				objType, _ := r.objType()
+				err = apiclient.WatchFrom(ctx, watchChan, objType, resourceVersion, r.options)
+			}
+			errChan <- err
+		}(r.resourceVersion)
+
+	receive:
+		for {
+			select {
+			case <-stopChan:
+				cl()
+				return
+			case bytes := <-watchChan:
+				r.parseJsonAndNotify(bytes)
+			case err := <-errChan:
+				klog.Infof("Reflector %s watch: %v, relist\n", r.Kind, err)
+				if err == apiclient.ErrExpired {
+					break receive
+				}
+				// e.g. the kind could not be discovered, retry later
+				select {
+				case <-stopChan:
+					cl()
+					return
+				case <-time.After(time.Second * 3):
+				}
+				break receive
+			}
 		}
+
+		cl()
+		r.list()
 	}
 }
 
+// parseJsonAndNotify pushes the watch event to the queue
 func (r *Reflector) parseJsonAndNotify(jsonObj []byte) {
+	var err error
+	var delta Delta
 	switch r.Kind {
 	case "Pod":
 		obj := &PodObject{}
-		err := json.Unmarshal(jsonObj, obj)
-		if err != nil {
-			klog.Error("Reflector parse error\n")
-		}
-
-		obj.StripKey()
-		r.transportQueue.Push(*obj)
+		err = json.Unmarshal(jsonObj, obj)
+		r.rekey(&obj.DeltaPart, obj.Pod.UID)
+		delta = *obj
 	case "ReplicaSet":
 		obj := &ReplicaSetObject{}
-		err := json.Unmarshal(jsonObj, obj)
-		if err != nil {
-			klog.Error("Reflector parse error\n")
-		}
-
-		obj.StripKey()
-		r.transportQueue.Push(*obj)
+		err = json.Unmarshal(jsonObj, obj)
+		r.rekey(&obj.DeltaPart, obj.ReplicaSet.UID)
+		delta = *obj
 	case "Service":
 		obj := &ServiceObject{}
-		err := json.Unmarshal(jsonObj, obj)
-		if err != nil {
-			klog.Error("Reflector parse error\n")
-		}
-
-		obj.StripKey()
-		r.transportQueue.Push(*obj)
+		err = json.Unmarshal(jsonObj, obj)
+		r.rekey(&obj.DeltaPart, obj.Service.UID)
+		delta = *obj
 	case "Endpoint":
 		obj := &EndpointObject{}
-		err := json.Unmarshal(jsonObj, obj)
-		if err != nil {
-			klog.Error("Reflector parse error\n")
-		}
-
-		obj.StripKey()
-		r.transportQueue.Push(*obj)
+		err = json.Unmarshal(jsonObj, obj)
+		r.rekey(&obj.DeltaPart, obj.Endpoint.UID)
+		delta = *obj
 	case "HorizontalPodAutoscaler":
 		obj := &HPAObject{}
-		err := json.Unmarshal(jsonObj, obj)
-		if err != nil {
-			klog.Error("Reflector parse error\n")
-		}
-
-		obj.StripKey()
-		r.transportQueue.Push(*obj)
+		err = json.Unmarshal(jsonObj, obj)
+		r.rekey(&obj.DeltaPart, obj.HPA.UID)
+		delta = *obj
 	case "GPUJob":
 		obj := &JobObject{}
-		err := json.Unmarshal(jsonObj, obj)
-		if err != nil {
-			klog.Error("Reflector parse error\n")
+		err = json.Unmarshal(jsonObj, obj)
+		r.rekey(&obj.DeltaPart, obj.Job.UID)
+		delta = *obj
+	case "Blob":
+		obj := &BlobObject{}
+		err = json.Unmarshal(jsonObj, obj)
+		r.rekey(&obj.DeltaPart, obj.Blob.UID)
+		delta = *obj
+	default:
+		if r.custom == nil {
+			return
 		}
-
-		obj.StripKey()
-		r.transportQueue.Push(*obj)
+		obj := &UnstructuredObject{}
+		err = json.Unmarshal(jsonObj, obj)
+		r.rekey(&obj.DeltaPart, obj.Object.UID)
+		delta = *obj
 	}
-}
-
-// GetPodStatus deprecated
-func GetPodStatus(pod *v1.Pod) *v1.PodStatus {
-	buf := apiclient.GetPodStatusHttp(pod)
-	if buf == nil {
-		return nil
+	if err != nil {
+		klog.Error("Reflector parse error\n")
 	}
 
-	obj := PodStatusObject{}
-	jsonErr := json.Unmarshal(buf, &obj)
-	if jsonErr != nil {
-		klog.Error("parse json error\n")
-	}
-
-	if obj.GetValue() == nil {
-		return nil
+	if delta.GetType() == "DELETE" {
+		delete(r.known, delta.GetKey())
+	} else {
+		if r.known == nil {
+			r.known = make(map[string]bool)
+		}
+		r.known[delta.GetKey()] = true
 	}
-
-	podStatus := obj.GetValue().(v1.PodStatus)
-	return &podStatus
+	r.transportQueue.Push(delta)
 }
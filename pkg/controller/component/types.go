@@ -2,7 +2,6 @@ package component
 
 import (
 	v1 "minik8s.com/minik8s/pkg/api/v1"
-	"strings"
 )
 
 type Delta interface {
@@ -16,11 +15,6 @@ type DeltaPart struct {
 	Key  string `json:"key"`
 }
 
-func (dp *DeltaPart) StripKey() {
-	slices := strings.Split(dp.Key, "/")
-	dp.Key = slices[len(slices)-1]
-}
-
 type PodObject struct {
 	DeltaPart
 	Pod v1.Pod `json:"value"`
@@ -41,11 +35,6 @@ type EndpointObject struct {
 	Endpoint v1.Endpoint `json:"value"`
 }
 
-type PodStatusObject struct {
-	DeltaPart
-	PodStatus v1.PodStatus `json:"value"`
-}
-
 type HPAObject struct {
 	DeltaPart
 	HPA v1.HorizontalPodAutoscaler `json:"value"`
@@ -56,6 +45,17 @@ type JobObject struct {
 	Job v1.GPUJob `json:"value"`
 }
 
+type BlobObject struct {
+	DeltaPart
+	Blob v1.Blob `json:"value"`
+}
+
+// UnstructuredObject is an object of a kind defined by a CustomResourceDefinition
+type UnstructuredObject struct {
+	DeltaPart
+	Object v1.Unstructured `json:"value"`
+}
+
 func (dp DeltaPart) GetType() string {
 	return dp.Type
 }
@@ -80,10 +80,6 @@ func (ed EndpointObject) GetValue() any {
 	return ed.Endpoint
 }
 
-func (ps PodStatusObject) GetValue() any {
-	return ps.PodStatus
-}
-
 func (h HPAObject) GetValue() any {
 	return h.HPA
 }
@@ -91,3 +87,21 @@ func (h HPAObject) GetValue() any {
 func (j JobObject) GetValue() any {
 	return j.Job
 }
+
+func (b BlobObject) GetValue() any {
+	return b.Blob
+}
+
+func (u UnstructuredObject) GetValue() any {
+	return u.Object
+}
+
+// DeletedObject is a DELETE delta the reflector makes up for an object which was
+// deleted while it could not watch, only the key is known
+type DeletedObject struct {
+	DeltaPart
+}
+
+func (d DeletedObject) GetValue() any {
+	return nil
+}
@@ -2,8 +2,13 @@ package component
 
 import (
 	"sync"
+	"time"
 )
 
+// ConflictRetryInterval is how long a controller waits before re-syncing a key whose
+// update conflicted, giving its informers time to receive the newer object.
+const ConflictRetryInterval = time.Second
+
 type set map[any]struct{}
 
 func (s set) has(item any) bool {
@@ -20,10 +25,11 @@ func (s set) delete(item any) {
 }
 
 type WorkQueue struct {
-	queue      []any
-	processing set
-	cond       *sync.Cond
-	mtx        sync.Mutex
+	queue        []any
+	processing   set
+	cond         *sync.Cond
+	mtx          sync.Mutex
+	shuttingDown bool
 }
 
 func (q *WorkQueue) Init() {
@@ -38,13 +44,27 @@ func (q *WorkQueue) Pop() {
 	q.cond.L.Unlock()
 }
 
+// Push appends obj to the queue, it is dropped if the queue has been shut down
 func (q *WorkQueue) Push(obj any) {
 	q.cond.L.Lock()
+	if q.shuttingDown {
+		q.cond.L.Unlock()
+		return
+	}
 	q.queue = append(q.queue, obj)
 	q.cond.L.Unlock()
 	q.cond.Signal()
 }
 
+// PushAfter pushes obj after the given delay, e.g. to retry a key whose sync
+// hit a conflict once the informer has caught up.
+func (q *WorkQueue) PushAfter(obj any, delay time.Duration) {
+	go func() {
+		time.Sleep(delay)
+		q.Push(obj)
+	}()
+}
+
 func (q *WorkQueue) Top() any {
 	q.cond.L.Lock()
 	obj := q.queue[0]
@@ -59,18 +79,31 @@ func (q *WorkQueue) Empty() bool {
 	return flag
 }
 
+// Fetch blocks until the queue is not empty and pops its first item. It returns nil
+// once the queue is shut down, the items left are dropped then.
 func (q *WorkQueue) Fetch() any {
 	q.cond.L.Lock()
-	if len(q.queue) == 0 {
+	defer q.cond.L.Unlock()
+	for len(q.queue) == 0 && !q.shuttingDown {
 		q.cond.Wait()
 	}
-	q.cond.L.Unlock()
-
-	obj := q.Top()
-	q.Pop()
+	if q.shuttingDown {
+		return nil
+	}
+	obj := q.queue[0]
+	q.queue = q.queue[1:]
 	return obj
 }
 
+// ShutDown makes Fetch return nil, so that the workers stop after the item they are
+// processing, e.g. when the leadership is lost
+func (q *WorkQueue) ShutDown() {
+	q.cond.L.Lock()
+	q.shuttingDown = true
+	q.cond.L.Unlock()
+	q.cond.Broadcast()
+}
+
 func (q *WorkQueue) Process(key string) bool {
 	q.mtx.Lock()
 	defer q.mtx.Unlock()
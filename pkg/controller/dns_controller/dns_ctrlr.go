@@ -7,6 +7,7 @@ import (
 	v1 "minik8s.com/minik8s/pkg/api/v1"
 	"minik8s.com/minik8s/pkg/apiclient"
 	"os/exec"
+	"time"
 )
 
 type DNSRequest struct {
@@ -34,33 +35,66 @@ func Run() {
 	ctx, cancle := context.WithCancel(context.Background())
 	defer cancle()
 
-	dnsChan := make(chan []byte)
-	//watch pod and node
-	go apiclient.Watch(ctx, dnsChan, apiclient.OBJ_ALL_DNSS)
-
-	//add existed dnss
-	dnss_raw := apiclient.Rest("", "", apiclient.OBJ_ALL_DNSS, apiclient.OP_GET)
-	var dnss []DNSRequest
-	err := json.Unmarshal(dnss_raw, &dnss)
-	if err != nil {
-		klog.Error("Unmarshal DNSs Failed: %v", err)
-	} else {
-		for _, dnsReq := range dnss {
-			dnsMap[dnsReq.Key] = dnsReq.DNS
-			installDNS(dnsReq.DNS)
+	//add existed dnss, a watch expired is resumed from a new list
+	resourceVersion := resyncDNSs()
+	for {
+		dnsChan := make(chan []byte)
+		expired := make(chan struct{})
+		go func(resourceVersion string) {
+			apiclient.WatchFrom(ctx, dnsChan, apiclient.OBJ_ALL_DNSS, resourceVersion)
+			close(expired)
+		}(resourceVersion)
+
+		//handle watch results
+	receive:
+		for {
+			select {
+			case rawBytes := <-dnsChan:
+				req := &DNSRequest{}
+				err := json.Unmarshal(rawBytes, req)
+				if err != nil {
+					klog.Error("Unmarshal Dns Change Req Failed: %v", err)
+				} else {
+					handleDNSChanRequest(req)
+				}
+			case <-expired:
+				break receive
+			}
 		}
-		klog.Infof("Current dns num: %v", len(dnsMap))
+		klog.Info("Watch dnss expired, relist")
+		resourceVersion = resyncDNSs()
 	}
+}
 
-	//handle watch results
-	for rawBytes := range dnsChan {
-		req := &DNSRequest{}
-		err := json.Unmarshal(rawBytes, req)
+// resyncDNSs lists the dnss, the ones changed or deleted since the last list are
+// handled as the events missed. It returns the resourceVersion to watch from.
+func resyncDNSs() string {
+	for {
+		dnss_raw, resourceVersion, err := apiclient.List(apiclient.OBJ_ALL_DNSS)
+		var dnss []DNSRequest
+		if err == nil {
+			err = json.Unmarshal(dnss_raw, &dnss)
+		}
 		if err != nil {
-			klog.Error("Unmarshal Dns Change Req Failed: %v", err)
-		} else {
-			handleDNSChanRequest(req)
+			klog.Errorf("List DNSs Failed: %v, relist after three seconds", err)
+			time.Sleep(time.Second * 3)
+			continue
+		}
+		listed := make(map[string]bool)
+		for i := range dnss {
+			listed[dnss[i].Key] = true
+			if old, exist := dnsMap[dnss[i].Key]; !exist || old.ResourceVersion != dnss[i].DNS.ResourceVersion {
+				dnss[i].Type = "PUT"
+				handleDNSChanRequest(&dnss[i])
+			}
 		}
+		for key, dns := range dnsMap {
+			if !listed[key] {
+				handleDNSChanRequest(&DNSRequest{Key: key, DNS: dns, Type: "DELETE"})
+			}
+		}
+		klog.Infof("Current dns num: %v", len(dnsMap))
+		return resourceVersion
 	}
 }
 
@@ -87,7 +121,8 @@ func handleDNSChanRequest(req *DNSRequest) {
 }
 
 func installDNS(dns v1.DNS) {
-	services_raw := apiclient.Rest("", "", apiclient.OBJ_ALL_SERVICES, apiclient.OP_GET)
+	// the paths refer to the services in the namespace of the dns
+	services_raw := apiclient.RestIn(v1.NamespaceOf(&dns.ObjectMeta), "", "", apiclient.OBJ_ALL_SERVICES, apiclient.OP_GET)
 	var svcs []ServiceRequest
 	err := json.Unmarshal(services_raw, &svcs)
 	if err != nil {
@@ -120,7 +155,8 @@ func installDNS(dns v1.DNS) {
 }
 
 func removeDNS(dns v1.DNS) {
-	services_raw := apiclient.Rest("", "", apiclient.OBJ_ALL_SERVICES, apiclient.OP_GET)
+	// the paths refer to the services in the namespace of the dns
+	services_raw := apiclient.RestIn(v1.NamespaceOf(&dns.ObjectMeta), "", "", apiclient.OBJ_ALL_SERVICES, apiclient.OP_GET)
 	var svcs []ServiceRequest
 	err := json.Unmarshal(services_raw, &svcs)
 	if err != nil {
@@ -1,8 +1,11 @@
 package endpoint
 
 import (
+	"context"
+	"errors"
 	"k8s.io/klog"
 	v1 "minik8s.com/minik8s/pkg/api/v1"
+	"minik8s.com/minik8s/pkg/apiclient"
 	"minik8s.com/minik8s/pkg/controller/component"
 )
 
@@ -11,6 +14,7 @@ type EndpointController struct {
 	endpointInformer *component.Informer
 	serviceInformer  *component.Informer
 	queue            component.WorkQueue
+	recorder         *component.EventRecorder
 }
 
 func NewEndpointController(podInfo *component.Informer, servInfo *component.Informer,
@@ -19,10 +23,12 @@ func NewEndpointController(podInfo *component.Informer, servInfo *component.Info
 		podInformer:      podInfo,
 		endpointInformer: epInfo,
 		serviceInformer:  servInfo,
+		recorder:         component.NewEventRecorder("endpoint-controller", ""),
 	}
 }
 
-func (epc *EndpointController) Run() {
+// Run syncs the endpoints of the services until ctx is done
+func (epc *EndpointController) Run(ctx context.Context) {
 	epc.queue.Init()
 
 	epc.podInformer.AddEventHandler(component.EventHandler{
@@ -38,7 +44,15 @@ func (epc *EndpointController) Run() {
 	})
 
 	epc.syncAll()
-	go epc.worker()
+
+	done := make(chan struct{})
+	go func() {
+		epc.worker()
+		close(done)
+	}()
+	<-ctx.Done()
+	epc.queue.ShutDown()
+	<-done
 }
 
 func (epc *EndpointController) syncAll() {
@@ -55,7 +69,11 @@ func (epc *EndpointController) worker() {
 }
 
 func (epc *EndpointController) processNextWorkItem() bool {
-	key := epc.queue.Fetch().(string)
+	key, ok := epc.queue.Fetch().(string)
+	if !ok {
+		// the queue has been shut down
+		return false
+	}
 
 	item := epc.serviceInformer.GetItem(key)
 	if item == nil {
@@ -69,7 +87,10 @@ func (epc *EndpointController) processNextWorkItem() bool {
 	service := item.(v1.Service)
 	err := epc.syncEndpoint(service)
 	epc.queue.Done(key)
-	if err != nil {
+	if errors.Is(err, apiclient.ErrConflict) {
+		klog.Infof("Service %s conflicts with a newer object, retry later", key)
+		epc.queue.PushAfter(key, component.ConflictRetryInterval)
+	} else if err != nil {
 		klog.Error("syncEndpoint error\n")
 		return false
 	}
@@ -82,6 +103,13 @@ func (epc *EndpointController) syncEndpoint(service v1.Service) error {
 	if service.Spec.Selector != nil {
 		for _, podObj := range allPods {
 			pod := podObj.(v1.Pod)
+			if !v1.SameNamespace(&pod.ObjectMeta, &service.ObjectMeta) {
+				continue
+			}
+			// a terminating pod no longer serves
+			if pod.DeletionTimestamp != nil {
+				continue
+			}
 			// check podStatus
 
 			if pod.Status.PodIP == "" {
@@ -103,7 +131,9 @@ func (epc *EndpointController) syncEndpoint(service v1.Service) error {
 					klog.Infof("Pod %s is owned by Service %s now", pod.UID, service.UID)
 					pod.OwnerReferences = append(pod.OwnerReferences, newOwner)
 
-					epc.podInformer.UpdateItem(pod.UID, pod)
+					if err := epc.podInformer.UpdateItem(pod.UID, pod); err != nil {
+						return err
+					}
 
 					relatedPods = append(relatedPods, pod)
 				}
@@ -116,7 +146,9 @@ func (epc *EndpointController) syncEndpoint(service v1.Service) error {
 					klog.Infof("Pod %s is not owned by Service %s now", pod.UID, service.UID)
 					pod.OwnerReferences = append(pod.OwnerReferences[:index], pod.OwnerReferences[index+1:]...)
 
-					epc.podInformer.UpdateItem(pod.UID, pod)
+					if err := epc.podInformer.UpdateItem(pod.UID, pod); err != nil {
+						return err
+					}
 				}
 			}
 		}
@@ -152,6 +184,7 @@ func (epc *EndpointController) createEndpoint(service v1.Service, pods []v1.Pod,
 	endpoint.Kind = "Endpoint"
 	endpoint.APIVersion = service.APIVersion
 	endpoint.ObjectMeta.Name = service.ObjectMeta.Name + "-endpoint"
+	endpoint.ObjectMeta.Namespace = service.ObjectMeta.Namespace
 	endpoint.UID = prevID
 	endpoint.ServiceIp = service.Spec.ClusterIP
 
@@ -160,6 +193,7 @@ func (epc *EndpointController) createEndpoint(service v1.Service, pods []v1.Pod,
 		Kind:       service.Kind,
 		APIVersion: service.APIVersion,
 		UID:        service.UID,
+		Controller: true,
 	}
 	endpoint.OwnerReferences = make([]v1.OwnerReference, 1)
 	endpoint.OwnerReferences[0] = owner
@@ -194,8 +228,9 @@ func (epc *EndpointController) createEndpoint(service v1.Service, pods []v1.Pod,
 
 	if prevID == "" {
 		epc.endpointInformer.AddItem(endpoint)
-	} else {
-		epc.endpointInformer.UpdateItem(endpoint.UID, endpoint)
+	} else if err := epc.endpointInformer.UpdateItem(endpoint.UID, endpoint); err != nil {
+		epc.recorder.Eventf(v1.ReferenceTo("Service", &service.ObjectMeta), v1.EventTypeWarning, "FailedToUpdateEndpoint",
+			"Failed to update endpoint %s: %v", endpoint.Name, err)
 	}
 }
 
@@ -248,7 +283,7 @@ func (epc *EndpointController) getPodMatchService(pod *v1.Pod) []v1.Service {
 	for _, item := range services {
 		service := item.(v1.Service)
 
-		if v1.MatchLabels(service.Labels, pod.Labels) {
+		if v1.SameNamespace(&service.ObjectMeta, &pod.ObjectMeta) && v1.MatchLabels(service.Labels, pod.Labels) {
 			result = append(result, service)
 		}
 	}
@@ -303,15 +338,8 @@ func (epc *EndpointController) deleteService(obj any) {
 	service := obj.(v1.Service)
 	klog.Info("delete Service ", service.UID)
 
-	eps := epc.endpointInformer.List()
-	for _, item := range eps {
-		ep := item.(v1.Endpoint)
-		if v1.GetOwnerService(ep.OwnerReferences) == service.UID {
-			epc.endpointInformer.DeleteItem(ep.UID)
-			break
-		}
-	}
-
+	// the endpoint is controlled by the service and left to the garbage collector, while
+	// the pods are only selected by it
 	pods := epc.podInformer.List()
 	for _, item := range pods {
 		pod := item.(v1.Pod)
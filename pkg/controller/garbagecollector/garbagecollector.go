@@ -0,0 +1,370 @@
+package garbagecollector
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"k8s.io/klog"
+	v1 "minik8s.com/minik8s/pkg/api/v1"
+	"minik8s.com/minik8s/pkg/apiclient"
+	"minik8s.com/minik8s/pkg/controller/component"
+	"strconv"
+	"sync"
+)
+
+// node is an object of the owner graph
+type node struct {
+	// kind of the informer the object comes from
+	kind      string
+	namespace string
+	name      string
+	uid       string
+	owners    []v1.OwnerReference
+	// deleting tells whether the object is marked for deletion
+	deleting bool
+	// foreground tells whether the object waits for the dependents it controls to go
+	foreground bool
+}
+
+// GarbageCollector deletes the objects whose owners no longer exist, i.e. the dependents
+// of the objects deleted with the Background propagation policy, and deletes
+// the objects deleted in the foreground once the dependents they control are gone
+type GarbageCollector struct {
+	informers []*component.Informer
+	queue     component.WorkQueue
+
+	mtx sync.Mutex
+	// objects by UID
+	nodes map[string]*node
+	// UIDs of the objects referencing an owner, by the UID of the owner
+	dependents map[string]map[string]bool
+}
+
+func NewGarbageCollector(informers ...*component.Informer) *GarbageCollector {
+	return &GarbageCollector{
+		informers:  informers,
+		nodes:      map[string]*node{},
+		dependents: map[string]map[string]bool{},
+	}
+}
+
+// Run builds the owner graph from the informers and collects until ctx is done
+func (gc *GarbageCollector) Run(ctx context.Context) {
+	gc.queue.Init()
+
+	for _, inf := range gc.informers {
+		kind := inf.Kind
+		inf.AddEventHandler(component.EventHandler{
+			OnAdd: func(obj any) {
+				gc.addObject(kind, obj)
+			},
+			OnUpdate: func(newObj, oldObj any) {
+				gc.addObject(kind, newObj)
+			},
+			OnDelete: func(obj any) {
+				gc.deleteObject(obj)
+			},
+		})
+	}
+
+	for _, inf := range gc.informers {
+		for _, obj := range inf.List() {
+			gc.addObject(inf.Kind, obj)
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		gc.worker()
+		close(done)
+	}()
+	<-ctx.Done()
+	gc.queue.ShutDown()
+	<-done
+}
+
+func (gc *GarbageCollector) worker() {
+	for gc.processNextWorkItem() {
+	}
+}
+
+func (gc *GarbageCollector) processNextWorkItem() bool {
+	uid, ok := gc.queue.Fetch().(string)
+	if !ok {
+		// the queue has been shut down
+		return false
+	}
+	if !gc.queue.Process(uid) {
+		return true
+	}
+
+	err := gc.attemptToDelete(uid)
+	gc.queue.Done(uid)
+	if err != nil {
+		klog.Errorf("collect %s error: %v, retry later", uid, err)
+		gc.queue.PushAfter(uid, component.ConflictRetryInterval)
+	}
+	return true
+}
+
+// addObject updates the edges of the object and checks its owners, which may have been
+// deleted before the object was seen. The owners deleted in the foreground are checked
+// too, as the object may no longer block them.
+func (gc *GarbageCollector) addObject(kind string, obj any) {
+	meta := objectMeta(obj)
+	if meta == nil {
+		return
+	}
+	n := &node{
+		kind:       kind,
+		namespace:  v1.NamespaceOf(meta),
+		name:       meta.Name,
+		uid:        meta.UID,
+		owners:     meta.OwnerReferences,
+		deleting:   meta.DeletionTimestamp != nil,
+		foreground: meta.HasFinalizer(v1.FinalizerForegroundDeletion),
+	}
+
+	gc.mtx.Lock()
+	var waiting []string
+	if old, exist := gc.nodes[meta.UID]; exist {
+		waiting = gc.foregroundOwners(old)
+		for _, ref := range old.owners {
+			delete(gc.dependents[ref.UID], meta.UID)
+		}
+	}
+	gc.nodes[meta.UID] = n
+	for _, ref := range n.owners {
+		if gc.dependents[ref.UID] == nil {
+			gc.dependents[ref.UID] = map[string]bool{}
+		}
+		gc.dependents[ref.UID][meta.UID] = true
+	}
+	gc.mtx.Unlock()
+
+	if len(n.owners) != 0 || n.foreground {
+		gc.queue.Push(meta.UID)
+	}
+	for _, uid := range waiting {
+		gc.queue.Push(uid)
+	}
+}
+
+// deleteObject removes the object from the graph and checks its dependents, and its
+// owners deleted in the foreground
+func (gc *GarbageCollector) deleteObject(obj any) {
+	meta := objectMeta(obj)
+	if meta == nil {
+		return
+	}
+
+	gc.mtx.Lock()
+	var waiting []string
+	if n, exist := gc.nodes[meta.UID]; exist {
+		waiting = gc.foregroundOwners(n)
+		for _, ref := range n.owners {
+			delete(gc.dependents[ref.UID], meta.UID)
+		}
+		delete(gc.nodes, meta.UID)
+	}
+	var deps []string
+	for uid := range gc.dependents[meta.UID] {
+		deps = append(deps, uid)
+	}
+	gc.mtx.Unlock()
+
+	for _, uid := range deps {
+		klog.Infof("%s %s is deleted, check its dependent %s", meta.Name, meta.UID, uid)
+		gc.queue.Push(uid)
+	}
+	for _, uid := range waiting {
+		gc.queue.Push(uid)
+	}
+}
+
+// foregroundOwners returns the UIDs of the owners of the object deleted in the
+// foreground, the caller holds the lock
+func (gc *GarbageCollector) foregroundOwners(n *node) []string {
+	var uids []string
+	for _, ref := range n.owners {
+		if owner, exist := gc.nodes[ref.UID]; exist && owner.foreground {
+			uids = append(uids, ref.UID)
+		}
+	}
+	return uids
+}
+
+// attemptToDelete carries on with the foreground deletion of the object, or deletes the
+// object if it has owners and none of them exist
+func (gc *GarbageCollector) attemptToDelete(uid string) error {
+	gc.mtx.Lock()
+	n, exist := gc.nodes[uid]
+	gc.mtx.Unlock()
+	if !exist {
+		return nil
+	}
+	if n.foreground {
+		return gc.deleteForeground(n)
+	} else if n.deleting {
+		return nil
+	}
+
+	if len(n.owners) == 0 {
+		return nil
+	}
+	for _, ref := range n.owners {
+		absent, err := gc.isAbsent(n.namespace, ref)
+		if err != nil {
+			return err
+		} else if !absent {
+			return nil
+		}
+	}
+
+	res, err := apiclient.ResourceFor(n.kind)
+	if err != nil {
+		klog.Warningf("Collect %s not handled: %v", n.kind, err)
+		return nil
+	}
+	klog.Infof("the owners of %s %s no longer exist, delete it", n.kind, n.name)
+	resp := apiclient.DeleteResourceWith(res, n.namespace, n.name, apiclient.DeleteOptions{
+		PropagationPolicy: v1.DeletePropagationBackground,
+	})
+	if resp == nil {
+		return errors.New("network error")
+	}
+	return nil
+}
+
+// deleteForeground deletes the dependents the owner controls in the foreground too, and
+// once none is left removes the foregroundDeletion finalizer of the owner so that it goes
+func (gc *GarbageCollector) deleteForeground(owner *node) error {
+	gc.mtx.Lock()
+	var blocking []*node
+	for uid := range gc.dependents[owner.uid] {
+		n, exist := gc.nodes[uid]
+		if !exist {
+			continue
+		}
+		if i := v1.CheckOwner(n.owners, owner.uid); i >= 0 && n.owners[i].Controller {
+			blocking = append(blocking, n)
+		}
+	}
+	gc.mtx.Unlock()
+
+	for _, n := range blocking {
+		// a dependent marked for deletion is waited for
+		if n.deleting {
+			continue
+		}
+		res, err := apiclient.ResourceFor(n.kind)
+		if err != nil {
+			return err
+		}
+		klog.Infof("%s %s is deleted in the foreground, delete its dependent %s %s", owner.kind, owner.name, n.kind, n.name)
+		resp := apiclient.DeleteResourceWith(res, n.namespace, n.name, apiclient.DeleteOptions{
+			PropagationPolicy: v1.DeletePropagationForeground,
+		})
+		if resp == nil {
+			return errors.New("network error")
+		}
+	}
+	if len(blocking) != 0 {
+		// checked again as they go
+		return nil
+	}
+	return gc.removeForegroundFinalizer(owner)
+}
+
+// removeForegroundFinalizer removes the foregroundDeletion finalizer of the owner, the
+// api server deletes it if it was the last one
+func (gc *GarbageCollector) removeForegroundFinalizer(owner *node) error {
+	res, err := apiclient.ResourceFor(owner.kind)
+	if err != nil {
+		return err
+	}
+	buf, err := apiclient.GetResource(res, owner.namespace, owner.name)
+	if errors.Is(err, apiclient.ErrNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	var resp ownerResponse
+	if err = json.Unmarshal(buf, &resp); err != nil {
+		return err
+	}
+	meta := resp.Owner.Metadata
+	i := 0
+	for i < len(meta.Finalizers) && meta.Finalizers[i] != v1.FinalizerForegroundDeletion {
+		i++
+	}
+	if meta.UID != owner.uid || i == len(meta.Finalizers) {
+		return nil
+	}
+	klog.Infof("the dependents of %s %s are gone, remove its %s finalizer", owner.kind, owner.name, v1.FinalizerForegroundDeletion)
+	// the tests fail if the owner has changed meanwhile, and the patch is retried
+	path := "/metadata/finalizers/" + strconv.Itoa(i)
+	patch, _ := json.Marshal([]map[string]any{
+		{"op": "test", "path": "/metadata/uid", "value": owner.uid},
+		{"op": "test", "path": path, "value": v1.FinalizerForegroundDeletion},
+		{"op": "remove", "path": path},
+	})
+	return apiclient.PatchResource(res, owner.namespace, owner.name, apiclient.JSONPatchType, patch)
+}
+
+// isAbsent tells whether the owner no longer exists. The informers may lag behind, so
+// an owner they do not know is looked up in the api server. The owners of unknown
+// kinds are never considered absent.
+func (gc *GarbageCollector) isAbsent(namespace string, ref v1.OwnerReference) (bool, error) {
+	gc.mtx.Lock()
+	_, exist := gc.nodes[ref.UID]
+	gc.mtx.Unlock()
+	if exist {
+		return false, nil
+	}
+
+	res, err := apiclient.ResourceFor(ref.Kind)
+	if err != nil {
+		return false, nil
+	}
+	buf, err := apiclient.GetResource(res, namespace, ref.Name)
+	if errors.Is(err, apiclient.ErrNotFound) {
+		return true, nil
+	} else if err != nil {
+		return false, err
+	}
+	// an object of the same name may have been created after the owner was deleted
+	var resp ownerResponse
+	if err = json.Unmarshal(buf, &resp); err != nil {
+		return false, err
+	}
+	return resp.Owner.Metadata.UID != ref.UID, nil
+}
+
+// ownerResponse is the part of an owner replied by the api server that tells which one it is
+type ownerResponse struct {
+	Owner struct {
+		Metadata v1.ObjectMeta `json:"metadata"`
+	} `json:"value"`
+}
+
+func objectMeta(obj any) *v1.ObjectMeta {
+	switch o := obj.(type) {
+	case v1.Pod:
+		return &o.ObjectMeta
+	case v1.ReplicaSet:
+		return &o.ObjectMeta
+	case v1.Service:
+		return &o.ObjectMeta
+	case v1.Endpoint:
+		return &o.ObjectMeta
+	case v1.HorizontalPodAutoscaler:
+		return &o.ObjectMeta
+	case v1.GPUJob:
+		return &o.ObjectMeta
+	case v1.Blob:
+		return &o.ObjectMeta
+	}
+	klog.Warningf("unknown object %T", obj)
+	return nil
+}
@@ -1,11 +1,11 @@
 package job
 
 import (
+	"context"
 	"k8s.io/klog"
-	"minik8s.com/minik8s/config"
 	v1 "minik8s.com/minik8s/pkg/api/v1"
+	"minik8s.com/minik8s/pkg/apiclient"
 	"minik8s.com/minik8s/pkg/controller/component"
-	"strconv"
 )
 
 const (
@@ -17,16 +17,19 @@ type JobController struct {
 	podInformer *component.Informer
 	jobInformer *component.Informer
 	queue       component.WorkQueue
+	recorder    *component.EventRecorder
 }
 
 func NewJobController(podInf *component.Informer, jobInf *component.Informer) *JobController {
 	return &JobController{
 		podInformer: podInf,
 		jobInformer: jobInf,
+		recorder:    component.NewEventRecorder("job-controller", ""),
 	}
 }
 
-func (jc *JobController) Run() {
+// Run syncs the pods of the jobs until ctx is done
+func (jc *JobController) Run(ctx context.Context) {
 	jc.queue.Init()
 
 	jc.jobInformer.AddEventHandler(component.EventHandler{
@@ -35,7 +38,14 @@ func (jc *JobController) Run() {
 		OnUpdate: jc.updateJob,
 	})
 
-	go jc.worker()
+	done := make(chan struct{})
+	go func() {
+		jc.worker()
+		close(done)
+	}()
+	<-ctx.Done()
+	jc.queue.ShutDown()
+	<-done
 }
 
 func (jc *JobController) worker() {
@@ -46,7 +56,11 @@ func (jc *JobController) worker() {
 }
 
 func (jc *JobController) processNextWorkItem() bool {
-	key := jc.queue.Fetch().(string)
+	key, ok := jc.queue.Fetch().(string)
+	if !ok {
+		// the queue has been shut down
+		return false
+	}
 
 	item := jc.jobInformer.GetItem(key)
 	if item == nil {
@@ -80,7 +94,8 @@ func (jc *JobController) syncJob(job *v1.GPUJob) error {
 			Entrypoint: []string{
 				"/bin/bash",
 				"-c",
-				"/apps/main " + config.AC_ServerAddr + ":" + strconv.Itoa(config.AC_ServerPort) + " " + job.UID,
+				"/apps/main " + apiclient.ServerURL() + " " + job.Name +
+					" " + v1.NamespaceOf(&job.ObjectMeta),
 			},
 		}
 
@@ -98,6 +113,7 @@ func (jc *JobController) syncJob(job *v1.GPUJob) error {
 						Name:       job.Name,
 						Kind:       job.Kind,
 						UID:        job.UID,
+						Controller: true,
 					},
 				},
 			},
@@ -107,7 +123,14 @@ func (jc *JobController) syncJob(job *v1.GPUJob) error {
 		}
 
 		jc.podInformer.AddItem(pod)
+		jc.recorder.Eventf(v1.ReferenceTo("GPUJob", &job.ObjectMeta), v1.EventTypeNormal, "SuccessfulCreate",
+			"Created pod: %s", pod.Name)
 	} else if job.Output != "" || job.Error != "" {
+		if job.Error != "" {
+			jc.recorder.Event(v1.ReferenceTo("GPUJob", &job.ObjectMeta), v1.EventTypeWarning, "Failed", job.Error)
+		} else {
+			jc.recorder.Event(v1.ReferenceTo("GPUJob", &job.ObjectMeta), v1.EventTypeNormal, "Completed", "Job completed")
+		}
 		jc.podInformer.DeleteItem(ownedPod.UID)
 		jc.jobInformer.DeleteItem(job.UID)
 	}
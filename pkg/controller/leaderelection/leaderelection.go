@@ -0,0 +1,276 @@
+/*
+	leaderelection：组件的多个副本通过一个Lease选出leader，只有leader工作，
+	其余副本作为热备，在leader的lease过期后接替它
+*/
+package leaderelection
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"math/rand"
+	"os"
+	"time"
+
+	"k8s.io/klog/v2"
+	v1 "minik8s.com/minik8s/pkg/api/v1"
+	"minik8s.com/minik8s/pkg/apiclient"
+	"minik8s.com/minik8s/utils/random"
+)
+
+// the defaults of the durations of Config
+const (
+	DefaultLeaseDuration = 15 * time.Second
+	DefaultRenewDeadline = 10 * time.Second
+	DefaultRetryPeriod   = 2 * time.Second
+)
+
+type Config struct {
+	// Namespace and Name of the lease, the namespace defaults to the default one
+	Namespace string
+	Name      string
+
+	// Identity tells the replicas apart, it defaults to the hostname with a random suffix
+	Identity string
+
+	// LeaseDuration is how long the standbys wait after the last renewal they have seen
+	// before they take over the lease
+	LeaseDuration time.Duration
+	// RenewDeadline is how long the leader keeps retrying to renew the lease before it
+	// steps down, it must be shorter than LeaseDuration
+	RenewDeadline time.Duration
+	// RetryPeriod is how often the lease is tried to be acquired or renewed
+	RetryPeriod time.Duration
+
+	// OnStartedLeading runs once the lease is acquired, its context is canceled when the
+	// leadership is lost. It should return once the work it started has stopped.
+	OnStartedLeading func(ctx context.Context)
+	// OnStoppedLeading is called when the leadership is lost, or when ctx is done after
+	// the lease was acquired. It is called after OnStartedLeading has returned, or once
+	// the lease would expire.
+	OnStoppedLeading func()
+}
+
+// LeaderElector acquires and renews the lease of a Config
+type LeaderElector struct {
+	config Config
+
+	// observed is the lease last read and observedTime is when it was seen to change. The
+	// expiry is judged by the local clock since the clocks of the replicas may differ.
+	observed     v1.Lease
+	observedTime time.Time
+}
+
+// NewLeaderElector fills in the defaults of the config
+func NewLeaderElector(config Config) (*LeaderElector, error) {
+	if config.Name == "" {
+		return nil, errors.New("the lease must have a name")
+	}
+	if config.Namespace == "" {
+		config.Namespace = v1.NamespaceDefault
+	}
+	if config.Identity == "" {
+		hostname, _ := os.Hostname()
+		config.Identity = hostname + "_" + random.String(8)
+	}
+	if config.LeaseDuration == 0 {
+		config.LeaseDuration = DefaultLeaseDuration
+	}
+	if config.RenewDeadline == 0 {
+		config.RenewDeadline = DefaultRenewDeadline
+	}
+	if config.RetryPeriod == 0 {
+		config.RetryPeriod = DefaultRetryPeriod
+	}
+	if config.RenewDeadline >= config.LeaseDuration {
+		return nil, errors.New("the renew deadline must be shorter than the lease duration")
+	}
+	if config.OnStartedLeading == nil {
+		return nil, errors.New("OnStartedLeading must be set")
+	}
+	return &LeaderElector{config: config}, nil
+}
+
+// AddFlags registers the --leader-elect flags setting the config, it returns whether the
+// leader election is enabled
+func AddFlags(fs *flag.FlagSet, config *Config) *bool {
+	enabled := fs.Bool("leader-elect", true, "elect a leader among the replicas, only the leader works")
+	fs.StringVar(&config.Namespace, "leader-elect-resource-namespace", v1.NamespaceDefault, "namespace of the lease")
+	fs.StringVar(&config.Name, "leader-elect-resource-name", config.Name, "name of the lease")
+	fs.DurationVar(&config.LeaseDuration, "leader-elect-lease-duration", DefaultLeaseDuration, "how long the standbys wait after the last renewal before they take over")
+	fs.DurationVar(&config.RenewDeadline, "leader-elect-renew-deadline", DefaultRenewDeadline, "how long the leader retries renewing before it steps down")
+	fs.DurationVar(&config.RetryPeriod, "leader-elect-retry-period", DefaultRetryPeriod, "how often the lease is tried to be acquired or renewed")
+	return enabled
+}
+
+// Run blocks until the lease is acquired, then runs OnStartedLeading and renews the lease
+// until it is lost or ctx is done. The lease is released when ctx is done.
+func Run(ctx context.Context, config Config) error {
+	le, err := NewLeaderElector(config)
+	if err != nil {
+		return err
+	}
+	le.Run(ctx)
+	return nil
+}
+
+func (le *LeaderElector) Run(ctx context.Context) {
+	if !le.acquire(ctx) {
+		return
+	}
+	leaderCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stopped := make(chan struct{})
+	go func() {
+		le.config.OnStartedLeading(leaderCtx)
+		close(stopped)
+	}()
+	le.renew(ctx)
+	cancel()
+	// the lease may expire LeaseDuration-RenewDeadline after renew gave up, the work in
+	// flight has to stop before a standby takes over
+	select {
+	case <-stopped:
+	case <-time.After(le.config.LeaseDuration - le.config.RenewDeadline):
+		klog.Errorf("OnStartedLeading did not return before lease %s/%s expired", le.config.Namespace, le.config.Name)
+	}
+	if ctx.Err() != nil {
+		le.release()
+	}
+	if le.config.OnStoppedLeading != nil {
+		le.config.OnStoppedLeading()
+	}
+}
+
+// Identity returns the identity the elector holds the lease as
+func (le *LeaderElector) Identity() string {
+	return le.config.Identity
+}
+
+// acquire retries until the lease is acquired, it returns false if ctx is done first
+func (le *LeaderElector) acquire(ctx context.Context) bool {
+	klog.Infof("attempting to acquire lease %s/%s as %s", le.config.Namespace, le.config.Name, le.config.Identity)
+	for {
+		if le.tryAcquireOrRenew() {
+			klog.Infof("successfully acquired lease %s/%s", le.config.Namespace, le.config.Name)
+			return true
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(jitter(le.config.RetryPeriod)):
+		}
+	}
+}
+
+// renew renews the lease every RetryPeriod until a renewal does not succeed within
+// RenewDeadline or ctx is done
+func (le *LeaderElector) renew(ctx context.Context) {
+	for {
+		deadline := time.Now().Add(le.config.RenewDeadline)
+		for !le.tryAcquireOrRenew() {
+			if time.Now().Add(le.config.RetryPeriod).After(deadline) {
+				klog.Errorf("failed to renew lease %s/%s, stepping down", le.config.Namespace, le.config.Name)
+				return
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(le.config.RetryPeriod):
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(le.config.RetryPeriod):
+		}
+	}
+}
+
+// tryAcquireOrRenew takes the lease if it is free or expired, or renews it if it is
+// held already. The update carries the resourceVersion read, so of two replicas racing
+// for the lease only one succeeds.
+func (le *LeaderElector) tryAcquireOrRenew() bool {
+	now := time.Now()
+	lease, err := apiclient.GetLease(le.config.Namespace, le.config.Name)
+	if err == apiclient.ErrNotFound {
+		lease = &v1.Lease{
+			TypeMeta:   v1.TypeMeta{Kind: "Lease", APIVersion: "v1"},
+			ObjectMeta: v1.ObjectMeta{Name: le.config.Name, Namespace: le.config.Namespace},
+			Spec: v1.LeaseSpec{
+				HolderIdentity:       le.config.Identity,
+				LeaseDurationSeconds: int32(le.config.LeaseDuration / time.Second),
+				AcquireTime:          &now,
+				RenewTime:            &now,
+			},
+		}
+		if err = apiclient.CreateLease(lease); err != nil {
+			klog.Errorf("create lease %s/%s error: %v", le.config.Namespace, le.config.Name, err)
+			return false
+		}
+		le.observe(lease, now)
+		return true
+	} else if err != nil {
+		klog.Errorf("get lease %s/%s error: %v", le.config.Namespace, le.config.Name, err)
+		return false
+	}
+
+	if !sameRecord(lease, &le.observed) {
+		le.observe(lease, now)
+	}
+	spec := &lease.Spec
+	held := spec.HolderIdentity == le.config.Identity
+	if !held && spec.HolderIdentity != "" &&
+		le.observedTime.Add(time.Duration(spec.LeaseDurationSeconds)*time.Second).After(now) {
+		return false
+	}
+
+	if !held {
+		spec.HolderIdentity = le.config.Identity
+		spec.AcquireTime = &now
+		spec.LeaseTransitions++
+	}
+	spec.LeaseDurationSeconds = int32(le.config.LeaseDuration / time.Second)
+	spec.RenewTime = &now
+	if err = apiclient.UpdateLease(lease); err != nil {
+		klog.Errorf("update lease %s/%s error: %v", le.config.Namespace, le.config.Name, err)
+		return false
+	}
+	le.observe(lease, now)
+	return true
+}
+
+// release gives up the lease so that a standby takes it over without waiting for it
+// to expire
+func (le *LeaderElector) release() {
+	lease, err := apiclient.GetLease(le.config.Namespace, le.config.Name)
+	if err != nil || lease.Spec.HolderIdentity != le.config.Identity {
+		return
+	}
+	lease.Spec.HolderIdentity = ""
+	if err = apiclient.UpdateLease(lease); err != nil {
+		klog.Errorf("release lease %s/%s error: %v", le.config.Namespace, le.config.Name, err)
+	}
+}
+
+func (le *LeaderElector) observe(lease *v1.Lease, now time.Time) {
+	le.observed = *lease
+	le.observedTime = now
+}
+
+// sameRecord tells whether the lease has not changed hands nor been renewed
+func sameRecord(a, b *v1.Lease) bool {
+	return a.Spec.HolderIdentity == b.Spec.HolderIdentity && sameTime(a.Spec.RenewTime, b.Spec.RenewTime)
+}
+
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+// jitter spreads the retries of the standbys over up to 1.2 times the period
+func jitter(period time.Duration) time.Duration {
+	return period + time.Duration(rand.Float64()*0.2*float64(period))
+}
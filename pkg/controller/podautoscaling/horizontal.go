@@ -1,15 +1,17 @@
 package podautoscaling
 
 import (
+	"context"
 	"errors"
 	"github.com/inhies/go-bytesize"
 	"k8s.io/klog"
 	"math"
 	v1 "minik8s.com/minik8s/pkg/api/v1"
+	"minik8s.com/minik8s/pkg/apiclient"
 	"minik8s.com/minik8s/pkg/controller/component"
-	"minik8s.com/minik8s/utils/random"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -20,6 +22,11 @@ type HorizontalController struct {
 	queue                component.WorkQueue
 	defaultScaleDownRule *v1.HPAScalingRules
 	defaultScaleUpRule   *v1.HPAScalingRules
+	recorder             *component.EventRecorder
+
+	// ctx stops the scaling in progress, wg waits for it
+	ctx context.Context
+	wg  sync.WaitGroup
 }
 
 func NewHorizontalController(hpaInf *component.Informer, podInf *component.Informer, rsInf *component.Informer) *HorizontalController {
@@ -46,6 +53,7 @@ func NewHorizontalController(hpaInf *component.Informer, podInf *component.Infor
 		hpaInformer: hpaInf,
 		podInformer: podInf,
 		rsInformer:  rsInf,
+		recorder:    component.NewEventRecorder("horizontal-pod-autoscaler", ""),
 		defaultScaleUpRule: &v1.HPAScalingRules{
 			StabilizationWindowSeconds: 0,
 			SelectPolicy:               v1.MaxChangePolicySelect,
@@ -59,8 +67,11 @@ func NewHorizontalController(hpaInf *component.Informer, podInf *component.Infor
 	}
 }
 
-func (hpaC *HorizontalController) Run() {
+// Run scales the targets of the autoscalers until ctx is done, it returns once the
+// scaling in progress has stopped
+func (hpaC *HorizontalController) Run(ctx context.Context) {
 	hpaC.queue.Init()
+	hpaC.ctx = ctx
 
 	hpaC.hpaInformer.AddEventHandler(component.EventHandler{
 		OnAdd:    hpaC.addHPA,
@@ -68,13 +79,32 @@ func (hpaC *HorizontalController) Run() {
 		OnDelete: hpaC.deleteHPA,
 	})
 
-	go hpaC.worker()
-	go hpaC.periodicallyScaleAll()
+	hpaC.wg.Add(2)
+	go func() {
+		defer hpaC.wg.Done()
+		hpaC.worker()
+	}()
+	go func() {
+		defer hpaC.wg.Done()
+		hpaC.periodicallyScaleAll()
+	}()
+	<-ctx.Done()
+	hpaC.queue.ShutDown()
+	hpaC.wg.Wait()
+}
+
+// wait sleeps for d, it returns false if ctx is done meanwhile
+func (hpaC *HorizontalController) wait(d time.Duration) bool {
+	select {
+	case <-hpaC.ctx.Done():
+		return false
+	case <-time.After(d):
+		return true
+	}
 }
 
 func (hpaC *HorizontalController) periodicallyScaleAll() {
-	for {
-		time.Sleep(time.Second * 15)
+	for hpaC.wait(time.Second * 15) {
 		hpas := hpaC.hpaInformer.List()
 		for _, item := range hpas {
 			hpa := item.(v1.HorizontalPodAutoscaler)
@@ -90,14 +120,23 @@ func (hpaC *HorizontalController) worker() {
 }
 
 func (hpaC *HorizontalController) processNextWorkItem() bool {
-	key := hpaC.queue.Fetch().(string)
+	key, ok := hpaC.queue.Fetch().(string)
+	if !ok {
+		// the queue has been shut down
+		return false
+	}
 	if !hpaC.queue.Process(key) {
 		klog.Infof("HPA %s is being processed", key)
 		return true
 	}
 
 	err := hpaC.reconcileAutoScaler(key)
-	if err != nil {
+	if errors.Is(err, apiclient.ErrConflict) {
+		klog.Infof("HPA %s conflicts with a newer object, retry later", key)
+		hpaC.queue.Done(key)
+		hpaC.queue.PushAfter(key, component.ConflictRetryInterval)
+		return true
+	} else if err != nil {
 		klog.Error(err.Error())
 		return false
 	}
@@ -108,7 +147,9 @@ func (hpaC *HorizontalController) getTargetReplicaSet(hpa *v1.HorizontalPodAutos
 	rss := hpaC.rsInformer.List()
 	for _, item := range rss {
 		rs := item.(v1.ReplicaSet)
-		if rs.Name == hpa.Spec.ScaleTargetRef.Name && rs.APIVersion == hpa.Spec.ScaleTargetRef.APIVersion {
+		// the target is looked up in the namespace of the autoscaler only
+		if v1.SameNamespace(&rs.ObjectMeta, &hpa.ObjectMeta) &&
+			rs.Name == hpa.Spec.ScaleTargetRef.Name && rs.APIVersion == hpa.Spec.ScaleTargetRef.APIVersion {
 			return &rs
 		}
 	}
@@ -121,7 +162,7 @@ func (hpaC *HorizontalController) getRSOwnedPods(rs *v1.ReplicaSet) []v1.Pod {
 	pods := hpaC.podInformer.List()
 	for _, item := range pods {
 		pod := item.(v1.Pod)
-		if v1.CheckOwner(pod.OwnerReferences, rs.UID) != -1 {
+		if v1.CheckOwner(pod.OwnerReferences, rs.UID) != -1 && pod.DeletionTimestamp == nil {
 			relatedPods = append(relatedPods, pod)
 		}
 	}
@@ -147,6 +188,7 @@ func (hpaC *HorizontalController) reconcileAutoScaler(key string) error {
 
 		if targetRS.Status.Replicas != -1 {
 			targetRS.Status.Replicas = -1
+			// the HPA only scales the replicaset, deleting it leaves the replicaset in place
 			owner := v1.OwnerReference{
 				Name:       hpa.Name,
 				APIVersion: hpa.APIVersion,
@@ -154,7 +196,14 @@ func (hpaC *HorizontalController) reconcileAutoScaler(key string) error {
 				Kind:       hpa.Kind,
 			}
 			targetRS.OwnerReferences = append(targetRS.OwnerReferences, owner)
-			hpaC.rsInformer.UpdateItem(targetRS.UID, *targetRS)
+			if err := hpaC.rsInformer.UpdateItem(targetRS.UID, *targetRS); err != nil {
+				return err
+			}
+			// the update above has moved the replicaset on, its status is put unconditionally
+			targetRS.ResourceVersion = ""
+			if err := hpaC.rsInformer.UpdateItemStatus(targetRS.UID, *targetRS); err != nil {
+				return err
+			}
 		}
 
 		relatedPods := hpaC.getRSOwnedPods(targetRS)
@@ -309,7 +358,13 @@ func (hpaC *HorizontalController) scale(hpa *v1.HorizontalPodAutoscaler, scaling
 	for i, pod := range pods {
 		podUIDs[i] = pod.UID
 	}
-	go hpaC.periodicallyScale(hpa, &chosenPolicy, podUIDs, rs)
+	hpaC.recorder.Eventf(v1.ReferenceTo("HorizontalPodAutoscaler", &hpa.ObjectMeta), v1.EventTypeNormal, "SuccessfulRescale",
+		"New size: %d; old size: %d", hpa.Status.DesiredReplicas, hpa.Status.CurrentReplicas)
+	hpaC.wg.Add(1)
+	go func() {
+		defer hpaC.wg.Done()
+		hpaC.periodicallyScale(hpa, &chosenPolicy, podUIDs, rs)
+	}()
 
 	return nil
 }
@@ -352,25 +407,31 @@ func (hpaC *HorizontalController) periodicallyScale(hpa *v1.HorizontalPodAutosca
 			if !endFlag {
 				leftToDelete -= max
 				klog.Infof("leftToDelete: %v, max: %v, wait: %v", leftToDelete, max, time.Duration(policy.PeriodSeconds)*time.Second)
-				time.Sleep(time.Duration(policy.PeriodSeconds) * time.Second)
+				if !hpaC.wait(time.Duration(policy.PeriodSeconds) * time.Second) {
+					hpaC.queue.Done(hpa.UID)
+					return
+				}
 			}
 		}
-	} else {
-		hpaC.masterCurrentPods(max, policy, hpa, rs)
-		// create pods
-		hpaC.createPods(max, policy, hpa, rs)
+	} else if !hpaC.masterCurrentPods(max, policy, hpa, rs) || !hpaC.createPods(max, policy, hpa, rs) {
+		// the scaling has been stopped, the next leader scales from the pods there are then
+		hpaC.queue.Done(hpa.UID)
+		return
 	}
 
-	hpaC.hpaInformer.UpdateItem(hpa.UID, *hpa)
+	hpaC.hpaInformer.UpdateItemStatus(hpa.UID, *hpa)
 	hpaC.queue.Done(hpa.UID)
 }
 
-func (hpaC *HorizontalController) masterCurrentPods(max int, policy *v1.HPAScalingPolicy, hpa *v1.HorizontalPodAutoscaler, rs *v1.ReplicaSet) {
+// masterCurrentPods adopts the orphan pods matching the target, it returns false if ctx
+// is done before all of them are adopted
+func (hpaC *HorizontalController) masterCurrentPods(max int, policy *v1.HPAScalingPolicy, hpa *v1.HorizontalPodAutoscaler, rs *v1.ReplicaSet) bool {
 	pods := hpaC.podInformer.List()
 	readyPods := make([]v1.Pod, 0)
 	for _, item := range pods {
 		pod := item.(v1.Pod)
-		if v1.GetOwnerReplicaSet(&pod) == "" && v1.MatchSelector(rs.Spec.Selector, pod.Labels) {
+		if v1.SameNamespace(&pod.ObjectMeta, &rs.ObjectMeta) && v1.GetOwnerReplicaSet(&pod) == "" &&
+			v1.MatchSelector(rs.Spec.Selector, pod.Labels) {
 			readyPods = append(readyPods, pod)
 		}
 	}
@@ -401,6 +462,7 @@ func (hpaC *HorizontalController) masterCurrentPods(max int, policy *v1.HPAScali
 				APIVersion: rs.APIVersion,
 				UID:        rs.UID,
 				Kind:       rs.Kind,
+				Controller: true,
 			}
 			pod.OwnerReferences = append(pod.OwnerReferences, ref)
 			hpaC.podInformer.UpdateItem(pod.UID, pod)
@@ -412,28 +474,35 @@ func (hpaC *HorizontalController) masterCurrentPods(max int, policy *v1.HPAScali
 
 		if !endFlag {
 			leftToAdd -= max
-			time.Sleep(time.Duration(policy.PeriodSeconds) * time.Second)
+			if !hpaC.wait(time.Duration(policy.PeriodSeconds) * time.Second) {
+				return false
+			}
 		}
 	}
+	return true
 }
 
-func (hpaC *HorizontalController) createPods(max int, policy *v1.HPAScalingPolicy, hpa *v1.HorizontalPodAutoscaler, rs *v1.ReplicaSet) {
+// createPods creates the pods missing, it returns false if ctx is done before all of
+// them are created
+func (hpaC *HorizontalController) createPods(max int, policy *v1.HPAScalingPolicy, hpa *v1.HorizontalPodAutoscaler, rs *v1.ReplicaSet) bool {
 	podTemplate := v1.Pod{
 		TypeMeta: v1.TypeMeta{
 			Kind:       "Pod",
 			APIVersion: rs.APIVersion,
 		},
 		ObjectMeta: v1.ObjectMeta{
-			Name:      rs.Spec.Template.Name + "-",
-			Namespace: rs.Spec.Template.Namespace,
-			UID:       "",
-			Labels:    rs.Spec.Template.Labels,
+			// the api server appends a unique suffix
+			GenerateName: rs.Spec.Template.Name + "-",
+			Namespace:    rs.Namespace,
+			UID:          "",
+			Labels:       rs.Spec.Template.Labels,
 			OwnerReferences: []v1.OwnerReference{
 				{
 					Name:       rs.Name,
 					APIVersion: rs.APIVersion,
 					UID:        rs.UID,
 					Kind:       rs.Kind,
+					Controller: true,
 				},
 			},
 		},
@@ -441,28 +510,9 @@ func (hpaC *HorizontalController) createPods(max int, policy *v1.HPAScalingPolic
 	}
 	podTemplate.UID = ""
 
-	for _, container := range podTemplate.Spec.Containers {
-		if container.Resources == nil {
-			container.Resources = map[string]string{
-				"cpu":    "4",
-				"memory": "512MB",
-			}
-			continue
-		}
-
-		if _, exist := container.Resources["cpu"]; !exist {
-			container.Resources["cpu"] = "4"
-		}
-
-		if _, exist := container.Resources["memory"]; !exist {
-			container.Resources["memory"] = "512MB"
-		}
-	}
-
 	delta := hpa.Status.DesiredReplicas - hpa.Status.CurrentReplicas
 	leftToAdd := delta
 
-	namePrefix := podTemplate.Name
 	for i := 0; i < delta; {
 		numInPeriod := max
 		endFlag := false
@@ -472,7 +522,6 @@ func (hpaC *HorizontalController) createPods(max int, policy *v1.HPAScalingPolic
 		}
 
 		for j := 0; j < numInPeriod; j++ {
-			podTemplate.Name = namePrefix + random.String(5)
 			hpaC.podInformer.AddItem(podTemplate)
 			hpa.Status.CurrentReplicas++
 			hpa.Status.LastScaleTime = time.Now()
@@ -482,9 +531,12 @@ func (hpaC *HorizontalController) createPods(max int, policy *v1.HPAScalingPolic
 		if !endFlag {
 			leftToAdd -= max
 			klog.Infof("leftToAdd: %v, max: %v, wait: %v", leftToAdd, max, time.Duration(policy.PeriodSeconds)*time.Second)
-			time.Sleep(time.Duration(policy.PeriodSeconds) * time.Second)
+			if !hpaC.wait(time.Duration(policy.PeriodSeconds) * time.Second) {
+				return false
+			}
 		}
 	}
+	return true
 }
 
 func (hpaC *HorizontalController) calcPodCpuUtilization(pod *v1.Pod) float64 {
@@ -620,5 +672,8 @@ func (hpaC *HorizontalController) deleteHPA(obj any) {
 	rs.Status.Replicas = hpa.Status.CurrentReplicas
 	index := v1.CheckOwner(rs.OwnerReferences, hpa.UID)
 	rs.OwnerReferences = append(rs.OwnerReferences[index:], rs.OwnerReferences[index+1:]...)
-	hpaC.rsInformer.UpdateItem(rs.UID, *rs)
+	if hpaC.rsInformer.UpdateItem(rs.UID, *rs) == nil {
+		rs.ResourceVersion = ""
+		hpaC.rsInformer.UpdateItemStatus(rs.UID, *rs)
+	}
 }
@@ -1,27 +1,32 @@
 package rs
 
 import (
+	"context"
+	"errors"
 	"k8s.io/klog"
 	v1 "minik8s.com/minik8s/pkg/api/v1"
+	"minik8s.com/minik8s/pkg/apiclient"
 	"minik8s.com/minik8s/pkg/controller/component"
-	"minik8s.com/minik8s/utils/random"
 )
 
 type ReplicaSetController struct {
 	podInformer *component.Informer
 	rsInformer  *component.Informer
 	queue       component.WorkQueue
+	recorder    *component.EventRecorder
 }
 
 func NewReplicaSetController(podInfo *component.Informer, rsInfo *component.Informer) *ReplicaSetController {
 	return &ReplicaSetController{
 		podInformer: podInfo,
 		rsInformer:  rsInfo,
+		recorder:    component.NewEventRecorder("replicaset-controller", ""),
 	}
 }
 
-// Run begins watching and syncing.
-func (rsc *ReplicaSetController) Run() {
+// Run begins watching and syncing, it returns once ctx is done and the worker has
+// finished the key it is syncing.
+func (rsc *ReplicaSetController) Run(ctx context.Context) {
 	rsc.queue.Init()
 
 	rsc.rsInformer.AddEventHandler(component.EventHandler{
@@ -37,7 +42,15 @@ func (rsc *ReplicaSetController) Run() {
 	})
 
 	rsc.syncAll()
-	go rsc.worker()
+
+	done := make(chan struct{})
+	go func() {
+		rsc.worker()
+		close(done)
+	}()
+	<-ctx.Done()
+	rsc.queue.ShutDown()
+	<-done
 }
 
 func (rsc *ReplicaSetController) syncAll() {
@@ -54,7 +67,11 @@ func (rsc *ReplicaSetController) worker() {
 }
 
 func (rsc *ReplicaSetController) processNextWorkItem() bool {
-	key := rsc.queue.Fetch().(string)
+	key, ok := rsc.queue.Fetch().(string)
+	if !ok {
+		// the queue has been shut down
+		return false
+	}
 	if !rsc.queue.Process(key) {
 		klog.Infof("ReplicaSet %s is being processed", key)
 		return true
@@ -62,7 +79,10 @@ func (rsc *ReplicaSetController) processNextWorkItem() bool {
 
 	err := rsc.syncReplicaSet(key)
 	rsc.queue.Done(key)
-	if err != nil {
+	if errors.Is(err, apiclient.ErrConflict) {
+		klog.Infof("ReplicaSet %s conflicts with a newer object, retry later", key)
+		rsc.queue.PushAfter(key, component.ConflictRetryInterval)
+	} else if err != nil {
 		klog.Error("syncReplicaSet error\n")
 	}
 	return true
@@ -86,6 +106,10 @@ func (rsc *ReplicaSetController) syncReplicaSet(key string) error {
 	ownedPods := make([]v1.Pod, 0)
 	for _, item := range pods {
 		pod := item.(v1.Pod)
+		// a terminating pod is no longer counted as a replica
+		if !v1.SameNamespace(&pod.ObjectMeta, &rs.ObjectMeta) || pod.DeletionTimestamp != nil {
+			continue
+		}
 		ownerRS := v1.GetOwnerReplicaSet(&pod)
 		if ownerRS == rs.UID {
 			ownedPods = append(ownedPods, pod)
@@ -109,29 +133,33 @@ func (rsc *ReplicaSetController) syncReplicaSet(key string) error {
 	rs.Status.Replicas = replicaNum
 	if replicaNum != rs.Spec.Replicas {
 		if replicaNum < rs.Spec.Replicas {
-			rsc.increaseReplica(replicaNum, &rs, matchedNotOwnedPods)
+			return rsc.increaseReplica(replicaNum, &rs, matchedNotOwnedPods)
 		} else {
-			rsc.decreaseReplica(replicaNum, &rs, ownedPods)
+			return rsc.decreaseReplica(replicaNum, &rs, ownedPods)
 		}
 	}
 
 	return nil
 }
 
-func (rsc *ReplicaSetController) decreaseReplica(realReplicaNum int, rs *v1.ReplicaSet, ownedPods []v1.Pod) {
+func (rsc *ReplicaSetController) decreaseReplica(realReplicaNum int, rs *v1.ReplicaSet, ownedPods []v1.Pod) error {
 	for i := 0; i < realReplicaNum-rs.Spec.Replicas; i++ {
 		pod := ownedPods[i]
 		index := v1.CheckOwner(pod.OwnerReferences, rs.UID)
 		klog.Infof("remove Pod %s's OwnerReference ReplicaSet %s", pod.UID, rs.UID)
 		pod.OwnerReferences = append(pod.OwnerReferences[:index], pod.OwnerReferences[index+1:]...)
-		rsc.podInformer.UpdateItem(pod.UID, pod)
+		if err := rsc.podInformer.UpdateItem(pod.UID, pod); err != nil {
+			return err
+		}
+		rsc.recorder.Eventf(v1.ReferenceTo("ReplicaSet", &rs.ObjectMeta), v1.EventTypeNormal, "SuccessfulRelease",
+			"Released pod: %s", pod.Name)
 		rs.Status.Replicas--
 	}
 
-	rsc.rsInformer.UpdateItem(rs.UID, *rs)
+	return rsc.rsInformer.UpdateItemStatus(rs.UID, *rs)
 }
 
-func (rsc *ReplicaSetController) increaseReplica(realReplicaNum int, rs *v1.ReplicaSet, matchedNotOwnedPods []v1.Pod) {
+func (rsc *ReplicaSetController) increaseReplica(realReplicaNum int, rs *v1.ReplicaSet, matchedNotOwnedPods []v1.Pod) error {
 	podsLen := len(matchedNotOwnedPods)
 	expectedIncrease := rs.Spec.Replicas - realReplicaNum
 	var length int
@@ -152,10 +180,15 @@ func (rsc *ReplicaSetController) increaseReplica(realReplicaNum int, rs *v1.Repl
 			APIVersion: rs.APIVersion,
 			UID:        rs.UID,
 			Kind:       rs.Kind,
+			Controller: true,
 		}
 		pod.OwnerReferences = append(pod.OwnerReferences, ref)
 
-		rsc.podInformer.UpdateItem(pod.UID, pod)
+		if err := rsc.podInformer.UpdateItem(pod.UID, pod); err != nil {
+			return err
+		}
+		rsc.recorder.Eventf(v1.ReferenceTo("ReplicaSet", &rs.ObjectMeta), v1.EventTypeNormal, "SuccessfulAdopt",
+			"Adopted pod: %s", pod.Name)
 		rs.Status.Replicas++
 	}
 
@@ -166,40 +199,28 @@ func (rsc *ReplicaSetController) increaseReplica(realReplicaNum int, rs *v1.Repl
 		}
 		pod.Kind = "Pod"
 		pod.APIVersion = rs.APIVersion
+		pod.Namespace = rs.Namespace
 		pod.UID = ""
-		pod.Name = pod.Name + "-" + random.String(5)
+		// the api server appends a unique suffix
+		pod.GenerateName = rs.Spec.Template.Name + "-"
+		pod.Name = ""
 
 		ref := v1.OwnerReference{
 			Name:       rs.Name,
 			APIVersion: rs.APIVersion,
 			UID:        rs.UID,
 			Kind:       rs.Kind,
+			Controller: true,
 		}
 		pod.OwnerReferences = append(pod.OwnerReferences, ref)
 
-		for _, container := range pod.Spec.Containers {
-			if container.Resources == nil {
-				container.Resources = map[string]string{
-					"cpu":    "4",
-					"memory": "512MB",
-				}
-				continue
-			}
-
-			if _, exist := container.Resources["cpu"]; !exist {
-				container.Resources["cpu"] = "4"
-			}
-
-			if _, exist := container.Resources["memory"]; !exist {
-				container.Resources["memory"] = "512MB"
-			}
-		}
-
 		rsc.podInformer.AddItem(pod)
+		rsc.recorder.Eventf(v1.ReferenceTo("ReplicaSet", &rs.ObjectMeta), v1.EventTypeNormal, "SuccessfulCreate",
+			"Created pod from template %s", rs.Spec.Template.Name)
 
 		rs.Status.Replicas++
 	}
-	rsc.rsInformer.UpdateItem(rs.UID, *rs)
+	return rsc.rsInformer.UpdateItemStatus(rs.UID, *rs)
 }
 
 // return replicaSets that matches the pod, while there
@@ -211,7 +232,7 @@ func (rsc *ReplicaSetController) getPodReplicaSet(pod *v1.Pod) []v1.ReplicaSet {
 	for _, item := range rss {
 		rs := item.(v1.ReplicaSet)
 
-		flag := v1.MatchSelector(rs.Spec.Selector, pod.Labels)
+		flag := v1.SameNamespace(&rs.ObjectMeta, &pod.ObjectMeta) && v1.MatchSelector(rs.Spec.Selector, pod.Labels)
 
 		if flag {
 			result = append(result, rs)
@@ -271,20 +292,11 @@ func (rsc *ReplicaSetController) updateRS(newObj any, oldObj any) {
 	}
 }
 
+// deleteRS leaves the pods to the garbage collector, or they have been orphaned by the
+// api server already
 func (rsc *ReplicaSetController) deleteRS(obj any) {
 	rs := obj.(v1.ReplicaSet)
 	klog.Info("delete ReplicaSet ", rs.UID)
-
-	pods := rsc.podInformer.List()
-	for _, item := range pods {
-		pod := item.(v1.Pod)
-		ownerIndex := v1.CheckOwner(pod.OwnerReferences, rs.UID)
-
-		if ownerIndex >= 0 {
-			pod.OwnerReferences = append(pod.OwnerReferences[:ownerIndex], pod.OwnerReferences[ownerIndex+1:]...)
-			rsc.podInformer.UpdateItem(pod.UID, pod)
-		}
-	}
 }
 
 func (rsc *ReplicaSetController) addPod(obj any) {
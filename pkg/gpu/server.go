@@ -8,9 +8,9 @@ import (
 	"k8s.io/klog/v2"
 	"minik8s.com/minik8s/config"
 	v1 "minik8s.com/minik8s/pkg/api/v1"
+	"minik8s.com/minik8s/pkg/apiclient"
 	"net/http"
 	"os"
-	"strconv"
 	"time"
 )
 
@@ -22,6 +22,12 @@ type GetGPUResponse struct {
 	Type string    `json:"type"`
 }
 
+type PutGPUResponse struct {
+	Status          string `json:"status"`
+	Error           string `json:"error,omitempty"`
+	ResourceVersion string `json:"resourceVersion,omitempty"`
+}
+
 func Run() {
 	getJob()
 	runJob()
@@ -34,9 +40,18 @@ func Run() {
 	}
 }
 
+// jobPath returns the path of the job, os.Args[3] is the namespace of the job
+func jobPath() string {
+	namespace := v1.NamespaceDefault
+	if len(os.Args) > 3 {
+		namespace = os.Args[3]
+	}
+	return "/namespaces/" + namespace + "/gpus/" + os.Args[2]
+}
+
 func getJob() {
-	url := os.Args[1] + "/gpu/" + os.Args[2]
-	resp, err := http.Get(url)
+	url := os.Args[1] + jobPath()
+	resp, err := apiclient.HttpGet(url)
 	if err != nil {
 		return
 	}
@@ -57,32 +72,35 @@ func getJob() {
 	job = &gpuResp.Job
 }
 
-func downloadFile(filename string, jobUID string) {
-	resp, err := http.Get(os.Args[1] + "/public/" + jobUID + "-" + filename)
-	if err != nil {
-		klog.Error(err)
+// downloadFile downloads the file of the job from the Blob holding it, the content is
+// checked against the checksum of the blob
+func downloadFile(filename string, blob string) {
+	if blob == "" {
+		klog.Errorf("file %s of job %s has no blob", filename, job.Name)
 		return
 	}
-	defer resp.Body.Close()
-	reader := bufio.NewReader(resp.Body) // 获得reader对象
 	file, err := os.Create("./" + filename)
 	if err != nil {
 		klog.Error(err)
 		return
 	}
-
 	writer := bufio.NewWriter(file) // 获得writer对象
-	_, err = io.Copy(writer, reader)
+	err = apiclient.DownloadBlob(v1.NamespaceOf(&job.ObjectMeta), blob, writer)
+	if err == nil {
+		err = writer.Flush()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
 	if err != nil {
-		klog.Error(err)
-		return
+		klog.Errorf("download file %s failed, err: %v", filename, err)
 	}
 }
 
 func runJob() {
-	downloadFile(job.Script, job.UID)
+	downloadFile(job.Script, job.ScriptBlob)
 	for _, file := range job.Files {
-		downloadFile(file.Filename, job.UID)
+		downloadFile(file.Filename, file.Blob)
 	}
 
 	sshClient := NewSshClient(config.AS_GPU_DATA_ADDR)
@@ -106,11 +124,24 @@ func getResult() {
 	job.Error = string(sshClient.RunCmd("cat " + config.AS_GPU_HOMEPATH + job.JobNum + ".err"))
 	klog.Infof("get result: \nOutput: %s\n Error: %s", job.Output, job.Error)
 
-	cli := http.Client{}
 	buf, _ := json.Marshal(job)
-	url := config.AC_ServerAddr + ":" + strconv.Itoa(config.AC_ServerPort) + config.AC_RestGpu_Path
-	req, _ := http.NewRequest(http.MethodPut, url+"/"+job.UID, bytes.NewReader(buf))
-	_, _ = cli.Do(req)
+	// the results are the status of the job
+	url := apiclient.ServerURL() + jobPath() + "/status"
+	req, _ := http.NewRequest(http.MethodPut, url, bytes.NewReader(buf))
+	resp, err := apiclient.Do(req)
+	if err != nil {
+		klog.Error(err)
+	} else {
+		// keep the resourceVersion of the job up to date for the next update
+		var putResp PutGPUResponse
+		buf, _ = io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if json.Unmarshal(buf, &putResp) == nil && putResp.ResourceVersion != "" {
+			job.ResourceVersion = putResp.ResourceVersion
+		} else {
+			klog.Errorf("update job failed: %s", buf)
+		}
+	}
 
 	sshClient.Close()
 }
@@ -1,18 +1,12 @@
 package commands
 
 import (
-	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
-	"io/ioutil"
-	"mime/multipart"
-	"net/http"
 	"os"
-	"strconv"
 
 	"github.com/spf13/cobra"
-	"minik8s.com/minik8s/config"
 	v1 "minik8s.com/minik8s/pkg/api/v1"
 	"minik8s.com/minik8s/pkg/apiclient"
 )
@@ -52,91 +46,68 @@ var addCmd = &cobra.Command{
 		}
 		var resp []byte
 		switch kind {
-		case "pod":
-			resp = apiclient.Rest("", "", apiclient.OBJ_ALL_PODS, apiclient.OP_GET)
-			var pods []GetPodResponse
-			var pod v1.Pod
-			json.Unmarshal(resp, &pods)
-			err := json.Unmarshal(buf, &pod)
-			if err != nil{
-				fmt.Println("error: ", err)
+		case "function":
+			resp = apiclient.RestIn(namespace, id, string(buf), apiclient.OBJ_FUNCTION, apiclient.OP_POST)
+			fmt.Println("服务器返回: ", string(resp))
+			return
+		case "AC":
+			resp = apiclient.RestIn(namespace, id, string(buf), apiclient.OBJ_ACTCHAIN, apiclient.OP_POST)
+			fmt.Println("服务器返回: ", string(resp))
+			return
+		}
+
+		res, err := resolveKind(kind)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		if res.Kind == "GPUJob" {
+			var gpuJob v1.GPUJob
+			err := json.Unmarshal(buf, &gpuJob)
+			if err != nil {
+				fmt.Println("输入文件解析失败: ", err)
 				return
 			}
-			for _, p := range pods {
-				if pod.Name == p.Pod.Name {
-					fmt.Println("error: Duplicated Pod Name!")
-					return
-				}
+			// 任务文件先作为Blob上传，任务引用已就绪的Blob创建，gpu server无需等待
+			var blobs []string
+			ok := true
+			if gpuJob.ScriptBlob, ok = uploadFile(gpuJob.Script); ok {
+				blobs = append(blobs, gpuJob.ScriptBlob)
 			}
-			for _, c := range pod.Spec.Containers{
-				if c.Resources == nil{
-					c.Resources = make(map[string]string)
-				}
-				if _, exist := c.Resources["cpu"]; !exist{
-					fmt.Println("automically set cpu: 4")
-					c.Resources["cpu"] = "4"
-				}
-				if _, exist := c.Resources["memory"]; !exist{
-					fmt.Println("automically set memory: 512MB")
-					c.Resources["memory"] = "512MB"
+			for i := range gpuJob.Files {
+				var uploaded bool
+				if gpuJob.Files[i].Blob, uploaded = uploadFile(gpuJob.Files[i].Filename); uploaded {
+					blobs = append(blobs, gpuJob.Files[i].Blob)
 				}
+				ok = ok && uploaded
 			}
-			buf, _ := json.Marshal(pod)
-			resp = apiclient.Rest("", string(buf), apiclient.OBJ_POD, apiclient.OP_POST)
-		case "service":
-			resp = apiclient.Rest("", "", apiclient.OBJ_ALL_SERVICES, apiclient.OP_GET)
-			var svcs []GetServiceResponse
-			var service v1.Service
-			json.Unmarshal(resp, &svcs)
-			err := json.Unmarshal(buf, &service)
-			if err != nil{
-				fmt.Println("error: ", err)
+			if !ok {
+				deleteBlobs(blobs)
 				return
 			}
-			for _, svc := range svcs {
-				if svc.Service.Spec.ClusterIP == service.Spec.ClusterIP {
-					fmt.Println("error: Duplicated Cluster IP!")
-					return
-				}
-			}
-			resp = apiclient.Rest("", string(buf), apiclient.OBJ_SERVICE, apiclient.OP_POST)
-		case "dns":
-			resp = apiclient.Rest("", string(buf), apiclient.OBJ_DNS, apiclient.OP_POST)
-		case "gpu":
-			var gpuJob v1.GPUJob
-			err := json.Unmarshal(buf, &gpuJob)
-			if err != nil {
-				fmt.Println("输入文件解析失败: ", err)
-				return
-			}
-			resp = apiclient.Rest("", string(buf), apiclient.OBJ_GPU, apiclient.OP_POST)
+			buf, _ = json.Marshal(gpuJob)
+			resp = apiclient.RestResource(res, namespace, "", string(buf), apiclient.OP_POST)
 			var stat StatusResponse
 			err = json.Unmarshal(resp, &stat)
 			if err != nil {
 				fmt.Println("服务器返回信息无效: ", err)
+				deleteBlobs(blobs)
 			} else if stat.Status != "OK" {
 				fmt.Println("创建对象失败：", stat.Error)
+				deleteBlobs(blobs)
 			} else {
 				fmt.Println("成功创建对象，id：", stat.Id)
-				uploadFile(gpuJob.Script, stat.Id+"-"+gpuJob.Script)
-				for _, up_file := range gpuJob.Files {
-					uploadFile(up_file.Filename, stat.Id+"-"+up_file.Filename)
+				// Blob由任务拥有，任务删除后随之回收
+				owner := v1.OwnerReference{APIVersion: gpuJob.APIVersion, Kind: res.Kind, Name: stat.Id, UID: stat.Uid, Controller: true}
+				for _, blob := range blobs {
+					if err = apiclient.SetBlobOwner(namespace, blob, owner); err != nil {
+						fmt.Println("设置文件所属任务失败：", blob, err)
+					}
 				}
 			}
 			return
-		case "replica":
-			resp = apiclient.Rest("", string(buf), apiclient.OBJ_REPLICAS, apiclient.OP_POST)
-		case "hpa":
-			resp = apiclient.Rest("", string(buf), apiclient.OBJ_HPA, apiclient.OP_POST)
-		case "function":
-			resp = apiclient.Rest(id, string(buf), apiclient.OBJ_FUNCTION, apiclient.OP_POST)
-			fmt.Println("服务器返回: ", string(resp))
-			return
-		case "AC":
-			resp = apiclient.Rest(id, string(buf), apiclient.OBJ_ACTCHAIN, apiclient.OP_POST)
-			fmt.Println("服务器返回: ", string(resp))
-			return
 		}
+		resp = apiclient.RestResource(res, namespace, "", string(buf), apiclient.OP_POST)
 
 		var stat StatusResponse
 		err = json.Unmarshal(resp, &stat)
@@ -153,49 +124,26 @@ var addCmd = &cobra.Command{
 
 func init() {
 	addCmd.Flags().StringP("file", "f", "nginx_pod.json", "指定json配置文件")
-	addCmd.Flags().StringP("kind", "k", "pod", "指定创建对象类型")
+	addCmd.Flags().StringP("kind", "k", "pod", "指定创建对象类型，如pod、po、pods或自定义资源的复数形式")
 	addCmd.Flags().StringP("id", "i", "xx", "指定创建对象的名字（仅对Serverless对象有效）")
 
 	rootCmd.AddCommand(addCmd)
 }
 
-func uploadFile(path string, newFilename string) {
-	upfile, err := os.OpenFile(path, os.O_RDONLY, 0666)
+// uploadFile uploads the file as a blob and returns its name
+func uploadFile(path string) (string, bool) {
+	blob, err := apiclient.UploadBlob(namespace, path, nil)
 	if err != nil {
-		fmt.Println("文件打开失败：", err)
+		fmt.Println("文件上传失败：", path, err)
+		return "", false
 	}
-	defer upfile.Close()
-
-	url := config.AC_ServerAddr + ":" + strconv.Itoa(config.AC_ServerPort) + "/upload"
-
-	body := &bytes.Buffer{}
-	writer := multipart.NewWriter(body)
-	part, err := writer.CreateFormFile("file", newFilename)
-	if err != nil {
-		fmt.Println("文件上传失败：", err)
-		return
-	}
-	_, err = io.Copy(part, upfile)
-	if err != nil {
-		fmt.Println("io copy err: ", err)
-		return
-	}
-
-	err = writer.Close()
-	if err != nil {
-		fmt.Println("文件上传失败：", err)
-		return
-	}
-	request, _ := http.NewRequest("POST", url, body)
-	request.Header.Set("Content-Type", writer.FormDataContentType())
+	fmt.Printf("文件已上传：%s -> blob %s（sha256 %s）\n", path, blob.Name, blob.Spec.SHA256)
+	return blob.Name, true
+}
 
-	client := &http.Client{}
-	resp, _ := client.Do(request)
-	respBody, err := ioutil.ReadAll(resp.Body)
-	resp.Body.Close()
-	if err != nil {
-		fmt.Println("文件上传失败：", err)
-		return
+// deleteBlobs deletes the blobs uploaded for a job that was not created
+func deleteBlobs(blobs []string) {
+	for _, blob := range blobs {
+		apiclient.DeleteBlob(namespace, blob)
 	}
-	fmt.Println(string(respBody))
 }
@@ -0,0 +1,124 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"minik8s.com/minik8s/pkg/apiclient"
+)
+
+var adminCmd = &cobra.Command{
+	Use:   "admin",
+	Short: `管理api server的存储`,
+	Long:  `用于查看存储状态、保存与恢复快照、压缩历史版本与整理碎片，需要集群管理员权限`,
+}
+
+var adminStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: `查看存储状态`,
+	Run: func(cmd *cobra.Command, args []string) {
+		status, err := apiclient.StorageStatus()
+		if err != nil {
+			fmt.Println("查询存储状态失败：", err)
+			return
+		}
+		fmt.Println("存储后端：", status.Backend)
+		fmt.Println("当前版本：", status.Revision)
+		fmt.Printf("数据库大小：%d bytes（使用中 %d bytes）\n", status.DBSize, status.DBSizeInUse)
+		if status.LastCompactionTime != nil {
+			fmt.Printf("上次压缩：版本 %d，%v\n", status.CompactedRevision, status.LastCompactionTime.Format(time.RFC3339))
+		}
+		if status.LastDefragmentationTime != nil {
+			fmt.Println("上次碎片整理：", status.LastDefragmentationTime.Format(time.RFC3339))
+		}
+	},
+}
+
+var adminSnapshotCmd = &cobra.Command{
+	Use:   "snapshot",
+	Short: `保存快照`,
+	Long:  `用于将minik8s的所有数据保存为同一版本的快照文件，可恢复到新的存储中`,
+	Run: func(cmd *cobra.Command, args []string) {
+		filePath, _ := cmd.Flags().GetString("file")
+		// 先写入临时文件，成功后再替换，避免留下不完整的快照
+		tmp := filePath + ".part"
+		file, err := os.Create(tmp)
+		if err != nil {
+			fmt.Println("文件创建失败：", err)
+			return
+		}
+		err = apiclient.SaveSnapshot(file)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err == nil {
+			err = os.Rename(tmp, filePath)
+		}
+		if err != nil {
+			os.Remove(tmp)
+			fmt.Println("保存快照失败：", err)
+			return
+		}
+		fmt.Println("快照已保存到：", filePath)
+	},
+}
+
+var adminRestoreCmd = &cobra.Command{
+	Use:   "restore",
+	Short: `恢复快照`,
+	Long:  `用于将快照恢复到空的存储中，对象的uid保持不变，版本号由新的存储重新分配`,
+	Run: func(cmd *cobra.Command, args []string) {
+		filePath, _ := cmd.Flags().GetString("file")
+		file, err := os.Open(filePath)
+		if err != nil {
+			fmt.Println("文件打开失败：", err)
+			return
+		}
+		defer file.Close()
+		rv, err := apiclient.RestoreSnapshot(file)
+		if err != nil {
+			fmt.Println("恢复快照失败：", err)
+			return
+		}
+		fmt.Println("快照已恢复，当前版本：", rv)
+	},
+}
+
+var adminCompactCmd = &cobra.Command{
+	Use:   "compact",
+	Short: `压缩历史版本`,
+	Long:  `用于丢弃指定版本之前的历史，之后无法从更早的版本继续watch`,
+	Run: func(cmd *cobra.Command, args []string) {
+		revision, _ := cmd.Flags().GetInt64("revision")
+		rv, err := apiclient.Compact(revision)
+		if err != nil {
+			fmt.Println("压缩失败：", err)
+			return
+		}
+		fmt.Println("已压缩至版本：", rv)
+	},
+}
+
+var adminDefragCmd = &cobra.Command{
+	Use:   "defrag",
+	Short: `整理碎片`,
+	Long:  `用于将压缩释放的空间归还给文件系统，整理期间存储会暂停读写`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := apiclient.Defragment(); err != nil {
+			fmt.Println("碎片整理失败：", err)
+			return
+		}
+		fmt.Println("碎片整理完成")
+	},
+}
+
+func init() {
+	adminSnapshotCmd.Flags().StringP("file", "f", "minik8s-snapshot.json", "快照文件")
+	adminRestoreCmd.Flags().StringP("file", "f", "minik8s-snapshot.json", "快照文件")
+	adminCompactCmd.Flags().Int64("revision", 0, "压缩到的版本，默认为当前版本")
+
+	adminCmd.AddCommand(adminStatusCmd, adminSnapshotCmd, adminRestoreCmd, adminCompactCmd, adminDefragCmd)
+	rootCmd.AddCommand(adminCmd)
+}
@@ -0,0 +1,93 @@
+package commands
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	v1 "minik8s.com/minik8s/pkg/api/v1"
+	"minik8s.com/minik8s/pkg/apiclient"
+)
+
+var applyCmd = &cobra.Command{
+	Use:   "apply",
+	Short: `声明式地创建或更新资源`,
+	Long: `用于将配置文件通过server-side apply合并到资源上，对象不存在时创建它。
+配置中的字段归--field-manager所有，配置中去掉的字段会从对象上删除，
+与其它manager所有的字段冲突时失败，可用--force-conflicts接管它们`,
+	Run: func(cmd *cobra.Command, args []string) {
+		filePath, _ := cmd.Flags().GetString("file")
+		manager, _ := cmd.Flags().GetString("field-manager")
+		force, _ := cmd.Flags().GetBool("force-conflicts")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+		buf, err := os.ReadFile(filePath)
+		if err != nil {
+			fmt.Println("文件打开失败：", err)
+			return
+		}
+		var manifest struct {
+			v1.TypeMeta
+			Metadata v1.ObjectMeta `json:"metadata"`
+		}
+		if err = json.Unmarshal(buf, &manifest); err != nil {
+			fmt.Println("输入文件解析失败: ", err)
+			return
+		}
+		if manifest.Kind == "" || manifest.Metadata.Name == "" {
+			fmt.Println("配置文件须指定kind与metadata.name")
+			return
+		}
+
+		// 自定义资源以apiVersion中的group区分
+		kind := manifest.Kind
+		if group, _, found := strings.Cut(manifest.APIVersion, "/"); found {
+			kind += "." + group
+		}
+		res, err := resolveKind(kind)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		ns := namespace
+		if ns == "" {
+			ns = manifest.Metadata.Namespace
+		}
+
+		resp, err := apiclient.ApplyResource(res, ns, manifest.Metadata.Name, buf, apiclient.ApplyOptions{
+			FieldManager: manager,
+			Force:        force,
+			DryRun:       dryRun,
+		})
+		switch {
+		case errors.Is(err, apiclient.ErrConflict):
+			fmt.Println("应用配置失败：", strings.TrimPrefix(err.Error(), apiclient.ErrConflict.Error()+": "))
+		case err != nil:
+			fmt.Println("应用配置失败：", err)
+		case dryRun:
+			var result struct {
+				Object json.RawMessage `json:"object"`
+			}
+			if err = json.Unmarshal(resp, &result); err != nil {
+				fmt.Println("服务器返回信息无效: ", err)
+				return
+			}
+			fmt.Println("配置有效（dry run，未保存），对象将为：")
+			fmt.Println(string(result.Object))
+		default:
+			fmt.Println("成功应用配置，id：", manifest.Metadata.Name)
+		}
+	},
+}
+
+func init() {
+	applyCmd.Flags().StringP("file", "f", "", "指定json配置文件")
+	applyCmd.Flags().String("field-manager", "kubectl", "配置中的字段所属的manager")
+	applyCmd.Flags().Bool("force-conflicts", false, "接管与其它manager冲突的字段")
+	applyCmd.Flags().Bool("dry-run", false, "只检查配置，不保存")
+
+	rootCmd.AddCommand(applyCmd)
+}
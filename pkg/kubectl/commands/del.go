@@ -1,14 +1,10 @@
 package commands
 
 import (
-	"bytes"
 	"fmt"
 	"github.com/spf13/cobra"
-	"io"
-	"minik8s.com/minik8s/config"
+	v1 "minik8s.com/minik8s/pkg/api/v1"
 	"minik8s.com/minik8s/pkg/apiclient"
-	"net/http"
-	"strconv"
 )
 
 var delCmd = &cobra.Command{
@@ -22,48 +18,51 @@ var delCmd = &cobra.Command{
 			fmt.Println("getString err: ", err)
 			return
 		}
-		fmt.Println("正在删除对象: ", id)
+		kind, err := cmd.Flags().GetString("kind")
+		if err != nil {
+			fmt.Println("getString err: ", err)
+			return
+		}
+		fmt.Println("正在删除对象: ", kind, id)
+
+		cascade, err := cmd.Flags().GetString("cascade")
+		if err != nil {
+			fmt.Println("getString err: ", err)
+			return
+		}
+		propagation, ok := cascadePolicies[cascade]
+		if !ok {
+			fmt.Println("未知的cascade策略: ", cascade)
+			return
+		}
 
-		switch id[0] {
-		case 'P':
-			resp := apiclient.Rest(id, "", apiclient.OBJ_POD, apiclient.OP_DELETE)
-			fmt.Printf("%s\n", resp)
-		case 'N':
-			resp := apiclient.Rest(id, "", apiclient.OBJ_NODE, apiclient.OP_DELETE)
-			fmt.Printf("%s\n", resp)
-		case 'S':
-			resp := apiclient.Rest(id, "", apiclient.OBJ_SERVICE, apiclient.OP_DELETE)
-			fmt.Printf("%s\n", resp)
-		case 'R':
-			resp := apiclient.Rest(id, "", apiclient.OBJ_REPLICAS, apiclient.OP_DELETE)
-			fmt.Printf("%s\n", resp)
-		case 'D':
-			resp := apiclient.Rest(id, "", apiclient.OBJ_DNS, apiclient.OP_DELETE)
-			fmt.Printf("%s\n", resp)
-		case 'H':
-			resp := apiclient.Rest(id, "", apiclient.OBJ_HPA, apiclient.OP_DELETE)
-			fmt.Printf("%s\n", resp)
-		case 'E':
-			resp := apiclient.Rest(id, "", apiclient.OBJ_ENDPOINT, apiclient.OP_DELETE)
-			fmt.Printf("%s\n", resp)
-		case 'G':
-			resp := apiclient.Rest(id, "", apiclient.OBJ_GPU, apiclient.OP_DELETE)
-			fmt.Printf("%s\n", resp)
-		case 'A':
-			cli := http.Client{}
-			url := config.AC_ServerAddr + ":" + strconv.Itoa(config.AC_ServerPort)
-			req, _ := http.NewRequest(http.MethodDelete, url+"/", bytes.NewReader([]byte{}))
-			resp, _ := cli.Do(req)
-			buf, _ := io.ReadAll(resp.Body)
-			fmt.Printf("%s\n", buf)
-		default:
-			fmt.Println("找不到指定的对象！")
+		// 删除命名空间时，其中的所有对象会被一并删除
+		res, err := resolveKind(kind)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		opts := apiclient.DeleteOptions{PropagationPolicy: propagation}
+		if grace, err := cmd.Flags().GetInt64("grace-period"); err == nil && grace >= 0 {
+			opts.GracePeriodSeconds = &grace
 		}
+		resp := apiclient.DeleteResourceWith(res, namespace, id, opts)
+		fmt.Printf("%s\n", resp)
 	},
 }
 
 func init() {
-	delCmd.Flags().StringP("id", "i", "X", "指定对象id")
+	delCmd.Flags().StringP("id", "i", "X", "指定对象名称")
+	delCmd.Flags().StringP("kind", "k", "", "指定对象类型")
+	delCmd.Flags().String("cascade", "background", "指定如何处理对象的dependents：background（稍后由garbage collector删除）、foreground（先于对象删除）或orphan（保留）")
+	delCmd.Flags().Int64("grace-period", -1, "指定对象终止的宽限时间（秒），负数表示使用该类对象的默认值")
 
 	rootCmd.AddCommand(delCmd)
 }
+
+// cascadePolicies maps --cascade to the propagation policy of the deletion
+var cascadePolicies = map[string]v1.DeletionPropagation{
+	"background": v1.DeletePropagationBackground,
+	"foreground": v1.DeletePropagationForeground,
+	"orphan":     v1.DeletePropagationOrphan,
+}
@@ -0,0 +1,46 @@
+package commands
+
+import (
+	"errors"
+	"strings"
+
+	v1 "minik8s.com/minik8s/pkg/api/v1"
+	"minik8s.com/minik8s/pkg/apiclient"
+)
+
+// discovered are the resources served by the api server, discovered once per command
+var discovered []v1.APIResource
+
+// resolveKind finds the resource of the -k kind by discovery. The kind is the plural, the
+// singular, a short name or the kind itself, e.g. pods, pod, po or Pod, optionally
+// followed by .<group> to tell apart the custom resources of different groups.
+func resolveKind(kind string) (*v1.APIResource, error) {
+	if discovered == nil {
+		resources, err := apiclient.Discover()
+		if err != nil {
+			return nil, err
+		}
+		discovered = resources
+	}
+	name, group, _ := strings.Cut(kind, ".")
+	// the short names are only tried once none of the names matches
+	var short *v1.APIResource
+	for i := range discovered {
+		res := &discovered[i]
+		if strings.Contains(res.Name, "/") || (group != "" && res.Group != group) {
+			continue
+		}
+		if name == res.Name || name == res.SingularName || strings.EqualFold(name, res.Kind) {
+			return res, nil
+		}
+		for _, shortName := range res.ShortNames {
+			if name == shortName && short == nil {
+				short = res
+			}
+		}
+	}
+	if short != nil {
+		return short, nil
+	}
+	return nil, errors.New("未知的对象类型: " + kind)
+}
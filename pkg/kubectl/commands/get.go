@@ -3,7 +3,12 @@ package commands
 import (
 	"encoding/json"
 	"fmt"
+	"sort"
+	"strings"
+	"time"
+
 	"github.com/spf13/cobra"
+	v1 "minik8s.com/minik8s/pkg/api/v1"
 	"minik8s.com/minik8s/pkg/apiclient"
 )
 
@@ -27,24 +32,12 @@ var getCmd = &cobra.Command{
 		if id == "X" {
 			fmt.Println("正在查询指定资源类型的所有对象: ", kind)
 			switch kind {
-			case "pod":
-				getPods()
-			case "service":
-				getServices()
-			case "replica":
-				getReplicaSet()
-			case "node":
-				getNodes()
-			case "endpoint":
-				getEndpoints()
-			case "dns":
-				getDNSs()
-			case "hpa":
-				getHPAs()
 			case "function":
 				getFuntions()
+				return
 			case "AC":
 				getACs()
+				return
 			case "all":
 				getPods()
 				getNodes()
@@ -53,58 +46,101 @@ var getCmd = &cobra.Command{
 				getEndpoints()
 				getReplicaSet()
 				getHPAs()
-			default:
-				fmt.Println("未知的对象类型！")
+				return
 			}
-		} else {
-			fmt.Println("正在查询指定对象: ", kind)
-			switch id[0] {
-			case 'P':
-				resp := apiclient.Rest(id, "", apiclient.OBJ_POD, apiclient.OP_GET)
-				fmt.Printf("%s\n", resp)
-			case 'S':
-				resp := apiclient.Rest(id, "", apiclient.OBJ_SERVICE, apiclient.OP_GET)
-				fmt.Printf("%s\n", resp)
-			case 'N':
-				resp := apiclient.Rest(id, "", apiclient.OBJ_NODE, apiclient.OP_GET)
-				fmt.Printf("%s\n", resp)
-			case 'R':
-				resp := apiclient.Rest(id, "", apiclient.OBJ_REPLICAS, apiclient.OP_GET)
-				fmt.Printf("%s\n", resp)
-			case 'D':
-				resp := apiclient.Rest(id, "", apiclient.OBJ_DNS, apiclient.OP_GET)
-				fmt.Printf("%s\n", resp)
-			case 'H':
-				resp := apiclient.Rest(id, "", apiclient.OBJ_HPA, apiclient.OP_GET)
-				fmt.Printf("%s\n", resp)
-			case 'E':
-				resp := apiclient.Rest(id, "", apiclient.OBJ_ENDPOINT, apiclient.OP_GET)
-				fmt.Printf("%s\n", resp)
-			case 'G':
-				resp := apiclient.Rest(id, "", apiclient.OBJ_GPU, apiclient.OP_GET)
-				fmt.Printf("%s\n", resp)
-			default:
-				if kind == "function"{
-					resp := apiclient.Rest(id, "", apiclient.OBJ_FUNCTION, apiclient.OP_GET)
-					fmt.Printf("服务器返回信息: %s\n", resp)
-					return
-				}
-				fmt.Println("找不到指定的对象！")
+			res, err := resolveKind(kind)
+			if err != nil {
+				fmt.Println(err)
+				return
 			}
+			if printList, ok := listPrinters[res.Kind]; ok && res.Group == "" {
+				printList()
+			} else {
+				getObjects(res)
+			}
+		} else if kind == "function" {
+			resp := apiclient.RestIn(namespace, id, "", apiclient.OBJ_FUNCTION, apiclient.OP_GET)
+			fmt.Printf("服务器返回信息: %s\n", resp)
+		} else if res, err := resolveKind(kind); err == nil {
+			fmt.Println("正在查询指定对象: ", kind)
+			resp := apiclient.RestResource(res, namespace, id, "", apiclient.OP_GET)
+			fmt.Printf("%s\n", resp)
+		} else {
+			fmt.Println(err)
 		}
 
 	},
 }
 
 func init() {
-	getCmd.Flags().StringP("kind", "k", "all", "指定访问的对象类型")
-	getCmd.Flags().StringP("id", "i", "X", "指定访问的对象id")
+	getCmd.Flags().StringP("kind", "k", "all", "指定访问的对象类型，如pod、po、pods或自定义资源的复数形式")
+	getCmd.Flags().StringP("id", "i", "X", "指定访问的对象名称")
+	getCmd.Flags().StringVarP(&labelSelector, "selector", "l", "", "按标签筛选对象，如app=web,tier!=db")
+	getCmd.Flags().StringVar(&fieldSelector, "field-selector", "", "按字段筛选对象，如spec.nodeName=N1001,status.phase=Running")
 
 	rootCmd.AddCommand(getCmd)
 }
 
+// listPrinters print the lists of the built-in kinds by their Kind, the others are
+// printed by getObjects
+var listPrinters = map[string]func(){
+	"Pod":                     getPods,
+	"Service":                 getServices,
+	"ReplicaSet":              getReplicaSet,
+	"Node":                    getNodes,
+	"Endpoint":                getEndpoints,
+	"DNS":                     getDNSs,
+	"HorizontalPodAutoscaler": getHPAs,
+	"Namespace":               getNamespaces,
+	"Event":                   getEvents,
+}
+
+// selectors of the objects listed, evaluated by the api server
+var labelSelector, fieldSelector string
+
+// list gets the objects of the kind in the namespace that match the selectors
+func list(objType apiclient.ObjType) []byte {
+	resp, _, err := apiclient.List(objType, listOpts())
+	if err != nil {
+		fmt.Println("查询失败: ", err)
+	}
+	return resp
+}
+
+// options of the objects listed
+func listOpts() apiclient.ListOptions {
+	return apiclient.ListOptions{
+		Namespace:     namespace,
+		LabelSelector: labelSelector,
+		FieldSelector: fieldSelector,
+	}
+}
+
+// getObjects prints the objects of any kind, the custom kinds included
+func getObjects(res *v1.APIResource) {
+	resp, _, err := apiclient.ListResource(res, listOpts())
+	if err != nil {
+		fmt.Println("查询失败: ", err)
+		return
+	}
+	var kvs []GetObjectResponse
+	err = json.Unmarshal(resp, &kvs)
+	if err != nil {
+		fmt.Println("服务器返回信息无效: ", err)
+		return
+	}
+	title := fmt.Sprintf("=->%v %v<-=", len(kvs), res.Kind)
+	line := strings.Repeat("=", len(title))
+	fmt.Printf("\n%v\n%v\n%v\n", line, title, line)
+	fmt.Printf("%v\t\t%v\t\t\t%v\n", "Namespace", "Name", "Uid")
+	for _, kv := range kvs {
+		fmt.Printf("%v\t\t%v\t\t%v\n", kv.Object.Namespace, kv.Object.Name, kv.Object.UID)
+	}
+	fmt.Printf("\n")
+}
+
 func getPods() {
-	resp := apiclient.Rest("", "", apiclient.OBJ_ALL_PODS, apiclient.OP_GET)
+	resp := list(apiclient.OBJ_ALL_PODS)
 	var kvs []GetPodResponse
 	err := json.Unmarshal(resp, &kvs)
 	if err != nil {
@@ -116,7 +152,11 @@ func getPods() {
 	fmt.Printf("\n============\n")
 	fmt.Printf("%v\t\t\t\t%v\t\t\t%v\t\t\t%v\t\t\t%v\t%v\t\t%v\n", "Key", "Name", "Uid", "Node", "PodStatus", "podIP", "OwnerReferences")
 	for _, kv := range kvs {
-		fmt.Printf("%v\t\t%v\t%v\t\t%v\t\t%v\t\t%v\t\t", kv.Key, kv.Pod.Name, kv.Pod.UID, kv.Pod.Spec.NodeName, kv.Pod.Status.Phase, kv.Pod.Status.PodIP)
+		status := string(kv.Pod.Status.Phase)
+		if kv.Pod.DeletionTimestamp != nil {
+			status = "Terminating"
+		}
+		fmt.Printf("%v\t\t%v\t%v\t\t%v\t\t%v\t\t%v\t\t", kv.Key, kv.Pod.Name, kv.Pod.UID, kv.Pod.Spec.NodeName, status, kv.Pod.Status.PodIP)
 		for _, owner := range kv.Pod.OwnerReferences {
 			fmt.Printf("%v: %v, ", owner.Kind, owner.UID)
 		}
@@ -126,7 +166,7 @@ func getPods() {
 }
 
 func getNodes() {
-	resp := apiclient.Rest("", "", apiclient.OBJ_ALL_NODES, apiclient.OP_GET)
+	resp := list(apiclient.OBJ_ALL_NODES)
 	var kvs []GetNodeResponse
 	err := json.Unmarshal(resp, &kvs)
 	if err != nil {
@@ -144,7 +184,7 @@ func getNodes() {
 }
 
 func getServices() {
-	resp := apiclient.Rest("", "", apiclient.OBJ_ALL_SERVICES, apiclient.OP_GET)
+	resp := list(apiclient.OBJ_ALL_SERVICES)
 	var kvs []GetServiceResponse
 	err := json.Unmarshal(resp, &kvs)
 	if err != nil {
@@ -161,7 +201,7 @@ func getServices() {
 	fmt.Printf("\n")
 }
 func getDNSs() {
-	resp := apiclient.Rest("", "", apiclient.OBJ_ALL_DNSS, apiclient.OP_GET)
+	resp := list(apiclient.OBJ_ALL_DNSS)
 	var kvs []GetDNSResponse
 	err := json.Unmarshal(resp, &kvs)
 	if err != nil {
@@ -179,7 +219,7 @@ func getDNSs() {
 }
 
 func getEndpoints() {
-	resp := apiclient.Rest("", "", apiclient.OBJ_ALL_ENDPOINTS, apiclient.OP_GET)
+	resp := list(apiclient.OBJ_ALL_ENDPOINTS)
 	var kvs []GetEndpointResponse
 	err := json.Unmarshal(resp, &kvs)
 	if err != nil {
@@ -202,7 +242,7 @@ func getEndpoints() {
 }
 
 func getReplicaSet() {
-	resp := apiclient.Rest("", "", apiclient.OBJ_ALL_REPLICAS, apiclient.OP_GET)
+	resp := list(apiclient.OBJ_ALL_REPLICAS)
 	var kvs []GetReplicaResponse
 	err := json.Unmarshal(resp, &kvs)
 	if err != nil {
@@ -220,7 +260,7 @@ func getReplicaSet() {
 }
 
 func getHPAs() {
-	resp := apiclient.Rest("", "", apiclient.OBJ_ALL_HPAS, apiclient.OP_GET)
+	resp := list(apiclient.OBJ_ALL_HPAS)
 	var kvs []GetHpaResponse
 	err := json.Unmarshal(resp, &kvs)
 	if err != nil {
@@ -238,7 +278,7 @@ func getHPAs() {
 }
 
 func getFuntions() {
-	resp := apiclient.Rest("", "", apiclient.OBJ_ALL_FUNCTIONS, apiclient.OP_GET)
+	resp := apiclient.RestIn(namespace, "", "", apiclient.OBJ_ALL_FUNCTIONS, apiclient.OP_GET)
 	var kvs GetFunctionResponse
 	err := json.Unmarshal(resp, &kvs)
 	if err != nil {
@@ -256,7 +296,7 @@ func getFuntions() {
 }
 
 func getACs() {
-	resp := apiclient.Rest("", "", apiclient.OBJ_ALL_ACTCHAINS, apiclient.OP_GET)
+	resp := apiclient.RestIn(namespace, "", "", apiclient.OBJ_ALL_ACTCHAINS, apiclient.OP_GET)
 	var kvs GetActionChainResponse
 	err := json.Unmarshal(resp, &kvs)
 	if err != nil {
@@ -272,3 +312,55 @@ func getACs() {
 	}
 	fmt.Printf("\n")
 }
+
+func getNamespaces() {
+	resp := list(apiclient.OBJ_ALL_NAMESPACES)
+	var kvs []GetNamespaceResponse
+	err := json.Unmarshal(resp, &kvs)
+	if err != nil {
+		fmt.Println("服务器返回信息无效: ", err)
+		return
+	}
+	fmt.Printf("\n==================\n")
+	fmt.Printf("=->%v Namespaces<-=", len(kvs))
+	fmt.Printf("\n==================\n")
+	fmt.Printf("%v\t\t\t%v\t\t\t%v\n", "Name", "Uid", "Phase")
+	for _, kv := range kvs {
+		fmt.Printf("%v\t\t\t%v\t\t%v\n", kv.Namespace.Name, kv.Namespace.UID, kv.Namespace.Status.Phase)
+	}
+	fmt.Printf("\n")
+}
+
+func getEvents() {
+	res, err := apiclient.ResourceFor("Event")
+	if err != nil {
+		fmt.Println("查询失败: ", err)
+		return
+	}
+	resp, _, err := apiclient.ListResource(res, listOpts())
+	if err != nil {
+		fmt.Println("查询失败: ", err)
+		return
+	}
+	var kvs []GetEventResponse
+	err = json.Unmarshal(resp, &kvs)
+	if err != nil {
+		fmt.Println("服务器返回信息无效: ", err)
+		return
+	}
+	// 按最后发生的时间排序
+	sort.Slice(kvs, func(i, j int) bool {
+		return kvs[i].Event.LastTimestamp.Before(kvs[j].Event.LastTimestamp)
+	})
+	fmt.Printf("\n==============\n")
+	fmt.Printf("=->%v Events<-=", len(kvs))
+	fmt.Printf("\n==============\n")
+	fmt.Printf("%v\t%v\t%v\t%v\t\t\t%v\t%v\n", "LastSeen", "Type", "Reason", "Object", "Count", "Message")
+	for _, kv := range kvs {
+		e := kv.Event
+		lastSeen := time.Since(e.LastTimestamp).Round(time.Second)
+		fmt.Printf("%v\t\t%v\t%v\t%v/%v\t\t%v\t%v\n", lastSeen, e.Type, e.Reason,
+			e.InvolvedObject.Kind, e.InvolvedObject.Name, e.Count, e.Message)
+	}
+	fmt.Printf("\n")
+}
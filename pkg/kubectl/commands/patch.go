@@ -0,0 +1,68 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"minik8s.com/minik8s/pkg/apiclient"
+)
+
+var patchCmd = &cobra.Command{
+	Use:   "patch",
+	Short: `修改资源的部分字段`,
+	Long:  `用于以json merge patch或json patch修改指定资源，无需提交整个对象`,
+	Run: func(cmd *cobra.Command, args []string) {
+		id, _ := cmd.Flags().GetString("id")
+		kind, _ := cmd.Flags().GetString("kind")
+		patch, _ := cmd.Flags().GetString("patch")
+		patchFile, _ := cmd.Flags().GetString("patch-file")
+		patchType, _ := cmd.Flags().GetString("type")
+
+		contentType, ok := patchTypes[patchType]
+		if !ok {
+			fmt.Println("未知的patch类型: ", patchType)
+			return
+		}
+		if patchFile != "" {
+			buf, err := os.ReadFile(patchFile)
+			if err != nil {
+				fmt.Println("文件打开失败：", err)
+				return
+			}
+			patch = string(buf)
+		}
+		if patch == "" {
+			fmt.Println("请通过-p或--patch-file指定patch")
+			return
+		}
+
+		res, err := resolveKind(kind)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		err = apiclient.PatchResource(res, namespace, id, contentType, []byte(patch))
+		if err != nil {
+			fmt.Println("修改对象失败：", err)
+		} else {
+			fmt.Println("成功修改对象，id：", id)
+		}
+	},
+}
+
+// patchTypes maps --type to the Content-Type of the patch
+var patchTypes = map[string]string{
+	"merge": apiclient.MergePatchType,
+	"json":  apiclient.JSONPatchType,
+}
+
+func init() {
+	patchCmd.Flags().StringP("id", "i", "X", "指定对象名称")
+	patchCmd.Flags().StringP("kind", "k", "X", "指定对象类型")
+	patchCmd.Flags().StringP("patch", "p", "", "patch的内容，如'{\"spec\":{\"replicas\":3}}'")
+	patchCmd.Flags().String("patch-file", "", "从文件读取patch")
+	patchCmd.Flags().String("type", "merge", "patch的类型：merge（json merge patch）或json（json patch）")
+
+	rootCmd.AddCommand(patchCmd)
+}
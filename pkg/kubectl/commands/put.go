@@ -46,42 +46,22 @@ var putCmd = &cobra.Command{
 		fmt.Println("正在更新对象: ", id)
 		var resp []byte
 		switch kind {
-		case "pod":
-			resp = apiclient.Rest(id, string(buf), apiclient.OBJ_POD, apiclient.OP_PUT)
-			fmt.Printf("%s\n", resp)
-		case "node":
-			resp = apiclient.Rest(id, string(buf), apiclient.OBJ_NODE, apiclient.OP_PUT)
-			fmt.Printf("%s\n", resp)
-		case "service":
-			resp = apiclient.Rest(id, string(buf), apiclient.OBJ_SERVICE, apiclient.OP_PUT)
-			fmt.Printf("%s\n", resp)
-		case "replica":
-			resp = apiclient.Rest(id, string(buf), apiclient.OBJ_REPLICAS, apiclient.OP_PUT)
-			fmt.Printf("%s\n", resp)
-		case "dns":
-			resp = apiclient.Rest(id, string(buf), apiclient.OBJ_DNS, apiclient.OP_PUT)
-			fmt.Printf("%s\n", resp)
-		case "hpa":
-			resp = apiclient.Rest(id, string(buf), apiclient.OBJ_HPA, apiclient.OP_PUT)
-			fmt.Printf("%s\n", resp)
-		case "endpoint":
-			resp = apiclient.Rest(id, string(buf), apiclient.OBJ_ENDPOINT, apiclient.OP_PUT)
-			fmt.Printf("%s\n", resp)
-		case "gpu":
-			resp = apiclient.Rest(id, string(buf), apiclient.OBJ_GPU, apiclient.OP_PUT)
-			fmt.Printf("%s\n", resp)
 		case "function":
-			resp = apiclient.Rest(id, string(buf), apiclient.OBJ_FUNCTION, apiclient.OP_PUT)
+			resp = apiclient.RestIn(namespace, id, string(buf), apiclient.OBJ_FUNCTION, apiclient.OP_PUT)
 			fmt.Println("服务器返回: ", resp)
 			return
 		case "AC":
-			resp = apiclient.Rest(id, string(buf), apiclient.OBJ_ACTCHAIN, apiclient.OP_PUT)
+			resp = apiclient.RestIn(namespace, id, string(buf), apiclient.OBJ_ACTCHAIN, apiclient.OP_PUT)
 			fmt.Println("服务器返回: ", resp)
 			return
-		default:
-			fmt.Println("找不到指定的对象！")
+		}
+		res, err := resolveKind(kind)
+		if err != nil {
+			fmt.Println(err)
 			return
 		}
+		resp = apiclient.RestResource(res, namespace, id, string(buf), apiclient.OP_PUT)
+		fmt.Printf("%s\n", resp)
 
 		var stat StatusResponse
 		err = json.Unmarshal(resp, &stat)
@@ -97,8 +77,8 @@ var putCmd = &cobra.Command{
 
 func init() {
 	putCmd.Flags().StringP("file", "f", "nginx_pod.json", "指定json配置文件")
-	putCmd.Flags().StringP("id", "i", "X", "指定对象id")
-	putCmd.Flags().StringP("kind", "k", "X", "指定对象id")
+	putCmd.Flags().StringP("id", "i", "X", "指定对象名称")
+	putCmd.Flags().StringP("kind", "k", "X", "指定对象类型")
 
 	rootCmd.AddCommand(putCmd)
 }
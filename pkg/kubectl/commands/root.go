@@ -5,12 +5,14 @@ import (
 
 	"github.com/spf13/cobra"
 	v1 "minik8s.com/minik8s/pkg/api/v1"
+	"minik8s.com/minik8s/pkg/apiclient"
 	"minik8s.com/minik8s/pkg/aqualake/apis/actionchain"
 )
 
 type StatusResponse struct {
 	Status string `json:"status"`
 	Id     string `json:"id,omitempty"`
+	Uid    string `json:"uid,omitempty"`
 	Error  string `json:"error,omitempty"`
 }
 type GetPodResponse struct {
@@ -48,6 +50,23 @@ type GetHpaResponse struct {
 	HPA v1.HorizontalPodAutoscaler `json:"value"`
 	Type       string        `json:"type"`
 }
+type GetNamespaceResponse struct {
+	Key       string       `json:"key"`
+	Namespace v1.Namespace `json:"value"`
+	Type      string       `json:"type"`
+}
+type GetEventResponse struct {
+	Key   string   `json:"key"`
+	Event v1.Event `json:"value"`
+	Type  string   `json:"type"`
+}
+
+// GetObjectResponse is an object of any kind, only its metadata is decoded
+type GetObjectResponse struct {
+	Key    string          `json:"key"`
+	Object v1.Unstructured `json:"value"`
+	Type   string          `json:"type"`
+}
 type GetFunctionResponse struct {
 	Funcitons []string `json:"functions"`
 	Error       string        `json:"error"`
@@ -63,11 +82,31 @@ var rootCmd = &cobra.Command{
 	Short: "minik8s的命令行工具",
 	Long:  `欢迎使用minik8s的命令行工具！`,
 
+	// 未指定--kubeconfig时使用$MINIK8S_CONFIG或~/.minik8s/config
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if kubeconfig == "" {
+			return nil
+		}
+		return apiclient.LoadCredentials(kubeconfig)
+	},
+
 	Run: func(cmd *cobra.Command, args []string) {
 		fmt.Println("111")
 	},
 }
 
+// namespace of the objects operated on, lists span all namespaces when it is empty
+// and the other operations use the default namespace
+var namespace string
+
+// kubeconfig is the credentials file to reach the api server with
+var kubeconfig string
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&kubeconfig, "kubeconfig", "", "访问api server所用的凭据文件")
+	rootCmd.PersistentFlags().StringVarP(&namespace, "namespace", "n", "", "指定对象所在的命名空间（默认为default，查询列表时默认为所有命名空间）")
+}
+
 func Execute() {
 	cobra.CheckErr(rootCmd.Execute())
 }
@@ -3,6 +3,7 @@ package config
 import (
 	"minik8s.com/minik8s/config"
 	v1 "minik8s.com/minik8s/pkg/api/v1"
+	"minik8s.com/minik8s/pkg/apiclient"
 )
 
 type KubeletConfiguration struct {
@@ -20,6 +21,7 @@ var ApiServerIP string = config.AC_ServerAddr
 
 var WeaveServerIP string = "10.119.11.209"
 
-var ApiServerAddress string = config.AC_ServerAddr + ":8080"
+// ApiServerAddress is the server of the credentials file if there is one
+var ApiServerAddress string = apiclient.ServerURL()
 
 var GatewayAddress string = "addr"
\ No newline at end of file
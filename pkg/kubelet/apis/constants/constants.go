@@ -2,7 +2,8 @@ package constants
 
 import v1 "minik8s.com/minik8s/pkg/api/v1"
 
-const EOF int = 26
+// header of the resourceVersion of a list, watch from it to miss nothing
+const ResourceVersionHeader string = "X-Resource-Version"
 
 func RegistNodeRequest() string {
 	return "/node"
@@ -20,14 +21,22 @@ func RefreshNodeRequest(nodeUID string) string {
 	return "/node/" + nodeUID
 }
 
-func RefreshPodStatusRequest(nodeUID string, podUID string) string {
-	return "/innode/" + nodeUID + "/podstatus/" + podUID
+func RefreshNodeStatusRequest(nodeUID string) string {
+	return "/node/" + nodeUID + "/status"
+}
+
+func RefreshPodStatusRequest(namespace string, name string) string {
+	return "/namespaces/" + namespace + "/pods/" + name + "/status"
 }
 
 func RefreshPodRequest(nodeUID string, podUID string) string {
 	return "/innode/" + nodeUID + "/pod/" + podUID
 }
 
+func PodRequest(namespace string, name string) string {
+	return "/namespaces/" + namespace + "/pods/" + name
+}
+
 func WatchEndpointsRequest() string {
 	return "/watch/endpoints"
 }
@@ -10,6 +10,8 @@ type PodChangeRequest struct {
 	Pod v1.Pod `json:"value"`
 
 	Type string `json:"type"`
+
+	ResourceVersion string `json:"resourceVersion,omitempty"`
 }
 
 type RegistResponse struct {
@@ -30,4 +32,6 @@ type EndpointChangeRequest struct {
 	Endpoint v1.Endpoint `json:"value"`
 
 	Type string `json:"type"`
+
+	ResourceVersion string `json:"resourceVersion,omitempty"`
 }
@@ -9,6 +9,7 @@ import (
 	"os/exec"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/docker/docker/api/types"
 	dockerctnr "github.com/docker/docker/api/types/container"
@@ -25,7 +26,7 @@ type ContainerManager interface {
 	CreateContainer(ctx context.Context, container *v1.Container) (string, error)
 	StartContainer(ctx context.Context, container *v1.Container) error
 	RestartContainer(ctx context.Context, container *v1.Container) error
-	StopContainer(ctx context.Context, container *v1.Container) error
+	StopContainer(ctx context.Context, container *v1.Container, timeout *time.Duration) error
 	PauseContainer(ctx context.Context, container *v1.Container) error
 	ResumeContainer(ctx context.Context, container *v1.Container) error
 	RemoveContainer(ctx context.Context, container *v1.Container) error
@@ -220,9 +221,11 @@ func (manager *containerManager) RestartContainer(ctx context.Context, container
 	return err
 }
 
-func (manager *containerManager) StopContainer(ctx context.Context, container *v1.Container) error {
+// StopContainer kills the container if it does not exit within timeout after SIGTERM, nil
+// means the default timeout of docker
+func (manager *containerManager) StopContainer(ctx context.Context, container *v1.Container, timeout *time.Duration) error {
 	klog.Infof("Stop Container %s", container.Name)
-	err := manager.dockerClient.ContainerStop(ctx, container.ID, nil)
+	err := manager.dockerClient.ContainerStop(ctx, container.ID, timeout)
 	return err
 }
 
@@ -6,13 +6,13 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"net/http"
 	"os/exec"
 	"regexp"
 	"strings"
 
 	"k8s.io/klog"
 	v1 "minik8s.com/minik8s/pkg/api/v1"
+	"minik8s.com/minik8s/pkg/apiclient"
 	"minik8s.com/minik8s/pkg/kubelet/apis/config"
 	"minik8s.com/minik8s/pkg/kubelet/apis/constants"
 	"minik8s.com/minik8s/pkg/kubelet/apis/httpresponse"
@@ -61,7 +61,7 @@ func NewKubeProxy() (KubeProxy, error) {
 	klog.Info("Init IP Tables successfully!")
 
 	// get all existed endpoints
-	resp, err := http.Get(config.ApiServerAddress + constants.GetAllEndpointsRequest())
+	resp, err := apiclient.HttpGet(config.ApiServerAddress + constants.GetAllEndpointsRequest())
 
 	if err != nil {
 		klog.Errorf("Get All Existed Endpoints Error: %s", err.Error())
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"k8s.io/klog/v2"
@@ -102,6 +103,16 @@ func (kl *Kubelet) DeletePod(UID string) error {
 	return kl.podManager.DeletePod(UID)
 }
 
+// TerminatePod stops the containers of the pod within the grace period, nil means the
+// default grace period of pods
+func (kl *Kubelet) TerminatePod(UID string, gracePeriodSeconds *int64) error {
+	grace := v1.DefaultTerminationGracePeriodSeconds
+	if gracePeriodSeconds != nil {
+		grace = *gracePeriodSeconds
+	}
+	return kl.podManager.TerminatePod(UID, time.Duration(grace)*time.Second)
+}
+
 func (kl *Kubelet) RecoverPod(pod v1.Pod) error {
 	if kl.podManager.CheckDuplicate(&pod) {
 		return errors.New("duplicated Pod")
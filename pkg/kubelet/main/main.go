@@ -1,7 +1,6 @@
 package main
 
 import (
-	"bufio"
 	"bytes"
 	"context"
 	"encoding/gob"
@@ -12,11 +11,13 @@ import (
 	"net/http"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/patrickmn/go-cache"
 	"k8s.io/klog/v2"
 	v1 "minik8s.com/minik8s/pkg/api/v1"
+	"minik8s.com/minik8s/pkg/apiclient"
 	"minik8s.com/minik8s/pkg/kubelet"
 	"minik8s.com/minik8s/pkg/kubelet/apis/config"
 	"minik8s.com/minik8s/pkg/kubelet/apis/constants"
@@ -73,7 +74,7 @@ func main() {
 
 		klog.Infof("Send request to register node %s.", constants.Node.Name)
 
-		resp, err := http.Post(config.ApiServerAddress+constants.RegistNodeRequest(), JsonContentType, bytes.NewBuffer([]byte{}))
+		resp, err := apiclient.HttpSend(http.MethodPost, config.ApiServerAddress+constants.RegistNodeRequest(), JsonContentType, bytes.NewBuffer([]byte{}))
 
 		// regist to apiserver
 		if err != nil || resp.StatusCode != 200 {
@@ -148,7 +149,7 @@ func main() {
 	if restart {
 		klog.Info("Try to recover pods...")
 
-		resp, err := http.Get(config.ApiServerAddress + constants.GetAllPodsRequest(constants.Node.UID))
+		resp, err := apiclient.HttpGet(config.ApiServerAddress + constants.GetAllPodsRequest(constants.Node.UID))
 
 		if err != nil {
 			klog.Errorf("Get All Existed Pods Error: %s", err.Error())
@@ -213,8 +214,18 @@ func main() {
 
 }
 
+// resourceVersion of the last event received, a broken watch resumes from it
+var podsResourceVersion, endpointsResourceVersion string
+
+// uid of the endpoints added to kube proxy
+var endpointUIDs = make(map[string]bool)
+
 func watchingPods(ctx context.Context, kl *kubelet.Kubelet, errChan chan string) {
-	resp, err := http.Get(config.ApiServerAddress + constants.WatchPodsRequest(kl.UID))
+	url := config.ApiServerAddress + constants.WatchPodsRequest(kl.UID)
+	if podsResourceVersion != "" {
+		url += "?resourceVersion=" + podsResourceVersion
+	}
+	resp, err := apiclient.HttpGet(url)
 
 	if err != nil {
 		klog.Errorf("Node %s Watch Pods Failed: %s", kl.UID, err.Error())
@@ -223,14 +234,21 @@ func watchingPods(ctx context.Context, kl *kubelet.Kubelet, errChan chan string)
 		errChan <- err.Error()
 		return
 	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusGone {
+		resyncPods(kl)
+		errChan <- "watch pods expired"
+		return
+	}
 
-	reader := bufio.NewReader(resp.Body)
+	decoder := apiclient.NewWatchDecoder(resp)
 	for {
 		select {
 		case <-ctx.Done():
 			return
 		default:
-			buf, err := reader.ReadBytes(byte(constants.EOF))
+			buf, err := decoder.Decode()
 
 			if err != nil {
 				klog.Errorf("Watch Pods Error: %s", err)
@@ -238,27 +256,82 @@ func watchingPods(ctx context.Context, kl *kubelet.Kubelet, errChan chan string)
 				return
 			}
 
-			buf[len(buf)-1] = '\n'
 			req := &httpresponse.PodChangeRequest{}
 			err = json.Unmarshal(buf, req)
 
 			if err != nil {
 				klog.Errorf("Unmarshal APIServer Data Failed: %s", err.Error())
-			} else {
+				continue
+			}
+
+			if req.Type == "ERROR" {
+				resyncPods(kl)
+				errChan <- "watch pods expired"
+				return
+			}
+			if req.ResourceVersion != "" {
+				podsResourceVersion = req.ResourceVersion
+			}
+			if req.Type != "BOOKMARK" {
 				handlePodChangeRequest(kl, req)
 			}
 		}
 	}
 }
 
+// resyncPods lists the pods of the node when the watch can not be resumed, it creates
+// the pods missed and deletes those no longer there
+func resyncPods(kl *kubelet.Kubelet) {
+	klog.Info("Watch pods expired, resync pods...")
+
+	resp, err := apiclient.HttpGet(config.ApiServerAddress + constants.GetAllPodsRequest(kl.UID))
+	if err != nil {
+		klog.Errorf("Get All Pods Error: %s", err.Error())
+		podsResourceVersion = ""
+		return
+	}
+
+	buf, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	var podArray []httpresponse.PodChangeRequest
+	err = json.Unmarshal(buf, &podArray)
+	if err != nil {
+		klog.Errorf("Unmarshal All Pods Error: %s, received string: %s", err.Error(), string(buf))
+		podsResourceVersion = ""
+		return
+	}
+	podsResourceVersion = resp.Header.Get(constants.ResourceVersionHeader)
+
+	listed := make(map[string]bool)
+	for _, req := range podArray {
+		req.Type = "PUT"
+		handlePodChangeRequest(kl, &req)
+		listed[req.Pod.UID] = true
+	}
+
+	pods, _ := kl.GetPods()
+	for _, pod := range pods {
+		if !listed[pod.UID] {
+			kl.DeletePod(pod.UID)
+		}
+	}
+}
+
 func handlePodChangeRequest(kl *kubelet.Kubelet, req *httpresponse.PodChangeRequest) {
 	parsedPath := strings.Split(req.Key, "/")
 	req.Pod.UID = parsedPath[len(parsedPath)-1]
 
 	switch req.Type {
 	case "PUT":
-		kl.CreatePod(req.Pod)
+		// a pod marked for deletion is not created if it has not been
+		if req.Pod.DeletionTimestamp != nil {
+			terminatePod(kl, req.Pod)
+		} else {
+			kl.CreatePod(req.Pod)
+		}
 	case "DELETE":
+		terminating.Delete(req.Pod.UID)
 		kl.DeletePod(req.Pod.UID)
 	default:
 		klog.Errorln("Unknown Pod Change Request Type: %s", req.Type)
@@ -266,15 +339,91 @@ func handlePodChangeRequest(kl *kubelet.Kubelet, req *httpresponse.PodChangeRequ
 	}
 }
 
+// UIDs of the pods being terminated
+var terminating sync.Map
+
+// terminatePod stops the containers of a pod marked for deletion, and then removes the
+// finalizer of the kubelet so that the api server removes the pod. The containers are
+// removed once the pod is deleted from the node.
+func terminatePod(kl *kubelet.Kubelet, pod v1.Pod) {
+	if _, loaded := terminating.LoadOrStore(pod.UID, true); loaded {
+		return
+	}
+
+	go func() {
+		err := kl.TerminatePod(pod.UID, pod.DeletionGracePeriodSeconds)
+		if err != nil {
+			klog.Errorf("Terminate Pod %s Error: %s", pod.Name, err.Error())
+		}
+
+		for {
+			err = removeKubeletFinalizer(pod)
+			if err == nil {
+				return
+			}
+			klog.Errorf("Remove Finalizer of Pod %s Error: %s", pod.Name, err.Error())
+			time.Sleep(time.Duration(constants.ReconnectInterval) * time.Second)
+		}
+	}()
+}
+
+// removeKubeletFinalizer removes the finalizer of the kubelet from the pod in the api server
+func removeKubeletFinalizer(pod v1.Pod) error {
+	url := config.ApiServerAddress + constants.PodRequest(v1.NamespaceOf(&pod.ObjectMeta), pod.Name)
+	for {
+		resp, err := apiclient.HttpGet(url)
+		if err != nil {
+			return err
+		}
+		buf, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusNotFound {
+			return nil
+		} else if resp.StatusCode != http.StatusOK {
+			return errors.New(string(buf))
+		}
+
+		var cur httpresponse.PodChangeRequest
+		if err = json.Unmarshal(buf, &cur); err != nil {
+			return err
+		}
+		// the pod has been deleted and another one of the same name created
+		if cur.Pod.UID != pod.UID || !cur.Pod.RemoveFinalizer(v1.FinalizerKubelet) {
+			return nil
+		}
+
+		body, _ := json.Marshal(cur.Pod)
+		req, _ := http.NewRequest(http.MethodPut, url, bytes.NewReader(body))
+		req.Header.Set("Content-Type", JsonContentType)
+		resp, err = apiclient.Do(req)
+		if err != nil {
+			return err
+		}
+		buf, _ = io.ReadAll(resp.Body)
+		resp.Body.Close()
+		switch resp.StatusCode {
+		case http.StatusOK, http.StatusNotFound:
+			return nil
+		case http.StatusConflict:
+			// modified meanwhile, retry with the latest one
+			continue
+		}
+		return errors.New(string(buf))
+	}
+}
+
 func sendHeartBeat(ctx context.Context) {
 	for {
-		body, err := json.Marshal(constants.Node)
+		// the heartbeat only refreshes the status, unconditionally
+		node := constants.Node
+		node.ResourceVersion = ""
+		body, err := json.Marshal(node)
 		if err != nil {
 			klog.Errorf("Unmarshal Node Error: %s", err.Error())
 		}
-		
-		req, _ := http.NewRequest(http.MethodPut, config.ApiServerAddress+constants.RefreshNodeRequest(constants.Node.UID), bytes.NewReader(body))
-		resp, err := http.DefaultClient.Do(req)
+
+		req, _ := http.NewRequest(http.MethodPut, config.ApiServerAddress+constants.RefreshNodeStatusRequest(constants.Node.UID), bytes.NewReader(body))
+		resp, err := apiclient.Do(req)
 
 		if err != nil {
 			klog.Errorf("Error When refresh Node: %s", err.Error())
@@ -295,22 +444,34 @@ func refreshAllPodStatus(ctx context.Context, kl *kubelet.Kubelet) {
 		}
 
 		for _, pod := range pods {
-
-			body, err := json.Marshal(pod.Status)
+			// the status subresource only takes the status, the uid keeps it off a pod of
+			// the same name created after this one was deleted
+			update := v1.Pod{
+				ObjectMeta: v1.ObjectMeta{Name: pod.Name, Namespace: pod.Namespace, UID: pod.UID},
+				Status:     pod.Status,
+			}
+			body, err := json.Marshal(update)
 
 			if err != nil {
 				klog.Errorf("Marshal pod status error: %s", err.Error())
+				continue
 			}
 
-			req, _ := http.NewRequest(http.MethodPut, config.ApiServerAddress+constants.RefreshPodStatusRequest(kl.UID, pod.UID), bytes.NewReader(body))
-			resp, err := http.DefaultClient.Do(req)
+			url := config.ApiServerAddress + constants.RefreshPodStatusRequest(v1.NamespaceOf(&pod.ObjectMeta), pod.Name)
+			req, _ := http.NewRequest(http.MethodPut, url, bytes.NewReader(body))
+			req.Header.Set("Content-Type", JsonContentType)
+			resp, err := apiclient.Do(req)
 
 			if err != nil {
 				klog.Errorf("Error When refresh Pod Status: %s", err.Error())
 				continue
 			}
 
+			buf, _ := io.ReadAll(resp.Body)
 			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+				klog.Errorf("Error When refresh Pod Status of %s: %s", pod.Name, buf)
+			}
 		}
 
 		time.Sleep(time.Duration(constants.RefreshPodStatusInterval) * time.Second)
@@ -318,7 +479,11 @@ func refreshAllPodStatus(ctx context.Context, kl *kubelet.Kubelet) {
 }
 
 func watchingEndpoints(ctx context.Context, kp kubeproxy.KubeProxy, errChan chan string) {
-	resp, err := http.Get(config.ApiServerAddress + constants.WatchEndpointsRequest())
+	url := config.ApiServerAddress + constants.WatchEndpointsRequest()
+	if endpointsResourceVersion != "" {
+		url += "?resourceVersion=" + endpointsResourceVersion
+	}
+	resp, err := apiclient.HttpGet(url)
 
 	if err != nil {
 		klog.Errorf("Node Watch Endpoints Failed: %s", err.Error())
@@ -327,14 +492,21 @@ func watchingEndpoints(ctx context.Context, kp kubeproxy.KubeProxy, errChan chan
 		errChan <- err.Error()
 		return
 	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusGone {
+		resyncEndpoints(kp)
+		errChan <- "watch endpoints expired"
+		return
+	}
 
-	reader := bufio.NewReader(resp.Body)
+	decoder := apiclient.NewWatchDecoder(resp)
 	for {
 		select {
 		case <-ctx.Done():
 			return
 		default:
-			buf, err := reader.ReadBytes(byte(constants.EOF))
+			buf, err := decoder.Decode()
 
 			if err != nil {
 				klog.Errorf("Watch Endpoints Error: %s", err)
@@ -342,19 +514,68 @@ func watchingEndpoints(ctx context.Context, kp kubeproxy.KubeProxy, errChan chan
 				return
 			}
 
-			buf[len(buf)-1] = '\n'
 			req := &httpresponse.EndpointChangeRequest{}
 			err = json.Unmarshal(buf, req)
 
 			if err != nil {
 				klog.Errorf("Unmarshal APIServer Data Failed: %s", err.Error())
-			} else {
+				continue
+			}
+
+			if req.Type == "ERROR" {
+				resyncEndpoints(kp)
+				errChan <- "watch endpoints expired"
+				return
+			}
+			if req.ResourceVersion != "" {
+				endpointsResourceVersion = req.ResourceVersion
+			}
+			if req.Type != "BOOKMARK" {
 				handleEndpointChangeRequest(kp, req)
 			}
 		}
 	}
 }
 
+// resyncEndpoints lists the endpoints when the watch can not be resumed, it adds
+// the endpoints missed and removes those no longer there
+func resyncEndpoints(kp kubeproxy.KubeProxy) {
+	klog.Info("Watch endpoints expired, resync endpoints...")
+
+	resp, err := apiclient.HttpGet(config.ApiServerAddress + constants.GetAllEndpointsRequest())
+	if err != nil {
+		klog.Errorf("Get All Endpoints Error: %s", err.Error())
+		endpointsResourceVersion = ""
+		return
+	}
+
+	buf, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	var epArray []httpresponse.EndpointChangeRequest
+	err = json.Unmarshal(buf, &epArray)
+	if err != nil {
+		klog.Errorf("Unmarshal All Endpoints Error: %s, received string: %s", err.Error(), string(buf))
+		endpointsResourceVersion = ""
+		return
+	}
+	endpointsResourceVersion = resp.Header.Get(constants.ResourceVersionHeader)
+
+	listed := make(map[string]bool)
+	for _, req := range epArray {
+		req.Type = "PUT"
+		handleEndpointChangeRequest(kp, &req)
+		parsedPath := strings.Split(req.Key, "/")
+		listed[parsedPath[len(parsedPath)-1]] = true
+	}
+
+	for uid := range endpointUIDs {
+		if !listed[uid] {
+			handleEndpointChangeRequest(kp, &httpresponse.EndpointChangeRequest{Key: uid, Type: "DELETE"})
+		}
+	}
+}
+
 func handleEndpointChangeRequest(kp kubeproxy.KubeProxy, req *httpresponse.EndpointChangeRequest) {
 	klog.Infof("Receive %s Endpoint %s, Key %s", req.Type, req.Endpoint.Name, req.Key)
 	parsedPath := strings.Split(req.Key, "/")
@@ -362,8 +583,10 @@ func handleEndpointChangeRequest(kp kubeproxy.KubeProxy, req *httpresponse.Endpo
 	switch req.Type {
 	case "PUT":
 		kp.AddEndpoint(context.TODO(), uid, req.Endpoint)
+		endpointUIDs[uid] = true
 	case "DELETE":
 		kp.RemoveEndpoint(context.TODO(), uid)
+		delete(endpointUIDs, uid)
 	default:
 		klog.Errorln("Unknown Pod Change Request Type: %s", req.Type)
 		return
@@ -9,11 +9,15 @@ import (
 	"net/http"
 	"os"
 	"os/exec"
+	"sync"
+	"time"
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/filters"
 	"k8s.io/klog/v2"
 	v1 "minik8s.com/minik8s/pkg/api/v1"
+	"minik8s.com/minik8s/pkg/apiclient"
+	"minik8s.com/minik8s/pkg/controller/component"
 	"minik8s.com/minik8s/pkg/kubelet/apis/config"
 	"minik8s.com/minik8s/pkg/kubelet/apis/constants"
 	"minik8s.com/minik8s/pkg/kubelet/container"
@@ -34,6 +38,9 @@ type PodManager interface {
 
 	DeletePod(UID string) error
 
+	// TerminatePod stops the containers of the pod within the grace period, they are removed by DeletePod
+	TerminatePod(UID string, gracePeriod time.Duration) error
+
 	PodStatus(UID string) (v1.PodStatus, error)
 
 	CreatePodBridgeNetwork(CIDR string) error
@@ -50,12 +57,15 @@ type podManager struct {
 	containerManager container.ContainerManager
 
 	weaveNetwork types.NetworkResource
+
+	recorder *component.EventRecorder
 }
 
 func NewPodManager() PodManager {
 	pm := &podManager{}
 	pm.podByUID = make(map[string]*v1.Pod)
 	pm.podByName = make(map[string]*v1.Pod)
+	pm.recorder = component.NewEventRecorder("kubelet", constants.Node.Name)
 
 	newContainerManager, err := container.NewContainerManager()
 
@@ -121,7 +131,6 @@ func (pm *podManager) GetPodByUID(UID string) (v1.Pod, bool) {
 	return v1.Pod{}, ok
 }
 
-// there is only one namespace named "default"
 func (pm *podManager) AddPod(pod *v1.Pod) error {
 	klog.Infof("Add Pod %s", pod.Name)
 
@@ -133,13 +142,13 @@ func (pm *podManager) AddPod(pod *v1.Pod) error {
 	}
 
 	pm.podByUID[pod.UID] = pod
-	pm.podByName[pod.Name] = pod
+	pm.podByName[podFullName(pod)] = pod
 
 	// start some pod initial containers
 	for k := range pod.Spec.InitialContainers {
 		container := pod.Spec.InitialContainers[k]
 
-		container.Name = pod.Name + "-" + container.Name
+		container.Name = podFullName(pod) + "-" + container.Name
 		container.NetworkMode = "weave"
 		container.ExposedPorts = pod.Spec.ExposedPorts
 		container.BindPorts = pod.Spec.BindPorts
@@ -148,6 +157,8 @@ func (pm *podManager) AddPod(pod *v1.Pod) error {
 
 		if err != nil {
 			klog.Errorf("Create pod %s Initial container %s failed: %s", pod.Name, container.Name, err.Error())
+			pm.recorder.Eventf(v1.ReferenceTo("Pod", &pod.ObjectMeta), v1.EventTypeWarning, "Failed",
+				"Error creating initial container %s: %v", container.Name, err)
 			return err
 		}
 
@@ -158,6 +169,8 @@ func (pm *podManager) AddPod(pod *v1.Pod) error {
 		if err != nil {
 			klog.Errorf("Start pod %s Initial container %s failed: %s", pod.Name, container.Name, err.Error())
 			klog.Errorln(err)
+			pm.recorder.Eventf(v1.ReferenceTo("Pod", &pod.ObjectMeta), v1.EventTypeWarning, "Failed",
+				"Error starting initial container %s: %v", container.Name, err)
 			return err
 		}
 
@@ -176,35 +189,44 @@ func (pm *podManager) AddPod(pod *v1.Pod) error {
 	// create related volumes
 	for _, volume := range pod.Spec.Volumes {
 		klog.Infof("Create Volume %s For Pod %s", pod.Name, volume)
-		cmd := exec.Command("docker", "volume", "create", pod.Name+"-"+volume)
+		cmd := exec.Command("docker", "volume", "create", podFullName(pod)+"-"+volume)
 		cmd.CombinedOutput()
 	}
 
 	// start user spec pods
 	for _, container := range pod.Spec.Containers {
-		container.Name = pod.Name + "-" + container.Name
+		container.Name = podFullName(pod) + "-" + container.Name
 		container.NetworkMode = constants.NetworkIDPrefix + pod.Spec.InitialContainers[constants.InitialPauseContainerKey].Name
 
 		id, err := pm.containerManager.CreateContainer(context.TODO(), container)
 
 		if err != nil {
 			klog.Errorln(err)
+			pm.recorder.Eventf(v1.ReferenceTo("Pod", &pod.ObjectMeta), v1.EventTypeWarning, "Failed",
+				"Error creating container %s: %v", container.Name, err)
 			continue
 		}
 
 		container.ID = id
+		pm.recorder.Eventf(v1.ReferenceTo("Pod", &pod.ObjectMeta), v1.EventTypeNormal, "Created",
+			"Created container %s", container.Name)
 
 		err = pm.containerManager.StartContainer(context.TODO(), container)
 
 		if err != nil {
 			klog.Errorln(err)
+			pm.recorder.Eventf(v1.ReferenceTo("Pod", &pod.ObjectMeta), v1.EventTypeWarning, "Failed",
+				"Error starting container %s: %v", container.Name, err)
+		} else {
+			pm.recorder.Eventf(v1.ReferenceTo("Pod", &pod.ObjectMeta), v1.EventTypeNormal, "Started",
+				"Started container %s", container.Name)
 		}
 	}
 
 	// refresh modified pod spec to apiserver.(for restart)
 	body, _ := json.Marshal(pod)
 	req, _ := http.NewRequest(http.MethodPut, config.ApiServerAddress+constants.RefreshPodRequest(constants.Node.UID, pod.UID), bytes.NewReader(body))
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := apiclient.Do(req)
 
 	if err != nil {
 		klog.Errorf("Error When refresh Pod Status: %s", err.Error())
@@ -227,7 +249,7 @@ func (pm *podManager) AddPodWithoutCreate(pod *v1.Pod) error {
 	}
 
 	pm.podByUID[pod.UID] = pod
-	pm.podByName[pod.Name] = pod
+	pm.podByName[podFullName(pod)] = pod
 
 	return nil
 }
@@ -247,8 +269,8 @@ func (pm *podManager) UpdatePod(pod *v1.Pod) error {
 		return errors.New(err)
 	}
 
-	delete(pm.podByName, oldPod.Name)
-	pm.podByName[pod.Name] = pod
+	delete(pm.podByName, podFullName(oldPod))
+	pm.podByName[podFullName(pod)] = pod
 	pm.podByUID[pod.UID] = pod
 
 	errs := []string{}
@@ -315,7 +337,7 @@ func (pm *podManager) DeletePod(UID string) error {
 	for k := range pod.Spec.InitialContainers {
 		container := pod.Spec.InitialContainers[k]
 
-		err := pm.containerManager.StopContainer(context.TODO(), &container)
+		err := pm.containerManager.StopContainer(context.TODO(), &container, nil)
 
 		if err != nil {
 			klog.Errorf("Remove Container %s: %s", container.Name, err)
@@ -332,12 +354,12 @@ func (pm *podManager) DeletePod(UID string) error {
 
 	for _, volume := range pod.Spec.Volumes {
 		klog.Infof("Delete Volume %s For Pod %s", pod.Name, volume)
-		cmd := exec.Command("docker", "volume", "rm", pod.Name+"-"+volume)
+		cmd := exec.Command("docker", "volume", "rm", podFullName(pod)+"-"+volume)
 		cmd.CombinedOutput()
 	}
 
 	for _, container := range pod.Spec.Containers {
-		err := pm.containerManager.StopContainer(context.TODO(), container)
+		err := pm.containerManager.StopContainer(context.TODO(), container, nil)
 
 		if err != nil {
 			klog.Errorf("Remove Container %s: %s", container.Name, err)
@@ -352,7 +374,7 @@ func (pm *podManager) DeletePod(UID string) error {
 		}
 	}
 
-	delete(pm.podByName, pod.Name)
+	delete(pm.podByName, podFullName(pod))
 	delete(pm.podByUID, pod.UID)
 
 	if len(errs) == 0 {
@@ -367,6 +389,50 @@ func (pm *podManager) DeletePod(UID string) error {
 	return errors.New(allErrs)
 }
 
+func (pm *podManager) TerminatePod(UID string, gracePeriod time.Duration) error {
+	pod, ok := pm.podByUID[UID]
+
+	if !ok {
+		errInfo := fmt.Sprintf("Pod %s UID does not exist", UID)
+		klog.Error(errInfo)
+		return errors.New(errInfo)
+	}
+
+	klog.Infof("Terminate Pod %s in %v", pod.Name, gracePeriod)
+
+	var errs []string
+
+	// 容器并行收到SIGTERM，共享同一个grace period
+	var wg sync.WaitGroup
+	var mtx sync.Mutex
+	for _, container := range pod.Spec.Containers {
+		wg.Add(1)
+		go func(container *v1.Container) {
+			defer wg.Done()
+			err := pm.containerManager.StopContainer(context.TODO(), container, &gracePeriod)
+
+			if err != nil {
+				klog.Errorf("Stop Container %s: %s", container.Name, err)
+				mtx.Lock()
+				errs = append(errs, err.Error())
+				mtx.Unlock()
+			}
+		}(container)
+	}
+	wg.Wait()
+
+	if len(errs) == 0 {
+		return nil
+	}
+
+	var allErrs string
+	for _, e := range errs {
+		allErrs = fmt.Sprintf("%s\n%s", allErrs, e)
+	}
+
+	return errors.New(allErrs)
+}
+
 func (pm *podManager) PodStatus(UID string) (v1.PodStatus, error) {
 	if UID == "" {
 		err := "pod UID is empty"
@@ -425,7 +491,7 @@ func (pm *podManager) PodStatus(UID string) (v1.PodStatus, error) {
 				State: containerState,
 			})
 
-		if cntr.Name == pod.Name+"-"+constants.InitialPauseContainer.Name {
+		if cntr.Name == podFullName(pod)+"-"+constants.InitialPauseContainer.Name {
 			pod.Status.PodIP = stats.NetworkSettings.Networks[constants.WeaveNetworkName].IPAddress
 		}
 	}
@@ -541,10 +607,16 @@ func (pm *podManager) CheckDuplicate(pod *v1.Pod) bool {
 		return true
 	}
 
-	if _, ok := pm.podByName[pod.Name]; ok {
+	if _, ok := pm.podByName[podFullName(pod)]; ok {
 		klog.Errorf("Duplicated pod: name %s, UID %s ", pod.Name, pod.UID)
 		return true
 	}
 
 	return false
 }
+
+// podFullName identifies the pod on the node, as pod names are only unique in a namespace.
+// It also prefixes the names of the containers and volumes of the pod.
+func podFullName(pod *v1.Pod) string {
+	return pod.Name + "_" + v1.NamespaceOf(&pod.ObjectMeta)
+}
@@ -4,9 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
-	"io"
 	"net/http"
-	"strconv"
 	"sync"
 	"time"
 
@@ -14,6 +12,7 @@ import (
 	"minik8s.com/minik8s/config"
 	v1 "minik8s.com/minik8s/pkg/api/v1"
 	"minik8s.com/minik8s/pkg/apiclient"
+	"minik8s.com/minik8s/pkg/controller/component"
 )
 
 type PodRequest struct {
@@ -45,11 +44,29 @@ var shed func(pod v1.Pod) bool
 
 var currNum int
 
+var recorder *component.EventRecorder
+
+// runCtx is the context Run is called with, the handlers stop writing once it is done
+var runCtx context.Context
+
+// workers tracks the goroutines writing to the api server, Run waits for them
+var workers sync.WaitGroup
+
+// goWorker runs f in a goroutine tracked by workers
+func goWorker(f func()) {
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		f()
+	}()
+}
+
 func Init() {
 	podMap = make(map[string]v1.Pod)
 	nodeMap = make(map[string]v1.Node)
 	cancelMap = make(map[string]context.CancelFunc)
 	currNum = 0
+	recorder = component.NewEventRecorder("scheduler", "")
 	switch config.SCHED_STRATEGY {
 	case "SIMPLE":
 		shed = shed_simple
@@ -58,48 +75,73 @@ func Init() {
 	}
 }
 
-func Run() {
-	ctx, cancle := context.WithCancel(context.Background())
+// Run schedules the pods until ctx is done, it returns once the handlers in flight have
+// finished
+func Run(ctx context.Context) {
+	runCtx = ctx
+	ctx, cancle := context.WithCancel(ctx)
 	defer cancle()
 
-	podChan := make(chan []byte)
-	nodeChan := make(chan []byte)
-	//watch pod and node
-	go apiclient.Watch(ctx, podChan, apiclient.OBJ_ALL_PODS)
-	go apiclient.Watch(ctx, nodeChan, apiclient.OBJ_ALL_NODES)
-
 	//add existed nodes
-	nodes_raw := apiclient.Rest("", "", apiclient.OBJ_ALL_NODES, apiclient.OP_GET)
+	nodes_raw, nodesVersion := listUntilOK(ctx, apiclient.OBJ_ALL_NODES)
 	var nodes []NodeRequest
 	err := json.Unmarshal(nodes_raw, &nodes)
 	if err != nil {
-		klog.Error("Unmarshal Pods Failed: %v", err)
+		klog.Errorf("Unmarshal Nodes Failed: %v", err)
 	} else {
 		for _, nodeReq := range nodes {
 			nodeMap[nodeReq.Key] = nodeReq.Node
-			newCtx, cancel := context.WithCancel(context.Background())
-			go deleteNodeAfter30s(newCtx, nodeReq.Key)
-			cancelMap[nodeReq.Key] = cancel
+			watchNode(nodeReq.Key)
 		}
 		klog.Infof("Current node num: %v", len(nodeMap))
 	}
 	//add existed pods
-	pods_raw := apiclient.Rest("", "", apiclient.OBJ_ALL_PODS, apiclient.OP_GET)
+	pods_raw, podsVersion := listUntilOK(ctx, apiclient.OBJ_ALL_PODS)
 	var pods []PodRequest
 	err = json.Unmarshal(pods_raw, &pods)
 	if err != nil {
-		klog.Error("Unmarshal Pods Failed: %v", err)
+		klog.Errorf("Unmarshal Pods Failed: %v", err)
 	} else {
 		for _, podReq := range pods {
 			podMap[podReq.Key] = podReq.Pod
+			if podReq.Pod.DeletionTimestamp != nil {
+				terminatePod(podReq.Pod)
+				continue
+			}
 			shed(podReq.Pod)
 		}
 		klog.Infof("Current pod num: %v", len(podMap))
 	}
 
+	//watch pod and node from the lists, a watch expired is resumed from a new list
+	podChan := make(chan []byte)
+	nodeChan := make(chan []byte)
+	expired := make(chan apiclient.ObjType)
+	watch := func(ch chan []byte, ty apiclient.ObjType, resourceVersion string) {
+		if apiclient.WatchFrom(ctx, ch, ty, resourceVersion) == apiclient.ErrExpired {
+			select {
+			case expired <- ty:
+			case <-ctx.Done():
+			}
+		}
+	}
+	go watch(podChan, apiclient.OBJ_ALL_PODS, podsVersion)
+	go watch(nodeChan, apiclient.OBJ_ALL_NODES, nodesVersion)
+
 	//handle watch results
 	for {
 		select {
+		case <-ctx.Done():
+			klog.Infof("Sched stopped, waiting for the handlers in flight")
+			workers.Wait()
+			return
+		case ty := <-expired:
+			klog.Infof("Sched watch expired, relist")
+			if ty == apiclient.OBJ_ALL_PODS {
+				go watch(podChan, ty, resyncPods(ctx))
+			} else {
+				go watch(nodeChan, ty, resyncNodes(ctx))
+			}
 		case rawBytes := <-podChan:
 			req := &PodRequest{}
 			err := json.Unmarshal(rawBytes, req)
@@ -108,7 +150,7 @@ func Run() {
 
 				klog.Error("Unmarshal Pod Change Req Failed: %v", err)
 			} else {
-				go handlePodChanRequest(req)
+				goWorker(func() { handlePodChanRequest(req) })
 			}
 		case rawBytes := <-nodeChan:
 			req := &NodeRequest{}
@@ -117,19 +159,93 @@ func Run() {
 			if err != nil {
 				klog.Error("Unmarshal Node Change Req Failed: %v", err)
 			} else {
-				go handleNodeChanRequest(req)
+				goWorker(func() { handleNodeChanRequest(req) })
 			}
 		}
 	}
 }
 
+// listUntilOK lists the objects, retrying until it succeeds or ctx is done
+func listUntilOK(ctx context.Context, ty apiclient.ObjType) ([]byte, string) {
+	for {
+		buf, resourceVersion, err := apiclient.List(ty)
+		if err == nil {
+			return buf, resourceVersion
+		}
+		klog.Errorf("Sched list error: %v, relist after three seconds", err)
+		select {
+		case <-time.After(time.Second * 3):
+		case <-ctx.Done():
+			return []byte("[]"), ""
+		}
+	}
+}
+
+// resyncPods lists the pods again after their watch has expired. The pods changed or
+// deleted meanwhile are handled as the events missed, the watch resumes from the
+// resourceVersion returned.
+func resyncPods(ctx context.Context) string {
+	buf, resourceVersion := listUntilOK(ctx, apiclient.OBJ_ALL_PODS)
+	var pods []PodRequest
+	if err := json.Unmarshal(buf, &pods); err != nil {
+		klog.Errorf("Unmarshal Pods Failed: %v", err)
+		return resourceVersion
+	}
+	listed := make(map[string]bool)
+	mtx.Lock()
+	defer mtx.Unlock()
+	for i := range pods {
+		req := &PodRequest{Key: pods[i].Key, Pod: pods[i].Pod, Type: "PUT"}
+		listed[req.Key] = true
+		if old, exist := podMap[req.Key]; !exist || old.ResourceVersion != req.Pod.ResourceVersion {
+			goWorker(func() { handlePodChanRequest(req) })
+		}
+	}
+	for key, pod := range podMap {
+		if !listed[key] {
+			req := &PodRequest{Key: key, Pod: pod, Type: "DELETE"}
+			goWorker(func() { handlePodChanRequest(req) })
+		}
+	}
+	return resourceVersion
+}
+
+// resyncNodes is resyncPods on the nodes
+func resyncNodes(ctx context.Context) string {
+	buf, resourceVersion := listUntilOK(ctx, apiclient.OBJ_ALL_NODES)
+	var nodes []NodeRequest
+	if err := json.Unmarshal(buf, &nodes); err != nil {
+		klog.Errorf("Unmarshal Nodes Failed: %v", err)
+		return resourceVersion
+	}
+	listed := make(map[string]bool)
+	mtx.Lock()
+	defer mtx.Unlock()
+	for i := range nodes {
+		req := &NodeRequest{Key: nodes[i].Key, Node: nodes[i].Node, Type: "PUT"}
+		listed[req.Key] = true
+		if old, exist := nodeMap[req.Key]; !exist || old.ResourceVersion != req.Node.ResourceVersion {
+			goWorker(func() { handleNodeChanRequest(req) })
+		}
+	}
+	for key, node := range nodeMap {
+		if !listed[key] {
+			req := &NodeRequest{Key: key, Node: node, Type: "DELETE"}
+			goWorker(func() { handleNodeChanRequest(req) })
+		}
+	}
+	return resourceVersion
+}
+
 func handlePodChanRequest(req *PodRequest) {
 	switch req.Type {
 	case "PUT":
+		terminating := false
 		mtx.Lock()
-		if _, exist := podMap[req.Key]; exist {
+		if old, exist := podMap[req.Key]; exist {
 			podMap[req.Key] = req.Pod
 			klog.Infof("Pod Changed: Key[%v] Value[...]", req.Key)
+			terminating = req.Pod.DeletionTimestamp != nil && old.DeletionTimestamp == nil
 		} else {
 			podMap[req.Key] = req.Pod
 			klog.Infof("New Pod Added: Key[%v] Value[...]", req.Key)
@@ -140,6 +256,9 @@ func handlePodChanRequest(req *PodRequest) {
 			}
 		}
 		mtx.Unlock()
+		if terminating {
+			terminatePod(req.Pod)
+		}
 
 	case "DELETE":
 		mtx.Lock()
@@ -148,13 +267,15 @@ func handlePodChanRequest(req *PodRequest) {
 		podUID := pod.UID
 		nodeUID := pod.Spec.NodeName
 
-		cli := http.Client{}
-		url := config.AC_ServerAddr + ":" + strconv.Itoa(config.AC_ServerPort)
+		url := apiclient.ServerURL()
 		buf, _ := json.Marshal(req.Pod)
 		http_req, _ := http.NewRequest(http.MethodDelete, url+"/innode/"+nodeUID+"/pod/"+podUID, bytes.NewReader(buf))
-		resp, _ := cli.Do(http_req)
-		resp.Body.Close()
-		klog.Infof("Delete Pod[%v] in Node[%v]", podUID, nodeUID)
+		if resp, err := apiclient.Do(http_req); err != nil {
+			klog.Errorf("Sched error: Cannot Delete Pod[%v] in Node[%v]: %v", podUID, nodeUID, err)
+		} else {
+			resp.Body.Close()
+			klog.Infof("Delete Pod[%v] in Node[%v]", podUID, nodeUID)
+		}
 
 		mtx.Lock()
 		delete(podMap, req.Key)
@@ -177,16 +298,12 @@ func handleNodeChanRequest(req *NodeRequest) {
 			nodeMap[req.Key] = req.Node
 			klog.Infof("Node Changed: Key[%v] Value[...]", req.Key)
 			cancelMap[req.Key]()
-			newCtx, cancel := context.WithCancel(context.Background())
-			go deleteNodeAfter30s(newCtx, req.Key)
-			cancelMap[req.Key] = cancel
+			watchNode(req.Key)
 		} else {
 			nodeMap[req.Key] = req.Node
 			klog.Infof("New Node Register: Key[%v] Value[...]", req.Key)
 			klog.Infof("Current node num: %v", len(nodeMap))
-			newCtx, cancel := context.WithCancel(context.Background())
-			go deleteNodeAfter30s(newCtx, req.Key)
-			cancelMap[req.Key] = cancel
+			watchNode(req.Key)
 			for _, podKey := range pendingPod {
 				shed(podMap[podKey])
 			}
@@ -210,11 +327,13 @@ func shed_simple(pod v1.Pod) bool {
 			if node.Status.Phase == "Unknown" {
 				continue
 			}
-			resp, _ := http.Get(config.AC_ServerAddr + ":" + strconv.Itoa(config.AC_ServerPort) + "/innode/" + node.UID + "/pods")
-
+			// the api server only returns the pods bound to the node
 			var pods []PodRequest
-			buf, _ := io.ReadAll(resp.Body)
-			resp.Body.Close()
+			buf, _, err := apiclient.List(apiclient.OBJ_ALL_PODS, apiclient.ListOptions{FieldSelector: "spec.nodeName=" + node.UID})
+			if err != nil {
+				klog.Errorf("List pods of Node[%v] failed: %v", node.UID, err)
+				continue
+			}
 			_ = json.Unmarshal(buf, &pods)
 			if len(pods) < min || min == -1 {
 				min = len(pods)
@@ -225,27 +344,11 @@ func shed_simple(pod v1.Pod) bool {
 	}
 	if pod.Spec.NodeName == "" {
 		klog.Errorf("Sched error: Cannot Assign Pod[%v]: no suitable node", pod.UID)
+		recorder.Event(v1.ReferenceTo("Pod", &pod.ObjectMeta), v1.EventTypeWarning, "FailedScheduling", "no suitable node")
 		return false
 	}
 
-	cli := http.Client{}
-	url := config.AC_ServerAddr + ":" + strconv.Itoa(config.AC_ServerPort)
-	buf, _ := json.Marshal(pod)
-	req, _ := http.NewRequest(http.MethodPut, url+"/innode/"+pod.Spec.NodeName+"/pod/"+pod.UID, bytes.NewReader(buf))
-	resp2, _ := cli.Do(req)
-
-	if resp2.StatusCode != http.StatusOK {
-		klog.Errorf("Sched error: Cannot Assign Pod[%v] to Node[%v]", pod.UID, pod.Spec.NodeName)
-		return false
-	}
-	resp2.Body.Close()
-
-	buf, _ = json.Marshal(pod)
-	req, _ = http.NewRequest(http.MethodPut, url+"/pod/"+pod.UID, bytes.NewReader(buf))
-	resp3, _ := cli.Do(req)
-	resp3.Body.Close()
-	klog.Infof("Sched ok with pod UID[%v] to Node UID[%v]", pod.UID, pod.Spec.NodeName)
-	return true
+	return bindPod(pod)
 }
 
 func shed_rr(pod v1.Pod) bool {
@@ -266,27 +369,148 @@ func shed_rr(pod v1.Pod) bool {
 	}
 	if pod.Spec.NodeName == "" {
 		klog.Errorf("Sched error: Cannot Assign Pod[%v]: no suitable node", pod.UID)
+		recorder.Event(v1.ReferenceTo("Pod", &pod.ObjectMeta), v1.EventTypeWarning, "FailedScheduling", "no suitable node")
+		return false
+	}
+
+	return bindPod(pod)
+}
+
+// terminatePod marks the copy of the pod in its node for deletion as well. The kubelet
+// stops the containers and then removes its finalizer, which lets the api server remove
+// the pod.
+func terminatePod(pod v1.Pod) {
+	if pod.Spec.NodeName == "" {
+		return
+	}
+	url := apiclient.ServerURL() + "/innode/" + pod.Spec.NodeName + "/pod/" + pod.UID
+	// the copy carries the containers the kubelet has created
+	resp, err := apiclient.HttpGet(url)
+	if err != nil {
+		klog.Errorf("Sched error: Cannot Get Pod[%v] in Node[%v]: %v", pod.UID, pod.Spec.NodeName, err)
+		return
+	}
+	copyReq := &PodRequest{}
+	err = json.NewDecoder(resp.Body).Decode(copyReq)
+	resp.Body.Close()
+	if err != nil || resp.StatusCode != http.StatusOK {
+		klog.Errorf("Sched error: Cannot Get Pod[%v] in Node[%v]", pod.UID, pod.Spec.NodeName)
+		return
+	}
+	copyReq.Pod.DeletionTimestamp = pod.DeletionTimestamp
+	copyReq.Pod.DeletionGracePeriodSeconds = pod.DeletionGracePeriodSeconds
+
+	buf, _ := json.Marshal(copyReq.Pod)
+	req, _ := http.NewRequest(http.MethodPut, url, bytes.NewReader(buf))
+	resp, err = apiclient.Do(req)
+	if err != nil {
+		klog.Errorf("Sched error: Cannot Terminate Pod[%v] in Node[%v]: %v", pod.UID, pod.Spec.NodeName, err)
+		return
+	}
+	resp.Body.Close()
+	klog.Infof("Terminate Pod[%v] in Node[%v]", pod.UID, pod.Spec.NodeName)
+}
+
+// bindPod writes the node the pod is scheduled to into the pod, then hands the pod to the
+// node. The binding is a compare-and-swap on the latest version of the pod, so a pod
+// bound meanwhile, e.g. by another scheduler, is never bound again or moved. The pod
+// holds the finalizer of the kubelet from then on.
+func bindPod(pod v1.Pod) bool {
+	namespace := v1.NamespaceOf(&pod.ObjectMeta)
+	url := apiclient.ServerURL() + "/namespaces/" + namespace + "/pods/" + pod.Name
+	nodeName := pod.Spec.NodeName
+	bound := false
+	for !bound {
+		if runCtx.Err() != nil {
+			// the leadership is lost, the next leader schedules the pod
+			klog.Infof("Sched stopped, leave Pod[%v] unbound", pod.UID)
+			return false
+		}
+		latest := &PodRequest{}
+		err := json.Unmarshal(apiclient.RestIn(namespace, pod.Name, "", apiclient.OBJ_POD, apiclient.OP_GET), latest)
+		if err != nil || latest.Pod.UID != pod.UID || latest.Pod.DeletionTimestamp != nil {
+			klog.Errorf("Sched error: Pod[%v] has been deleted", pod.UID)
+			return false
+		}
+		pod = latest.Pod
+		if pod.Spec.NodeName != "" && pod.Spec.NodeName != nodeName {
+			klog.Errorf("Sched error: Pod[%v] has been bound to Node[%v] meanwhile", pod.UID, pod.Spec.NodeName)
+			return false
+		}
+		// the pods bound hold the finalizer of the kubelet
+		if pod.HasFinalizer(v1.FinalizerKubelet) {
+			klog.Infof("Pod[%v] has been bound to Node[%v] already", pod.UID, pod.Spec.NodeName)
+			break
+		}
+		pod.Spec.NodeName = nodeName
+		pod.AddFinalizer(v1.FinalizerKubelet)
+
+		// the resourceVersion of the latest pod makes the update fail if it is modified
+		buf, _ := json.Marshal(pod)
+		req, _ := http.NewRequest(http.MethodPut, url, bytes.NewReader(buf))
+		resp, err := apiclient.Do(req)
+		if err != nil {
+			klog.Errorf("Sched error: Cannot Update Pod[%v]: %v", pod.UID, err)
+			return false
+		}
+		resp.Body.Close()
+		switch resp.StatusCode {
+		case http.StatusOK:
+			bound = true
+		case http.StatusConflict:
+			klog.Infof("Pod[%v] has been modified, retry with the latest version", pod.UID)
+		default:
+			klog.Errorf("Sched error: Cannot Update Pod[%v]: %v", pod.UID, resp.Status)
+			return false
+		}
+	}
+
+	if !handToNode(pod) {
+		recorder.Eventf(v1.ReferenceTo("Pod", &pod.ObjectMeta), v1.EventTypeWarning, "FailedScheduling",
+			"cannot assign to node %s", pod.Spec.NodeName)
 		return false
 	}
+	if bound {
+		klog.Infof("Sched ok with pod UID[%v] to Node UID[%v]", pod.UID, pod.Spec.NodeName)
+		recorder.Eventf(v1.ReferenceTo("Pod", &pod.ObjectMeta), v1.EventTypeNormal, "Scheduled",
+			"Successfully assigned %s/%s to %s", namespace, pod.Name, pod.Spec.NodeName)
+	}
+	return true
+}
 
-	cli := http.Client{}
-	url := config.AC_ServerAddr + ":" + strconv.Itoa(config.AC_ServerPort)
+// handToNode puts the bound pod to its node unless the node has it already, e.g. when
+// the scheduler stopped between the binding and the hand-over
+func handToNode(pod v1.Pod) bool {
+	url := apiclient.ServerURL() + "/innode/" + pod.Spec.NodeName + "/pod/" + pod.UID
+	resp, err := apiclient.HttpGet(url)
+	if err == nil {
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusOK {
+			return true
+		}
+	}
 	buf, _ := json.Marshal(pod)
-	req, _ := http.NewRequest(http.MethodPut, url+"/innode/"+pod.Spec.NodeName+"/pod/"+pod.UID, bytes.NewReader(buf))
-	resp2, _ := cli.Do(req)
-	if resp2.StatusCode != http.StatusOK {
-		klog.Errorf("Sched error: Cannot Assign Pod[%v] to Node[%v]", pod.UID, pod.Spec.NodeName)
+	req, _ := http.NewRequest(http.MethodPut, url, bytes.NewReader(buf))
+	resp, err = apiclient.Do(req)
+	if err != nil {
+		klog.Errorf("Sched error: Cannot Assign Pod[%v] to Node[%v]: %v", pod.UID, pod.Spec.NodeName, err)
+		return false
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		klog.Errorf("Sched error: Cannot Assign Pod[%v] to Node[%v]: %v", pod.UID, pod.Spec.NodeName, resp.Status)
 		return false
 	}
-	resp2.Body.Close()
-	buf, _ = json.Marshal(pod)
-	req, _ = http.NewRequest(http.MethodPut, url+"/pod/"+pod.UID, bytes.NewReader(buf))
-	resp3, _ := cli.Do(req)
-	klog.Infof("Sched ok with pod UID[%v] to Node UID[%v]", pod.UID, pod.Spec.NodeName)
-	resp3.Body.Close()
 	return true
 }
 
+// watchNode marks the node Unknown unless it is updated within 30s, the caller holds mtx
+func watchNode(key string) {
+	ctx, cancel := context.WithCancel(runCtx)
+	goWorker(func() { deleteNodeAfter30s(ctx, key) })
+	cancelMap[key] = cancel
+}
+
 func deleteNodeAfter30s(ctx context.Context, key string) {
 	select {
 	case <-ctx.Done():
@@ -298,8 +522,9 @@ func deleteNodeAfter30s(ctx context.Context, key string) {
 		node := nodeMap[key]
 		node.Status.Phase = "Unknown"
 		nodeMap[key] = node
-		buf, _ := json.Marshal(node)
-		apiclient.Rest(node.UID, string(buf), apiclient.OBJ_NODE, apiclient.OP_PUT)
+		if err := apiclient.UpdateNodeStatus(&node); err != nil {
+			klog.Errorf("update status of Node[%v] failed: %v", key, err)
+		}
 		mtx.Unlock()
 	}
 }